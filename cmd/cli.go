@@ -0,0 +1,606 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/application"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/config"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/database"
+	sqlRepo "github.com/danilkompaniets/auth-service/internal/infrastructure/repository/sqlRepo"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/go-yaml/yaml"
+)
+
+const usage = `usage: auth-service [command]
+
+Commands:
+  serve                                    start the HTTP and gRPC servers (default)
+  migrate up|down|status                   apply, roll back the latest or list migrations
+  user create -email E [-password P] [-roles r1,r2] [-verified]
+  user disable|enable|delete -id N | -email E
+  user set-password -id N | -email E [-password P]
+  token issue -id N | -email E             print an access token for the user
+  token inspect TOKEN                      verify a token and print its claims
+  token revoke TOKEN | -user-id N          revoke one access token or every token of a user
+  client create -name N -redirect-uris u1,u2 [-scopes s1,s2] [-confidential]
+  client create -name N -service [-scopes s1,s2]
+  client list                              list registered OAuth clients
+  client delete -id ID                     remove a client and end its sessions
+  keys generate -alg A -out FILE           write new signing key material
+  keys rotate -dir DIR [-kid K]            add a new active key and print the signingKeys config
+  config validate                          load the config and build every component from it
+
+Passwords are read from stdin when -password is not given.
+The config is read from CONFIG_PATH, like the server does.`
+
+// runCommand dispatches the operator subcommands. They share the server's config
+// and wiring, so they behave exactly like the running service.
+func runCommand(ctx context.Context, args []string) error {
+	switch args[0] {
+	case "migrate":
+		return runMigrate(ctx, args[1:])
+	case "user":
+		return runUser(ctx, args[1:])
+	case "token":
+		return runToken(ctx, args[1:])
+	case "client":
+		return runClient(ctx, args[1:])
+	case "keys":
+		return runKeys(args[1:])
+	case "config":
+		return runConfig(ctx, args[1:])
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+		return nil
+	default:
+		return fmt.Errorf("unknown command %q\n\n%s", args[0], usage)
+	}
+}
+
+func subcommand(args []string, group string) (string, []string, error) {
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("%s needs a subcommand\n\n%s", group, usage)
+	}
+	return args[0], args[1:], nil
+}
+
+func runMigrate(ctx context.Context, args []string) error {
+	sub, _, err := subcommand(args, "migrate")
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	switch sub {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+		for _, m := range applied {
+			fmt.Printf("applied %03d %s\n", m.Version, m.Name)
+		}
+		return nil
+	case "down":
+		reverted, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("rolled back %03d %s\n", reverted.Version, reverted.Name)
+		return nil
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%03d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q", sub)
+	}
+}
+
+// withService opens the database and builds the AuthService for one command.
+func withService(ctx context.Context, fn func(svc *application.AuthService, repo *sqlRepo.Repository) error) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	db, err := openDatabase(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	repo, err := newRepository(cfg, db)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	svc, _, err := newAuthService(ctx, cfg, repo)
+	if err != nil {
+		return err
+	}
+
+	return fn(svc, repo)
+}
+
+// userFlags registers the -id and -email flags that select the target account.
+type userFlags struct {
+	id    *int64
+	email *string
+}
+
+func newUserFlags(fs *flag.FlagSet) userFlags {
+	return userFlags{
+		id:    fs.Int64("id", 0, "user id"),
+		email: fs.String("email", "", "user email"),
+	}
+}
+
+func (f userFlags) resolve(ctx context.Context, repo *sqlRepo.Repository) (*model.User, error) {
+	switch {
+	case *f.id != 0 && *f.email != "":
+		return nil, errors.New("use either -id or -email")
+	case *f.id != 0:
+		return repo.GetUserByID(ctx, *f.id)
+	case *f.email != "":
+		return repo.GetUserByEmail(ctx, *f.email)
+	default:
+		return nil, errors.New("-id or -email is required")
+	}
+}
+
+func runUser(ctx context.Context, args []string) error {
+	sub, args, err := subcommand(args, "user")
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("user "+sub, flag.ContinueOnError)
+	switch sub {
+	case "create":
+		email := fs.String("email", "", "email of the new user")
+		password := fs.String("password", "", "password, read from stdin when empty")
+		roles := fs.String("roles", "", "comma separated roles to assign")
+		verified := fs.Bool("verified", false, "mark the email as verified")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if *email == "" {
+			return errors.New("-email is required")
+		}
+		pw, err := passwordArg(*password)
+		if err != nil {
+			return err
+		}
+
+		return withService(ctx, func(svc *application.AuthService, _ *sqlRepo.Repository) error {
+			now := time.Now().UTC()
+			user := model.User{Email: *email, Password: pw, CreatedAt: now, UpdatedAt: now}
+			if *verified {
+				// Без письма со ссылкой подтверждения
+				user.EmailVerifiedAt = &now
+			}
+			id, err := svc.CreateUser(ctx, user)
+			if err != nil {
+				return err
+			}
+			for _, role := range strings.Split(*roles, ",") {
+				if role = strings.TrimSpace(role); role == "" {
+					continue
+				}
+				if err := svc.AssignRole(ctx, id, role); err != nil {
+					return fmt.Errorf("user %d created, but assigning role %q failed: %w", id, role, err)
+				}
+			}
+			fmt.Printf("created user %d\n", id)
+			return nil
+		})
+	case "disable", "enable", "delete":
+		target := newUserFlags(fs)
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		return withService(ctx, func(svc *application.AuthService, repo *sqlRepo.Repository) error {
+			user, err := target.resolve(ctx, repo)
+			if err != nil {
+				return err
+			}
+			switch sub {
+			case "disable":
+				err = svc.DisableUser(ctx, user.Id)
+			case "enable":
+				err = svc.EnableUser(ctx, user.Id)
+			default:
+				err = svc.DeleteUser(ctx, user.Id)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%sd user %d (%s)\n", sub, user.Id, user.Email)
+			return nil
+		})
+	case "set-password":
+		target := newUserFlags(fs)
+		password := fs.String("password", "", "new password, read from stdin when empty")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		pw, err := passwordArg(*password)
+		if err != nil {
+			return err
+		}
+
+		return withService(ctx, func(svc *application.AuthService, repo *sqlRepo.Repository) error {
+			user, err := target.resolve(ctx, repo)
+			if err != nil {
+				return err
+			}
+			if err := svc.SetPassword(ctx, user.Id, pw); err != nil {
+				return err
+			}
+			fmt.Printf("password of user %d changed, all sessions ended\n", user.Id)
+			return nil
+		})
+	default:
+		return fmt.Errorf("unknown user command %q", sub)
+	}
+}
+
+// passwordArg keeps passwords out of shell history and the process list unless the
+// operator passes one explicitly.
+func passwordArg(password string) (string, error) {
+	if password != "" {
+		return password, nil
+	}
+
+	fmt.Fprint(os.Stderr, "password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return "", errors.New("password must not be empty")
+	}
+	return line, nil
+}
+
+func runToken(ctx context.Context, args []string) error {
+	sub, args, err := subcommand(args, "token")
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("token "+sub, flag.ContinueOnError)
+	switch sub {
+	case "issue":
+		target := newUserFlags(fs)
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		return withService(ctx, func(svc *application.AuthService, repo *sqlRepo.Repository) error {
+			user, err := target.resolve(ctx, repo)
+			if err != nil {
+				return err
+			}
+			token, err := svc.IssueAccessToken(ctx, user.Id)
+			if err != nil {
+				return err
+			}
+			fmt.Println(token)
+			return nil
+		})
+	case "inspect":
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return errors.New("usage: token inspect TOKEN")
+		}
+
+		return withService(ctx, func(svc *application.AuthService, _ *sqlRepo.Repository) error {
+			claims, err := svc.AuthenticateAccessToken(ctx, fs.Arg(0))
+			if err != nil {
+				return err
+			}
+			out, err := json.MarshalIndent(claims, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(out))
+			return nil
+		})
+	case "revoke":
+		userID := fs.Int64("user-id", 0, "revoke every token of this user instead of a single one")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if (*userID == 0) == (fs.NArg() != 1) {
+			return errors.New("usage: token revoke TOKEN | -user-id N")
+		}
+
+		return withService(ctx, func(svc *application.AuthService, _ *sqlRepo.Repository) error {
+			if *userID != 0 {
+				if err := svc.RevokeUserTokens(ctx, *userID, time.Time{}); err != nil {
+					return err
+				}
+				fmt.Printf("revoked all tokens of user %d\n", *userID)
+				return nil
+			}
+			if err := svc.RevokeAccessToken(ctx, fs.Arg(0)); err != nil {
+				return err
+			}
+			fmt.Println("token revoked")
+			return nil
+		})
+	default:
+		return fmt.Errorf("unknown token command %q", sub)
+	}
+}
+
+func runClient(ctx context.Context, args []string) error {
+	sub, args, err := subcommand(args, "client")
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("client "+sub, flag.ContinueOnError)
+	switch sub {
+	case "create":
+		name := fs.String("name", "", "name shown on the consent page")
+		redirectURIs := fs.String("redirect-uris", "", "comma separated redirect URIs")
+		scopes := fs.String("scopes", "", "comma separated scopes the client may request")
+		confidential := fs.Bool("confidential", false, "issue a client secret for a server-side client")
+		service := fs.Bool("service", false, "register a service that authenticates as itself with client_credentials")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		return withService(ctx, func(svc *application.AuthService, _ *sqlRepo.Repository) error {
+			var (
+				client *model.OAuthClient
+				secret string
+				err    error
+			)
+			if *service {
+				client, secret, err = svc.RegisterServiceClient(ctx, *name, splitList(*scopes))
+			} else {
+				client, secret, err = svc.RegisterOAuthClient(ctx, *name, splitList(*redirectURIs), splitList(*scopes), *confidential)
+			}
+			if err != nil {
+				return err
+			}
+			fmt.Printf("client_id: %s\n", client.Id)
+			if secret != "" {
+				fmt.Printf("client_secret: %s\n", secret)
+			}
+			return nil
+		})
+	case "list":
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		return withService(ctx, func(svc *application.AuthService, _ *sqlRepo.Repository) error {
+			clients, err := svc.ListOAuthClients(ctx)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tNAME\tTYPE\tGRANT TYPES\tREDIRECT URIS\tSCOPES")
+			for _, c := range clients {
+				kind := "public"
+				if c.SecretHash != "" {
+					kind = "confidential"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", c.Id, c.Name, kind, strings.Join(c.GrantTypes, ","),
+					strings.Join(c.RedirectURIs, ","), strings.Join(c.Scopes, ","))
+			}
+			return w.Flush()
+		})
+	case "delete":
+		id := fs.String("id", "", "client id")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if *id == "" {
+			return errors.New("-id is required")
+		}
+
+		return withService(ctx, func(svc *application.AuthService, _ *sqlRepo.Repository) error {
+			if err := svc.DeleteOAuthClient(ctx, *id); err != nil {
+				return err
+			}
+			fmt.Printf("deleted client %s\n", *id)
+			return nil
+		})
+	default:
+		return fmt.Errorf("unknown client command %q", sub)
+	}
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// signingKeyEntry mirrors one item of the signingKeys config list.
+type signingKeyEntry struct {
+	Kid       string `yaml:"kid"`
+	Path      string `yaml:"path"`
+	Active    bool   `yaml:"active,omitempty"`
+	RetiredAt string `yaml:"retiredAt,omitempty"`
+}
+
+func runKeys(args []string) error {
+	sub, args, err := subcommand(args, "keys")
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("keys "+sub, flag.ContinueOnError)
+	switch sub {
+	case "generate":
+		alg := fs.String("alg", security.AlgorithmHS256, "HS256, RS256, ES256 or EdDSA")
+		out := fs.String("out", "", "file to write the key to")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if *out == "" {
+			return errors.New("-out is required")
+		}
+
+		if err := writeSigningKey(*out, *alg); err != nil {
+			return err
+		}
+		fmt.Printf("wrote %s key to %s\n", *alg, *out)
+		return nil
+	case "rotate":
+		dir := fs.String("dir", "", "directory for the new key file")
+		kid := fs.String("kid", "", "kid of the new key, defaults to the current time")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if *dir == "" {
+			return errors.New("-dir is required")
+		}
+
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+		alg := cfg.App.Env.SigningAlgorithm
+		if alg == "" {
+			alg = security.AlgorithmHS256
+		}
+
+		now := time.Now().UTC()
+		if *kid == "" {
+			*kid = now.Format("20060102-150405")
+		}
+		path := filepath.Join(*dir, *kid+".key")
+		if err := writeSigningKey(path, alg); err != nil {
+			return err
+		}
+
+		// The previously active key keeps verifying for the grace period from now on.
+		keys := []signingKeyEntry{{Kid: *kid, Path: path, Active: true}}
+		for _, k := range cfg.App.Env.SigningKeys {
+			entry := signingKeyEntry{Kid: k.Kid, Path: k.Path, RetiredAt: k.RetiredAt}
+			if k.Active {
+				entry.RetiredAt = now.Format(time.RFC3339)
+			}
+			keys = append(keys, entry)
+		}
+		out, err := yaml.Marshal(map[string][]signingKeyEntry{"signingKeys": keys})
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "wrote %s key %s to %s\n", alg, *kid, path)
+		fmt.Fprintln(os.Stderr, "replace signingKeys in the config with the list below and send SIGHUP to every instance:")
+		fmt.Print(string(out))
+		return nil
+	default:
+		return fmt.Errorf("unknown keys command %q", sub)
+	}
+}
+
+// writeSigningKey refuses to overwrite an existing file so a key in use is never lost.
+func writeSigningKey(path, alg string) error {
+	key, err := security.GenerateSigningKey(alg)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(key); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func runConfig(ctx context.Context, args []string) error {
+	sub, _, err := subcommand(args, "config")
+	if err != nil {
+		return err
+	}
+	if sub != "validate" {
+		return fmt.Errorf("unknown config command %q", sub)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	// Nothing below touches the database until a request arrives, so the service can
+	// be built without one.
+	repo, err := newRepository(cfg, nil)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if _, _, err := newAuthService(ctx, cfg, repo); err != nil {
+		return err
+	}
+	if _, err := newRateLimiter(ctx, cfg); err != nil {
+		return fmt.Errorf("failed to set up rate limiting: %w", err)
+	}
+
+	fmt.Println("config is valid")
+	return nil
+}
@@ -8,14 +8,26 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/danilkompaniets/auth-service/internal/application"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/breached"
 	"github.com/danilkompaniets/auth-service/internal/infrastructure/config"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/database"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/federation"
 	"github.com/danilkompaniets/auth-service/internal/infrastructure/grpc"
 	"github.com/danilkompaniets/auth-service/internal/infrastructure/http"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/lockout"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/mail"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/ratelimit"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
 	sqlRepo "github.com/danilkompaniets/auth-service/internal/infrastructure/repository/sqlRepo"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/revocation"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
 	grpc2 "github.com/danilkompaniets/auth-service/internal/interfaces/grpc"
-	"github.com/danilkompaniets/go-chat-common/tokens"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"golang.org/x/crypto/bcrypt"
 	"log"
 	"os"
 	"os/signal"
@@ -26,51 +38,69 @@ import (
 )
 
 func main() {
-	cfg := config.MustLoad()
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] != "serve" {
+		if err := runCommand(context.Background(), args); err != nil && !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	dbCfg := cfg.App.Database
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbCfg.Host,
-		dbCfg.Port,
-		dbCfg.Username,
-		dbCfg.Password,
-		dbCfg.Database,
-	)
+	serve()
+}
 
-	db, err := sql.Open("postgres", dsn)
+// serve runs the HTTP and gRPC servers until SIGINT or SIGTERM.
+func serve() {
+	cfg := config.MustLoad()
+
+	db, err := openDatabase(cfg)
 	if err != nil {
-		log.Fatalf("failed to connect to database: %v", err)
+		log.Fatal(err)
 	}
 	defer db.Close()
 
-	if err := db.Ping(); err != nil {
-		log.Fatalf("database ping failed: %v", err)
+	if cfg.App.Database.AutoMigrate {
+		migrator, err := database.NewMigrator(db)
+		if err != nil {
+			log.Fatalf("failed to load migrations: %v", err)
+		}
+		if _, err := migrator.Up(context.Background()); err != nil {
+			log.Fatalf("failed to apply migrations: %v", err)
+		}
 	}
 
-	accessTokenTTL, err := time.ParseDuration(cfg.App.Env.AccessTokenTTL)
+	// Сервисы и репо
+	repo, err := newRepository(cfg, db)
 	if err != nil {
-		log.Fatalf("invalid access token TTL: %v", err)
+		log.Fatal(err)
 	}
 
-	refreshTokenTTL, err := time.ParseDuration(cfg.App.Env.RefreshTokenTTL)
-	if err != nil {
-		log.Fatalf("invalid refresh token TTL: %v", err)
+	if n, err := repo.HashLegacyRefreshTokens(context.Background()); err != nil {
+		log.Fatalf("failed to hash legacy refresh tokens: %v", err)
+	} else if n > 0 {
+		log.Printf("Hashed %d legacy refresh tokens", n)
 	}
 
-	jwtManager := tokens.NewJWTManager(
-		cfg.App.Env.AccessTokenSecret,
-		cfg.App.Env.RefreshTokenSecret,
-		accessTokenTTL,
-		refreshTokenTTL,
-	)
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
 
-	// Сервисы и репо
-	repo := sqlRepo.NewAuthRepository(db)
-	svc := application.NewAuthService(repo, jwtManager)
+	svc, jwtManager, err := newAuthService(bgCtx, cfg, repo)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	limiter, err := newRateLimiter(bgCtx, cfg)
+	if err != nil {
+		log.Fatalf("failed to set up rate limiting: %v", err)
+	}
 
 	grpcHandler := grpc2.NewAuthGRPCHandler(svc)
-	grpcApp := grpc.NewGRPCApp(grpcHandler, *cfg)
-	httpApp := http.NewHttpApplication(svc)
+	grpcApp := grpc.NewGRPCApp(grpcHandler, *cfg, limiter)
+	httpApp, err := http.NewHttpApplication(svc, limiter, cfg.App.TrustedProxies)
+	if err != nil {
+		log.Fatalf("failed to set up http server: %v", err)
+	}
 
 	errs := make(chan error, 2)
 
@@ -90,6 +120,10 @@ func main() {
 		}
 	}()
 
+	if len(cfg.App.Env.SigningKeys) > 0 {
+		go reloadSigningKeysOnSIGHUP(jwtManager.KeyRing())
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
@@ -109,6 +143,611 @@ func main() {
 	if err := httpApp.Shutdown(ctx); err != nil {
 		log.Printf("Error when stopping HTTP server: %v", err)
 	}
+	// Письма, которые запросы отправляют в фоне
+	svc.Wait()
 
 	log.Println("Servers stopped gracefully")
 }
+
+func openDatabase(cfg *config.Config) (*sql.DB, error) {
+	dbCfg := cfg.App.Database
+	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		dbCfg.Host,
+		dbCfg.Port,
+		dbCfg.Username,
+		dbCfg.Password,
+		dbCfg.Database,
+	)
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("database ping failed: %w", err)
+	}
+
+	return db, nil
+}
+
+func newRepository(cfg *config.Config, db *sql.DB) (*sqlRepo.Repository, error) {
+	pepper := cfg.App.Env.RefreshTokenPepper
+	if pepper == "" && cfg.App.Env.RefreshTokenSecret != "" {
+		// Kept for deployments from before the pepper existed, whose stored hashes were
+		// made with the signing secret. Rotating that secret then logs everyone out.
+		log.Println("REFRESH_TOKEN_PEPPER is not set, hashing refresh tokens with REFRESH_TOKEN_SECRET; set a separate pepper")
+		pepper = cfg.App.Env.RefreshTokenSecret
+	}
+	if pepper == "" {
+		return nil, errors.New("REFRESH_TOKEN_PEPPER must be set")
+	}
+
+	return sqlRepo.NewAuthRepository(db, security.NewTokenHasher(pepper)), nil
+}
+
+// newAuthService wires the service the way the config describes. Background cleanup
+// of its stores runs until ctx is done.
+func newAuthService(ctx context.Context, cfg *config.Config, repo *sqlRepo.Repository) (*application.AuthService, *security.JWTManager, error) {
+	accessTokenTTL, err := time.ParseDuration(cfg.App.Env.AccessTokenTTL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid access token TTL: %w", err)
+	}
+
+	refreshTokenTTL, err := time.ParseDuration(cfg.App.Env.RefreshTokenTTL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid refresh token TTL: %w", err)
+	}
+
+	go collectRefreshTokens(ctx, repo, refreshTokenTTL, time.Hour)
+
+	jwtManager, err := newJWTManager(cfg, accessTokenTTL, refreshTokenTTL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to set up token signing: %w", err)
+	}
+
+	var clockSkew time.Duration
+	if cfg.App.Env.ClockSkew != "" {
+		if clockSkew, err = time.ParseDuration(cfg.App.Env.ClockSkew); err != nil {
+			return nil, nil, fmt.Errorf("invalid clock skew: %w", err)
+		}
+	}
+	jwtManager.WithClaimsPolicy(security.ClaimsPolicy{
+		Issuer:           cfg.App.Env.Issuer,
+		Audience:         cfg.App.Env.Audience,
+		TrustedIssuers:   cfg.App.Env.TrustedIssuers,
+		AllowedAudiences: cfg.App.Env.AllowedAudiences,
+		Leeway:           clockSkew,
+	})
+
+	revocationCacheTTL := 30 * time.Second
+	if cfg.App.Env.RevocationCacheTTL != "" {
+		if revocationCacheTTL, err = time.ParseDuration(cfg.App.Env.RevocationCacheTTL); err != nil {
+			return nil, nil, fmt.Errorf("invalid revocation cache TTL: %w", err)
+		}
+	}
+	revocations := revocation.NewStore(repo, revocationCacheTTL, accessTokenTTL)
+	go revocations.Run(ctx, time.Hour)
+
+	mailer, err := newMailer(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to set up mailer: %w", err)
+	}
+	verificationTTL := 24 * time.Hour
+	if cfg.App.Email.VerificationTokenTTL != "" {
+		if verificationTTL, err = time.ParseDuration(cfg.App.Email.VerificationTokenTTL); err != nil {
+			return nil, nil, fmt.Errorf("invalid verification token TTL: %w", err)
+		}
+	}
+
+	passwordResetTTL := 30 * time.Minute
+	if cfg.App.Email.PasswordResetTokenTTL != "" {
+		if passwordResetTTL, err = time.ParseDuration(cfg.App.Email.PasswordResetTokenTTL); err != nil {
+			return nil, nil, fmt.Errorf("invalid password reset token TTL: %w", err)
+		}
+	}
+
+	mfa, err := newMFAConfig(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to set up mfa: %w", err)
+	}
+
+	passwords, err := newPasswordHasher(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to set up password hashing: %w", err)
+	}
+
+	passwordPolicy, err := newPasswordPolicy(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to set up password policy: %w", err)
+	}
+
+	svcOpts := []application.Option{
+		application.WithPasswordHasher(passwords),
+		application.WithPasswordPolicy(passwordPolicy),
+		application.WithRevocationStore(revocations),
+		application.WithEmailVerification(mailer, application.EmailVerification{
+			Required: cfg.App.Email.RequireVerified,
+			TokenTTL: verificationTTL,
+			LinkURL:  cfg.App.Email.VerificationURL,
+		}),
+		application.WithPasswordReset(mailer, application.PasswordReset{
+			TokenTTL: passwordResetTTL,
+			LinkURL:  cfg.App.Email.PasswordResetURL,
+		}),
+		application.WithEmailChange(mailer, application.EmailChange{
+			TokenTTL: verificationTTL,
+			LinkURL:  cfg.App.Email.EmailChangeURL,
+		}),
+		application.WithMFA(mfa),
+	}
+	if cfg.App.Email.Login.Enabled {
+		emailLogin, err := newEmailLoginConfig(cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to set up email login: %w", err)
+		}
+		svcOpts = append(svcOpts, application.WithEmailLogin(mailer, emailLogin))
+	}
+	if cfg.App.WebAuthn.RPID != "" {
+		webAuthn, err := newWebAuthnConfig(cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to set up passkeys: %w", err)
+		}
+		svcOpts = append(svcOpts, application.WithWebAuthn(webAuthn))
+	} else {
+		log.Println("webauthn rpID is not set, passkeys are disabled")
+	}
+	if cfg.App.OAuth.Enabled {
+		oauth, err := newOAuthConfig(cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to set up oauth: %w", err)
+		}
+		svcOpts = append(svcOpts, application.WithOAuth(oauth))
+
+		switch alg := jwtManager.KeyRing().Active().Method.Alg(); {
+		case cfg.App.Env.Issuer == "":
+			log.Println("issuer is not set, OpenID Connect is disabled")
+		case alg == security.AlgorithmHS256:
+			log.Println("relying parties cannot verify HS256 ID tokens, OpenID Connect is disabled")
+		default:
+			svcOpts = append(svcOpts, application.WithOIDC(application.OIDC{Issuer: cfg.App.Env.Issuer, SigningAlgorithm: alg}))
+		}
+	}
+
+	if len(cfg.App.Federation.Providers) > 0 {
+		federationCfg, err := newFederationConfig(cfg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to set up federated login: %w", err)
+		}
+		svcOpts = append(svcOpts, application.WithFederation(federationCfg))
+	}
+
+	tracker, err := newLoginAttemptTracker(cfg, repo)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to set up login throttling: %w", err)
+	}
+	go tracker.Run(ctx, 10*time.Minute)
+	svcOpts = append(svcOpts, application.WithLoginThrottling(tracker))
+
+	return application.NewAuthService(repo, jwtManager, svcOpts...), jwtManager, nil
+}
+
+// collectRefreshTokens deletes rotated and revoked refresh tokens every interval once
+// they are older than refreshTTL, until ctx is done.
+func collectRefreshTokens(ctx context.Context, repo *sqlRepo.Repository, refreshTTL, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := repo.DeleteStaleRefreshTokens(ctx, time.Now().Add(-refreshTTL)); err != nil {
+				log.Printf("refresh token cleanup failed: %v", err)
+			} else if n > 0 {
+				log.Printf("refresh token cleanup removed %d entries", n)
+			}
+		}
+	}
+}
+
+func newJWTManager(cfg *config.Config, accessTTL, refreshTTL time.Duration) (*security.JWTManager, error) {
+	env := cfg.App.Env
+
+	if len(env.SigningKeys) > 0 {
+		gracePeriod := refreshTTL
+		if env.SigningKeyGracePeriod != "" {
+			var err error
+			if gracePeriod, err = time.ParseDuration(env.SigningKeyGracePeriod); err != nil {
+				return nil, fmt.Errorf("invalid signing key grace period: %w", err)
+			}
+		}
+
+		active, retired, err := loadSigningKeys(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		ring := security.NewKeyRing(active, gracePeriod)
+		ring.Load(active, retired)
+		return security.NewJWTManagerWithKeyRing(ring, accessTTL, refreshTTL), nil
+	}
+
+	switch env.SigningAlgorithm {
+	case "", security.AlgorithmHS256:
+		return security.NewJWTManager(env.AccessTokenSecret, env.RefreshTokenSecret, accessTTL, refreshTTL), nil
+	default:
+		key, err := security.LoadPrivateKey("", env.SigningKeyPath, env.SigningAlgorithm)
+		if err != nil {
+			return nil, err
+		}
+		return security.NewJWTManagerWithKey(key, accessTTL, refreshTTL), nil
+	}
+}
+
+func newMailer(cfg *config.Config) (mail.Mailer, error) {
+	email := cfg.App.Email
+
+	switch email.Mailer {
+	case "smtp":
+		return mail.NewSMTPMailer(mail.SMTPConfig{
+			Host:     email.SMTP.Host,
+			Port:     email.SMTP.Port,
+			Username: email.SMTP.Username,
+			Password: email.SMTP.Password,
+			From:     email.SMTP.From,
+		}), nil
+	case "", "log":
+		if email.LogPath == "" {
+			return mail.NewLogMailer(os.Stdout), nil
+		}
+		return mail.NewFileMailer(email.LogPath)
+	default:
+		return nil, fmt.Errorf("unknown mailer %q", email.Mailer)
+	}
+}
+
+func newPasswordHasher(cfg *config.Config) (security.PasswordHasher, error) {
+	pw := cfg.App.Passwords
+
+	switch pw.Algorithm {
+	case "", security.AlgorithmArgon2id:
+		params := security.DefaultArgon2Params
+		if pw.Argon2id.Memory > 0 {
+			params.Memory = pw.Argon2id.Memory
+		}
+		if pw.Argon2id.Iterations > 0 {
+			params.Iterations = pw.Argon2id.Iterations
+		}
+		if pw.Argon2id.Parallelism > 0 {
+			params.Parallelism = pw.Argon2id.Parallelism
+		}
+		if pw.Argon2id.SaltLength > 0 {
+			params.SaltLength = pw.Argon2id.SaltLength
+		}
+		if pw.Argon2id.KeyLength > 0 {
+			params.KeyLength = pw.Argon2id.KeyLength
+		}
+		return security.NewArgon2idHasher(params, pw.Pepper), nil
+	case security.AlgorithmBcrypt:
+		cost := bcrypt.DefaultCost
+		if pw.BcryptCost > 0 {
+			cost = pw.BcryptCost
+		}
+		if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return security.NewBcryptHasher(cost, pw.Pepper), nil
+	default:
+		return nil, fmt.Errorf("unknown password hashing algorithm %q", pw.Algorithm)
+	}
+}
+
+func newPasswordPolicy(cfg *config.Config) (application.PasswordPolicy, error) {
+	p := cfg.App.Passwords.Policy
+	policy := application.PasswordPolicy{
+		MinLength:     p.MinLength,
+		MaxLength:     p.MaxLength,
+		RequireUpper:  p.RequireUpper,
+		RequireLower:  p.RequireLower,
+		RequireDigit:  p.RequireDigit,
+		RequireSymbol: p.RequireSymbol,
+		DisallowEmail: p.DisallowEmail,
+		History:       p.History,
+	}
+
+	if p.BreachedCorpusDir == "" {
+		log.Println("breached password corpus is not set, breached password check is disabled")
+		return policy, nil
+	}
+	corpus, err := breached.NewPrefixStore(p.BreachedCorpusDir)
+	if err != nil {
+		return policy, err
+	}
+	policy.Breached = corpus
+
+	return policy, nil
+}
+
+func newMFAConfig(cfg *config.Config) (application.MFA, error) {
+	mfaCfg := application.MFA{Issuer: cfg.App.MFA.Issuer, ChallengeTTL: 5 * time.Minute}
+
+	if cfg.App.MFA.ChallengeTTL != "" {
+		ttl, err := time.ParseDuration(cfg.App.MFA.ChallengeTTL)
+		if err != nil {
+			return mfaCfg, fmt.Errorf("invalid mfa challenge TTL: %w", err)
+		}
+		mfaCfg.ChallengeTTL = ttl
+	}
+
+	if cfg.App.MFA.EncryptionKey == "" {
+		log.Println("MFA_ENCRYPTION_KEY is not set, TOTP enrolment is disabled")
+		return mfaCfg, nil
+	}
+	box, err := security.NewSecretBox(cfg.App.MFA.EncryptionKey)
+	if err != nil {
+		return mfaCfg, err
+	}
+	mfaCfg.Secrets = box
+
+	return mfaCfg, nil
+}
+
+func newEmailLoginConfig(cfg *config.Config) (application.EmailLogin, error) {
+	login := cfg.App.Email.Login
+	loginCfg := application.EmailLogin{
+		TokenTTL:      10 * time.Minute,
+		LinkURL:       login.URL,
+		MaxRequests:   5,
+		RequestWindow: 15 * time.Minute,
+		MaxAttempts:   5,
+	}
+
+	if login.TokenTTL != "" {
+		ttl, err := time.ParseDuration(login.TokenTTL)
+		if err != nil {
+			return loginCfg, fmt.Errorf("invalid email login token TTL: %w", err)
+		}
+		loginCfg.TokenTTL = ttl
+	}
+	if login.RequestWindow != "" {
+		window, err := time.ParseDuration(login.RequestWindow)
+		if err != nil {
+			return loginCfg, fmt.Errorf("invalid email login request window: %w", err)
+		}
+		loginCfg.RequestWindow = window
+	}
+	if login.MaxRequests > 0 {
+		loginCfg.MaxRequests = login.MaxRequests
+	}
+	if login.MaxAttempts > 0 {
+		loginCfg.MaxAttempts = login.MaxAttempts
+	}
+
+	return loginCfg, nil
+}
+
+func newWebAuthnConfig(cfg *config.Config) (application.WebAuthn, error) {
+	webAuthnCfg := application.WebAuthn{SessionTTL: 5 * time.Minute}
+
+	if cfg.App.WebAuthn.SessionTTL != "" {
+		ttl, err := time.ParseDuration(cfg.App.WebAuthn.SessionTTL)
+		if err != nil {
+			return webAuthnCfg, fmt.Errorf("invalid webauthn session TTL: %w", err)
+		}
+		webAuthnCfg.SessionTTL = ttl
+	}
+
+	rp, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.App.WebAuthn.RPID,
+		RPDisplayName: cfg.App.WebAuthn.RPDisplayName,
+		RPOrigins:     cfg.App.WebAuthn.RPOrigins,
+	})
+	if err != nil {
+		return webAuthnCfg, err
+	}
+	webAuthnCfg.RelyingParty = rp
+
+	return webAuthnCfg, nil
+}
+
+func newOAuthConfig(cfg *config.Config) (application.OAuth, error) {
+	oauthCfg := application.OAuth{CodeTTL: time.Minute}
+
+	if cfg.App.OAuth.CodeTTL != "" {
+		ttl, err := time.ParseDuration(cfg.App.OAuth.CodeTTL)
+		if err != nil {
+			return oauthCfg, fmt.Errorf("invalid oauth code TTL: %w", err)
+		}
+		oauthCfg.CodeTTL = ttl
+	}
+
+	return oauthCfg, nil
+}
+
+func newFederationConfig(cfg *config.Config) (application.Federation, error) {
+	federationCfg := application.Federation{
+		StateTTL:  10 * time.Minute,
+		Providers: make(map[string]application.FederatedProvider, len(cfg.App.Federation.Providers)),
+	}
+
+	if cfg.App.Federation.StateTTL != "" {
+		ttl, err := time.ParseDuration(cfg.App.Federation.StateTTL)
+		if err != nil {
+			return federationCfg, fmt.Errorf("invalid federation state TTL: %w", err)
+		}
+		federationCfg.StateTTL = ttl
+	}
+
+	for _, p := range cfg.App.Federation.Providers {
+		if p.Name == "" {
+			return federationCfg, errors.New("identity provider without name")
+		}
+		if _, ok := federationCfg.Providers[p.Name]; ok {
+			return federationCfg, fmt.Errorf("identity provider %q is configured twice", p.Name)
+		}
+		provider, err := federation.NewProvider(federation.Config{
+			Type:         p.Type,
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  p.RedirectURL,
+			Scopes:       p.Scopes,
+		}, nil)
+		if err != nil {
+			return federationCfg, fmt.Errorf("identity provider %q: %w", p.Name, err)
+		}
+		federationCfg.Providers[p.Name] = application.FederatedProvider{
+			Provider:    provider,
+			AllowSignup: p.AllowSignup,
+			LinkByEmail: p.LinkByEmail,
+		}
+	}
+
+	return federationCfg, nil
+}
+
+// loginAttemptTracker is a lockout tracker with its background cleanup.
+type loginAttemptTracker interface {
+	application.LoginAttemptTracker
+	Run(ctx context.Context, interval time.Duration)
+}
+
+func newLoginAttemptTracker(cfg *config.Config, repo repository.LoginAttemptRepository) (loginAttemptTracker, error) {
+	lockoutCfg := cfg.App.Lockout
+	policy := lockout.Policy{
+		Threshold:  5,
+		BaseDelay:  30 * time.Second,
+		MaxDelay:   15 * time.Minute,
+		ResetAfter: time.Hour,
+	}
+
+	if lockoutCfg.Threshold > 0 {
+		policy.Threshold = lockoutCfg.Threshold
+	}
+	if lockoutCfg.BaseDelay != "" {
+		delay, err := time.ParseDuration(lockoutCfg.BaseDelay)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lockout base delay: %w", err)
+		}
+		policy.BaseDelay = delay
+	}
+	if lockoutCfg.MaxDelay != "" {
+		delay, err := time.ParseDuration(lockoutCfg.MaxDelay)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lockout max delay: %w", err)
+		}
+		policy.MaxDelay = delay
+	}
+	if lockoutCfg.ResetAfter != "" {
+		resetAfter, err := time.ParseDuration(lockoutCfg.ResetAfter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lockout reset: %w", err)
+		}
+		policy.ResetAfter = resetAfter
+	}
+
+	switch lockoutCfg.Store {
+	case "", "sql":
+		return lockout.NewSQLTracker(repo, policy), nil
+	case "memory":
+		return lockout.NewMemoryTracker(policy), nil
+	default:
+		return nil, fmt.Errorf("unknown lockout store %q", lockoutCfg.Store)
+	}
+}
+
+// newRateLimiter returns nil, which disables limiting, when no rules are configured.
+func newRateLimiter(ctx context.Context, cfg *config.Config) (*ratelimit.Limiter, error) {
+	rlCfg := cfg.App.RateLimit
+	if len(rlCfg.Rules) == 0 {
+		log.Println("no rate limit rules configured, rate limiting is disabled")
+		return nil, nil
+	}
+
+	rules := make([]ratelimit.Rule, 0, len(rlCfg.Rules))
+	for _, r := range rlCfg.Rules {
+		window, err := time.ParseDuration(r.Window)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate limit window for route %q: %w", r.Route, err)
+		}
+		rules = append(rules, ratelimit.Rule{
+			Route: r.Route,
+			Key:   r.Key,
+			Limit: ratelimit.Limit{Requests: r.Requests, Window: window, Burst: r.Burst},
+		})
+	}
+
+	switch rlCfg.Store {
+	case "", "memory":
+		store := ratelimit.NewMemoryStore()
+		go store.Run(ctx, time.Minute)
+		return ratelimit.NewLimiter(store, rules)
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", rlCfg.Store)
+	}
+}
+
+func loadSigningKeys(cfg *config.Config) (*security.SigningKey, []security.RetiredKey, error) {
+	var (
+		active  *security.SigningKey
+		retired []security.RetiredKey
+	)
+
+	for _, k := range cfg.App.Env.SigningKeys {
+		if k.Kid == "" {
+			return nil, nil, fmt.Errorf("signing key %s has no kid", k.Path)
+		}
+
+		key, err := security.LoadSigningKey(k.Kid, k.Path, cfg.App.Env.SigningAlgorithm)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if k.Active {
+			if active != nil {
+				return nil, nil, fmt.Errorf("more than one active signing key: %s, %s", active.Kid, k.Kid)
+			}
+			active = key
+			continue
+		}
+
+		var retiredAt time.Time
+		if k.RetiredAt != "" {
+			if retiredAt, err = time.Parse(time.RFC3339, k.RetiredAt); err != nil {
+				return nil, nil, fmt.Errorf("invalid retiredAt for key %s: %w", k.Kid, err)
+			}
+		}
+		retired = append(retired, security.RetiredKey{Key: key, RetiredAt: retiredAt})
+	}
+
+	if active == nil {
+		return nil, nil, errors.New("no active signing key configured")
+	}
+
+	return active, retired, nil
+}
+
+// reloadSigningKeysOnSIGHUP re-reads the key list so operators can rotate keys without a restart.
+func reloadSigningKeysOnSIGHUP(ring *security.KeyRing) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	for range hup {
+		cfg, err := config.Load()
+		if err != nil {
+			log.Printf("Signing key reload failed: %v", err)
+			continue
+		}
+
+		active, retired, err := loadSigningKeys(cfg)
+		if err != nil {
+			log.Printf("Signing key reload failed: %v", err)
+			continue
+		}
+
+		ring.Load(active, retired)
+		log.Printf("Signing keys reloaded, active kid: %s", active.Kid)
+	}
+}
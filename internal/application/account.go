@@ -0,0 +1,142 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/mail"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+)
+
+const PurposeEmailChange = "email_change"
+
+var ErrInvalidPassword = errors.New("current password is incorrect")
+
+// EmailChange configures the confirmation links sent to a new email address.
+type EmailChange struct {
+	TokenTTL time.Duration
+	// LinkURL is the confirmation endpoint; the token is added as the token query parameter.
+	LinkURL string
+}
+
+func WithEmailChange(mailer mail.Mailer, cfg EmailChange) Option {
+	return func(s *AuthService) {
+		s.mailer = mailer
+		s.emailChange = cfg
+	}
+}
+
+// ChangePassword replaces the password after checking the current one and ends every
+// other session of the user. The session of currentRefreshToken stays logged in; when
+// it is empty or unknown, all sessions are ended.
+func (s *AuthService) ChangePassword(ctx context.Context, userID int64, currentPassword, newPassword, currentRefreshToken string) error {
+	if newPassword == "" {
+		return errors.New("new password must not be empty")
+	}
+
+	user, err := s.checkPassword(ctx, userID, currentPassword)
+	if err != nil {
+		return err
+	}
+	if err := s.validatePassword(ctx, userID, user.Email, user.Password, newPassword); err != nil {
+		return err
+	}
+
+	hash, err := s.passwords.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.UpdatePassword(ctx, userID, hash); err != nil {
+		return err
+	}
+	s.recordPassword(ctx, userID, hash)
+
+	if currentRefreshToken != "" {
+		current, err := s.repo.GetRefreshToken(ctx, currentRefreshToken)
+		if err == nil && current.UserId == userID {
+			return s.repo.RevokeOtherRefreshTokens(ctx, userID, current.FamilyId)
+		}
+	}
+	return s.repo.RevokeUserRefreshTokens(ctx, userID)
+}
+
+// RequestEmailChange mails a confirmation link to newEmail. The address only changes
+// once the link is opened, which proves the user controls it.
+func (s *AuthService) RequestEmailChange(ctx context.Context, userID int64, currentPassword, newEmail string) error {
+	if s.mailer == nil || s.emailChange.TokenTTL == 0 {
+		return errors.New("email change is not configured")
+	}
+	if newEmail == "" {
+		return errors.New("new email must not be empty")
+	}
+
+	user, err := s.checkPassword(ctx, userID, currentPassword)
+	if err != nil {
+		return err
+	}
+	if user.Email == newEmail {
+		return errors.New("new email matches the current one")
+	}
+
+	_, err = s.repo.GetUserByEmail(ctx, newEmail)
+	if err == nil {
+		return repository.ErrEmailTaken
+	}
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		return err
+	}
+
+	link, err := s.issueActionLink(ctx, model.ActionToken{UserId: userID, Purpose: PurposeEmailChange, Payload: newEmail},
+		s.emailChange.TokenTTL, s.emailChange.LinkURL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Open the link below to use this address for your account:\n\n%s\n\nThe link expires in %s.",
+			link, s.emailChange.TokenTTL),
+	})
+}
+
+// ConfirmEmailChange consumes the token sent by RequestEmailChange and switches the
+// account to the new address.
+func (s *AuthService) ConfirmEmailChange(ctx context.Context, token string) error {
+	if token == "" {
+		return errors.New("token must not be empty")
+	}
+
+	consumed, err := s.consumeActionToken(ctx, token, PurposeEmailChange)
+	if err != nil {
+		return err
+	}
+	if consumed.Payload == "" {
+		return repository.ErrActionTokenInvalid
+	}
+
+	return s.repo.UpdateEmail(ctx, consumed.UserId, consumed.Payload)
+}
+
+func (s *AuthService) checkPassword(ctx context.Context, userID int64, password string) (*model.User, error) {
+	if userID == 0 || password == "" {
+		return nil, ErrInvalidPassword
+	}
+
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	ok, _, err := s.verifyPassword(password, user.Password)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidPassword
+	}
+
+	return user, nil
+}
@@ -0,0 +1,87 @@
+package application
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/mail"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func testUser(t *testing.T) *model.User {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.MinCost)
+	assert.NoError(t, err)
+	return &model.User{Id: 1, Email: "test@test.com", Password: string(hashedPassword)}
+}
+
+func TestChangePassword_KeepsCurrentSession(t *testing.T) {
+	repo := new(MockRepo)
+	service := NewAuthService(repo, nil)
+
+	repo.On("GetUserByID", mock.Anything, int64(1)).Return(testUser(t), nil)
+	repo.On("UpdatePassword", mock.Anything, int64(1), mock.Anything).Return(nil)
+	repo.On("GetRefreshToken", mock.Anything, "refresh").Return(&model.RefreshToken{UserId: 1, FamilyId: "family-1"}, nil)
+	repo.On("RevokeOtherRefreshTokens", mock.Anything, int64(1), "family-1").Return(nil)
+
+	err := service.ChangePassword(context.Background(), 1, "123456", "newPassword", "refresh")
+	assert.NoError(t, err)
+	repo.AssertNotCalled(t, "RevokeUserRefreshTokens", mock.Anything, mock.Anything)
+}
+
+func TestChangePassword_WrongCurrentPassword(t *testing.T) {
+	repo := new(MockRepo)
+	service := NewAuthService(repo, nil)
+
+	repo.On("GetUserByID", mock.Anything, int64(1)).Return(testUser(t), nil)
+
+	err := service.ChangePassword(context.Background(), 1, "wrong", "newPassword", "")
+	assert.ErrorIs(t, err, ErrInvalidPassword)
+	repo.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestRequestEmailChange(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	mailer := new(MockMailer)
+	service := NewAuthService(repo, jwt, WithEmailChange(mailer, EmailChange{
+		TokenTTL: time.Hour,
+		LinkURL:  "http://localhost/api/v1/auth/email/confirm",
+	}))
+
+	repo.On("GetUserByID", mock.Anything, int64(1)).Return(testUser(t), nil)
+	repo.On("GetUserByEmail", mock.Anything, "new@test.com").Return((*model.User)(nil), repository.ErrUserNotFound)
+	repo.On("GetUserByEmail", mock.Anything, "taken@test.com").Return(&model.User{Id: 2}, nil)
+	jwt.On("GenerateActionToken", int64(1), PurposeEmailChange, time.Hour).
+		Return("confirm", &security.Claims{UserID: 1, ID: "jti-1"}, nil)
+	repo.On("CreateActionToken", mock.Anything, mock.MatchedBy(func(token model.ActionToken) bool {
+		return token.Payload == "new@test.com"
+	})).Return(nil)
+	// Письмо уходит на новый адрес
+	mailer.On("Send", mock.Anything, mock.MatchedBy(func(msg mail.Message) bool {
+		return msg.To == "new@test.com"
+	})).Return(nil)
+
+	assert.NoError(t, service.RequestEmailChange(context.Background(), 1, "123456", "new@test.com"))
+	assert.ErrorIs(t, service.RequestEmailChange(context.Background(), 1, "123456", "taken@test.com"), repository.ErrEmailTaken)
+	mailer.AssertNumberOfCalls(t, "Send", 1)
+}
+
+func TestConfirmEmailChange(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	service := NewAuthService(repo, jwt)
+
+	jwt.On("ParseActionToken", "confirm", PurposeEmailChange).Return(&security.Claims{UserID: 1, ID: "jti-1"}, nil)
+	repo.On("ConsumeActionToken", mock.Anything, "jti-1", PurposeEmailChange).
+		Return(&model.ActionToken{Jti: "jti-1", UserId: 1, Payload: "new@test.com"}, nil)
+	repo.On("UpdateEmail", mock.Anything, int64(1), "new@test.com").Return(nil)
+
+	assert.NoError(t, service.ConfirmEmailChange(context.Background(), "confirm"))
+	repo.AssertExpectations(t)
+}
@@ -0,0 +1,87 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+)
+
+// issueActionToken signs a single-use token for action.UserId and action.Purpose and
+// records it together with action.Payload.
+func (s *AuthService) issueActionToken(ctx context.Context, action model.ActionToken, ttl time.Duration) (string, error) {
+	token, claims, err := s.jwtManager.GenerateActionToken(action.UserId, action.Purpose, ttl)
+	if err != nil {
+		return "", err
+	}
+
+	action.Jti = claims.ID
+	action.ExpiresAt = claims.ExpiresAt
+	if err := s.repo.CreateActionToken(ctx, action); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// issueActionLink returns linkURL with a fresh action token added as the token query parameter.
+func (s *AuthService) issueActionLink(ctx context.Context, action model.ActionToken, ttl time.Duration, linkURL string) (string, error) {
+	token, err := s.issueActionToken(ctx, action, ttl)
+	if err != nil {
+		return "", err
+	}
+
+	return actionLink(linkURL, token)
+}
+
+// activeActionToken checks a token like consumeActionToken, but leaves it usable, for
+// flows that must validate their input before the token may be spent.
+func (s *AuthService) activeActionToken(ctx context.Context, token, purpose string) (*model.ActionToken, error) {
+	claims, err := s.jwtManager.ParseActionToken(token, purpose)
+	if err != nil {
+		return nil, repository.ErrActionTokenInvalid
+	}
+
+	active, err := s.repo.GetActionToken(ctx, claims.ID, purpose)
+	if err != nil {
+		return nil, err
+	}
+	if active.UserId != claims.UserID {
+		return nil, repository.ErrActionTokenInvalid
+	}
+
+	return active, nil
+}
+
+// consumeActionToken checks the signature and purpose, then claims the token so it
+// cannot be used again. Any failure is reported as ErrActionTokenInvalid.
+func (s *AuthService) consumeActionToken(ctx context.Context, token, purpose string) (*model.ActionToken, error) {
+	claims, err := s.jwtManager.ParseActionToken(token, purpose)
+	if err != nil {
+		return nil, repository.ErrActionTokenInvalid
+	}
+
+	consumed, err := s.repo.ConsumeActionToken(ctx, claims.ID, purpose)
+	if err != nil {
+		return nil, err
+	}
+	if consumed.UserId != claims.UserID {
+		return nil, repository.ErrActionTokenInvalid
+	}
+
+	return consumed, nil
+}
+
+func actionLink(base, token string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid link url %q: %w", base, err)
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
@@ -2,16 +2,43 @@ package application
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/mail"
 	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
 	"github.com/danilkompaniets/auth-service/pkg/model"
-	"github.com/danilkompaniets/go-chat-common/tokens"
 	"golang.org/x/crypto/bcrypt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
 )
 
 type AuthService struct {
-	repo       repository.AuthRepository
-	jwtManager tokens.TokenManager
+	repo           repository.AuthRepository
+	jwtManager     security.TokenManager
+	events         SecurityEventPublisher
+	revocations    RevocationStore
+	mailer         mail.Mailer
+	verification   EmailVerification
+	passwordReset  PasswordReset
+	emailChange    EmailChange
+	mfa            *MFA
+	webauthn       *WebAuthn
+	emailLogin     *EmailLogin
+	loginAttempts  LoginAttemptTracker
+	passwords      security.PasswordHasher
+	passwordPolicy PasswordPolicy
+	oauth          *OAuth
+	oidc           *OIDC
+	federation     *Federation
+	background     sync.WaitGroup
+	// dummyHash is made once with the configured hasher for verifyPassword.
+	dummyHash     string
+	dummyHashOnce sync.Once
 }
 
 type Tokens struct {
@@ -19,8 +46,42 @@ type Tokens struct {
 	RefreshToken string `json:"refresh_token"`
 }
 
-func NewAuthService(repo repository.AuthRepository, manager tokens.TokenManager) *AuthService {
-	return &AuthService{repo: repo, jwtManager: manager}
+var (
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected, session revoked")
+	ErrInvalidCredentials  = errors.New("invalid email or password")
+	ErrRefreshTokenClient  = errors.New("refresh token was issued to another client")
+	ErrSessionRevoked      = errors.New("session has been revoked")
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+)
+
+// Option configures optional AuthService collaborators.
+type Option func(*AuthService)
+
+// WithPasswordHasher replaces the default bcrypt hasher. Hashes of other supported
+// algorithms keep verifying and are upgraded on the next successful login.
+func WithPasswordHasher(hasher security.PasswordHasher) Option {
+	return func(s *AuthService) {
+		s.passwords = hasher
+	}
+}
+
+func WithSecurityEvents(events SecurityEventPublisher) Option {
+	return func(s *AuthService) {
+		s.events = events
+	}
+}
+
+func NewAuthService(repo repository.AuthRepository, manager security.TokenManager, opts ...Option) *AuthService {
+	s := &AuthService{
+		repo:       repo,
+		jwtManager: manager,
+		events:     LogSecurityEventPublisher{},
+		passwords:  security.NewBcryptHasher(bcrypt.DefaultCost, ""),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *AuthService) CreateUser(ctx context.Context, user model.User) (int64, error) {
@@ -28,35 +89,158 @@ func (s *AuthService) CreateUser(ctx context.Context, user model.User) (int64, e
 		return 0, errors.New("user fields cannot be empty")
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if err := s.validatePassword(ctx, 0, user.Email, "", user.Password); err != nil {
+		return 0, err
+	}
+
+	hash, err := s.passwords.Hash(user.Password)
 	if err != nil {
 		return 0, err
 	}
 
-	user.Password = string(hash)
+	user.Password = hash
 
-	return s.repo.CreateUser(ctx, user)
-}
+	id, err := s.repo.CreateUser(ctx, user)
+	if err != nil {
+		return 0, err
+	}
+	s.recordPassword(ctx, id, hash)
 
-func (s *AuthService) LoginUser(ctx context.Context, user model.User) (*Tokens, error) {
-	if user.Email == "" || user.Password == "" {
-		return nil, errors.New("user fields cannot be empty")
+	// Operators may create users whose address they already vouch for.
+	if user.EmailVerifiedAt == nil {
+		s.sendRegistrationVerification(ctx, id, user.Email)
 	}
 
-	userFound, err := s.repo.GetUserByEmail(ctx, user.Email)
+	return id, nil
+}
+
+func (s *AuthService) LoginUser(ctx context.Context, user model.User, device model.Device) (*Tokens, error) {
+	userID, err := s.VerifyLogin(ctx, user.Email, user.Password, device)
 	if err != nil {
 		return nil, err
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(userFound.Password), []byte(user.Password))
+	return s.startSession(ctx, userID, device)
+}
+
+// VerifyLogin runs every check of a password login, including lockouts and the
+// second factor challenge, without opening a session. Pages that log users in for
+// another purpose, like the OAuth authorization page, use it instead of LoginUser.
+func (s *AuthService) VerifyLogin(ctx context.Context, email, password string, device model.Device) (int64, error) {
+	if email == "" || password == "" {
+		return 0, errors.New("user fields cannot be empty")
+	}
+
+	keys := loginThrottleKeys(email, device)
+	if err := s.checkLoginThrottle(ctx, keys); err != nil {
+		return 0, err
+	}
+
+	// Unknown emails answer like wrong passwords and cost the same hash check, so
+	// neither the error nor the timing tells which addresses are registered.
+	userFound, err := s.repo.GetUserByEmail(ctx, email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		s.verifyPassword(password, "")
+		s.recordLoginFailure(ctx, keys, 0, device)
+		return 0, ErrInvalidCredentials
+	}
 	if err != nil {
-		return nil, err
+		return 0, err
+	}
+
+	ok, rehash, err := s.verifyPassword(password, userFound.Password)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		s.recordLoginFailure(ctx, keys, userFound.Id, device)
+		return 0, ErrInvalidCredentials
+	}
+	if userFound.DisabledAt != nil {
+		return 0, ErrUserDisabled
+	}
+	if rehash {
+		s.upgradePasswordHash(ctx, userFound.Id, password)
+	}
+	if s.verification.Required && userFound.EmailVerifiedAt == nil {
+		return 0, ErrEmailNotVerified
 	}
+	// With a second factor the failures are only forgotten once it is passed too,
+	// otherwise every correct password would give another round of code guesses.
+	if err := s.mfaChallenge(ctx, userFound.Id); err != nil {
+		return 0, err
+	}
+	s.resetLoginFailures(ctx, email)
+
+	return userFound.Id, nil
+}
+
+// verifyPassword rejects every password for accounts that have none, like the ones
+// signed up through an identity provider. It still checks the password against a
+// dummy hash then, so those answers take as long as a real check.
+func (s *AuthService) verifyPassword(password, hash string) (ok bool, rehash bool, err error) {
+	if hash == "" {
+		s.dummyHashOnce.Do(func() {
+			s.dummyHash, err = s.passwords.Hash("no password set for this account")
+		})
+		if err == nil && s.dummyHash != "" {
+			s.passwords.Verify(password, s.dummyHash)
+		}
+		return false, false, nil
+	}
+	return s.passwords.Verify(password, hash)
+}
+
+// upgradePasswordHash replaces a hash made with outdated parameters. Failures are
+// only logged, the next login tries again.
+func (s *AuthService) upgradePasswordHash(ctx context.Context, userID int64, password string) {
+	hash, err := s.passwords.Hash(password)
+	if err == nil {
+		err = s.repo.UpdatePassword(ctx, userID, hash)
+	}
+	if err != nil {
+		log.Printf("password rehash for user %d failed: %v", userID, err)
+	}
+}
+
+// startSession opens a new refresh token family, leaving the user's other sessions untouched.
+func (s *AuthService) startSession(ctx context.Context, userID int64, device model.Device) (*Tokens, error) {
+	return s.startClientSession(ctx, userID, device, "", "")
+}
 
-	accessToken, err := s.jwtManager.GenerateAccessToken(userFound.Id)
-	refreshToken, err := s.jwtManager.GenerateRefreshToken(userFound.Id)
+// startClientSession opens a session that only the given OAuth client can refresh.
+// An empty clientID means the first-party endpoints.
+func (s *AuthService) startClientSession(ctx context.Context, userID int64, device model.Device, clientID, scope string) (*Tokens, error) {
+	authz, err := s.clientAuthorization(ctx, userID, clientID, scope)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := s.jwtManager.GenerateAccessToken(userID, authz)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := s.jwtManager.GenerateRefreshToken(userID)
+	if err != nil {
+		return nil, err
+	}
+	familyID, err := newFamilyID()
+	if err != nil {
+		return nil, err
+	}
 
-	err = s.repo.SaveRefreshToken(ctx, userFound.Id, refreshToken)
+	now := time.Now().UTC()
+	_, err = s.repo.CreateRefreshToken(ctx, model.RefreshToken{
+		UserId:     userID,
+		Token:      refreshToken,
+		FamilyId:   familyID,
+		DeviceName: device.Name,
+		UserAgent:  device.UserAgent,
+		IP:         device.IP,
+		ClientId:   clientID,
+		Scope:      scope,
+		CreatedAt:  now,
+		LastUsedAt: now,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -64,46 +248,125 @@ func (s *AuthService) LoginUser(ctx context.Context, user model.User) (*Tokens,
 	return &Tokens{RefreshToken: refreshToken, AccessToken: accessToken}, nil
 }
 
+// RefreshUserTokens rotates the presented token within its family. Presenting a
+// token that was already rotated means two parties hold it, so the whole family
+// is revoked and both have to log in again.
 func (s *AuthService) RefreshUserTokens(ctx context.Context, refreshToken string) (*Tokens, error) {
+	tokens, _, err := s.refreshSession(ctx, refreshToken, "")
+	return tokens, err
+}
+
+// refreshSession rotates a token of a session opened by clientID and returns the
+// session's scope along with the new tokens.
+func (s *AuthService) refreshSession(ctx context.Context, refreshToken, clientID string) (*Tokens, string, error) {
 	userID, err := s.jwtManager.VerifyRefreshToken(refreshToken)
 	if err != nil {
-		return nil, err
+		return nil, "", fmt.Errorf("%w: %v", ErrRefreshTokenInvalid, err)
 	}
 
-	newAccessToken, err := s.jwtManager.GenerateAccessToken(userID)
+	current, err := s.repo.GetRefreshToken(ctx, refreshToken)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+	if current.UserId != userID {
+		return nil, "", fmt.Errorf("%w: token does not belong to user", ErrRefreshTokenInvalid)
+	}
+	if current.ClientId != clientID {
+		return nil, "", ErrRefreshTokenClient
+	}
+	if current.RevokedAt != nil {
+		return nil, "", ErrSessionRevoked
+	}
+	if current.RotatedAt != nil {
+		return nil, "", s.revokeReusedFamily(ctx, current)
+	}
+
+	// Roles are reloaded on every refresh so grants and revocations reach the
+	// next access token without a new login.
+	authz, err := s.clientAuthorization(ctx, userID, current.ClientId, current.Scope)
+	if err != nil {
+		return nil, "", err
+	}
+	newAccessToken, err := s.jwtManager.GenerateAccessToken(userID, authz)
+	if err != nil {
+		return nil, "", err
 	}
 	newRefreshToken, err := s.jwtManager.GenerateRefreshToken(userID)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	err = s.repo.DeleteRefreshToken(ctx, userID)
+	now := time.Now().UTC()
+	_, err = s.repo.RotateRefreshToken(ctx, current.Id, model.RefreshToken{
+		UserId:     userID,
+		Token:      newRefreshToken,
+		FamilyId:   current.FamilyId,
+		DeviceName: current.DeviceName,
+		UserAgent:  current.UserAgent,
+		IP:         current.IP,
+		ClientId:   current.ClientId,
+		Scope:      current.Scope,
+		CreatedAt:  now,
+		LastUsedAt: now,
+	})
+	if errors.Is(err, repository.ErrRefreshTokenRotated) {
+		// Lost a race against another refresh with the same token: that is reuse too.
+		return nil, "", s.revokeReusedFamily(ctx, current)
+	}
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	err = s.repo.SaveRefreshToken(ctx, userID, newRefreshToken)
-	if err != nil {
-		return nil, err
+	return &Tokens{RefreshToken: newRefreshToken, AccessToken: newAccessToken}, current.Scope, nil
+}
+
+func (s *AuthService) revokeReusedFamily(ctx context.Context, reused *model.RefreshToken) error {
+	if err := s.repo.RevokeRefreshTokenFamily(ctx, reused.FamilyId); err != nil {
+		return err
 	}
 
-	return &Tokens{RefreshToken: newRefreshToken, AccessToken: newAccessToken}, nil
+	s.events.Publish(ctx, SecurityEvent{
+		Type:   EventRefreshTokenReuse,
+		UserID: reused.UserId,
+		Details: map[string]string{
+			"family_id":   reused.FamilyId,
+			"token_id":    strconv.FormatInt(reused.Id, 10),
+			"device_name": reused.DeviceName,
+		},
+		OccurredAt: time.Now().UTC(),
+	})
+
+	return ErrRefreshTokenReused
 }
 
-func (s *AuthService) GetRefreshToken(ctx context.Context, userID int64) (string, error) {
-	if userID == 0 {
-		return "", errors.New("userID must not be empty")
+// Logout ends the session the refresh token belongs to.
+func (s *AuthService) Logout(ctx context.Context, refreshToken string) error {
+	if refreshToken == "" {
+		return fmt.Errorf("%w: token must not be empty", ErrRefreshTokenInvalid)
+	}
+
+	current, err := s.repo.GetRefreshToken(ctx, refreshToken)
+	if err != nil {
+		return err
 	}
-	return s.repo.GetRefreshToken(ctx, userID)
+
+	return s.repo.RevokeRefreshTokenFamily(ctx, current.FamilyId)
 }
 
-func (s *AuthService) DeleteRefreshToken(ctx context.Context, userID int64) error {
+// LogoutAll ends every session of the user.
+func (s *AuthService) LogoutAll(ctx context.Context, userID int64) error {
 	if userID == 0 {
 		return errors.New("userID must not be empty")
 	}
-	return s.repo.DeleteRefreshToken(ctx, userID)
+	return s.repo.RevokeUserRefreshTokens(ctx, userID)
+}
+
+func newFamilyID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
 
 func (s *AuthService) GetUserByRefreshToken(ctx context.Context, token string) (int64, error) {
@@ -118,17 +381,22 @@ func (s *AuthService) GetUserByRefreshToken(ctx context.Context, token string) (
 	return userID, nil
 }
 
-func (s *AuthService) ValidateToken(token string) (int64, error) {
-	if token == "" {
-		return 0, errors.New("token must not be empty")
-	}
-	userID, err := s.jwtManager.VerifyAccessToken(token)
+func (s *AuthService) ValidateToken(ctx context.Context, token string) (int64, error) {
+	return s.ValidateTokenForAudience(ctx, token, "")
+}
+
+// ValidateTokenForAudience additionally requires the token to be issued for audience,
+// so a token minted for one product is not accepted by another. An empty audience
+// only applies the globally configured audience rules.
+func (s *AuthService) ValidateTokenForAudience(ctx context.Context, token, audience string) (int64, error) {
+	claims, err := s.AuthorizeToken(ctx, token, audience)
 	if err != nil {
 		return 0, err
 	}
-	if userID == 0 {
-		return 0, errors.New("user not found")
-	}
 
-	return userID, nil
+	return claims.UserID, nil
+}
+
+func (s *AuthService) JWKS() security.JWKS {
+	return s.jwtManager.JWKS()
 }
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/danilkompaniets/auth-service/internal/application"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/database"
 	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository/sqlRepo"
 	"github.com/danilkompaniets/auth-service/pkg/model"
 
@@ -58,24 +59,14 @@ func setupTestDB(t *testing.T) func() {
 		time.Sleep(500 * time.Millisecond)
 	}
 
-	// Создание таблиц для тестов
-	schema := `
-	CREATE TABLE IF NOT EXISTS users (
-		id SERIAL PRIMARY KEY,
-		email TEXT UNIQUE NOT NULL,
-		password TEXT NOT NULL,
-		created_at TIMESTAMP NOT NULL,
-		updated_at TIMESTAMP NOT NULL
-	);
-	CREATE TABLE IF NOT EXISTS refresh_tokens (
-		user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
-		token TEXT NOT NULL,
-		created_at TIMESTAMP DEFAULT NOW()
-	);`
-	_, err = db.Exec(schema)
+	// Схема создаётся теми же миграциями, что и в проде
+	migrator, err := database.NewMigrator(db)
 	if err != nil {
 		t.Fatal(err)
 	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
 
 	t.Log("Test DB ready")
 
@@ -90,7 +81,7 @@ func TestAuthServiceIntegration(t *testing.T) {
 	cleanup := setupTestDB(t)
 	defer cleanup()
 
-	repo := sqlRepo.NewAuthRepository(db)
+	repo := sqlRepo.NewAuthRepository(db, security.NewTokenHasher("pepper"))
 	jwtManager := security.NewJWTManager("access_secret", "refresh_secret", time.Minute*5, time.Hour*24)
 	service := application.NewAuthService(repo, jwtManager)
 
@@ -113,7 +104,7 @@ func TestAuthServiceIntegration(t *testing.T) {
 	}
 
 	// 2️⃣ Тест логина пользователя
-	tokens, err := service.LoginUser(ctx, model.User{Email: user.Email, Password: "password123"})
+	tokens, err := service.LoginUser(ctx, model.User{Email: user.Email, Password: "password123"}, model.Device{Name: "laptop"})
 	if err != nil {
 		t.Fatalf("LoginUser failed: %v", err)
 	}
@@ -133,7 +124,7 @@ func TestAuthServiceIntegration(t *testing.T) {
 	}
 
 	// 4️⃣ Проверка токена доступа
-	userID, err := service.ValidateToken(newTokens.AccessToken)
+	userID, err := service.ValidateToken(ctx, newTokens.AccessToken)
 	if err != nil {
 		t.Fatalf("ValidateToken failed: %v", err)
 	}
@@ -142,9 +133,33 @@ func TestAuthServiceIntegration(t *testing.T) {
 		t.Fatalf("Expected userID %d, got %d", id, userID)
 	}
 
-	// 5️⃣ Проверка удаления refresh token
-	err = service.DeleteRefreshToken(ctx, id)
+	// 5️⃣ Вторая сессия не затрагивает первую
+	phoneTokens, err := service.LoginUser(ctx, model.User{Email: user.Email, Password: "password123"}, model.Device{Name: "phone"})
+	if err != nil {
+		t.Fatalf("LoginUser failed: %v", err)
+	}
+
+	err = service.Logout(ctx, phoneTokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Logout failed: %v", err)
+	}
+
+	laptopTokens, err := service.RefreshUserTokens(ctx, newTokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("laptop session should survive phone logout: %v", err)
+	}
+
+	// Повторное использование старого refresh token отзывает всю цепочку
+	if _, err := service.RefreshUserTokens(ctx, newTokens.RefreshToken); err == nil {
+		t.Fatal("expected reuse of rotated refresh token to fail")
+	}
+	if _, err := service.RefreshUserTokens(ctx, laptopTokens.RefreshToken); err == nil {
+		t.Fatal("expected family to be revoked after reuse")
+	}
+
+	// 6️⃣ Проверка удаления всех сессий
+	err = service.LogoutAll(ctx, id)
 	if err != nil {
-		t.Fatalf("DeleteRefreshToken failed: %v", err)
+		t.Fatalf("LogoutAll failed: %v", err)
 	}
 }
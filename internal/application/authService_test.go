@@ -3,8 +3,12 @@ package application
 import (
 	"context"
 	"golang.org/x/crypto/bcrypt"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
 	"github.com/danilkompaniets/auth-service/pkg/model"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -24,27 +28,342 @@ func (m *MockRepo) GetUserByEmail(ctx context.Context, email string) (*model.Use
 	return args.Get(0).(*model.User), args.Error(1)
 }
 
-func (m *MockRepo) SaveRefreshToken(ctx context.Context, userID int64, token string) error {
-	args := m.Called(ctx, userID, token)
+func (m *MockRepo) CreateRefreshToken(ctx context.Context, token model.RefreshToken) (int64, error) {
+	args := m.Called(ctx, token)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepo) GetRefreshToken(ctx context.Context, token string) (*model.RefreshToken, error) {
+	args := m.Called(ctx, token)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.RefreshToken), args.Error(1)
+}
+
+func (m *MockRepo) RotateRefreshToken(ctx context.Context, parentID int64, next model.RefreshToken) (int64, error) {
+	args := m.Called(ctx, parentID, next)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepo) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	args := m.Called(ctx, familyID)
 	return args.Error(0)
 }
 
-func (m *MockRepo) DeleteRefreshToken(ctx context.Context, userID int64) error {
+func (m *MockRepo) RevokeUserRefreshTokens(ctx context.Context, userID int64) error {
 	args := m.Called(ctx, userID)
 	return args.Error(0)
 }
 
-func (m *MockRepo) GetRefreshToken(ctx context.Context, userID int64) (string, error) {
+func (m *MockRepo) GetUserRoles(ctx context.Context, userID int64) ([]string, error) {
 	args := m.Called(ctx, userID)
-	return args.String(0), args.Error(1)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockRepo) GetUserPermissions(ctx context.Context, userID int64) ([]string, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockRepo) AssignRole(ctx context.Context, userID int64, role string) error {
+	args := m.Called(ctx, userID, role)
+	return args.Error(0)
+}
+
+func (m *MockRepo) RevokeRole(ctx context.Context, userID int64, role string) error {
+	args := m.Called(ctx, userID, role)
+	return args.Error(0)
+}
+
+func (m *MockRepo) ListRoles(ctx context.Context) ([]model.Role, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]model.Role), args.Error(1)
+}
+
+func (m *MockRepo) SaveRole(ctx context.Context, role model.Role) (int64, error) {
+	args := m.Called(ctx, role)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepo) RevokeOtherRefreshTokens(ctx context.Context, userID int64, keepFamilyID string) error {
+	args := m.Called(ctx, userID, keepFamilyID)
+	return args.Error(0)
+}
+
+func (m *MockRepo) GetUserByID(ctx context.Context, userID int64) (*model.User, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.User), args.Error(1)
+}
+
+func (m *MockRepo) UpdateEmail(ctx context.Context, userID int64, email string) error {
+	args := m.Called(ctx, userID, email)
+	return args.Error(0)
+}
+
+func (m *MockRepo) SetUserDisabled(ctx context.Context, userID int64, disabled bool) error {
+	args := m.Called(ctx, userID, disabled)
+	return args.Error(0)
+}
+
+func (m *MockRepo) DeleteUser(ctx context.Context, userID int64) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockRepo) MarkEmailVerified(ctx context.Context, userID int64) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockRepo) UpdatePassword(ctx context.Context, userID int64, passwordHash string) error {
+	args := m.Called(ctx, userID, passwordHash)
+	return args.Error(0)
+}
+
+func (m *MockRepo) CreateActionToken(ctx context.Context, token model.ActionToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockRepo) ConsumeActionToken(ctx context.Context, jti, purpose string) (*model.ActionToken, error) {
+	args := m.Called(ctx, jti, purpose)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.ActionToken), args.Error(1)
+}
+
+func (m *MockRepo) GetActionToken(ctx context.Context, jti, purpose string) (*model.ActionToken, error) {
+	args := m.Called(ctx, jti, purpose)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.ActionToken), args.Error(1)
+}
+
+func (m *MockRepo) InvalidateActionTokens(ctx context.Context, userID int64, purpose string) error {
+	args := m.Called(ctx, userID, purpose)
+	return args.Error(0)
+}
+
+func (m *MockRepo) GetMFA(ctx context.Context, userID int64) (*model.MFA, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.MFA), args.Error(1)
+}
+
+func (m *MockRepo) SaveMFA(ctx context.Context, mfa model.MFA) error {
+	args := m.Called(ctx, mfa)
+	return args.Error(0)
+}
+
+func (m *MockRepo) ConfirmMFA(ctx context.Context, userID int64) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockRepo) UseMFAStep(ctx context.Context, userID int64, step int64) error {
+	args := m.Called(ctx, userID, step)
+	return args.Error(0)
+}
+
+func (m *MockRepo) DeleteMFA(ctx context.Context, userID int64) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockRepo) ReplaceRecoveryCodes(ctx context.Context, userID int64, codes []string) error {
+	args := m.Called(ctx, userID, codes)
+	return args.Error(0)
+}
+
+func (m *MockRepo) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	args := m.Called(ctx, userID, code)
+	return args.Error(0)
+}
+
+func (m *MockRepo) ListWebAuthnCredentials(ctx context.Context, userID int64) ([]model.WebAuthnCredential, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]model.WebAuthnCredential), args.Error(1)
+}
+
+func (m *MockRepo) GetWebAuthnCredential(ctx context.Context, credentialID []byte) (*model.WebAuthnCredential, error) {
+	args := m.Called(ctx, credentialID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.WebAuthnCredential), args.Error(1)
+}
+
+func (m *MockRepo) CreateWebAuthnCredential(ctx context.Context, credential model.WebAuthnCredential) (int64, error) {
+	args := m.Called(ctx, credential)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepo) UpdateWebAuthnCredentialUsage(ctx context.Context, credentialID []byte, signCount uint32, flags uint8) error {
+	args := m.Called(ctx, credentialID, signCount, flags)
+	return args.Error(0)
+}
+
+func (m *MockRepo) DeleteWebAuthnCredential(ctx context.Context, userID, id int64) error {
+	args := m.Called(ctx, userID, id)
+	return args.Error(0)
+}
+
+func (m *MockRepo) CreateWebAuthnSession(ctx context.Context, session model.WebAuthnSession) error {
+	args := m.Called(ctx, session)
+	return args.Error(0)
+}
+
+func (m *MockRepo) ConsumeWebAuthnSession(ctx context.Context, id, purpose string) (*model.WebAuthnSession, error) {
+	args := m.Called(ctx, id, purpose)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.WebAuthnSession), args.Error(1)
+}
+
+func (m *MockRepo) CreateLoginCode(ctx context.Context, code model.LoginCode) error {
+	args := m.Called(ctx, code)
+	return args.Error(0)
+}
+
+func (m *MockRepo) CountLoginCodesSince(ctx context.Context, userID int64, since time.Time) (int, error) {
+	args := m.Called(ctx, userID, since)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRepo) ConsumeLoginLink(ctx context.Context, jti string) (*model.LoginCode, error) {
+	args := m.Called(ctx, jti)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.LoginCode), args.Error(1)
+}
+
+func (m *MockRepo) ConsumeLoginCode(ctx context.Context, userID int64, code string, maxAttempts int) (*model.LoginCode, error) {
+	args := m.Called(ctx, userID, code, maxAttempts)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.LoginCode), args.Error(1)
+}
+
+func (m *MockRepo) CreateOAuthClient(ctx context.Context, client model.OAuthClient) error {
+	args := m.Called(ctx, client)
+	return args.Error(0)
+}
+
+func (m *MockRepo) GetOAuthClient(ctx context.Context, clientID string) (*model.OAuthClient, error) {
+	args := m.Called(ctx, clientID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.OAuthClient), args.Error(1)
+}
+
+func (m *MockRepo) ListOAuthClients(ctx context.Context) ([]model.OAuthClient, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]model.OAuthClient), args.Error(1)
+}
+
+func (m *MockRepo) DeleteOAuthClient(ctx context.Context, clientID string) error {
+	args := m.Called(ctx, clientID)
+	return args.Error(0)
+}
+
+func (m *MockRepo) CreateAuthorizationCode(ctx context.Context, code model.AuthorizationCode) error {
+	args := m.Called(ctx, code)
+	return args.Error(0)
+}
+
+func (m *MockRepo) ConsumeAuthorizationCode(ctx context.Context, code string) (*model.AuthorizationCode, error) {
+	args := m.Called(ctx, code)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.AuthorizationCode), args.Error(1)
+}
+
+func (m *MockRepo) AddPasswordHistory(ctx context.Context, userID int64, passwordHash string, keep int) error {
+	args := m.Called(ctx, userID, passwordHash, keep)
+	return args.Error(0)
+}
+
+func (m *MockRepo) ListPasswordHistory(ctx context.Context, userID int64, limit int) ([]string, error) {
+	args := m.Called(ctx, userID, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockRepo) CreateIdentity(ctx context.Context, identity model.Identity) (int64, error) {
+	args := m.Called(ctx, identity)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepo) CreateUserWithIdentity(ctx context.Context, user model.User, identity model.Identity) (int64, error) {
+	args := m.Called(ctx, user, identity)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockRepo) GetIdentity(ctx context.Context, provider, subject string) (*model.Identity, error) {
+	args := m.Called(ctx, provider, subject)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.Identity), args.Error(1)
+}
+
+func (m *MockRepo) ListIdentities(ctx context.Context, userID int64) ([]model.Identity, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]model.Identity), args.Error(1)
+}
+
+func (m *MockRepo) RecordIdentityLogin(ctx context.Context, id int64, email string) error {
+	args := m.Called(ctx, id, email)
+	return args.Error(0)
+}
+
+func (m *MockRepo) DeleteIdentity(ctx context.Context, userID, id int64) error {
+	args := m.Called(ctx, userID, id)
+	return args.Error(0)
+}
+
+func (m *MockRepo) CreateFederatedLogin(ctx context.Context, login model.FederatedLogin) error {
+	args := m.Called(ctx, login)
+	return args.Error(0)
+}
+
+func (m *MockRepo) ConsumeFederatedLogin(ctx context.Context, state string) (*model.FederatedLogin, error) {
+	args := m.Called(ctx, state)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*model.FederatedLogin), args.Error(1)
+}
+
+type MockEvents struct {
+	mock.Mock
+}
+
+func (m *MockEvents) Publish(ctx context.Context, event SecurityEvent) {
+	m.Called(ctx, event)
 }
 
 type MockJWT struct {
 	mock.Mock
 }
 
-func (m *MockJWT) GenerateAccessToken(userID int64) (string, error) {
-	args := m.Called(userID)
+func (m *MockJWT) GenerateAccessToken(userID int64, authz security.Authorization) (string, error) {
+	args := m.Called(userID, authz)
 	return args.String(0), args.Error(1)
 }
 
@@ -63,6 +382,53 @@ func (m *MockJWT) VerifyAccessToken(token string) (int64, error) {
 	return args.Get(0).(int64), args.Error(1)
 }
 
+func (m *MockJWT) ParseAccessToken(token string) (*security.Claims, error) {
+	args := m.Called(token)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*security.Claims), args.Error(1)
+}
+
+func (m *MockJWT) ParseRefreshToken(token string) (*security.Claims, error) {
+	args := m.Called(token)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*security.Claims), args.Error(1)
+}
+
+func (m *MockJWT) GenerateActionToken(userID int64, purpose string, ttl time.Duration) (string, *security.Claims, error) {
+	args := m.Called(userID, purpose, ttl)
+	if args.Get(1) == nil {
+		return args.String(0), nil, args.Error(2)
+	}
+	return args.String(0), args.Get(1).(*security.Claims), args.Error(2)
+}
+
+func (m *MockJWT) ParseActionToken(token, purpose string) (*security.Claims, error) {
+	args := m.Called(token, purpose)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*security.Claims), args.Error(1)
+}
+
+func (m *MockJWT) GenerateServiceToken(clientID string, scopes []string) (string, error) {
+	args := m.Called(clientID, scopes)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockJWT) GenerateIDToken(userID int64, clientID string, claims map[string]interface{}) (string, error) {
+	args := m.Called(userID, clientID, claims)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockJWT) JWKS() security.JWKS {
+	args := m.Called()
+	return args.Get(0).(security.JWKS)
+}
+
 // --- Тесты ---
 
 func TestCreateUser_Success(t *testing.T) {
@@ -94,14 +460,23 @@ func TestLoginUser_Success(t *testing.T) {
 	user := &model.User{Id: 1, Email: "test@test.com", Password: string(hashedPassword)}
 
 	repo.On("GetUserByEmail", mock.Anything, "test@test.com").Return(user, nil)
-	jwt.On("GenerateAccessToken", int64(1)).Return("access", nil)
+	repo.On("GetUserRoles", mock.Anything, int64(1)).Return([]string{"admin"}, nil)
+	repo.On("GetUserPermissions", mock.Anything, int64(1)).Return([]string{"tokens:revoke"}, nil)
+	jwt.On("GenerateAccessToken", int64(1), security.Authorization{
+		Roles:       []string{"admin"},
+		Permissions: []string{"tokens:revoke"},
+	}).Return("access", nil)
 	jwt.On("GenerateRefreshToken", int64(1)).Return("refresh", nil)
-	repo.On("SaveRefreshToken", mock.Anything, int64(1), "refresh").Return(nil)
+	repo.On("CreateRefreshToken", mock.Anything, mock.MatchedBy(func(rt model.RefreshToken) bool {
+		return rt.UserId == 1 && rt.Token == "refresh" && rt.FamilyId != "" && rt.DeviceName == "laptop" && rt.IP == "10.0.0.1"
+	})).Return(int64(10), nil)
 
-	tokens, err := service.LoginUser(context.Background(), model.User{Email: "test@test.com", Password: "123456"})
+	device := model.Device{Name: "laptop", UserAgent: "curl", IP: "10.0.0.1"}
+	tokens, err := service.LoginUser(context.Background(), model.User{Email: "test@test.com", Password: "123456"}, device)
 	assert.NoError(t, err)
 	assert.Equal(t, "access", tokens.AccessToken)
 	assert.Equal(t, "refresh", tokens.RefreshToken)
+	repo.AssertNotCalled(t, "RevokeUserRefreshTokens", mock.Anything, mock.Anything)
 }
 
 func TestLoginUser_WrongPassword(t *testing.T) {
@@ -114,20 +489,81 @@ func TestLoginUser_WrongPassword(t *testing.T) {
 
 	repo.On("GetUserByEmail", mock.Anything, "test@test.com").Return(user, nil)
 
-	_, err := service.LoginUser(context.Background(), model.User{Email: "test@test.com", Password: "wrong"})
+	_, err := service.LoginUser(context.Background(), model.User{Email: "test@test.com", Password: "wrong"}, model.Device{})
 	assert.Error(t, err)
 }
 
+// countingHasher counts password checks to compare the work of two logins.
+type countingHasher struct {
+	security.PasswordHasher
+	verified int
+}
+
+func (h *countingHasher) Verify(password, encoded string) (bool, bool, error) {
+	h.verified++
+	return h.PasswordHasher.Verify(password, encoded)
+}
+
+func TestLoginUser_UnknownEmailLooksLikeWrongPassword(t *testing.T) {
+	repo := new(MockRepo)
+	hasher := &countingHasher{PasswordHasher: security.NewBcryptHasher(bcrypt.MinCost, "")}
+	service := NewAuthService(repo, new(MockJWT), WithPasswordHasher(hasher))
+
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.MinCost)
+	user := &model.User{Id: 1, Email: "test@test.com", Password: string(hashedPassword)}
+	repo.On("GetUserByEmail", mock.Anything, "test@test.com").Return(user, nil)
+	repo.On("GetUserByEmail", mock.Anything, "ghost@test.com").Return((*model.User)(nil), repository.ErrUserNotFound)
+
+	_, wrongPassword := service.LoginUser(context.Background(), model.User{Email: "test@test.com", Password: "wrong"}, model.Device{})
+	_, unknownEmail := service.LoginUser(context.Background(), model.User{Email: "ghost@test.com", Password: "wrong"}, model.Device{})
+
+	// Ответ и объём работы не выдают, зарегистрирован ли email
+	assert.ErrorIs(t, wrongPassword, ErrInvalidCredentials)
+	assert.Equal(t, wrongPassword, unknownEmail)
+	assert.Equal(t, 2, hasher.verified)
+}
+
+func TestLoginUser_RehashesOutdatedPassword(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	hasher := security.NewArgon2idHasher(security.Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}, "")
+	service := NewAuthService(repo, jwt, WithPasswordHasher(hasher))
+
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.MinCost)
+	user := &model.User{Id: 1, Email: "test@test.com", Password: string(hashedPassword)}
+
+	repo.On("GetUserByEmail", mock.Anything, "test@test.com").Return(user, nil)
+	// bcrypt-хеш заменяется на argon2id после успешного входа
+	repo.On("UpdatePassword", mock.Anything, int64(1), mock.MatchedBy(func(hash string) bool {
+		ok, rehash, err := hasher.Verify("123456", hash)
+		return strings.HasPrefix(hash, "$argon2id$") && ok && !rehash && err == nil
+	})).Return(nil).Once()
+	repo.On("GetUserRoles", mock.Anything, int64(1)).Return([]string{}, nil)
+	repo.On("GetUserPermissions", mock.Anything, int64(1)).Return([]string{}, nil)
+	jwt.On("GenerateAccessToken", int64(1), mock.Anything).Return("access", nil)
+	jwt.On("GenerateRefreshToken", int64(1)).Return("refresh", nil)
+	repo.On("CreateRefreshToken", mock.Anything, mock.Anything).Return(int64(10), nil)
+
+	_, err := service.LoginUser(context.Background(), model.User{Email: "test@test.com", Password: "123456"}, model.Device{})
+	assert.NoError(t, err)
+	repo.AssertExpectations(t)
+}
+
 func TestRefreshUserTokens_Success(t *testing.T) {
 	repo := new(MockRepo)
 	jwt := new(MockJWT)
 	service := NewAuthService(repo, jwt)
 
 	jwt.On("VerifyRefreshToken", "oldToken").Return(int64(1), nil)
-	jwt.On("GenerateAccessToken", int64(1)).Return("newAccess", nil)
+	repo.On("GetRefreshToken", mock.Anything, "oldToken").
+		Return(&model.RefreshToken{Id: 10, UserId: 1, Token: "oldToken", FamilyId: "family-1", DeviceName: "laptop"}, nil)
+	repo.On("GetUserRoles", mock.Anything, int64(1)).Return([]string{}, nil)
+	repo.On("GetUserPermissions", mock.Anything, int64(1)).Return([]string{}, nil)
+	jwt.On("GenerateAccessToken", int64(1), mock.Anything).Return("newAccess", nil)
 	jwt.On("GenerateRefreshToken", int64(1)).Return("newRefresh", nil)
-	repo.On("DeleteRefreshToken", mock.Anything, int64(1)).Return(nil)
-	repo.On("SaveRefreshToken", mock.Anything, int64(1), "newRefresh").Return(nil)
+	repo.On("RotateRefreshToken", mock.Anything, int64(10), mock.MatchedBy(func(rt model.RefreshToken) bool {
+		return rt.Token == "newRefresh" && rt.FamilyId == "family-1" && rt.DeviceName == "laptop"
+	})).Return(int64(11), nil)
 
 	tokens, err := service.RefreshUserTokens(context.Background(), "oldToken")
 	assert.NoError(t, err)
@@ -135,23 +571,124 @@ func TestRefreshUserTokens_Success(t *testing.T) {
 	assert.Equal(t, "newRefresh", tokens.RefreshToken)
 }
 
-func TestGetRefreshToken_Success(t *testing.T) {
+func TestRefreshUserTokens_UnknownSession(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	service := NewAuthService(repo, jwt)
+
+	jwt.On("VerifyRefreshToken", "oldToken").Return(int64(1), nil)
+	repo.On("GetRefreshToken", mock.Anything, "oldToken").Return(nil, repository.ErrRefreshTokenNotFound)
+
+	_, err := service.RefreshUserTokens(context.Background(), "oldToken")
+	assert.ErrorIs(t, err, repository.ErrRefreshTokenNotFound)
+	jwt.AssertNotCalled(t, "GenerateAccessToken", mock.Anything, mock.Anything)
+}
+
+func TestRefreshUserTokens_ReuseRevokesFamily(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	events := new(MockEvents)
+	service := NewAuthService(repo, jwt, WithSecurityEvents(events))
+
+	rotatedAt := time.Now()
+	jwt.On("VerifyRefreshToken", "stolen").Return(int64(1), nil)
+	repo.On("GetRefreshToken", mock.Anything, "stolen").
+		Return(&model.RefreshToken{Id: 10, UserId: 1, FamilyId: "family-1", RotatedAt: &rotatedAt}, nil)
+	repo.On("RevokeRefreshTokenFamily", mock.Anything, "family-1").Return(nil)
+	events.On("Publish", mock.Anything, mock.MatchedBy(func(e SecurityEvent) bool {
+		return e.Type == EventRefreshTokenReuse && e.UserID == 1 && e.Details["family_id"] == "family-1"
+	})).Return()
+
+	_, err := service.RefreshUserTokens(context.Background(), "stolen")
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+	events.AssertExpectations(t)
+	jwt.AssertNotCalled(t, "GenerateAccessToken", mock.Anything, mock.Anything)
+}
+
+func TestRefreshUserTokens_ConcurrentRotationIsReuse(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	events := new(MockEvents)
+	service := NewAuthService(repo, jwt, WithSecurityEvents(events))
+
+	jwt.On("VerifyRefreshToken", "oldToken").Return(int64(1), nil)
+	repo.On("GetRefreshToken", mock.Anything, "oldToken").
+		Return(&model.RefreshToken{Id: 10, UserId: 1, FamilyId: "family-1"}, nil)
+	repo.On("GetUserRoles", mock.Anything, int64(1)).Return([]string{}, nil)
+	repo.On("GetUserPermissions", mock.Anything, int64(1)).Return([]string{}, nil)
+	jwt.On("GenerateAccessToken", int64(1), mock.Anything).Return("newAccess", nil)
+	jwt.On("GenerateRefreshToken", int64(1)).Return("newRefresh", nil)
+	repo.On("RotateRefreshToken", mock.Anything, int64(10), mock.Anything).Return(int64(0), repository.ErrRefreshTokenRotated)
+	repo.On("RevokeRefreshTokenFamily", mock.Anything, "family-1").Return(nil)
+	events.On("Publish", mock.Anything, mock.Anything).Return()
+
+	_, err := service.RefreshUserTokens(context.Background(), "oldToken")
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+	repo.AssertCalled(t, "RevokeRefreshTokenFamily", mock.Anything, "family-1")
+}
+
+func TestRefreshUserTokens_RevokedSession(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	service := NewAuthService(repo, jwt)
+
+	revokedAt := time.Now()
+	jwt.On("VerifyRefreshToken", "oldToken").Return(int64(1), nil)
+	repo.On("GetRefreshToken", mock.Anything, "oldToken").
+		Return(&model.RefreshToken{Id: 10, UserId: 1, FamilyId: "family-1", RevokedAt: &revokedAt}, nil)
+
+	_, err := service.RefreshUserTokens(context.Background(), "oldToken")
+	assert.Error(t, err)
+	repo.AssertNotCalled(t, "RevokeRefreshTokenFamily", mock.Anything, mock.Anything)
+}
+
+func TestLogout_EndsOnlyCurrentSession(t *testing.T) {
 	repo := new(MockRepo)
 	service := NewAuthService(repo, nil)
 
-	repo.On("GetRefreshToken", mock.Anything, int64(1)).Return("refreshToken", nil)
+	repo.On("GetRefreshToken", mock.Anything, "refresh").Return(&model.RefreshToken{Id: 10, UserId: 1, FamilyId: "family-1"}, nil)
+	repo.On("RevokeRefreshTokenFamily", mock.Anything, "family-1").Return(nil)
 
-	token, err := service.GetRefreshToken(context.Background(), 1)
+	err := service.Logout(context.Background(), "refresh")
 	assert.NoError(t, err)
-	assert.Equal(t, "refreshToken", token)
+	repo.AssertNotCalled(t, "RevokeUserRefreshTokens", mock.Anything, mock.Anything)
 }
 
-func TestDeleteRefreshToken_Success(t *testing.T) {
+func TestLogout_UnknownToken(t *testing.T) {
 	repo := new(MockRepo)
 	service := NewAuthService(repo, nil)
 
-	repo.On("DeleteRefreshToken", mock.Anything, int64(1)).Return(nil)
+	repo.On("GetRefreshToken", mock.Anything, "rotated").Return(nil, repository.ErrRefreshTokenNotFound)
 
-	err := service.DeleteRefreshToken(context.Background(), 1)
+	err := service.Logout(context.Background(), "rotated")
+	assert.ErrorIs(t, err, repository.ErrRefreshTokenNotFound)
+	repo.AssertNotCalled(t, "RevokeRefreshTokenFamily", mock.Anything, mock.Anything)
+
+	// Пустой токен даже не ищется в базе
+	err = service.Logout(context.Background(), "")
+	assert.ErrorIs(t, err, ErrRefreshTokenInvalid)
+}
+
+func TestLogoutAll_Success(t *testing.T) {
+	repo := new(MockRepo)
+	service := NewAuthService(repo, nil)
+
+	repo.On("RevokeUserRefreshTokens", mock.Anything, int64(1)).Return(nil)
+
+	err := service.LogoutAll(context.Background(), 1)
 	assert.NoError(t, err)
 }
+
+func TestValidateTokenForAudience(t *testing.T) {
+	jwt := new(MockJWT)
+	service := NewAuthService(nil, jwt)
+
+	jwt.On("ParseAccessToken", "access").Return(&security.Claims{UserID: 1, Audience: []string{"chat"}}, nil)
+
+	userID, err := service.ValidateTokenForAudience(context.Background(), "access", "chat")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), userID)
+
+	_, err = service.ValidateTokenForAudience(context.Background(), "access", "billing")
+	assert.Error(t, err)
+}
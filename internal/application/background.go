@@ -0,0 +1,29 @@
+package application
+
+import (
+	"context"
+	"time"
+)
+
+// backgroundTimeout bounds work that outlives the request that started it.
+const backgroundTimeout = 30 * time.Second
+
+// runInBackground runs fn after the request has been answered, for work whose
+// duration would otherwise tell the caller whether an account exists. The request
+// context is not used, it ends with the response.
+func (s *AuthService) runInBackground(fn func(ctx context.Context)) {
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), backgroundTimeout)
+		defer cancel()
+		fn(ctx)
+	}()
+}
+
+// Wait blocks until the work earlier requests left running in the background, like
+// sending emails, is done. Call it on shutdown after the servers stopped.
+func (s *AuthService) Wait() {
+	s.background.Wait()
+}
@@ -0,0 +1,51 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/danilkompaniets/auth-service/pkg/model"
+)
+
+// RegisterServiceClient stores a client for a backend service that authenticates as
+// itself with the client credentials grant. It is always confidential and can only
+// obtain the scopes given here; the secret is only ever returned here.
+func (s *AuthService) RegisterServiceClient(ctx context.Context, name string, scopes []string) (*model.OAuthClient, string, error) {
+	if name == "" {
+		return nil, "", fmt.Errorf("%w: name must not be empty", ErrInvalidOAuthClient)
+	}
+
+	return s.registerClient(ctx, model.OAuthClient{
+		Name:         name,
+		RedirectURIs: []string{},
+		Scopes:       scopes,
+		GrantTypes:   []string{GrantTypeClientCredentials},
+	}, true)
+}
+
+// exchangeClientCredentials issues an access token whose subject is the client.
+// No refresh token is issued, the client simply authenticates again (RFC 6749
+// section 4.4.3).
+func (s *AuthService) exchangeClientCredentials(client *model.OAuthClient, req TokenRequest) (*OAuthTokens, error) {
+	if client.SecretHash == "" {
+		return nil, oauthError(OAuthUnauthorizedClient, "public clients cannot use the client credentials grant")
+	}
+
+	scopes := client.Scopes
+	if req.Scope != "" {
+		scopes = strings.Fields(req.Scope)
+		for _, scope := range scopes {
+			if !contains(client.Scopes, scope) {
+				return nil, oauthError(OAuthInvalidScope, fmt.Sprintf("scope %q is not allowed for this client", scope))
+			}
+		}
+	}
+
+	accessToken, err := s.jwtManager.GenerateServiceToken(client.Id, scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.oauthTokens(&Tokens{AccessToken: accessToken}, strings.Join(scopes, " "))
+}
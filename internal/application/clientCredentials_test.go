@@ -0,0 +1,104 @@
+package application
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// registerServiceClient регистрирует сервисный клиент и настраивает мок на его чтение
+func registerServiceClient(t *testing.T, repo *MockRepo, service *AuthService) (*model.OAuthClient, string) {
+	var stored model.OAuthClient
+	repo.On("CreateOAuthClient", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		stored = args.Get(1).(model.OAuthClient)
+	}).Return(nil)
+
+	client, secret, err := service.RegisterServiceClient(context.Background(), "billing", []string{"messages:read", "users:read"})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, secret)
+	assert.Equal(t, []string{GrantTypeClientCredentials}, stored.GrantTypes)
+
+	repo.On("GetOAuthClient", mock.Anything, client.Id).Return(&stored, nil)
+	return client, secret
+}
+
+func TestExchangeClientCredentials(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	service := newOAuthService(repo, jwt)
+	client, secret := registerServiceClient(t, repo, service)
+
+	jwt.On("GenerateServiceToken", client.Id, []string{"messages:read"}).Return("service-token", nil)
+	jwt.On("ParseAccessToken", "service-token").Return(&security.Claims{ExpiresAt: time.Now().Add(time.Minute)}, nil)
+
+	tokens, err := service.ExchangeOAuthToken(context.Background(), TokenRequest{
+		GrantType:    GrantTypeClientCredentials,
+		ClientID:     client.Id,
+		ClientSecret: secret,
+		Scope:        "messages:read",
+	}, model.Device{})
+	assert.NoError(t, err)
+	assert.Equal(t, "service-token", tokens.AccessToken)
+	// Refresh-токен сервисам не выдаётся
+	assert.Empty(t, tokens.RefreshToken)
+	assert.Equal(t, "messages:read", tokens.Scope)
+
+	var oauthErr *OAuthError
+	_, err = service.ExchangeOAuthToken(context.Background(), TokenRequest{
+		GrantType:    GrantTypeClientCredentials,
+		ClientID:     client.Id,
+		ClientSecret: secret,
+		Scope:        "admin",
+	}, model.Device{})
+	assert.ErrorAs(t, err, &oauthErr)
+	assert.Equal(t, OAuthInvalidScope, oauthErr.Code)
+}
+
+func TestExchangeClientCredentials_GrantNotAllowed(t *testing.T) {
+	repo := new(MockRepo)
+	service := newOAuthService(repo, new(MockJWT))
+	client, secret := registerServiceClient(t, repo, service)
+
+	// Сервисный клиент не может пользоваться authorization code
+	var oauthErr *OAuthError
+	_, err := service.ExchangeOAuthToken(context.Background(), TokenRequest{
+		GrantType:    GrantTypeAuthorizationCode,
+		ClientID:     client.Id,
+		ClientSecret: secret,
+	}, model.Device{})
+	assert.ErrorAs(t, err, &oauthErr)
+	assert.Equal(t, OAuthUnauthorizedClient, oauthErr.Code)
+
+	// И наоборот: клиент пользовательского входа не получает токен сервиса
+	repo.On("GetOAuthClient", mock.Anything, "chat-web").Return(publicClient(), nil)
+	_, err = service.ExchangeOAuthToken(context.Background(), TokenRequest{
+		GrantType: GrantTypeClientCredentials,
+		ClientID:  "chat-web",
+	}, model.Device{})
+	assert.ErrorAs(t, err, &oauthErr)
+	assert.Equal(t, OAuthUnauthorizedClient, oauthErr.Code)
+}
+
+func TestAuthorizeToken_ServicePrincipal(t *testing.T) {
+	jwt := new(MockJWT)
+	service := NewAuthService(nil, jwt)
+
+	jwt.On("ParseAccessToken", "service-token").Return(&security.Claims{
+		Principal:     security.PrincipalService,
+		Subject:       "billing",
+		Authorization: security.Authorization{ClientID: "billing"},
+	}, nil)
+	jwt.On("ParseAccessToken", "broken").Return(&security.Claims{}, nil)
+
+	claims, err := service.AuthorizeToken(context.Background(), "service-token", "")
+	assert.NoError(t, err)
+	assert.True(t, claims.IsService())
+
+	_, err = service.AuthorizeToken(context.Background(), "broken", "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,200 @@
+package application
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/mail"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+)
+
+const PurposeEmailLogin = "email_login"
+
+// EmailLogin configures passwordless login by email.
+type EmailLogin struct {
+	// TokenTTL bounds how long the link and code in one email stay valid.
+	TokenTTL time.Duration
+	// LinkURL is the client page that posts the token back; it is added as the token
+	// query parameter.
+	LinkURL string
+	// MaxRequests emails are sent per account within RequestWindow, further requests
+	// are dropped.
+	MaxRequests   int
+	RequestWindow time.Duration
+	// MaxAttempts wrong codes are tolerated before the active code stops working.
+	MaxAttempts int
+}
+
+// WithEmailLogin lets users log in with a link or code sent to their address instead
+// of a password.
+func WithEmailLogin(mailer mail.Mailer, cfg EmailLogin) Option {
+	return func(s *AuthService) {
+		s.mailer = mailer
+		s.emailLogin = &cfg
+	}
+}
+
+// RequestEmailLogin mails a magic link and a 6-digit code, replacing any earlier
+// ones. Like ForgotPassword it returns nil for unknown addresses and does the rest in
+// the background, where requests over the limit are dropped silently, so neither the
+// response nor its timing reveals anything about the account.
+func (s *AuthService) RequestEmailLogin(ctx context.Context, email string) error {
+	if s.mailer == nil || s.emailLogin == nil {
+		return errors.New("email login is not configured")
+	}
+	if email == "" {
+		return errors.New("email must not be empty")
+	}
+
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.DisabledAt != nil {
+		return nil
+	}
+
+	s.runInBackground(func(ctx context.Context) {
+		if err := s.sendLimitedEmailLogin(ctx, user); err != nil {
+			log.Printf("failed to send login email to user %d: %v", user.Id, err)
+		}
+	})
+	return nil
+}
+
+func (s *AuthService) sendLimitedEmailLogin(ctx context.Context, user *model.User) error {
+	sent, err := s.repo.CountLoginCodesSince(ctx, user.Id, time.Now().Add(-s.emailLogin.RequestWindow))
+	if err != nil {
+		return err
+	}
+	if sent >= s.emailLogin.MaxRequests {
+		log.Printf("email login for user %d rate limited: %d codes within %s", user.Id, sent, s.emailLogin.RequestWindow)
+		return nil
+	}
+
+	return s.sendEmailLogin(ctx, user.Id, user.Email)
+}
+
+// LoginWithEmailCode exchanges the code from the login email for tokens, just like
+// LoginUser, including the second factor step.
+func (s *AuthService) LoginWithEmailCode(ctx context.Context, email, code string, device model.Device) (*Tokens, error) {
+	if s.emailLogin == nil {
+		return nil, errors.New("email login is not configured")
+	}
+	if email == "" || code == "" {
+		return nil, errors.New("email and code must not be empty")
+	}
+
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil, repository.ErrLoginCodeInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.repo.ConsumeLoginCode(ctx, user.Id, code, s.emailLogin.MaxAttempts); err != nil {
+		return nil, err
+	}
+
+	return s.finishEmailLogin(ctx, user, device)
+}
+
+// LoginWithEmailLink exchanges the token from the magic link for tokens. It uses up
+// the code sent in the same email too.
+func (s *AuthService) LoginWithEmailLink(ctx context.Context, token string, device model.Device) (*Tokens, error) {
+	if s.emailLogin == nil {
+		return nil, errors.New("email login is not configured")
+	}
+	if token == "" {
+		return nil, errors.New("token must not be empty")
+	}
+
+	claims, err := s.jwtManager.ParseActionToken(token, PurposeEmailLogin)
+	if err != nil {
+		return nil, repository.ErrLoginCodeInvalid
+	}
+	consumed, err := s.repo.ConsumeLoginLink(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if consumed.UserId != claims.UserID {
+		return nil, repository.ErrLoginCodeInvalid
+	}
+
+	user, err := s.repo.GetUserByID(ctx, consumed.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.finishEmailLogin(ctx, user, device)
+}
+
+// finishEmailLogin treats the address as verified, since the user just read a mail
+// sent to it, and then continues like a password login.
+func (s *AuthService) finishEmailLogin(ctx context.Context, user *model.User, device model.Device) (*Tokens, error) {
+	if user.DisabledAt != nil {
+		return nil, ErrUserDisabled
+	}
+	if user.EmailVerifiedAt == nil {
+		if err := s.repo.MarkEmailVerified(ctx, user.Id); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.mfaChallenge(ctx, user.Id); err != nil {
+		return nil, err
+	}
+
+	return s.startSession(ctx, user.Id, device)
+}
+
+func (s *AuthService) sendEmailLogin(ctx context.Context, userID int64, email string) error {
+	code, err := newLoginCode()
+	if err != nil {
+		return err
+	}
+
+	token, claims, err := s.jwtManager.GenerateActionToken(userID, PurposeEmailLogin, s.emailLogin.TokenTTL)
+	if err != nil {
+		return err
+	}
+	err = s.repo.CreateLoginCode(ctx, model.LoginCode{
+		UserId:    userID,
+		Jti:       claims.ID,
+		Code:      code,
+		ExpiresAt: claims.ExpiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	link, err := actionLink(s.emailLogin.LinkURL, token)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Your login code",
+		Body: fmt.Sprintf("Your login code is %s\n\nOr open the link below to log in:\n\n%s\n\n"+
+			"The code and link expire in %s. If you did not try to log in, you can ignore this email.",
+			code, link, s.emailLogin.TokenTTL),
+	})
+}
+
+func newLoginCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
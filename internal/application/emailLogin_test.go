@@ -0,0 +1,128 @@
+package application
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/mail"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var testEmailLogin = EmailLogin{
+	TokenTTL:      10 * time.Minute,
+	LinkURL:       "http://localhost/login/email",
+	MaxRequests:   3,
+	RequestWindow: 15 * time.Minute,
+	MaxAttempts:   5,
+}
+
+func TestRequestEmailLogin_SendsCodeAndLink(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	mailer := new(MockMailer)
+	service := NewAuthService(repo, jwt, WithEmailLogin(mailer, testEmailLogin))
+
+	expiresAt := time.Now().Add(10 * time.Minute)
+	var stored model.LoginCode
+	repo.On("GetUserByEmail", mock.Anything, "test@test.com").Return(&model.User{Id: 1, Email: "test@test.com"}, nil)
+	repo.On("CountLoginCodesSince", mock.Anything, int64(1), mock.Anything).Return(0, nil)
+	jwt.On("GenerateActionToken", int64(1), PurposeEmailLogin, 10*time.Minute).
+		Return("magic", &security.Claims{UserID: 1, ID: "jti-1", ExpiresAt: expiresAt}, nil)
+	repo.On("CreateLoginCode", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		stored = args.Get(1).(model.LoginCode)
+	}).Return(nil)
+	mailer.On("Send", mock.Anything, mock.MatchedBy(func(msg mail.Message) bool {
+		return msg.To == "test@test.com" &&
+			assert.Contains(t, msg.Body, "login/email?token=magic") &&
+			assert.Contains(t, msg.Body, stored.Code)
+	})).Return(nil)
+
+	assert.NoError(t, service.RequestEmailLogin(context.Background(), "test@test.com"))
+	// Письмо отправляется в фоне
+	service.Wait()
+	assert.Equal(t, "jti-1", stored.Jti)
+	assert.Equal(t, expiresAt, stored.ExpiresAt)
+	assert.Len(t, stored.Code, 6)
+	mailer.AssertExpectations(t)
+}
+
+func TestRequestEmailLogin_RateLimited(t *testing.T) {
+	repo := new(MockRepo)
+	mailer := new(MockMailer)
+	service := NewAuthService(repo, nil, WithEmailLogin(mailer, testEmailLogin))
+
+	repo.On("GetUserByEmail", mock.Anything, "test@test.com").Return(&model.User{Id: 1, Email: "test@test.com"}, nil)
+	repo.On("CountLoginCodesSince", mock.Anything, int64(1), mock.MatchedBy(func(since time.Time) bool {
+		return time.Since(since) >= 15*time.Minute
+	})).Return(3, nil)
+
+	// Лимит исчерпан: письмо не отправляется, но ответ тот же
+	assert.NoError(t, service.RequestEmailLogin(context.Background(), "test@test.com"))
+	service.Wait()
+	repo.AssertNotCalled(t, "CreateLoginCode", mock.Anything, mock.Anything)
+	mailer.AssertNotCalled(t, "Send", mock.Anything, mock.Anything)
+}
+
+func TestRequestEmailLogin_UnknownEmail(t *testing.T) {
+	repo := new(MockRepo)
+	mailer := new(MockMailer)
+	service := NewAuthService(repo, nil, WithEmailLogin(mailer, testEmailLogin))
+
+	repo.On("GetUserByEmail", mock.Anything, "ghost@test.com").Return((*model.User)(nil), repository.ErrUserNotFound)
+
+	assert.NoError(t, service.RequestEmailLogin(context.Background(), "ghost@test.com"))
+	service.Wait()
+	mailer.AssertNotCalled(t, "Send", mock.Anything, mock.Anything)
+}
+
+func TestLoginWithEmailCode(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	service := NewAuthService(repo, jwt, WithEmailLogin(new(MockMailer), testEmailLogin))
+
+	repo.On("GetUserByEmail", mock.Anything, "test@test.com").Return(&model.User{Id: 1, Email: "test@test.com"}, nil)
+	repo.On("ConsumeLoginCode", mock.Anything, int64(1), "123456", 5).Return(&model.LoginCode{UserId: 1}, nil).Once()
+	// Письмо прочитано, значит адрес подтверждён
+	repo.On("MarkEmailVerified", mock.Anything, int64(1)).Return(nil)
+	mockSession(repo, jwt)
+
+	tokens, err := service.LoginWithEmailCode(context.Background(), "test@test.com", "123456", model.Device{})
+	assert.NoError(t, err)
+	assert.Equal(t, "access", tokens.AccessToken)
+	repo.AssertCalled(t, "MarkEmailVerified", mock.Anything, int64(1))
+
+	// Повторно код не принимается
+	repo.On("ConsumeLoginCode", mock.Anything, int64(1), "123456", 5).Return(nil, repository.ErrLoginCodeInvalid)
+
+	_, err = service.LoginWithEmailCode(context.Background(), "test@test.com", "123456", model.Device{})
+	assert.ErrorIs(t, err, repository.ErrLoginCodeInvalid)
+}
+
+func TestLoginWithEmailLink(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	service := NewAuthService(repo, jwt, WithEmailLogin(new(MockMailer), testEmailLogin))
+
+	verifiedAt := time.Now()
+	jwt.On("ParseActionToken", "magic", PurposeEmailLogin).Return(&security.Claims{UserID: 1, ID: "jti-1"}, nil)
+	repo.On("ConsumeLoginLink", mock.Anything, "jti-1").Return(&model.LoginCode{UserId: 1, Jti: "jti-1"}, nil)
+	repo.On("GetUserByID", mock.Anything, int64(1)).
+		Return(&model.User{Id: 1, Email: "test@test.com", EmailVerifiedAt: &verifiedAt}, nil)
+	mockSession(repo, jwt)
+
+	tokens, err := service.LoginWithEmailLink(context.Background(), "magic", model.Device{})
+	assert.NoError(t, err)
+	assert.Equal(t, "refresh", tokens.RefreshToken)
+	repo.AssertNotCalled(t, "MarkEmailVerified", mock.Anything, mock.Anything)
+
+	// Токен другого назначения
+	jwt.On("ParseActionToken", "reset", PurposeEmailLogin).Return(nil, assert.AnError)
+
+	_, err = service.LoginWithEmailLink(context.Background(), "reset", model.Device{})
+	assert.ErrorIs(t, err, repository.ErrLoginCodeInvalid)
+}
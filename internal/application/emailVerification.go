@@ -0,0 +1,96 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/mail"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+)
+
+const PurposeEmailVerification = "email_verification"
+
+var ErrEmailNotVerified = errors.New("email address is not verified")
+
+// EmailVerification configures the links sent on registration.
+type EmailVerification struct {
+	// Required rejects logins until the address has been verified.
+	Required bool
+	TokenTTL time.Duration
+	// LinkURL is the page the link points to; the token is added as the token query parameter.
+	LinkURL string
+}
+
+// WithEmailVerification sends a verification link to every new account. Without it
+// accounts are usable right away and never verified.
+func WithEmailVerification(mailer mail.Mailer, cfg EmailVerification) Option {
+	return func(s *AuthService) {
+		s.mailer = mailer
+		s.verification = cfg
+	}
+}
+
+// VerifyEmail consumes a verification token and marks the address as verified.
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) error {
+	if token == "" {
+		return errors.New("token must not be empty")
+	}
+
+	consumed, err := s.consumeActionToken(ctx, token, PurposeEmailVerification)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.MarkEmailVerified(ctx, consumed.UserId)
+}
+
+// ResendVerificationEmail sends a fresh link. Unknown and already verified addresses
+// are silently ignored so the endpoint cannot be used to probe for accounts.
+func (s *AuthService) ResendVerificationEmail(ctx context.Context, email string) error {
+	if s.mailer == nil {
+		return errors.New("email verification is not configured")
+	}
+
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	return s.sendVerificationEmail(ctx, user.Id, user.Email)
+}
+
+// sendRegistrationVerification does not fail registration: the account already
+// exists and the user can ask for another link.
+func (s *AuthService) sendRegistrationVerification(ctx context.Context, userID int64, email string) {
+	if s.mailer == nil {
+		return
+	}
+	if err := s.sendVerificationEmail(ctx, userID, email); err != nil {
+		log.Printf("failed to send verification email to user %d: %v", userID, err)
+	}
+}
+
+func (s *AuthService) sendVerificationEmail(ctx context.Context, userID int64, email string) error {
+	link, err := s.issueActionLink(ctx, model.ActionToken{UserId: userID, Purpose: PurposeEmailVerification},
+		s.verification.TokenTTL, s.verification.LinkURL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Open the link below to confirm your email address:\n\n%s\n\nThe link expires in %s.",
+			link, s.verification.TokenTTL),
+	})
+}
@@ -0,0 +1,118 @@
+package application
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/mail"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type MockMailer struct {
+	mock.Mock
+}
+
+func (m *MockMailer) Send(ctx context.Context, msg mail.Message) error {
+	args := m.Called(ctx, msg)
+	return args.Error(0)
+}
+
+var testVerification = EmailVerification{
+	Required: true,
+	TokenTTL: time.Hour,
+	LinkURL:  "http://localhost/api/v1/auth/verify-email",
+}
+
+func TestCreateUser_SendsVerificationEmail(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	mailer := new(MockMailer)
+	service := NewAuthService(repo, jwt, WithEmailVerification(mailer, testVerification))
+
+	expiresAt := time.Now().Add(time.Hour)
+	repo.On("CreateUser", mock.Anything, mock.Anything).Return(int64(1), nil)
+	jwt.On("GenerateActionToken", int64(1), PurposeEmailVerification, time.Hour).
+		Return("verify", &security.Claims{UserID: 1, ID: "jti-1", ExpiresAt: expiresAt}, nil)
+	repo.On("CreateActionToken", mock.Anything, model.ActionToken{
+		Jti:       "jti-1",
+		UserId:    1,
+		Purpose:   PurposeEmailVerification,
+		ExpiresAt: expiresAt,
+	}).Return(nil)
+	mailer.On("Send", mock.Anything, mock.MatchedBy(func(msg mail.Message) bool {
+		return msg.To == "test@test.com" && assert.Contains(t, msg.Body, "verify-email?token=verify")
+	})).Return(nil)
+
+	id, err := service.CreateUser(context.Background(), model.User{Email: "test@test.com", Password: "123456"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), id)
+	mailer.AssertExpectations(t)
+}
+
+func TestCreateUser_VerifiedSkipsVerificationEmail(t *testing.T) {
+	repo := new(MockRepo)
+	mailer := new(MockMailer)
+	service := NewAuthService(repo, new(MockJWT), WithEmailVerification(mailer, testVerification))
+
+	verifiedAt := time.Now()
+	repo.On("CreateUser", mock.Anything, mock.MatchedBy(func(u model.User) bool {
+		return u.EmailVerifiedAt == &verifiedAt
+	})).Return(int64(1), nil)
+
+	// Адрес уже подтверждён оператором, письмо не нужно
+	_, err := service.CreateUser(context.Background(), model.User{Email: "test@test.com", Password: "123456", EmailVerifiedAt: &verifiedAt})
+	assert.NoError(t, err)
+	mailer.AssertNotCalled(t, "Send", mock.Anything, mock.Anything)
+	repo.AssertNotCalled(t, "CreateActionToken", mock.Anything, mock.Anything)
+}
+
+func TestLoginUser_UnverifiedEmail(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	service := NewAuthService(repo, jwt, WithEmailVerification(new(MockMailer), testVerification))
+
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.DefaultCost)
+	repo.On("GetUserByEmail", mock.Anything, "test@test.com").
+		Return(&model.User{Id: 1, Email: "test@test.com", Password: string(hashedPassword)}, nil)
+
+	_, err := service.LoginUser(context.Background(), model.User{Email: "test@test.com", Password: "123456"}, model.Device{})
+	assert.ErrorIs(t, err, ErrEmailNotVerified)
+	jwt.AssertNotCalled(t, "GenerateAccessToken", mock.Anything, mock.Anything)
+}
+
+func TestVerifyEmail(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	service := NewAuthService(repo, jwt)
+
+	jwt.On("ParseActionToken", "verify", PurposeEmailVerification).Return(&security.Claims{UserID: 1, ID: "jti-1"}, nil)
+	repo.On("ConsumeActionToken", mock.Anything, "jti-1", PurposeEmailVerification).
+		Return(&model.ActionToken{Jti: "jti-1", UserId: 1}, nil).Once()
+	repo.On("MarkEmailVerified", mock.Anything, int64(1)).Return(nil)
+
+	assert.NoError(t, service.VerifyEmail(context.Background(), "verify"))
+
+	// Повторное использование токена
+	repo.On("ConsumeActionToken", mock.Anything, "jti-1", PurposeEmailVerification).
+		Return(nil, repository.ErrActionTokenInvalid)
+
+	assert.ErrorIs(t, service.VerifyEmail(context.Background(), "verify"), repository.ErrActionTokenInvalid)
+	repo.AssertNumberOfCalls(t, "MarkEmailVerified", 1)
+}
+
+func TestResendVerificationEmail_UnknownUser(t *testing.T) {
+	repo := new(MockRepo)
+	mailer := new(MockMailer)
+	service := NewAuthService(repo, nil, WithEmailVerification(mailer, testVerification))
+
+	repo.On("GetUserByEmail", mock.Anything, "ghost@test.com").Return((*model.User)(nil), repository.ErrUserNotFound)
+
+	assert.NoError(t, service.ResendVerificationEmail(context.Background(), "ghost@test.com"))
+	mailer.AssertNotCalled(t, "Send", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,289 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/federation"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+)
+
+var (
+	ErrFederationDisabled       = errors.New("federated login is not configured")
+	ErrUnknownProvider          = errors.New("unknown identity provider")
+	ErrIdentityLinkRequired     = errors.New("an account with this email already exists, log in and link the provider to it")
+	ErrFederatedSignupDisabled  = errors.New("signing up through this identity provider is disabled")
+	ErrFederatedEmailUnverified = errors.New("identity provider did not verify the email address")
+	ErrLastLoginMethod          = errors.New("cannot unlink the only way to log in, set a password first")
+)
+
+// Federation lets users log in with upstream identity providers.
+type Federation struct {
+	// StateTTL bounds the time between starting a login and the provider's callback.
+	StateTTL time.Duration
+	// Providers are keyed by the name used in URLs and stored with each identity.
+	Providers map[string]FederatedProvider
+}
+
+// FederatedProvider decides what a provider's login may do besides logging in users
+// that already linked it.
+type FederatedProvider struct {
+	Provider federation.Provider
+	// AllowSignup creates an account for a verified email that is not registered yet.
+	AllowSignup bool
+	// LinkByEmail links the provider to the existing account with the same email, if
+	// both the provider and we verified it. Only enable it for providers that own the
+	// email domains they vouch for; otherwise users link explicitly after logging in.
+	LinkByEmail bool
+}
+
+func WithFederation(cfg Federation) Option {
+	return func(s *AuthService) {
+		s.federation = &cfg
+	}
+}
+
+// FederatedRedirect starts a login at a provider. The client keeps State, sends the
+// browser to URL and posts code and state of the callback back, after checking the
+// state matches the one it kept.
+type FederatedRedirect struct {
+	URL   string `json:"url"`
+	State string `json:"state"`
+}
+
+// FederationProviders lists the names of the configured providers.
+func (s *AuthService) FederationProviders() []string {
+	if s.federation == nil {
+		return []string{}
+	}
+	names := make([]string, 0, len(s.federation.Providers))
+	for name := range s.federation.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// BeginFederatedLogin starts logging in or signing up with the named provider.
+func (s *AuthService) BeginFederatedLogin(ctx context.Context, provider string) (*FederatedRedirect, error) {
+	return s.beginFederation(ctx, provider, 0)
+}
+
+// CompleteFederatedLogin redeems the provider's callback for tokens. The account is
+// found by the provider's subject; an unknown subject is linked to the account with
+// the same email or signs up a new one, as far as the provider's settings allow. Like
+// LoginUser it demands the second factor of users that enabled one.
+func (s *AuthService) CompleteFederatedLogin(ctx context.Context, state, code string, device model.Device) (*Tokens, error) {
+	login, provider, identity, err := s.completeFederation(ctx, state, code)
+	if err != nil {
+		return nil, err
+	}
+	// A state started for linking must not log anybody in.
+	if login.UserId != 0 {
+		return nil, repository.ErrFederatedLoginInvalid
+	}
+
+	user, err := s.federatedUser(ctx, login.Provider, provider, identity)
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, ErrUserDisabled
+	}
+	if s.verification.Required && user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+	if err := s.mfaChallenge(ctx, user.Id); err != nil {
+		return nil, err
+	}
+
+	return s.startSession(ctx, user.Id, device)
+}
+
+// BeginIdentityLink starts linking the named provider to a logged in user.
+func (s *AuthService) BeginIdentityLink(ctx context.Context, userID int64, provider string) (*FederatedRedirect, error) {
+	if userID == 0 {
+		return nil, errors.New("user id must not be empty")
+	}
+	return s.beginFederation(ctx, provider, userID)
+}
+
+// CompleteIdentityLink links the account the user logged in with at the provider. It
+// returns ErrIdentityExists when that account is linked to any user already, or the
+// user has another account at the provider linked.
+func (s *AuthService) CompleteIdentityLink(ctx context.Context, userID int64, state, code string) (*model.Identity, error) {
+	login, _, identity, err := s.completeFederation(ctx, state, code)
+	if err != nil {
+		return nil, err
+	}
+	if login.UserId == 0 || login.UserId != userID {
+		return nil, repository.ErrFederatedLoginInvalid
+	}
+
+	linked := model.Identity{
+		UserId:   userID,
+		Provider: login.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}
+	linked.Id, err = s.repo.CreateIdentity(ctx, linked)
+	if err != nil {
+		return nil, err
+	}
+	linked.CreatedAt = time.Now().UTC()
+
+	return &linked, nil
+}
+
+func (s *AuthService) ListIdentities(ctx context.Context, userID int64) ([]model.Identity, error) {
+	return s.repo.ListIdentities(ctx, userID)
+}
+
+// UnlinkIdentity removes a linked provider. Users without a password keep their last
+// provider unless they can log in by email instead.
+func (s *AuthService) UnlinkIdentity(ctx context.Context, userID, id int64) error {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.Password == "" && s.emailLogin == nil {
+		identities, err := s.repo.ListIdentities(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if len(identities) <= 1 {
+			return ErrLastLoginMethod
+		}
+	}
+
+	return s.repo.DeleteIdentity(ctx, userID, id)
+}
+
+func (s *AuthService) beginFederation(ctx context.Context, name string, userID int64) (*FederatedRedirect, error) {
+	provider, err := s.federatedProvider(name)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := newOAuthToken(32)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := newOAuthToken(32)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := newOAuthToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := provider.Provider.AuthCodeURL(ctx, state, pkceChallenge(verifier), nonce)
+	if err != nil {
+		return nil, err
+	}
+	err = s.repo.CreateFederatedLogin(ctx, model.FederatedLogin{
+		State:        state,
+		Provider:     name,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		UserId:       userID,
+		ExpiresAt:    time.Now().UTC().Add(s.federation.StateTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &FederatedRedirect{URL: url, State: state}, nil
+}
+
+// completeFederation uses up the state and redeems the code at the provider the
+// login was started with.
+func (s *AuthService) completeFederation(ctx context.Context, state, code string) (*model.FederatedLogin, *FederatedProvider, *federation.Identity, error) {
+	if s.federation == nil {
+		return nil, nil, nil, ErrFederationDisabled
+	}
+	if state == "" || code == "" {
+		return nil, nil, nil, errors.New("state and code must not be empty")
+	}
+
+	login, err := s.repo.ConsumeFederatedLogin(ctx, state)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	provider, err := s.federatedProvider(login.Provider)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	identity, err := provider.Provider.Exchange(ctx, code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return login, provider, identity, nil
+}
+
+// federatedUser finds or creates the account of an upstream identity.
+func (s *AuthService) federatedUser(ctx context.Context, name string, provider *FederatedProvider, identity *federation.Identity) (*model.User, error) {
+	linked, err := s.repo.GetIdentity(ctx, name, identity.Subject)
+	if err == nil {
+		if err := s.repo.RecordIdentityLogin(ctx, linked.Id, identity.Email); err != nil {
+			log.Printf("failed to record login of identity %d: %v", linked.Id, err)
+		}
+		return s.repo.GetUserByID(ctx, linked.UserId)
+	}
+	if !errors.Is(err, repository.ErrIdentityNotFound) {
+		return nil, err
+	}
+
+	// Anything beyond a known subject relies on the email, so the provider must vouch for it.
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, ErrFederatedEmailUnverified
+	}
+	newIdentity := model.Identity{Provider: name, Subject: identity.Subject, Email: identity.Email}
+
+	user, err := s.repo.GetUserByEmail(ctx, identity.Email)
+	if err == nil {
+		// The local address must be verified too, or whoever registered it first
+		// without owning it would get the provider's account linked to theirs.
+		if !provider.LinkByEmail || user.EmailVerifiedAt == nil {
+			return nil, ErrIdentityLinkRequired
+		}
+		newIdentity.UserId = user.Id
+		if _, err := s.repo.CreateIdentity(ctx, newIdentity); err != nil {
+			return nil, err
+		}
+		log.Printf("identity provider %s linked to user %d by verified email", name, user.Id)
+		return user, nil
+	}
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		return nil, err
+	}
+
+	if !provider.AllowSignup {
+		return nil, ErrFederatedSignupDisabled
+	}
+	now := time.Now().UTC()
+	user = &model.User{Email: identity.Email, EmailVerifiedAt: &now, CreatedAt: now, UpdatedAt: now}
+	user.Id, err = s.repo.CreateUserWithIdentity(ctx, *user, newIdentity)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *AuthService) federatedProvider(name string) (*FederatedProvider, error) {
+	if s.federation == nil {
+		return nil, ErrFederationDisabled
+	}
+	provider, ok := s.federation.Providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return &provider, nil
+}
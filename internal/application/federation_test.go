@@ -0,0 +1,259 @@
+package application
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/federation"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockProvider struct {
+	mock.Mock
+}
+
+func (m *MockProvider) AuthCodeURL(ctx context.Context, state, codeChallenge, nonce string) (string, error) {
+	args := m.Called(ctx, state, codeChallenge, nonce)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*federation.Identity, error) {
+	args := m.Called(ctx, code, codeVerifier, nonce)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*federation.Identity), args.Error(1)
+}
+
+func newFederationService(repo *MockRepo, jwt *MockJWT, provider *MockProvider, allowSignup, linkByEmail bool) *AuthService {
+	return NewAuthService(repo, jwt, WithFederation(Federation{
+		StateTTL: 10 * time.Minute,
+		Providers: map[string]FederatedProvider{
+			"google": {Provider: provider, AllowSignup: allowSignup, LinkByEmail: linkByEmail},
+		},
+	}))
+}
+
+// mockCallback подставляет сохранённый вход и ответ провайдера для state "state-1"
+func mockCallback(repo *MockRepo, provider *MockProvider, userID int64, identity *federation.Identity) {
+	repo.On("ConsumeFederatedLogin", mock.Anything, "state-1").Return(&model.FederatedLogin{
+		State: "state-1", Provider: "google", CodeVerifier: "verifier", Nonce: "nonce", UserId: userID,
+	}, nil).Once()
+	provider.On("Exchange", mock.Anything, "code", "verifier", "nonce").Return(identity, nil).Once()
+}
+
+var testIdentity = &federation.Identity{Subject: "upstream-1", Email: "test@test.com", EmailVerified: true}
+
+func TestBeginFederatedLogin(t *testing.T) {
+	repo := new(MockRepo)
+	provider := new(MockProvider)
+	service := newFederationService(repo, nil, provider, false, false)
+
+	var stored model.FederatedLogin
+	var challenge, nonce string
+	provider.On("AuthCodeURL", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		challenge, nonce = args.String(2), args.String(3)
+	}).Return("https://accounts.example.com/authorize", nil)
+	repo.On("CreateFederatedLogin", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		stored = args.Get(1).(model.FederatedLogin)
+	}).Return(nil)
+
+	redirect, err := service.BeginFederatedLogin(context.Background(), "google")
+	require.NoError(t, err)
+	assert.Equal(t, "https://accounts.example.com/authorize", redirect.URL)
+	assert.Equal(t, redirect.State, stored.State)
+	assert.Equal(t, "google", stored.Provider)
+	assert.Equal(t, int64(0), stored.UserId)
+	assert.Equal(t, nonce, stored.Nonce)
+	// Провайдер получает только производную от verifier
+	assert.True(t, verifyPKCE(challenge, stored.CodeVerifier))
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), stored.ExpiresAt, time.Minute)
+
+	_, err = service.BeginFederatedLogin(context.Background(), "facebook")
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+}
+
+func TestCompleteFederatedLogin_LinkedIdentity(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	provider := new(MockProvider)
+	service := newFederationService(repo, jwt, provider, false, false)
+
+	mockCallback(repo, provider, 0, testIdentity)
+	repo.On("GetIdentity", mock.Anything, "google", "upstream-1").Return(&model.Identity{Id: 3, UserId: 1}, nil)
+	repo.On("RecordIdentityLogin", mock.Anything, int64(3), "test@test.com").Return(nil)
+	repo.On("GetUserByID", mock.Anything, int64(1)).Return(&model.User{Id: 1, Email: "other@test.com"}, nil)
+	mockSession(repo, jwt)
+
+	tokens, err := service.CompleteFederatedLogin(context.Background(), "state-1", "code", model.Device{})
+	require.NoError(t, err)
+	assert.Equal(t, "access", tokens.AccessToken)
+	repo.AssertCalled(t, "RecordIdentityLogin", mock.Anything, int64(3), "test@test.com")
+
+	// Повторное использование state
+	repo.On("ConsumeFederatedLogin", mock.Anything, "state-1").Return(nil, repository.ErrFederatedLoginInvalid)
+
+	_, err = service.CompleteFederatedLogin(context.Background(), "state-1", "code", model.Device{})
+	assert.ErrorIs(t, err, repository.ErrFederatedLoginInvalid)
+}
+
+func TestCompleteFederatedLogin_DisabledUser(t *testing.T) {
+	repo := new(MockRepo)
+	provider := new(MockProvider)
+	service := newFederationService(repo, nil, provider, false, false)
+
+	disabledAt := time.Now()
+	mockCallback(repo, provider, 0, testIdentity)
+	repo.On("GetIdentity", mock.Anything, "google", "upstream-1").Return(&model.Identity{Id: 3, UserId: 1}, nil)
+	repo.On("RecordIdentityLogin", mock.Anything, int64(3), "test@test.com").Return(nil)
+	repo.On("GetUserByID", mock.Anything, int64(1)).Return(&model.User{Id: 1, DisabledAt: &disabledAt}, nil)
+
+	_, err := service.CompleteFederatedLogin(context.Background(), "state-1", "code", model.Device{})
+	assert.ErrorIs(t, err, ErrUserDisabled)
+}
+
+func TestCompleteFederatedLogin_ExistingEmail(t *testing.T) {
+	verifiedAt := time.Now()
+	cases := map[string]struct {
+		linkByEmail bool
+		identity    *federation.Identity
+		user        *model.User
+		err         error
+	}{
+		// Связывание по email выключено для провайдера
+		"link disabled": {false, testIdentity, &model.User{Id: 1, Email: "test@test.com", EmailVerifiedAt: &verifiedAt}, ErrIdentityLinkRequired},
+		// Локальный адрес не подтверждён: его мог занять кто угодно
+		"local unverified": {true, testIdentity, &model.User{Id: 1, Email: "test@test.com"}, ErrIdentityLinkRequired},
+		// Провайдер не подтвердил адрес
+		"upstream unverified": {true, &federation.Identity{Subject: "upstream-1", Email: "test@test.com"},
+			&model.User{Id: 1, Email: "test@test.com", EmailVerifiedAt: &verifiedAt}, ErrFederatedEmailUnverified},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			repo := new(MockRepo)
+			provider := new(MockProvider)
+			service := newFederationService(repo, nil, provider, true, tc.linkByEmail)
+
+			mockCallback(repo, provider, 0, tc.identity)
+			repo.On("GetIdentity", mock.Anything, "google", "upstream-1").Return(nil, repository.ErrIdentityNotFound)
+			repo.On("GetUserByEmail", mock.Anything, "test@test.com").Return(tc.user, nil)
+
+			_, err := service.CompleteFederatedLogin(context.Background(), "state-1", "code", model.Device{})
+			assert.ErrorIs(t, err, tc.err)
+			repo.AssertNotCalled(t, "CreateIdentity", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestCompleteFederatedLogin_LinksByEmail(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	provider := new(MockProvider)
+	service := newFederationService(repo, jwt, provider, false, true)
+
+	verifiedAt := time.Now()
+	mockCallback(repo, provider, 0, testIdentity)
+	repo.On("GetIdentity", mock.Anything, "google", "upstream-1").Return(nil, repository.ErrIdentityNotFound)
+	repo.On("GetUserByEmail", mock.Anything, "test@test.com").
+		Return(&model.User{Id: 1, Email: "test@test.com", EmailVerifiedAt: &verifiedAt}, nil)
+	repo.On("CreateIdentity", mock.Anything, model.Identity{UserId: 1, Provider: "google", Subject: "upstream-1", Email: "test@test.com"}).
+		Return(int64(3), nil)
+	mockSession(repo, jwt)
+
+	tokens, err := service.CompleteFederatedLogin(context.Background(), "state-1", "code", model.Device{})
+	require.NoError(t, err)
+	assert.Equal(t, "refresh", tokens.RefreshToken)
+}
+
+func TestCompleteFederatedLogin_Signup(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	provider := new(MockProvider)
+	service := newFederationService(repo, jwt, provider, true, false)
+
+	mockCallback(repo, provider, 0, testIdentity)
+	repo.On("GetIdentity", mock.Anything, "google", "upstream-1").Return(nil, repository.ErrIdentityNotFound)
+	repo.On("GetUserByEmail", mock.Anything, "test@test.com").Return((*model.User)(nil), repository.ErrUserNotFound)
+	// Аккаунт создаётся без пароля и с подтверждённым адресом
+	repo.On("CreateUserWithIdentity", mock.Anything, mock.MatchedBy(func(u model.User) bool {
+		return u.Email == "test@test.com" && u.Password == "" && u.EmailVerifiedAt != nil
+	}), model.Identity{Provider: "google", Subject: "upstream-1", Email: "test@test.com"}).Return(int64(1), nil)
+	mockSession(repo, jwt)
+
+	tokens, err := service.CompleteFederatedLogin(context.Background(), "state-1", "code", model.Device{})
+	require.NoError(t, err)
+	assert.Equal(t, "access", tokens.AccessToken)
+}
+
+func TestCompleteFederatedLogin_SignupDisabled(t *testing.T) {
+	repo := new(MockRepo)
+	provider := new(MockProvider)
+	service := newFederationService(repo, nil, provider, false, false)
+
+	mockCallback(repo, provider, 0, testIdentity)
+	repo.On("GetIdentity", mock.Anything, "google", "upstream-1").Return(nil, repository.ErrIdentityNotFound)
+	repo.On("GetUserByEmail", mock.Anything, "test@test.com").Return((*model.User)(nil), repository.ErrUserNotFound)
+
+	_, err := service.CompleteFederatedLogin(context.Background(), "state-1", "code", model.Device{})
+	assert.ErrorIs(t, err, ErrFederatedSignupDisabled)
+}
+
+func TestCompleteIdentityLink(t *testing.T) {
+	repo := new(MockRepo)
+	provider := new(MockProvider)
+	service := newFederationService(repo, nil, provider, false, false)
+
+	mockCallback(repo, provider, 1, testIdentity)
+	repo.On("CreateIdentity", mock.Anything, model.Identity{UserId: 1, Provider: "google", Subject: "upstream-1", Email: "test@test.com"}).
+		Return(int64(3), nil)
+
+	identity, err := service.CompleteIdentityLink(context.Background(), 1, "state-1", "code")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), identity.Id)
+
+	// State привязки другого пользователя
+	mockCallback(repo, provider, 2, testIdentity)
+
+	_, err = service.CompleteIdentityLink(context.Background(), 1, "state-1", "code")
+	assert.ErrorIs(t, err, repository.ErrFederatedLoginInvalid)
+
+	// State привязки не годится для входа
+	mockCallback(repo, provider, 1, testIdentity)
+
+	_, err = service.CompleteFederatedLogin(context.Background(), "state-1", "code", model.Device{})
+	assert.ErrorIs(t, err, repository.ErrFederatedLoginInvalid)
+}
+
+func TestUnlinkIdentity_LastLoginMethod(t *testing.T) {
+	repo := new(MockRepo)
+	service := newFederationService(repo, nil, new(MockProvider), false, false)
+
+	// Пароля нет, привязка единственная
+	repo.On("GetUserByID", mock.Anything, int64(1)).Return(&model.User{Id: 1}, nil)
+	repo.On("ListIdentities", mock.Anything, int64(1)).Return([]model.Identity{{Id: 3, UserId: 1}}, nil)
+
+	assert.ErrorIs(t, service.UnlinkIdentity(context.Background(), 1, 3), ErrLastLoginMethod)
+	repo.AssertNotCalled(t, "DeleteIdentity", mock.Anything, mock.Anything, mock.Anything)
+
+	// С паролем привязку можно удалить
+	repo.On("GetUserByID", mock.Anything, int64(2)).Return(&model.User{Id: 2, Password: "hash"}, nil)
+	repo.On("DeleteIdentity", mock.Anything, int64(2), int64(4)).Return(nil)
+
+	assert.NoError(t, service.UnlinkIdentity(context.Background(), 2, 4))
+}
+
+func TestLoginUser_NoPassword(t *testing.T) {
+	repo := new(MockRepo)
+	service := NewAuthService(repo, nil)
+
+	// Аккаунт создан через провайдера и не имеет пароля
+	repo.On("GetUserByEmail", mock.Anything, "test@test.com").Return(&model.User{Id: 1, Email: "test@test.com"}, nil)
+
+	_, err := service.LoginUser(context.Background(), model.User{Email: "test@test.com", Password: "anything"}, model.Device{})
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
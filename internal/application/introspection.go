@@ -0,0 +1,193 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+)
+
+// Token type hints of RFC 7009 section 2.1, also used by RFC 7662.
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
+)
+
+// OAuthUnsupportedTokenType is the RFC 7009 error for tokens the server cannot revoke.
+const OAuthUnsupportedTokenType = "unsupported_token_type"
+
+// ClientTokenRequest holds the parameters of introspection and revocation requests.
+type ClientTokenRequest struct {
+	ClientID      string
+	ClientSecret  string
+	Token         string
+	TokenTypeHint string
+}
+
+// Introspection is the RFC 7662 section 2.2 response. Inactive tokens only report
+// Active, so nothing is disclosed about tokens that are invalid, expired or revoked.
+type Introspection struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	TokenType string   `json:"token_type,omitempty"`
+	Exp       int64    `json:"exp,omitempty"`
+	Iat       int64    `json:"iat,omitempty"`
+	Nbf       int64    `json:"nbf,omitempty"`
+	Sub       string   `json:"sub,omitempty"`
+	Aud       []string `json:"aud,omitempty"`
+	Iss       string   `json:"iss,omitempty"`
+	Jti       string   `json:"jti,omitempty"`
+	// PrincipalType tells users from service clients, like the gRPC ValidateToken does.
+	PrincipalType string `json:"principal_type,omitempty"`
+}
+
+// IntrospectToken serves the RFC 7662 introspection endpoint. Only confidential
+// clients may call it. Access tokens of any client are described to them, since
+// that is what resource servers and gateways need; refresh tokens are only
+// described to the client they were issued to.
+func (s *AuthService) IntrospectToken(ctx context.Context, req ClientTokenRequest) (*Introspection, error) {
+	if s.oauth == nil {
+		return nil, ErrOAuthDisabled
+	}
+
+	client, err := s.authenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+	if client.SecretHash == "" {
+		return nil, oauthError(OAuthUnauthorizedClient, "only confidential clients may introspect tokens")
+	}
+	if req.Token == "" {
+		return nil, oauthError(OAuthInvalidRequest, "token is required")
+	}
+
+	// The hint only decides which lookup runs first (RFC 7662 section 2.1).
+	lookups := []func(context.Context, *model.OAuthClient, string) (*Introspection, error){
+		s.introspectAccessToken, s.introspectRefreshToken,
+	}
+	if req.TokenTypeHint == TokenTypeHintRefreshToken {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+	for _, lookup := range lookups {
+		if result, err := lookup(ctx, client, req.Token); result != nil || err != nil {
+			return result, err
+		}
+	}
+
+	return &Introspection{}, nil
+}
+
+// introspectAccessToken returns nil unless the token is an active access token.
+func (s *AuthService) introspectAccessToken(ctx context.Context, _ *model.OAuthClient, token string) (*Introspection, error) {
+	claims, err := s.AuthorizeToken(ctx, token, "")
+	if err != nil {
+		return nil, nil
+	}
+
+	result := introspection(claims, TokenTypeHintAccessToken)
+	result.Scope = strings.Join(claims.Scopes, " ")
+	result.ClientID = claims.ClientID
+	return result, nil
+}
+
+// introspectRefreshToken returns nil unless the token is a live refresh token of
+// client. The signature alone says nothing about rotation or logout, so the
+// session is looked up as well.
+func (s *AuthService) introspectRefreshToken(ctx context.Context, client *model.OAuthClient, token string) (*Introspection, error) {
+	claims, err := s.jwtManager.ParseRefreshToken(token)
+	if err != nil {
+		return nil, nil
+	}
+
+	current, err := s.repo.GetRefreshToken(ctx, token)
+	if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if current.UserId != claims.UserID || current.ClientId != client.Id ||
+		current.RotatedAt != nil || current.RevokedAt != nil {
+		return nil, nil
+	}
+
+	result := introspection(claims, TokenTypeHintRefreshToken)
+	result.Scope = current.Scope
+	result.ClientID = current.ClientId
+	return result, nil
+}
+
+func introspection(claims *security.Claims, tokenType string) *Introspection {
+	result := &Introspection{
+		Active:        true,
+		TokenType:     tokenType,
+		Exp:           claims.ExpiresAt.Unix(),
+		Iat:           claims.IssuedAt.Unix(),
+		Sub:           claims.Subject,
+		Aud:           claims.Audience,
+		Iss:           claims.Issuer,
+		Jti:           claims.ID,
+		PrincipalType: claims.Principal,
+	}
+	if result.Sub == "" && claims.UserID != 0 {
+		result.Sub = strconv.FormatInt(claims.UserID, 10)
+	}
+	if !claims.NotBefore.IsZero() {
+		result.Nbf = claims.NotBefore.Unix()
+	}
+	return result
+}
+
+// RevokeOAuthToken serves the RFC 7009 revocation endpoint. Clients can only revoke
+// tokens issued to them; revoking a refresh token ends its whole session. Tokens
+// that are invalid or already expired are not an error, as the RFC requires.
+func (s *AuthService) RevokeOAuthToken(ctx context.Context, req ClientTokenRequest) error {
+	if s.oauth == nil {
+		return ErrOAuthDisabled
+	}
+
+	client, err := s.authenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return err
+	}
+	if req.Token == "" {
+		return oauthError(OAuthInvalidRequest, "token is required")
+	}
+
+	if _, err := s.jwtManager.ParseRefreshToken(req.Token); err == nil {
+		return s.revokeOAuthRefreshToken(ctx, client, req.Token)
+	}
+
+	claims, err := s.jwtManager.ParseAccessToken(req.Token)
+	if err != nil {
+		return nil
+	}
+	if claims.ClientID != client.Id {
+		return oauthError(OAuthUnauthorizedClient, "the token was issued to another client")
+	}
+	if s.revocations == nil || claims.ID == "" {
+		return oauthError(OAuthUnsupportedTokenType, "access tokens cannot be revoked, they expire on their own")
+	}
+
+	return s.revocations.RevokeToken(ctx, claims)
+}
+
+func (s *AuthService) revokeOAuthRefreshToken(ctx context.Context, client *model.OAuthClient, token string) error {
+	current, err := s.repo.GetRefreshToken(ctx, token)
+	if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if current.ClientId != client.Id {
+		return oauthError(OAuthUnauthorizedClient, "the token was issued to another client")
+	}
+
+	return s.repo.RevokeRefreshTokenFamily(ctx, current.FamilyId)
+}
@@ -0,0 +1,161 @@
+package application
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestIntrospectToken(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	service := newOAuthService(repo, jwt)
+	gateway, secret := registerServiceClient(t, repo, service)
+
+	expiresAt := time.Now().Add(time.Minute).Truncate(time.Second)
+	jwt.On("ParseAccessToken", "access").Return(&security.Claims{
+		UserID:        1,
+		Principal:     security.PrincipalUser,
+		ID:            "jti-1",
+		Subject:       "1",
+		ExpiresAt:     expiresAt,
+		Authorization: security.Authorization{ClientID: "chat-web", Scopes: []string{"chat"}},
+	}, nil)
+	jwt.On("ParseAccessToken", "garbage").Return(nil, assert.AnError)
+	jwt.On("ParseRefreshToken", "garbage").Return(nil, assert.AnError)
+
+	// Шлюз видит access токены любых клиентов
+	result, err := service.IntrospectToken(context.Background(), ClientTokenRequest{
+		ClientID: gateway.Id, ClientSecret: secret, Token: "access",
+	})
+	assert.NoError(t, err)
+	assert.True(t, result.Active)
+	assert.Equal(t, "1", result.Sub)
+	assert.Equal(t, "chat", result.Scope)
+	assert.Equal(t, "chat-web", result.ClientID)
+	assert.Equal(t, expiresAt.Unix(), result.Exp)
+
+	// О невалидном токене ничего не сообщается
+	result, err = service.IntrospectToken(context.Background(), ClientTokenRequest{
+		ClientID: gateway.Id, ClientSecret: secret, Token: "garbage", TokenTypeHint: TokenTypeHintRefreshToken,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &Introspection{}, result)
+
+	// Без секрета клиент не аутентифицирован
+	var oauthErr *OAuthError
+	_, err = service.IntrospectToken(context.Background(), ClientTokenRequest{ClientID: gateway.Id, Token: "access"})
+	assert.ErrorAs(t, err, &oauthErr)
+	assert.Equal(t, OAuthInvalidClient, oauthErr.Code)
+}
+
+func TestIntrospectToken_PublicClient(t *testing.T) {
+	repo := new(MockRepo)
+	service := newOAuthService(repo, new(MockJWT))
+	repo.On("GetOAuthClient", mock.Anything, "chat-web").Return(publicClient(), nil)
+
+	var oauthErr *OAuthError
+	_, err := service.IntrospectToken(context.Background(), ClientTokenRequest{ClientID: "chat-web", Token: "access"})
+	assert.ErrorAs(t, err, &oauthErr)
+	assert.Equal(t, OAuthUnauthorizedClient, oauthErr.Code)
+}
+
+func TestIntrospectToken_RefreshToken(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	service := newOAuthService(repo, jwt)
+	client, secret := registerServiceClient(t, repo, service)
+
+	jwt.On("ParseRefreshToken", mock.Anything).Return(&security.Claims{UserID: 1, Principal: security.PrincipalUser}, nil)
+	repo.On("GetRefreshToken", mock.Anything, "own").
+		Return(&model.RefreshToken{UserId: 1, ClientId: client.Id, Scope: "users:read"}, nil)
+	repo.On("GetRefreshToken", mock.Anything, "foreign").
+		Return(&model.RefreshToken{UserId: 1, ClientId: "chat-web"}, nil)
+	rotatedAt := time.Now()
+	repo.On("GetRefreshToken", mock.Anything, "rotated").
+		Return(&model.RefreshToken{UserId: 1, ClientId: client.Id, RotatedAt: &rotatedAt}, nil)
+	repo.On("GetRefreshToken", mock.Anything, "unknown").Return(nil, repository.ErrRefreshTokenNotFound)
+
+	result, err := service.IntrospectToken(context.Background(), ClientTokenRequest{
+		ClientID: client.Id, ClientSecret: secret, Token: "own", TokenTypeHint: TokenTypeHintRefreshToken,
+	})
+	assert.NoError(t, err)
+	assert.True(t, result.Active)
+	assert.Equal(t, TokenTypeHintRefreshToken, result.TokenType)
+	assert.Equal(t, "1", result.Sub)
+	assert.Equal(t, "users:read", result.Scope)
+
+	// Чужие, уже ротированные и неизвестные refresh токены неактивны
+	jwt.On("ParseAccessToken", mock.Anything).Return(nil, assert.AnError)
+	for _, token := range []string{"foreign", "rotated", "unknown"} {
+		result, err = service.IntrospectToken(context.Background(), ClientTokenRequest{
+			ClientID: client.Id, ClientSecret: secret, Token: token,
+		})
+		assert.NoError(t, err)
+		assert.False(t, result.Active, token)
+	}
+}
+
+func TestRevokeOAuthToken_RefreshToken(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	service := newOAuthService(repo, jwt)
+	repo.On("GetOAuthClient", mock.Anything, "chat-web").Return(publicClient(), nil)
+
+	jwt.On("ParseRefreshToken", mock.Anything).Return(&security.Claims{UserID: 1}, nil)
+	repo.On("GetRefreshToken", mock.Anything, "own").
+		Return(&model.RefreshToken{UserId: 1, ClientId: "chat-web", FamilyId: "family"}, nil)
+	repo.On("GetRefreshToken", mock.Anything, "first-party").
+		Return(&model.RefreshToken{UserId: 1, FamilyId: "other"}, nil)
+	repo.On("GetRefreshToken", mock.Anything, "unknown").Return(nil, repository.ErrRefreshTokenNotFound)
+	repo.On("RevokeRefreshTokenFamily", mock.Anything, "family").Return(nil)
+
+	// Публичный клиент отзывает свой токен по одному client_id
+	err := service.RevokeOAuthToken(context.Background(), ClientTokenRequest{ClientID: "chat-web", Token: "own"})
+	assert.NoError(t, err)
+	repo.AssertCalled(t, "RevokeRefreshTokenFamily", mock.Anything, "family")
+
+	// Неизвестный токен не ошибка
+	assert.NoError(t, service.RevokeOAuthToken(context.Background(), ClientTokenRequest{ClientID: "chat-web", Token: "unknown"}))
+
+	var oauthErr *OAuthError
+	err = service.RevokeOAuthToken(context.Background(), ClientTokenRequest{ClientID: "chat-web", Token: "first-party"})
+	assert.ErrorAs(t, err, &oauthErr)
+	assert.Equal(t, OAuthUnauthorizedClient, oauthErr.Code)
+	repo.AssertNotCalled(t, "RevokeRefreshTokenFamily", mock.Anything, "other")
+}
+
+func TestRevokeOAuthToken_AccessToken(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	revocations := new(MockRevocations)
+	service := NewAuthService(repo, jwt, WithOAuth(OAuth{}), WithRevocationStore(revocations))
+	client, secret := registerServiceClient(t, repo, service)
+
+	claims := &security.Claims{ID: "jti-1", Principal: security.PrincipalService,
+		Authorization: security.Authorization{ClientID: client.Id}}
+	jwt.On("ParseRefreshToken", mock.Anything).Return(nil, assert.AnError)
+	jwt.On("ParseAccessToken", "service-token").Return(claims, nil)
+	jwt.On("ParseAccessToken", "user-token").Return(&security.Claims{ID: "jti-2", UserID: 1}, nil)
+	revocations.On("RevokeToken", mock.Anything, claims).Return(nil)
+
+	err := service.RevokeOAuthToken(context.Background(), ClientTokenRequest{
+		ClientID: client.Id, ClientSecret: secret, Token: "service-token",
+	})
+	assert.NoError(t, err)
+	revocations.AssertExpectations(t)
+
+	// Токены первой стороны клиенту не принадлежат
+	var oauthErr *OAuthError
+	err = service.RevokeOAuthToken(context.Background(), ClientTokenRequest{
+		ClientID: client.Id, ClientSecret: secret, Token: "user-token",
+	})
+	assert.ErrorAs(t, err, &oauthErr)
+	assert.Equal(t, OAuthUnauthorizedClient, oauthErr.Code)
+}
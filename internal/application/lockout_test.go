@@ -0,0 +1,198 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type MockTracker struct {
+	mock.Mock
+}
+
+func (m *MockTracker) Check(ctx context.Context, key string) (time.Duration, error) {
+	args := m.Called(ctx, key)
+	return args.Get(0).(time.Duration), args.Error(1)
+}
+
+func (m *MockTracker) RecordFailure(ctx context.Context, key string) (time.Duration, error) {
+	args := m.Called(ctx, key)
+	return args.Get(0).(time.Duration), args.Error(1)
+}
+
+func (m *MockTracker) Reset(ctx context.Context, key string) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+func TestLoginUser_LockedOutSkipsPasswordCheck(t *testing.T) {
+	repo := new(MockRepo)
+	tracker := new(MockTracker)
+	service := NewAuthService(repo, new(MockJWT), WithLoginThrottling(tracker))
+
+	tracker.On("Check", mock.Anything, "account:test@test.com").Return(time.Duration(0), nil)
+	tracker.On("Check", mock.Anything, "ip:10.0.0.1").Return(2*time.Minute, nil)
+
+	_, err := service.LoginUser(context.Background(), model.User{Email: " Test@test.com", Password: "123456"}, model.Device{IP: "10.0.0.1"})
+
+	var locked *LockedOutError
+	assert.True(t, errors.As(err, &locked))
+	assert.Equal(t, 2*time.Minute, locked.RetryAfter)
+	// Пароль не проверяется, пока действует блокировка
+	repo.AssertNotCalled(t, "GetUserByEmail", mock.Anything, mock.Anything)
+}
+
+func TestLoginUser_WrongPasswordRecordsFailureAndPublishesLockout(t *testing.T) {
+	repo := new(MockRepo)
+	tracker := new(MockTracker)
+	events := new(MockEvents)
+	service := NewAuthService(repo, new(MockJWT), WithLoginThrottling(tracker), WithSecurityEvents(events))
+
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.DefaultCost)
+	user := &model.User{Id: 1, Email: "test@test.com", Password: string(hashedPassword)}
+
+	tracker.On("Check", mock.Anything, mock.Anything).Return(time.Duration(0), nil)
+	repo.On("GetUserByEmail", mock.Anything, "test@test.com").Return(user, nil)
+	tracker.On("RecordFailure", mock.Anything, "account:test@test.com").Return(time.Minute, nil)
+	tracker.On("RecordFailure", mock.Anything, "ip:10.0.0.1").Return(time.Duration(0), nil)
+	events.On("Publish", mock.Anything, mock.MatchedBy(func(e SecurityEvent) bool {
+		return e.Type == EventLoginLockout && e.UserID == 1 && e.Details["scope"] == "account" && e.Details["lockout_sec"] == "60"
+	})).Return().Once()
+
+	_, err := service.LoginUser(context.Background(), model.User{Email: "test@test.com", Password: "wrong"}, model.Device{IP: "10.0.0.1"})
+	assert.Error(t, err)
+	tracker.AssertExpectations(t)
+	events.AssertExpectations(t)
+}
+
+func TestLoginUser_UnknownEmailRecordsFailure(t *testing.T) {
+	repo := new(MockRepo)
+	tracker := new(MockTracker)
+	service := NewAuthService(repo, new(MockJWT), WithLoginThrottling(tracker))
+
+	tracker.On("Check", mock.Anything, mock.Anything).Return(time.Duration(0), nil)
+	repo.On("GetUserByEmail", mock.Anything, "nobody@test.com").Return((*model.User)(nil), repository.ErrUserNotFound)
+	tracker.On("RecordFailure", mock.Anything, "account:nobody@test.com").Return(time.Duration(0), nil)
+
+	_, err := service.LoginUser(context.Background(), model.User{Email: "nobody@test.com", Password: "123456"}, model.Device{})
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	tracker.AssertExpectations(t)
+}
+
+func TestLoginUser_SuccessResetsAccountFailures(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	tracker := new(MockTracker)
+	service := NewAuthService(repo, jwt, WithLoginThrottling(tracker))
+
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.DefaultCost)
+	user := &model.User{Id: 1, Email: "test@test.com", Password: string(hashedPassword)}
+
+	// Ошибка трекера не блокирует вход
+	tracker.On("Check", mock.Anything, "account:test@test.com").Return(time.Duration(0), errors.New("db down"))
+	repo.On("GetUserByEmail", mock.Anything, "test@test.com").Return(user, nil)
+	tracker.On("Reset", mock.Anything, "account:test@test.com").Return(nil)
+	repo.On("GetUserRoles", mock.Anything, int64(1)).Return([]string{}, nil)
+	repo.On("GetUserPermissions", mock.Anything, int64(1)).Return([]string{}, nil)
+	jwt.On("GenerateAccessToken", int64(1), mock.Anything).Return("access", nil)
+	jwt.On("GenerateRefreshToken", int64(1)).Return("refresh", nil)
+	repo.On("CreateRefreshToken", mock.Anything, mock.Anything).Return(int64(10), nil)
+
+	tokens, err := service.LoginUser(context.Background(), model.User{Email: "test@test.com", Password: "123456"}, model.Device{})
+	assert.NoError(t, err)
+	assert.Equal(t, "access", tokens.AccessToken)
+	tracker.AssertExpectations(t)
+}
+
+func TestLoginUser_MFAChallengeKeepsAccountFailures(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	tracker := new(MockTracker)
+	service := NewAuthService(repo, jwt, WithMFA(testMFA(t)), WithLoginThrottling(tracker))
+
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.DefaultCost)
+	user := &model.User{Id: 1, Email: "test@test.com", Password: string(hashedPassword)}
+	confirmedAt := time.Now()
+
+	tracker.On("Check", mock.Anything, mock.Anything).Return(time.Duration(0), nil)
+	repo.On("GetUserByEmail", mock.Anything, "test@test.com").Return(user, nil)
+	repo.On("GetMFA", mock.Anything, int64(1)).Return(&model.MFA{UserId: 1, ConfirmedAt: &confirmedAt}, nil)
+	jwt.On("GenerateActionToken", int64(1), PurposeMFAChallenge, 5*time.Minute).
+		Return("challenge", &security.Claims{UserID: 1, ID: "jti-1"}, nil)
+	repo.On("CreateActionToken", mock.Anything, mock.Anything).Return(nil)
+
+	_, err := service.LoginUser(context.Background(), model.User{Email: "test@test.com", Password: "123456"}, model.Device{})
+
+	var mfaErr *MFARequiredError
+	assert.True(t, errors.As(err, &mfaErr))
+	// Верный пароль без второго фактора не сбрасывает счётчик неудачных попыток
+	tracker.AssertNotCalled(t, "Reset", mock.Anything, mock.Anything)
+}
+
+func TestCompleteMFALogin_WrongCodeRecordsFailure(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	tracker := new(MockTracker)
+	service := NewAuthService(repo, jwt, WithMFA(testMFA(t)), WithLoginThrottling(tracker))
+
+	confirmedAt := time.Now()
+	jwt.On("ParseActionToken", "challenge", PurposeMFAChallenge).Return(&security.Claims{UserID: 1, ID: "jti-1"}, nil)
+	repo.On("ConsumeActionToken", mock.Anything, "jti-1", PurposeMFAChallenge).
+		Return(&model.ActionToken{Jti: "jti-1", UserId: 1}, nil)
+	repo.On("GetUserByID", mock.Anything, int64(1)).Return(&model.User{Id: 1, Email: "test@test.com"}, nil)
+	tracker.On("Check", mock.Anything, mock.Anything).Return(time.Duration(0), nil)
+	repo.On("GetMFA", mock.Anything, int64(1)).Return(&model.MFA{UserId: 1, ConfirmedAt: &confirmedAt}, nil)
+	repo.On("UseRecoveryCode", mock.Anything, int64(1), "abcde-fghij").Return(repository.ErrRecoveryCodeInvalid)
+	tracker.On("RecordFailure", mock.Anything, "account:test@test.com").Return(time.Duration(0), nil)
+	tracker.On("RecordFailure", mock.Anything, "ip:10.0.0.1").Return(time.Duration(0), nil)
+
+	_, err := service.CompleteMFALogin(context.Background(), "challenge", "abcde-fghij", model.Device{IP: "10.0.0.1"})
+	assert.ErrorIs(t, err, ErrMFAInvalidCode)
+	tracker.AssertExpectations(t)
+	tracker.AssertNotCalled(t, "Reset", mock.Anything, mock.Anything)
+}
+
+func TestCompleteMFALogin_LockedOut(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	tracker := new(MockTracker)
+	service := NewAuthService(repo, jwt, WithMFA(testMFA(t)), WithLoginThrottling(tracker))
+
+	jwt.On("ParseActionToken", "challenge", PurposeMFAChallenge).Return(&security.Claims{UserID: 1, ID: "jti-1"}, nil)
+	repo.On("ConsumeActionToken", mock.Anything, "jti-1", PurposeMFAChallenge).
+		Return(&model.ActionToken{Jti: "jti-1", UserId: 1}, nil)
+	repo.On("GetUserByID", mock.Anything, int64(1)).Return(&model.User{Id: 1, Email: "test@test.com"}, nil)
+	tracker.On("Check", mock.Anything, "account:test@test.com").Return(time.Minute, nil)
+
+	_, err := service.CompleteMFALogin(context.Background(), "challenge", "123456", model.Device{})
+
+	var locked *LockedOutError
+	assert.True(t, errors.As(err, &locked))
+	// Код не проверяется, пока действует блокировка
+	repo.AssertNotCalled(t, "GetMFA", mock.Anything, mock.Anything)
+}
+
+func TestUnlockUser(t *testing.T) {
+	repo := new(MockRepo)
+	tracker := new(MockTracker)
+	service := NewAuthService(repo, new(MockJWT), WithLoginThrottling(tracker))
+
+	repo.On("GetUserByID", mock.Anything, int64(1)).Return(&model.User{Id: 1, Email: "Test@test.com"}, nil)
+	tracker.On("Reset", mock.Anything, "account:test@test.com").Return(nil)
+	assert.NoError(t, service.UnlockUser(context.Background(), 1))
+
+	repo.On("GetUserByID", mock.Anything, int64(2)).Return((*model.User)(nil), repository.ErrUserNotFound)
+	assert.ErrorIs(t, service.UnlockUser(context.Background(), 2), repository.ErrUserNotFound)
+
+	tracker.On("Reset", mock.Anything, "ip:10.0.0.1").Return(nil)
+	assert.NoError(t, service.UnlockIP(context.Background(), "10.0.0.1"))
+	tracker.AssertExpectations(t)
+}
@@ -0,0 +1,303 @@
+package application
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+)
+
+const (
+	PurposeMFAChallenge = "mfa_challenge"
+
+	MFAMethodTOTP    = "totp"
+	MFAMethodPasskey = "passkey"
+
+	recoveryCodeCount = 10
+)
+
+var (
+	ErrMFAInvalidCode    = errors.New("invalid mfa code")
+	ErrMFAAlreadyEnabled = errors.New("mfa is already enabled")
+)
+
+// MFARequiredError is returned by LoginUser when the password was correct but the
+// account has a second factor. ChallengeToken is passed to CompleteMFALogin or,
+// for passkeys, to BeginPasskeyMFA and CompletePasskeyMFALogin. Methods lists the
+// factors the user can choose from.
+type MFARequiredError struct {
+	ChallengeToken string
+	Methods        []string
+}
+
+func (e *MFARequiredError) Error() string {
+	return "second factor required"
+}
+
+// MFA configures TOTP two-factor authentication.
+type MFA struct {
+	// Issuer is shown next to the account in authenticator apps.
+	Issuer string
+	// Secrets encrypts TOTP secrets at rest. Without it nobody can enrol, but logins
+	// of already enrolled users are still challenged and then fail closed.
+	Secrets *security.SecretBox
+	// ChallengeTTL bounds the time between the password and the code step.
+	ChallengeTTL time.Duration
+}
+
+func WithMFA(cfg MFA) Option {
+	return func(s *AuthService) {
+		s.mfa = &cfg
+	}
+}
+
+// TOTPEnrollment is what the client needs to add the account to an authenticator app.
+// QRPayload is the text to encode into a QR code.
+type TOTPEnrollment struct {
+	Secret    string `json:"secret"`
+	URI       string `json:"uri"`
+	QRPayload string `json:"qr_payload"`
+}
+
+// EnrollTOTP starts an enrolment that only takes effect after ConfirmTOTP. Starting
+// again before confirming replaces the pending secret.
+func (s *AuthService) EnrollTOTP(ctx context.Context, userID int64) (*TOTPEnrollment, error) {
+	if s.mfa == nil || s.mfa.Secrets == nil {
+		return nil, errors.New("mfa is not configured")
+	}
+
+	existing, err := s.repo.GetMFA(ctx, userID)
+	if err != nil && !errors.Is(err, repository.ErrMFANotFound) {
+		return nil, err
+	}
+	if existing != nil && existing.ConfirmedAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := security.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.mfa.Secrets.Seal(secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SaveMFA(ctx, model.MFA{UserId: userID, SecretEncrypted: sealed}); err != nil {
+		return nil, err
+	}
+
+	uri := security.TOTPURI(s.mfa.Issuer, user.Email, secret)
+	return &TOTPEnrollment{Secret: secret, URI: uri, QRPayload: uri}, nil
+}
+
+// ConfirmTOTP activates a pending enrolment once the user proves their app produces
+// valid codes, and returns recovery codes. They are shown only this once.
+func (s *AuthService) ConfirmTOTP(ctx context.Context, userID int64, code string) ([]string, error) {
+	mfa, err := s.repo.GetMFA(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if mfa.ConfirmedAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	if err := s.checkTOTP(ctx, mfa, code); err != nil {
+		return nil, err
+	}
+	if err := s.repo.ConfirmMFA(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.ReplaceRecoveryCodes(ctx, userID, codes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// CompleteMFALogin finishes a login started by LoginUser. The challenge is single-use,
+// so a wrong code sends the user back to the password step.
+func (s *AuthService) CompleteMFALogin(ctx context.Context, challengeToken, code string, device model.Device) (*Tokens, error) {
+	userID, err := s.VerifyMFALogin(ctx, challengeToken, code, device)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.startSession(ctx, userID, device)
+}
+
+// VerifyMFALogin checks the second step like CompleteMFALogin, but only returns the
+// user instead of opening a session. Wrong codes count against the same lockout keys
+// as wrong passwords, and only a correct one clears the account's failures.
+func (s *AuthService) VerifyMFALogin(ctx context.Context, challengeToken, code string, device model.Device) (int64, error) {
+	if challengeToken == "" || code == "" {
+		return 0, errors.New("challenge token and code must not be empty")
+	}
+
+	challenge, err := s.consumeActionToken(ctx, challengeToken, PurposeMFAChallenge)
+	if err != nil {
+		return 0, err
+	}
+	user, err := s.repo.GetUserByID(ctx, challenge.UserId)
+	if err != nil {
+		return 0, err
+	}
+	keys := loginThrottleKeys(user.Email, device)
+	if err := s.checkLoginThrottle(ctx, keys); err != nil {
+		return 0, err
+	}
+
+	if err := s.checkMFACode(ctx, challenge.UserId, code); err != nil {
+		if errors.Is(err, ErrMFAInvalidCode) {
+			s.recordLoginFailure(ctx, keys, challenge.UserId, device)
+		}
+		return 0, err
+	}
+	s.resetLoginFailures(ctx, user.Email)
+
+	return challenge.UserId, nil
+}
+
+// checkMFACode accepts a current TOTP code or an unused recovery code.
+func (s *AuthService) checkMFACode(ctx context.Context, userID int64, code string) error {
+	// Users whose only second factor is a passkey have no codes to check.
+	mfa, err := s.repo.GetMFA(ctx, userID)
+	if errors.Is(err, repository.ErrMFANotFound) {
+		return ErrMFAInvalidCode
+	}
+	if err != nil {
+		return err
+	}
+	if mfa.ConfirmedAt == nil {
+		return ErrMFAInvalidCode
+	}
+
+	if isTOTPCode(code) {
+		return s.checkTOTP(ctx, mfa, code)
+	}
+	err = s.repo.UseRecoveryCode(ctx, userID, normalizeRecoveryCode(code))
+	if errors.Is(err, repository.ErrRecoveryCodeInvalid) {
+		return ErrMFAInvalidCode
+	}
+	return err
+}
+
+// ResetMFA removes a user's second factor, e.g. after they lost their device and
+// recovery codes. Only administrators should be able to call it.
+func (s *AuthService) ResetMFA(ctx context.Context, userID int64) error {
+	if userID == 0 {
+		return errors.New("userID must not be empty")
+	}
+	return s.repo.DeleteMFA(ctx, userID)
+}
+
+// mfaChallenge returns an MFARequiredError when the user has a confirmed TOTP
+// enrolment or a registered passkey.
+func (s *AuthService) mfaChallenge(ctx context.Context, userID int64) error {
+	var methods []string
+	if s.mfa != nil {
+		mfa, err := s.repo.GetMFA(ctx, userID)
+		if err != nil && !errors.Is(err, repository.ErrMFANotFound) {
+			return err
+		}
+		if mfa != nil && mfa.ConfirmedAt != nil {
+			methods = append(methods, MFAMethodTOTP)
+		}
+	}
+	passkeys, err := s.hasPasskeys(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if passkeys {
+		methods = append(methods, MFAMethodPasskey)
+	}
+	if len(methods) == 0 {
+		return nil
+	}
+
+	token, err := s.issueActionToken(ctx, model.ActionToken{UserId: userID, Purpose: PurposeMFAChallenge}, s.mfaChallengeTTL())
+	if err != nil {
+		return err
+	}
+	return &MFARequiredError{ChallengeToken: token, Methods: methods}
+}
+
+func (s *AuthService) mfaChallengeTTL() time.Duration {
+	if s.mfa != nil {
+		return s.mfa.ChallengeTTL
+	}
+	return s.webauthn.SessionTTL
+}
+
+func (s *AuthService) checkTOTP(ctx context.Context, mfa *model.MFA, code string) error {
+	if s.mfa == nil || s.mfa.Secrets == nil {
+		return errors.New("mfa is not configured")
+	}
+
+	secret, err := s.mfa.Secrets.Open(mfa.SecretEncrypted)
+	if err != nil {
+		return err
+	}
+
+	step, ok := security.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return ErrMFAInvalidCode
+	}
+
+	err = s.repo.UseMFAStep(ctx, mfa.UserId, step)
+	if errors.Is(err, repository.ErrMFACodeReused) {
+		return ErrMFAInvalidCode
+	}
+	return err
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != 6 {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRecoveryCodes returns codes like "abcde-fghij" with 50 bits of entropy each.
+func newRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:10]
+		codes[i] = raw[:5] + "-" + raw[5:]
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode accepts codes typed without the dash or in upper case.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+	code = strings.ReplaceAll(code, "-", "")
+	if len(code) == 10 {
+		return code[:5] + "-" + code[5:]
+	}
+	return code
+}
@@ -0,0 +1,110 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func testMFA(t *testing.T) MFA {
+	box, err := security.NewSecretBox("test-key")
+	assert.NoError(t, err)
+	return MFA{Issuer: "Chat", Secrets: box, ChallengeTTL: 5 * time.Minute}
+}
+
+func TestEnrollAndConfirmTOTP(t *testing.T) {
+	repo := new(MockRepo)
+	cfg := testMFA(t)
+	service := NewAuthService(repo, nil, WithMFA(cfg))
+
+	var saved model.MFA
+	repo.On("GetMFA", mock.Anything, int64(1)).Return(nil, repository.ErrMFANotFound).Once()
+	repo.On("GetUserByID", mock.Anything, int64(1)).Return(&model.User{Id: 1, Email: "test@test.com"}, nil)
+	repo.On("SaveMFA", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		saved = args.Get(1).(model.MFA)
+	}).Return(nil)
+
+	enrollment, err := service.EnrollTOTP(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Contains(t, enrollment.URI, "otpauth://totp/Chat:test@test.com")
+	// Секрет хранится только в зашифрованном виде
+	assert.NotContains(t, saved.SecretEncrypted, enrollment.Secret)
+
+	code, err := security.TOTPCode(enrollment.Secret, time.Now())
+	assert.NoError(t, err)
+
+	repo.On("GetMFA", mock.Anything, int64(1)).Return(&saved, nil)
+	repo.On("UseMFAStep", mock.Anything, int64(1), mock.Anything).Return(nil)
+	repo.On("ConfirmMFA", mock.Anything, int64(1)).Return(nil)
+	repo.On("ReplaceRecoveryCodes", mock.Anything, int64(1), mock.MatchedBy(func(codes []string) bool {
+		return len(codes) == recoveryCodeCount
+	})).Return(nil)
+
+	codes, err := service.ConfirmTOTP(context.Background(), 1, code)
+	assert.NoError(t, err)
+	assert.Len(t, codes, recoveryCodeCount)
+
+	_, err = service.ConfirmTOTP(context.Background(), 1, "000000")
+	assert.ErrorIs(t, err, ErrMFAInvalidCode)
+}
+
+func TestLoginUser_MFAChallenge(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	service := NewAuthService(repo, jwt, WithMFA(testMFA(t)))
+
+	confirmedAt := time.Now()
+	repo.On("GetUserByEmail", mock.Anything, "test@test.com").Return(testUser(t), nil)
+	// Хеш с MinCost обновляется до стоимости по умолчанию
+	repo.On("UpdatePassword", mock.Anything, int64(1), mock.Anything).Return(nil)
+	repo.On("GetMFA", mock.Anything, int64(1)).Return(&model.MFA{UserId: 1, ConfirmedAt: &confirmedAt}, nil)
+	jwt.On("GenerateActionToken", int64(1), PurposeMFAChallenge, 5*time.Minute).
+		Return("challenge", &security.Claims{UserID: 1, ID: "jti-1"}, nil)
+	repo.On("CreateActionToken", mock.Anything, mock.Anything).Return(nil)
+
+	tokens, err := service.LoginUser(context.Background(), model.User{Email: "test@test.com", Password: "123456"}, model.Device{})
+	assert.Nil(t, tokens)
+
+	var mfaErr *MFARequiredError
+	assert.True(t, errors.As(err, &mfaErr))
+	assert.Equal(t, "challenge", mfaErr.ChallengeToken)
+	jwt.AssertNotCalled(t, "GenerateAccessToken", mock.Anything, mock.Anything)
+}
+
+func TestCompleteMFALogin_RecoveryCode(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	service := NewAuthService(repo, jwt, WithMFA(testMFA(t)))
+
+	confirmedAt := time.Now()
+	jwt.On("ParseActionToken", "challenge", PurposeMFAChallenge).Return(&security.Claims{UserID: 1, ID: "jti-1"}, nil)
+	repo.On("ConsumeActionToken", mock.Anything, "jti-1", PurposeMFAChallenge).
+		Return(&model.ActionToken{Jti: "jti-1", UserId: 1}, nil)
+	repo.On("GetUserByID", mock.Anything, int64(1)).Return(testUser(t), nil)
+	repo.On("GetMFA", mock.Anything, int64(1)).Return(&model.MFA{UserId: 1, ConfirmedAt: &confirmedAt}, nil)
+	// Код введён без дефиса и заглавными буквами
+	repo.On("UseRecoveryCode", mock.Anything, int64(1), "abcde-fghij").Return(nil)
+	repo.On("GetUserRoles", mock.Anything, int64(1)).Return([]string{}, nil)
+	repo.On("GetUserPermissions", mock.Anything, int64(1)).Return([]string{}, nil)
+	jwt.On("GenerateAccessToken", int64(1), mock.Anything).Return("access", nil)
+	jwt.On("GenerateRefreshToken", int64(1)).Return("refresh", nil)
+	repo.On("CreateRefreshToken", mock.Anything, mock.Anything).Return(int64(10), nil)
+
+	tokens, err := service.CompleteMFALogin(context.Background(), "challenge", "ABCDEFGHIJ", model.Device{})
+	assert.NoError(t, err)
+	assert.Equal(t, "access", tokens.AccessToken)
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	assert.Equal(t, "abcde-fghij", normalizeRecoveryCode(" ABCDE-FGHIJ "))
+	assert.Equal(t, "abcde-fghij", normalizeRecoveryCode("abcdefghij"))
+	assert.False(t, isTOTPCode("abcde-fghij"))
+	assert.True(t, isTOTPCode("012345"))
+}
@@ -0,0 +1,518 @@
+package application
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+)
+
+const (
+	ResponseTypeCode           = "code"
+	PKCEMethodS256             = "S256"
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeClientCredentials = "client_credentials"
+)
+
+// Error codes of RFC 6749 sections 4.1.2.1 and 5.2.
+const (
+	OAuthInvalidRequest          = "invalid_request"
+	OAuthInvalidClient           = "invalid_client"
+	OAuthInvalidGrant            = "invalid_grant"
+	OAuthInvalidScope            = "invalid_scope"
+	OAuthUnauthorizedClient      = "unauthorized_client"
+	OAuthAccessDenied            = "access_denied"
+	OAuthUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthUnsupportedResponseType = "unsupported_response_type"
+	OAuthLoginRequired           = "login_required"
+)
+
+var (
+	ErrOAuthDisabled      = errors.New("oauth is not configured")
+	ErrInvalidOAuthClient = errors.New("invalid oauth client")
+	ErrInvalidRedirectURI = errors.New("invalid redirect uri")
+)
+
+// OAuth configures the authorization server.
+type OAuth struct {
+	// CodeTTL bounds the time between the redirect back to the client and its token request.
+	CodeTTL time.Duration
+}
+
+func WithOAuth(cfg OAuth) Option {
+	return func(s *AuthService) {
+		s.oauth = &cfg
+	}
+}
+
+// OAuthError is an error the client is told about in the RFC 6749 format.
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func oauthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// AuthorizeRequest holds the parameters of an authorization request.
+type AuthorizeRequest struct {
+	ClientID            string
+	RedirectURI         string
+	ResponseType        string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	// Nonce and Prompt are OpenID Connect parameters.
+	Nonce  string
+	Prompt string
+}
+
+// TokenRequest holds the parameters of a token request. ClientSecret comes from HTTP
+// Basic authentication or the request body and stays empty for public clients.
+type TokenRequest struct {
+	GrantType    string
+	ClientID     string
+	ClientSecret string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+	// Scope narrows the scopes of a client credentials grant; empty requests all of them.
+	Scope string
+}
+
+// OAuthTokens is the result of a token request.
+type OAuthTokens struct {
+	Tokens
+	// IDToken is only set when the openid scope was granted.
+	IDToken   string
+	ExpiresIn time.Duration
+	Scope     string
+}
+
+// RegisterOAuthClient stores a new client after validating its redirect URIs.
+// Confidential clients get a secret, which is only ever returned here.
+func (s *AuthService) RegisterOAuthClient(ctx context.Context, name string, redirectURIs, scopes []string, confidential bool) (*model.OAuthClient, string, error) {
+	if name == "" {
+		return nil, "", fmt.Errorf("%w: name must not be empty", ErrInvalidOAuthClient)
+	}
+	if len(redirectURIs) == 0 {
+		return nil, "", fmt.Errorf("%w: at least one redirect uri is required", ErrInvalidRedirectURI)
+	}
+	for _, uri := range redirectURIs {
+		if err := validateRedirectURI(uri); err != nil {
+			return nil, "", err
+		}
+	}
+
+	return s.registerClient(ctx, model.OAuthClient{
+		Name:         name,
+		RedirectURIs: redirectURIs,
+		Scopes:       scopes,
+		GrantTypes:   []string{GrantTypeAuthorizationCode, GrantTypeRefreshToken},
+	}, confidential)
+}
+
+// registerClient assigns the id and, for confidential clients, the secret.
+func (s *AuthService) registerClient(ctx context.Context, client model.OAuthClient, confidential bool) (*model.OAuthClient, string, error) {
+	if client.Scopes == nil {
+		client.Scopes = []string{}
+	}
+
+	var err error
+	if client.Id, err = newOAuthToken(16); err != nil {
+		return nil, "", err
+	}
+	client.CreatedAt = time.Now().UTC()
+
+	var secret string
+	if confidential {
+		if secret, err = newOAuthToken(32); err != nil {
+			return nil, "", err
+		}
+		if client.SecretHash, err = s.passwords.Hash(secret); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if err := s.repo.CreateOAuthClient(ctx, client); err != nil {
+		return nil, "", err
+	}
+
+	return &client, secret, nil
+}
+
+func (s *AuthService) ListOAuthClients(ctx context.Context) ([]model.OAuthClient, error) {
+	return s.repo.ListOAuthClients(ctx)
+}
+
+// DeleteOAuthClient removes the client and ends every session opened through it.
+func (s *AuthService) DeleteOAuthClient(ctx context.Context, clientID string) error {
+	return s.repo.DeleteOAuthClient(ctx, clientID)
+}
+
+// ValidateAuthorizeRequest checks an authorization request and fills in the redirect
+// URI when the client has a single one registered. When the returned client is nil
+// the redirect URI cannot be trusted, so the error must be shown to the user instead
+// of being sent back to the client.
+func (s *AuthService) ValidateAuthorizeRequest(ctx context.Context, req *AuthorizeRequest) (*model.OAuthClient, error) {
+	if s.oauth == nil {
+		return nil, ErrOAuthDisabled
+	}
+	if req.ClientID == "" {
+		return nil, oauthError(OAuthInvalidRequest, "client_id is required")
+	}
+
+	client, err := s.repo.GetOAuthClient(ctx, req.ClientID)
+	if errors.Is(err, repository.ErrOAuthClientNotFound) {
+		return nil, oauthError(OAuthInvalidRequest, "unknown client")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !contains(client.GrantTypes, GrantTypeAuthorizationCode) {
+		return nil, oauthError(OAuthUnauthorizedClient, "the client may not use the authorization code flow")
+	}
+
+	redirectURI, ok := matchRedirectURI(client.RedirectURIs, req.RedirectURI)
+	if !ok {
+		return nil, oauthError(OAuthInvalidRequest, "redirect_uri is not registered for this client")
+	}
+	req.RedirectURI = redirectURI
+
+	if req.ResponseType != ResponseTypeCode {
+		return client, oauthError(OAuthUnsupportedResponseType, "response_type must be code")
+	}
+	if req.CodeChallengeMethod != PKCEMethodS256 || !validPKCEValue(req.CodeChallenge) {
+		return client, oauthError(OAuthInvalidRequest, "a code_challenge with code_challenge_method S256 is required")
+	}
+	for _, scope := range strings.Fields(req.Scope) {
+		if !contains(client.Scopes, scope) {
+			return client, oauthError(OAuthInvalidScope, fmt.Sprintf("scope %q is not allowed for this client", scope))
+		}
+	}
+	// There is no login session to reuse, every authorization shows the login page.
+	if contains(strings.Fields(req.Prompt), "none") {
+		return client, oauthError(OAuthLoginRequired, "the user has to log in")
+	}
+
+	return client, nil
+}
+
+// AuthorizeUser issues an authorization code once the user has logged in and
+// approved the request. The code is redirected to the client, which trades it for
+// tokens together with the PKCE verifier.
+func (s *AuthService) AuthorizeUser(ctx context.Context, userID int64, req AuthorizeRequest) (string, error) {
+	if _, err := s.ValidateAuthorizeRequest(ctx, &req); err != nil {
+		return "", err
+	}
+
+	code, err := newOAuthToken(32)
+	if err != nil {
+		return "", err
+	}
+	err = s.repo.CreateAuthorizationCode(ctx, model.AuthorizationCode{
+		Code:                code,
+		ClientId:            req.ClientID,
+		UserId:              userID,
+		RedirectURI:         req.RedirectURI,
+		Scope:               strings.Join(strings.Fields(req.Scope), " "),
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		Nonce:               req.Nonce,
+		AuthTime:            time.Now().UTC(),
+		ExpiresAt:           time.Now().UTC().Add(s.oauth.CodeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// ExchangeOAuthToken serves the token endpoint: it redeems authorization codes and
+// rotates refresh tokens of sessions opened through OAuth. Errors meant for the
+// client are *OAuthError.
+func (s *AuthService) ExchangeOAuthToken(ctx context.Context, req TokenRequest, device model.Device) (*OAuthTokens, error) {
+	if s.oauth == nil {
+		return nil, ErrOAuthDisabled
+	}
+
+	client, err := s.authenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	switch req.GrantType {
+	case GrantTypeAuthorizationCode, GrantTypeRefreshToken, GrantTypeClientCredentials:
+		if !contains(client.GrantTypes, req.GrantType) {
+			return nil, oauthError(OAuthUnauthorizedClient, fmt.Sprintf("the client may not use grant_type %q", req.GrantType))
+		}
+	}
+
+	switch req.GrantType {
+	case GrantTypeAuthorizationCode:
+		return s.exchangeAuthorizationCode(ctx, client, req, device)
+	case GrantTypeRefreshToken:
+		return s.exchangeRefreshToken(ctx, client, req)
+	case GrantTypeClientCredentials:
+		return s.exchangeClientCredentials(client, req)
+	case "":
+		return nil, oauthError(OAuthInvalidRequest, "grant_type is required")
+	default:
+		return nil, oauthError(OAuthUnsupportedGrantType, fmt.Sprintf("grant_type %q is not supported", req.GrantType))
+	}
+}
+
+func (s *AuthService) exchangeAuthorizationCode(ctx context.Context, client *model.OAuthClient, req TokenRequest, device model.Device) (*OAuthTokens, error) {
+	if req.Code == "" || req.CodeVerifier == "" {
+		return nil, oauthError(OAuthInvalidRequest, "code and code_verifier are required")
+	}
+
+	code, err := s.repo.ConsumeAuthorizationCode(ctx, req.Code)
+	if errors.Is(err, repository.ErrAuthCodeInvalid) {
+		return nil, oauthError(OAuthInvalidGrant, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if code.ClientId != client.Id {
+		return nil, oauthError(OAuthInvalidGrant, "authorization code was issued to another client")
+	}
+	if req.RedirectURI != "" && req.RedirectURI != code.RedirectURI {
+		return nil, oauthError(OAuthInvalidGrant, "redirect_uri does not match the authorization request")
+	}
+	if !verifyPKCE(code.CodeChallenge, req.CodeVerifier) {
+		return nil, oauthError(OAuthInvalidGrant, "code_verifier does not match the code_challenge")
+	}
+
+	user, err := s.repo.GetUserByID(ctx, code.UserId)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil, oauthError(OAuthInvalidGrant, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, oauthError(OAuthInvalidGrant, ErrUserDisabled.Error())
+	}
+
+	device.Name = client.Name
+	tokens, err := s.startClientSession(ctx, user.Id, device, client.Id, code.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.oauthTokens(tokens, code.Scope)
+	if err != nil {
+		return nil, err
+	}
+	if s.oidc != nil && contains(strings.Fields(code.Scope), ScopeOpenID) {
+		if result.IDToken, err = s.idToken(user, client.Id, code); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func (s *AuthService) exchangeRefreshToken(ctx context.Context, client *model.OAuthClient, req TokenRequest) (*OAuthTokens, error) {
+	if req.RefreshToken == "" {
+		return nil, oauthError(OAuthInvalidRequest, "refresh_token is required")
+	}
+	if _, err := s.jwtManager.VerifyRefreshToken(req.RefreshToken); err != nil {
+		return nil, oauthError(OAuthInvalidGrant, "refresh token is invalid or expired")
+	}
+
+	tokens, scope, err := s.refreshSession(ctx, req.RefreshToken, client.Id)
+	switch {
+	case errors.Is(err, repository.ErrRefreshTokenNotFound), errors.Is(err, ErrRefreshTokenClient),
+		errors.Is(err, ErrSessionRevoked), errors.Is(err, ErrRefreshTokenReused):
+		return nil, oauthError(OAuthInvalidGrant, err.Error())
+	case err != nil:
+		return nil, err
+	}
+
+	return s.oauthTokens(tokens, scope)
+}
+
+func (s *AuthService) oauthTokens(tokens *Tokens, scope string) (*OAuthTokens, error) {
+	claims, err := s.jwtManager.ParseAccessToken(tokens.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OAuthTokens{Tokens: *tokens, ExpiresIn: time.Until(claims.ExpiresAt).Round(time.Second), Scope: scope}, nil
+}
+
+// authenticateClient requires the secret of confidential clients. Public clients
+// must not send one.
+func (s *AuthService) authenticateClient(ctx context.Context, clientID, secret string) (*model.OAuthClient, error) {
+	failed := oauthError(OAuthInvalidClient, "client authentication failed")
+	if clientID == "" {
+		return nil, failed
+	}
+
+	client, err := s.repo.GetOAuthClient(ctx, clientID)
+	if errors.Is(err, repository.ErrOAuthClientNotFound) {
+		return nil, failed
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if client.SecretHash == "" {
+		if secret != "" {
+			return nil, failed
+		}
+		return client, nil
+	}
+	if secret == "" {
+		return nil, failed
+	}
+	ok, _, err := s.passwords.Verify(secret, client.SecretHash)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, failed
+	}
+
+	return client, nil
+}
+
+// validateRedirectURI accepts the redirect URIs OAuth 2.1 allows: https, http on a
+// loopback address for native apps, and private-use schemes in reverse domain
+// notation (RFC 8252).
+func validateRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() {
+		return fmt.Errorf("%w: %q must be an absolute uri", ErrInvalidRedirectURI, raw)
+	}
+	if u.Fragment != "" {
+		return fmt.Errorf("%w: %q must not contain a fragment", ErrInvalidRedirectURI, raw)
+	}
+
+	switch u.Scheme {
+	case "https":
+		if u.Host == "" {
+			return fmt.Errorf("%w: %q has no host", ErrInvalidRedirectURI, raw)
+		}
+	case "http":
+		if !isLoopback(u.Hostname()) {
+			return fmt.Errorf("%w: %q must use https unless it points to a loopback address", ErrInvalidRedirectURI, raw)
+		}
+	default:
+		if !strings.Contains(u.Scheme, ".") {
+			return fmt.Errorf("%w: custom scheme of %q must be in reverse domain notation", ErrInvalidRedirectURI, raw)
+		}
+	}
+
+	return nil
+}
+
+// matchRedirectURI compares redirect URIs exactly, except that native apps listening
+// on a loopback IP may pick any port (RFC 8252 section 7.3). A missing URI is only
+// allowed when the client has exactly one registered.
+func matchRedirectURI(registered []string, requested string) (string, bool) {
+	if requested == "" {
+		if len(registered) == 1 {
+			return registered[0], true
+		}
+		return "", false
+	}
+
+	for _, uri := range registered {
+		if uri == requested || sameLoopbackURI(uri, requested) {
+			return requested, true
+		}
+	}
+	return "", false
+}
+
+func sameLoopbackURI(registered, requested string) bool {
+	a, err := url.Parse(registered)
+	if err != nil {
+		return false
+	}
+	b, err := url.Parse(requested)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(a.Hostname())
+
+	return a.Scheme == "http" && b.Scheme == "http" && ip != nil && ip.IsLoopback() &&
+		a.Hostname() == b.Hostname() && a.Path == b.Path && a.RawQuery == b.RawQuery
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// verifyPKCE checks an S256 code challenge (RFC 7636 section 4.6).
+func verifyPKCE(challenge, verifier string) bool {
+	if !validPKCEValue(verifier) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(pkceChallenge(verifier)), []byte(challenge)) == 1
+}
+
+// pkceChallenge derives the S256 code challenge of verifier.
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// validPKCEValue checks the length and alphabet RFC 7636 prescribes for verifiers;
+// S256 challenges fit the same rules.
+func validPKCEValue(v string) bool {
+	if len(v) < 43 || len(v) > 128 {
+		return false
+	}
+	for _, r := range v {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '.', r == '_', r == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newOAuthToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
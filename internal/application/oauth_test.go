@@ -0,0 +1,288 @@
+package application
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const testVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+func testChallenge() string {
+	sum := sha256.Sum256([]byte(testVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func newOAuthService(repo *MockRepo, jwt *MockJWT) *AuthService {
+	return NewAuthService(repo, jwt, WithOAuth(OAuth{CodeTTL: time.Minute}))
+}
+
+func publicClient() *model.OAuthClient {
+	return &model.OAuthClient{
+		Id:           "chat-web",
+		Name:         "Chat Web",
+		RedirectURIs: []string{"https://chat.example.com/callback"},
+		Scopes:       []string{"chat"},
+		GrantTypes:   []string{GrantTypeAuthorizationCode, GrantTypeRefreshToken},
+	}
+}
+
+func TestValidateRedirectURI(t *testing.T) {
+	valid := []string{
+		"https://chat.example.com/callback",
+		"http://127.0.0.1/callback",
+		"http://localhost:8080/callback",
+		"com.example.chat:/oauth",
+	}
+	for _, uri := range valid {
+		assert.NoError(t, validateRedirectURI(uri), uri)
+	}
+
+	invalid := []string{
+		"/callback",
+		"http://chat.example.com/callback",
+		"https://chat.example.com/callback#frag",
+		"chat:/oauth",
+	}
+	for _, uri := range invalid {
+		assert.ErrorIs(t, validateRedirectURI(uri), ErrInvalidRedirectURI, uri)
+	}
+}
+
+func TestMatchRedirectURI(t *testing.T) {
+	registered := []string{"https://chat.example.com/callback", "http://127.0.0.1/callback"}
+
+	_, ok := matchRedirectURI(registered, "https://chat.example.com/callback/")
+	assert.False(t, ok)
+
+	// Для loopback-адресов порт может быть любым
+	uri, ok := matchRedirectURI(registered, "http://127.0.0.1:53111/callback")
+	assert.True(t, ok)
+	assert.Equal(t, "http://127.0.0.1:53111/callback", uri)
+
+	// Без redirect_uri подходит только единственный зарегистрированный
+	_, ok = matchRedirectURI(registered, "")
+	assert.False(t, ok)
+	uri, ok = matchRedirectURI(registered[:1], "")
+	assert.True(t, ok)
+	assert.Equal(t, registered[0], uri)
+}
+
+func TestVerifyPKCE(t *testing.T) {
+	assert.True(t, verifyPKCE(testChallenge(), testVerifier))
+	assert.False(t, verifyPKCE(testChallenge(), testVerifier[:len(testVerifier)-1]+"a"))
+	assert.False(t, verifyPKCE(testChallenge(), "short"))
+}
+
+func TestValidateAuthorizeRequest(t *testing.T) {
+	repo := new(MockRepo)
+	service := newOAuthService(repo, nil)
+
+	repo.On("GetOAuthClient", mock.Anything, "chat-web").Return(publicClient(), nil)
+	repo.On("GetOAuthClient", mock.Anything, "unknown").Return(nil, repository.ErrOAuthClientNotFound)
+
+	valid := func() *AuthorizeRequest {
+		return &AuthorizeRequest{
+			ClientID:            "chat-web",
+			ResponseType:        ResponseTypeCode,
+			Scope:               "chat",
+			CodeChallenge:       testChallenge(),
+			CodeChallengeMethod: PKCEMethodS256,
+		}
+	}
+
+	req := valid()
+	client, err := service.ValidateAuthorizeRequest(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, "chat-web", client.Id)
+	assert.Equal(t, "https://chat.example.com/callback", req.RedirectURI)
+
+	// Ошибки до проверки redirect_uri нельзя отправлять клиенту
+	req = valid()
+	req.ClientID = "unknown"
+	client, err = service.ValidateAuthorizeRequest(context.Background(), req)
+	assert.Nil(t, client)
+	assert.Error(t, err)
+
+	req = valid()
+	req.RedirectURI = "https://evil.example.com/callback"
+	client, err = service.ValidateAuthorizeRequest(context.Background(), req)
+	assert.Nil(t, client)
+	assert.Error(t, err)
+
+	// PKCE обязателен, plain не принимается
+	var oauthErr *OAuthError
+	req = valid()
+	req.CodeChallengeMethod = "plain"
+	client, err = service.ValidateAuthorizeRequest(context.Background(), req)
+	assert.NotNil(t, client)
+	assert.ErrorAs(t, err, &oauthErr)
+	assert.Equal(t, OAuthInvalidRequest, oauthErr.Code)
+
+	req = valid()
+	req.Scope = "chat admin"
+	_, err = service.ValidateAuthorizeRequest(context.Background(), req)
+	assert.ErrorAs(t, err, &oauthErr)
+	assert.Equal(t, OAuthInvalidScope, oauthErr.Code)
+}
+
+func TestExchangeAuthorizationCode(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	service := newOAuthService(repo, jwt)
+
+	repo.On("GetOAuthClient", mock.Anything, "chat-web").Return(publicClient(), nil)
+	repo.On("ConsumeAuthorizationCode", mock.Anything, "code").Return(&model.AuthorizationCode{
+		ClientId:            "chat-web",
+		UserId:              1,
+		RedirectURI:         "https://chat.example.com/callback",
+		Scope:               "chat",
+		CodeChallenge:       testChallenge(),
+		CodeChallengeMethod: PKCEMethodS256,
+	}, nil)
+	repo.On("GetUserByID", mock.Anything, int64(1)).Return(&model.User{Id: 1}, nil)
+	// Клиент получает только согласованные scopes, без ролей и прав пользователя
+	jwt.On("GenerateAccessToken", int64(1), security.Authorization{ClientID: "chat-web", Scopes: []string{"chat"}}).
+		Return("access", nil)
+	jwt.On("GenerateRefreshToken", int64(1)).Return("refresh", nil)
+	jwt.On("ParseAccessToken", "access").Return(&security.Claims{ExpiresAt: time.Now().Add(15 * time.Minute)}, nil)
+	repo.On("CreateRefreshToken", mock.Anything, mock.MatchedBy(func(rt model.RefreshToken) bool {
+		return rt.ClientId == "chat-web" && rt.Scope == "chat" && rt.DeviceName == "Chat Web"
+	})).Return(int64(10), nil)
+
+	tokens, err := service.ExchangeOAuthToken(context.Background(), TokenRequest{
+		GrantType:    GrantTypeAuthorizationCode,
+		ClientID:     "chat-web",
+		Code:         "code",
+		RedirectURI:  "https://chat.example.com/callback",
+		CodeVerifier: testVerifier,
+	}, model.Device{})
+	assert.NoError(t, err)
+	assert.Equal(t, "access", tokens.AccessToken)
+	assert.Equal(t, "refresh", tokens.RefreshToken)
+	assert.Equal(t, "chat", tokens.Scope)
+	assert.Equal(t, 15*time.Minute, tokens.ExpiresIn)
+	repo.AssertExpectations(t)
+}
+
+func TestExchangeAuthorizationCode_WrongVerifier(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	service := newOAuthService(repo, jwt)
+
+	repo.On("GetOAuthClient", mock.Anything, "chat-web").Return(publicClient(), nil)
+	repo.On("ConsumeAuthorizationCode", mock.Anything, "code").Return(&model.AuthorizationCode{
+		ClientId:      "chat-web",
+		UserId:        1,
+		CodeChallenge: testChallenge(),
+	}, nil)
+
+	// Код одноразовый: после неудачной попытки он уже израсходован
+	var oauthErr *OAuthError
+	_, err := service.ExchangeOAuthToken(context.Background(), TokenRequest{
+		GrantType:    GrantTypeAuthorizationCode,
+		ClientID:     "chat-web",
+		Code:         "code",
+		CodeVerifier: "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA",
+	}, model.Device{})
+	assert.ErrorAs(t, err, &oauthErr)
+	assert.Equal(t, OAuthInvalidGrant, oauthErr.Code)
+	jwt.AssertNotCalled(t, "GenerateAccessToken", mock.Anything, mock.Anything)
+}
+
+func TestExchangeAuthorizationCode_OtherClient(t *testing.T) {
+	repo := new(MockRepo)
+	service := newOAuthService(repo, new(MockJWT))
+
+	repo.On("GetOAuthClient", mock.Anything, "chat-web").Return(publicClient(), nil)
+	repo.On("ConsumeAuthorizationCode", mock.Anything, "code").Return(&model.AuthorizationCode{
+		ClientId:      "chat-mobile",
+		UserId:        1,
+		CodeChallenge: testChallenge(),
+	}, nil)
+
+	var oauthErr *OAuthError
+	_, err := service.ExchangeOAuthToken(context.Background(), TokenRequest{
+		GrantType:    GrantTypeAuthorizationCode,
+		ClientID:     "chat-web",
+		Code:         "code",
+		CodeVerifier: testVerifier,
+	}, model.Device{})
+	assert.ErrorAs(t, err, &oauthErr)
+	assert.Equal(t, OAuthInvalidGrant, oauthErr.Code)
+}
+
+func TestExchangeRefreshToken_BoundToClient(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	service := newOAuthService(repo, jwt)
+
+	repo.On("GetOAuthClient", mock.Anything, "chat-web").Return(publicClient(), nil)
+	jwt.On("VerifyRefreshToken", "refresh").Return(int64(1), nil)
+	repo.On("GetRefreshToken", mock.Anything, "refresh").
+		Return(&model.RefreshToken{Id: 10, UserId: 1, FamilyId: "family-1", ClientId: "chat-mobile"}, nil)
+
+	// Refresh-токен другого клиента не принимается
+	var oauthErr *OAuthError
+	_, err := service.ExchangeOAuthToken(context.Background(), TokenRequest{
+		GrantType:    GrantTypeRefreshToken,
+		ClientID:     "chat-web",
+		RefreshToken: "refresh",
+	}, model.Device{})
+	assert.ErrorAs(t, err, &oauthErr)
+	assert.Equal(t, OAuthInvalidGrant, oauthErr.Code)
+	repo.AssertNotCalled(t, "RotateRefreshToken", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestExchangeOAuthToken_ConfidentialClient(t *testing.T) {
+	repo := new(MockRepo)
+	service := newOAuthService(repo, new(MockJWT))
+
+	var stored model.OAuthClient
+	repo.On("CreateOAuthClient", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		stored = args.Get(1).(model.OAuthClient)
+	}).Return(nil)
+
+	client, secret, err := service.RegisterOAuthClient(context.Background(), "Backend", []string{"https://chat.example.com/cb"}, nil, true)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, secret)
+	assert.NotEqual(t, secret, stored.SecretHash)
+
+	repo.On("GetOAuthClient", mock.Anything, client.Id).Return(&stored, nil)
+
+	// Без секрета и с неверным секретом клиент не аутентифицируется
+	var oauthErr *OAuthError
+	for _, presented := range []string{"", "wrong"} {
+		_, err = service.ExchangeOAuthToken(context.Background(), TokenRequest{
+			GrantType:    GrantTypeAuthorizationCode,
+			ClientID:     client.Id,
+			ClientSecret: presented,
+		}, model.Device{})
+		assert.ErrorAs(t, err, &oauthErr)
+		assert.Equal(t, OAuthInvalidClient, oauthErr.Code)
+	}
+
+	// С верным секретом доходим до проверки параметров запроса
+	_, err = service.ExchangeOAuthToken(context.Background(), TokenRequest{
+		GrantType:    GrantTypeAuthorizationCode,
+		ClientID:     client.Id,
+		ClientSecret: secret,
+	}, model.Device{})
+	assert.ErrorAs(t, err, &oauthErr)
+	assert.Equal(t, OAuthInvalidRequest, oauthErr.Code)
+}
+
+func TestRegisterOAuthClient_InvalidRedirectURI(t *testing.T) {
+	service := newOAuthService(new(MockRepo), nil)
+
+	_, _, err := service.RegisterOAuthClient(context.Background(), "Chat", []string{"http://chat.example.com/cb"}, nil, false)
+	assert.ErrorIs(t, err, ErrInvalidRedirectURI)
+}
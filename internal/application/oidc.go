@@ -0,0 +1,135 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+)
+
+// Scopes of OpenID Connect Core section 5.4. Clients only get the ones they were
+// registered with.
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+var (
+	ErrOIDCDisabled      = errors.New("openid connect is not configured")
+	ErrInsufficientScope = errors.New("access token was not granted the openid scope")
+)
+
+// OIDC turns the OAuth authorization server into an OpenID Connect provider.
+type OIDC struct {
+	// Issuer must equal the iss claim of issued tokens; the endpoints are served below it.
+	Issuer string
+	// SigningAlgorithm is the alg of the access token keys, which sign ID tokens too.
+	SigningAlgorithm string
+}
+
+// WithOIDC needs WithOAuth as well, ID tokens are issued by the token endpoint.
+func WithOIDC(cfg OIDC) Option {
+	return func(s *AuthService) {
+		cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+		s.oidc = &cfg
+	}
+}
+
+// OpenIDConfiguration is the discovery document of OpenID Connect Discovery section 3.
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+func (s *AuthService) OpenIDConfiguration() (*OpenIDConfiguration, error) {
+	if s.oauth == nil || s.oidc == nil {
+		return nil, ErrOIDCDisabled
+	}
+
+	issuer := s.oidc.Issuer
+	return &OpenIDConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserinfoEndpoint:                  issuer + "/userinfo",
+		IntrospectionEndpoint:             issuer + "/oauth/introspect",
+		RevocationEndpoint:                issuer + "/oauth/revoke",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		ScopesSupported:                   []string{ScopeOpenID, ScopeProfile, ScopeEmail},
+		ResponseTypesSupported:            []string{ResponseTypeCode},
+		GrantTypesSupported:               []string{GrantTypeAuthorizationCode, GrantTypeRefreshToken, GrantTypeClientCredentials},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{s.oidc.SigningAlgorithm},
+		TokenEndpointAuthMethodsSupported: []string{"none", "client_secret_basic", "client_secret_post"},
+		CodeChallengeMethodsSupported:     []string{PKCEMethodS256},
+		ClaimsSupported: []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "azp",
+			"email", "email_verified", "preferred_username", "updated_at"},
+	}, nil
+}
+
+// UserInfo returns the claims the access token's scopes release about its user
+// (OpenID Connect Core section 5.3). Only tokens issued to a client that was granted
+// the openid scope are accepted.
+func (s *AuthService) UserInfo(ctx context.Context, claims *security.Claims) (map[string]interface{}, error) {
+	if s.oidc == nil {
+		return nil, ErrOIDCDisabled
+	}
+	if claims.ClientID == "" || !claims.HasScope(ScopeOpenID) {
+		return nil, ErrInsufficientScope
+	}
+
+	user, err := s.repo.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, ErrUserDisabled
+	}
+
+	return userClaims(user, claims.Scopes), nil
+}
+
+func (s *AuthService) idToken(user *model.User, clientID string, code *model.AuthorizationCode) (string, error) {
+	claims := userClaims(user, strings.Fields(code.Scope))
+	delete(claims, "sub")
+	claims["auth_time"] = code.AuthTime.Unix()
+	if code.Nonce != "" {
+		claims["nonce"] = code.Nonce
+	}
+
+	return s.jwtManager.GenerateIDToken(user.Id, clientID, claims)
+}
+
+// userClaims maps the user to the standard claims of the granted scopes. Users have
+// no name of their own, so profile only releases the email as preferred_username.
+func userClaims(user *model.User, scopes []string) map[string]interface{} {
+	claims := map[string]interface{}{
+		"sub": strconv.FormatInt(user.Id, 10),
+	}
+	if contains(scopes, ScopeEmail) {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.EmailVerifiedAt != nil
+	}
+	if contains(scopes, ScopeProfile) {
+		claims["preferred_username"] = user.Email
+		claims["updated_at"] = user.UpdatedAt.Unix()
+	}
+	return claims
+}
@@ -0,0 +1,121 @@
+package application
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newOIDCService(repo *MockRepo, jwt *MockJWT) *AuthService {
+	return NewAuthService(repo, jwt,
+		WithOAuth(OAuth{CodeTTL: time.Minute}),
+		WithOIDC(OIDC{Issuer: "https://auth.example.com/", SigningAlgorithm: "RS256"}))
+}
+
+func TestOpenIDConfiguration(t *testing.T) {
+	_, err := NewAuthService(nil, nil, WithOAuth(OAuth{})).OpenIDConfiguration()
+	assert.ErrorIs(t, err, ErrOIDCDisabled)
+
+	cfg, err := newOIDCService(nil, nil).OpenIDConfiguration()
+	assert.NoError(t, err)
+	assert.Equal(t, "https://auth.example.com", cfg.Issuer)
+	assert.Equal(t, "https://auth.example.com/oauth/token", cfg.TokenEndpoint)
+	assert.Equal(t, []string{"RS256"}, cfg.IDTokenSigningAlgValuesSupported)
+}
+
+func TestExchangeAuthorizationCode_IDToken(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	service := newOIDCService(repo, jwt)
+
+	authTime := time.Now().Add(-time.Minute)
+	verifiedAt := time.Now()
+	repo.On("GetOAuthClient", mock.Anything, "grafana").Return(&model.OAuthClient{Id: "grafana", Name: "Grafana",
+		GrantTypes: []string{GrantTypeAuthorizationCode}}, nil)
+	repo.On("ConsumeAuthorizationCode", mock.Anything, "code").Return(&model.AuthorizationCode{
+		ClientId:      "grafana",
+		UserId:        1,
+		Scope:         "openid email",
+		CodeChallenge: testChallenge(),
+		Nonce:         "n-1",
+		AuthTime:      authTime,
+	}, nil)
+	repo.On("GetUserByID", mock.Anything, int64(1)).
+		Return(&model.User{Id: 1, Email: "test@test.com", EmailVerifiedAt: &verifiedAt}, nil)
+	repo.On("GetUserRoles", mock.Anything, int64(1)).Return([]string{}, nil)
+	repo.On("GetUserPermissions", mock.Anything, int64(1)).Return([]string{}, nil)
+	// Access токен несёт клиента и выданные ему scope
+	jwt.On("GenerateAccessToken", int64(1), mock.MatchedBy(func(authz security.Authorization) bool {
+		return authz.ClientID == "grafana" && authz.HasScope("openid") && authz.HasScope("email")
+	})).Return("access", nil)
+	jwt.On("GenerateRefreshToken", int64(1)).Return("refresh", nil)
+	jwt.On("ParseAccessToken", "access").Return(&security.Claims{ExpiresAt: time.Now().Add(time.Minute)}, nil)
+	repo.On("CreateRefreshToken", mock.Anything, mock.Anything).Return(int64(10), nil)
+	jwt.On("GenerateIDToken", int64(1), "grafana", map[string]interface{}{
+		"auth_time":      authTime.Unix(),
+		"nonce":          "n-1",
+		"email":          "test@test.com",
+		"email_verified": true,
+	}).Return("id-token", nil)
+
+	tokens, err := service.ExchangeOAuthToken(context.Background(), TokenRequest{
+		GrantType:    GrantTypeAuthorizationCode,
+		ClientID:     "grafana",
+		Code:         "code",
+		CodeVerifier: testVerifier,
+	}, model.Device{})
+	assert.NoError(t, err)
+	assert.Equal(t, "id-token", tokens.IDToken)
+	jwt.AssertExpectations(t)
+}
+
+func TestValidateAuthorizeRequest_PromptNone(t *testing.T) {
+	repo := new(MockRepo)
+	service := newOIDCService(repo, nil)
+
+	client := publicClient()
+	client.Scopes = []string{"openid"}
+	repo.On("GetOAuthClient", mock.Anything, "chat-web").Return(client, nil)
+
+	// Сессии входа нет, поэтому prompt=none всегда требует логина
+	var oauthErr *OAuthError
+	_, err := service.ValidateAuthorizeRequest(context.Background(), &AuthorizeRequest{
+		ClientID:            "chat-web",
+		ResponseType:        ResponseTypeCode,
+		Scope:               "openid",
+		CodeChallenge:       testChallenge(),
+		CodeChallengeMethod: PKCEMethodS256,
+		Prompt:              "none",
+	})
+	assert.ErrorAs(t, err, &oauthErr)
+	assert.Equal(t, OAuthLoginRequired, oauthErr.Code)
+}
+
+func TestUserInfo(t *testing.T) {
+	repo := new(MockRepo)
+	service := newOIDCService(repo, nil)
+
+	updatedAt := time.Now()
+	repo.On("GetUserByID", mock.Anything, int64(1)).Return(&model.User{Id: 1, Email: "test@test.com", UpdatedAt: updatedAt}, nil)
+
+	claims := &security.Claims{UserID: 1, Authorization: security.Authorization{ClientID: "grafana", Scopes: []string{"openid", "profile"}}}
+	info, err := service.UserInfo(context.Background(), claims)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"sub":                "1",
+		"preferred_username": "test@test.com",
+		"updated_at":         updatedAt.Unix(),
+	}, info)
+
+	// Токены первой стороны и токены без openid не принимаются
+	_, err = service.UserInfo(context.Background(), &security.Claims{UserID: 1})
+	assert.ErrorIs(t, err, ErrInsufficientScope)
+	claims.Scopes = []string{"profile"}
+	_, err = service.UserInfo(context.Background(), claims)
+	assert.ErrorIs(t, err, ErrInsufficientScope)
+}
@@ -0,0 +1,180 @@
+package application
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Password policy violation codes.
+const (
+	PasswordTooShort      = "too_short"
+	PasswordTooLong       = "too_long"
+	PasswordMissingUpper  = "missing_uppercase"
+	PasswordMissingLower  = "missing_lowercase"
+	PasswordMissingDigit  = "missing_digit"
+	PasswordMissingSymbol = "missing_symbol"
+	PasswordContainsEmail = "contains_email"
+	PasswordReused        = "reused"
+	PasswordBreached      = "breached"
+)
+
+const (
+	passwordField = "password"
+	// Shorter local parts such as "jo" match too many ordinary passwords.
+	minEmailLocalPartToMatch = 3
+)
+
+// BreachedPasswordChecker reports whether a password appears in a known breach corpus.
+type BreachedPasswordChecker interface {
+	Contains(ctx context.Context, password string) (bool, error)
+}
+
+// PasswordPolicy is enforced whenever a password is set. The zero value accepts any
+// non-empty password.
+type PasswordPolicy struct {
+	MinLength     int
+	MaxLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// DisallowEmail rejects passwords containing the local part of the user's email.
+	DisallowEmail bool
+	// History is how many recent passwords, the current one included, cannot be reused.
+	History  int
+	Breached BreachedPasswordChecker
+}
+
+// PolicyViolation is one rule a password broke.
+type PolicyViolation struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError lists every rule a rejected password broke.
+type PasswordPolicyError struct {
+	Violations []PolicyViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.Message
+	}
+	return "password rejected: " + strings.Join(messages, "; ")
+}
+
+func WithPasswordPolicy(policy PasswordPolicy) Option {
+	return func(s *AuthService) {
+		s.passwordPolicy = policy
+	}
+}
+
+// validatePassword checks password against the policy. userID and currentHash are
+// zero for new accounts, which have no history to compare with.
+func (s *AuthService) validatePassword(ctx context.Context, userID int64, email, currentHash, password string) error {
+	p := s.passwordPolicy
+	var violations []PolicyViolation
+	violate := func(code, format string, args ...interface{}) {
+		violations = append(violations, PolicyViolation{Field: passwordField, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if p.MinLength > 0 && length < p.MinLength {
+		violate(PasswordTooShort, "must be at least %d characters long", p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violate(PasswordTooLong, "must be at most %d characters long", p.MaxLength)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		violate(PasswordMissingUpper, "must contain an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		violate(PasswordMissingLower, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		violate(PasswordMissingDigit, "must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		violate(PasswordMissingSymbol, "must contain a symbol")
+	}
+
+	if p.DisallowEmail {
+		local, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(email)), "@")
+		if utf8.RuneCountInString(local) >= minEmailLocalPartToMatch && strings.Contains(strings.ToLower(password), local) {
+			violate(PasswordContainsEmail, "must not contain your email address")
+		}
+	}
+
+	if len(violations) == 0 && userID != 0 && p.History > 0 {
+		reused, err := s.isRecentPassword(ctx, userID, currentHash, password)
+		if err != nil {
+			return err
+		}
+		if reused {
+			violate(PasswordReused, "must differ from your last %d passwords", p.History)
+		}
+	}
+
+	if len(violations) == 0 && p.Breached != nil {
+		breached, err := p.Breached.Contains(ctx, password)
+		if err != nil {
+			log.Printf("breached password check failed: %v", err)
+		} else if breached {
+			violate(PasswordBreached, "appears in a known data breach, choose another one")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+func (s *AuthService) isRecentPassword(ctx context.Context, userID int64, currentHash, password string) (bool, error) {
+	hashes, err := s.repo.ListPasswordHistory(ctx, userID, s.passwordPolicy.History)
+	if err != nil {
+		return false, err
+	}
+	// Accounts created before the history existed only have their current hash.
+	if currentHash != "" && (len(hashes) == 0 || hashes[0] != currentHash) {
+		hashes = append(hashes, currentHash)
+	}
+
+	for _, hash := range hashes {
+		// Hashes under a retired pepper cannot be checked and are skipped.
+		if ok, _, _ := s.passwords.Verify(password, hash); ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// recordPassword remembers a newly set password hash for the reuse check.
+func (s *AuthService) recordPassword(ctx context.Context, userID int64, hash string) {
+	if s.passwordPolicy.History <= 0 {
+		return
+	}
+	if err := s.repo.AddPasswordHistory(ctx, userID, hash, s.passwordPolicy.History); err != nil {
+		log.Printf("password history for user %d not recorded: %v", userID, err)
+	}
+}
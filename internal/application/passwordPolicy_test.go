@@ -0,0 +1,115 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type MockBreached struct {
+	mock.Mock
+}
+
+func (m *MockBreached) Contains(ctx context.Context, password string) (bool, error) {
+	args := m.Called(ctx, password)
+	return args.Bool(0), args.Error(1)
+}
+
+var testPolicy = PasswordPolicy{
+	MinLength:     10,
+	MaxLength:     64,
+	RequireUpper:  true,
+	RequireLower:  true,
+	RequireDigit:  true,
+	RequireSymbol: true,
+	DisallowEmail: true,
+	History:       3,
+}
+
+func policyCodes(t *testing.T, err error) []string {
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("expected PasswordPolicyError, got %v", err)
+	}
+	codes := make([]string, len(policyErr.Violations))
+	for i, v := range policyErr.Violations {
+		assert.Equal(t, "password", v.Field)
+		codes[i] = v.Code
+	}
+	return codes
+}
+
+func TestCreateUser_PasswordPolicyViolations(t *testing.T) {
+	repo := new(MockRepo)
+	service := NewAuthService(repo, nil, WithPasswordPolicy(testPolicy))
+
+	_, err := service.CreateUser(context.Background(), model.User{Email: "alice@test.com", Password: "alice"})
+	assert.ElementsMatch(t, []string{
+		PasswordTooShort, PasswordMissingUpper, PasswordMissingDigit, PasswordMissingSymbol, PasswordContainsEmail,
+	}, policyCodes(t, err))
+	repo.AssertNotCalled(t, "CreateUser", mock.Anything, mock.Anything)
+}
+
+func TestCreateUser_BreachedPassword(t *testing.T) {
+	repo := new(MockRepo)
+	breached := new(MockBreached)
+	policy := testPolicy
+	policy.Breached = breached
+	service := NewAuthService(repo, nil, WithPasswordPolicy(policy))
+
+	breached.On("Contains", mock.Anything, "Password123!").Return(true, nil)
+
+	_, err := service.CreateUser(context.Background(), model.User{Email: "bob@test.com", Password: "Password123!"})
+	assert.Equal(t, []string{PasswordBreached}, policyCodes(t, err))
+}
+
+func TestCreateUser_RecordsPasswordHistory(t *testing.T) {
+	repo := new(MockRepo)
+	breached := new(MockBreached)
+	policy := testPolicy
+	policy.Breached = breached
+	service := NewAuthService(repo, nil, WithPasswordPolicy(policy))
+
+	// Ошибка проверки утечек не блокирует регистрацию
+	breached.On("Contains", mock.Anything, mock.Anything).Return(false, errors.New("corpus unavailable"))
+	repo.On("CreateUser", mock.Anything, mock.Anything).Return(int64(1), nil)
+	repo.On("AddPasswordHistory", mock.Anything, int64(1), mock.Anything, 3).Return(nil)
+
+	id, err := service.CreateUser(context.Background(), model.User{Email: "bob@test.com", Password: "c0rrect-Horse"})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), id)
+	repo.AssertExpectations(t)
+}
+
+func TestChangePassword_RejectsRecentPassword(t *testing.T) {
+	repo := new(MockRepo)
+	service := NewAuthService(repo, nil, WithPasswordPolicy(testPolicy))
+
+	older, _ := bcrypt.GenerateFromPassword([]byte("0ld-Password"), bcrypt.MinCost)
+	repo.On("GetUserByID", mock.Anything, int64(1)).Return(testUser(t), nil)
+	repo.On("ListPasswordHistory", mock.Anything, int64(1), 3).Return([]string{string(older)}, nil)
+
+	err := service.ChangePassword(context.Background(), 1, "123456", "0ld-Password", "")
+	assert.Equal(t, []string{PasswordReused}, policyCodes(t, err))
+	repo.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestChangePassword_RecordsNewPassword(t *testing.T) {
+	repo := new(MockRepo)
+	service := NewAuthService(repo, nil, WithPasswordPolicy(testPolicy))
+
+	repo.On("GetUserByID", mock.Anything, int64(1)).Return(testUser(t), nil)
+	// Истории ещё нет, сравнивается только текущий хеш
+	repo.On("ListPasswordHistory", mock.Anything, int64(1), 3).Return([]string{}, nil)
+	repo.On("UpdatePassword", mock.Anything, int64(1), mock.Anything).Return(nil)
+	repo.On("AddPasswordHistory", mock.Anything, int64(1), mock.Anything, 3).Return(nil)
+	repo.On("RevokeUserRefreshTokens", mock.Anything, int64(1)).Return(nil)
+
+	assert.NoError(t, service.ChangePassword(context.Background(), 1, "123456", "N3w-Password", ""))
+	repo.AssertExpectations(t)
+}
@@ -0,0 +1,118 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/mail"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+)
+
+const PurposePasswordReset = "password_reset"
+
+// PasswordReset configures the links sent by ForgotPassword.
+type PasswordReset struct {
+	TokenTTL time.Duration
+	// LinkURL is the reset page; the token is added as the token query parameter.
+	LinkURL string
+}
+
+func WithPasswordReset(mailer mail.Mailer, cfg PasswordReset) Option {
+	return func(s *AuthService) {
+		s.mailer = mailer
+		s.passwordReset = cfg
+	}
+}
+
+// ForgotPassword mails a reset link to the account's address. It returns nil whether
+// or not the account exists, and the link is issued and sent in the background with
+// failures only logged, so neither the response nor its timing tells callers which
+// addresses are registered.
+func (s *AuthService) ForgotPassword(ctx context.Context, email string) error {
+	if s.mailer == nil || s.passwordReset.TokenTTL == 0 {
+		return errors.New("password reset is not configured")
+	}
+	if email == "" {
+		return errors.New("email must not be empty")
+	}
+
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s.runInBackground(func(ctx context.Context) {
+		if err := s.sendPasswordResetEmail(ctx, user.Id, user.Email); err != nil {
+			log.Printf("failed to send password reset email to user %d: %v", user.Id, err)
+		}
+	})
+	return nil
+}
+
+// ResetPassword consumes a reset token, stores the new password and ends every
+// session of the user, since whoever knew the old password may still hold one. The
+// user's other reset links stop working too. A password the policy rejects leaves
+// the token usable for another try, but spent or expired tokens are refused before
+// the policy runs, so they cannot be replayed to probe the password history.
+func (s *AuthService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	if token == "" || newPassword == "" {
+		return errors.New("token and password must not be empty")
+	}
+
+	active, err := s.activeActionToken(ctx, token, PurposePasswordReset)
+	if err != nil {
+		return err
+	}
+	userID := active.UserId
+
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.validatePassword(ctx, userID, user.Email, user.Password, newPassword); err != nil {
+		return err
+	}
+	hash, err := s.passwords.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.consumeActionToken(ctx, token, PurposePasswordReset); err != nil {
+		return err
+	}
+	if err := s.repo.UpdatePassword(ctx, userID, hash); err != nil {
+		return err
+	}
+	s.recordPassword(ctx, userID, hash)
+	if err := s.repo.InvalidateActionTokens(ctx, userID, PurposePasswordReset); err != nil {
+		log.Printf("failed to invalidate password reset links of user %d: %v", userID, err)
+	}
+
+	if s.revocations != nil {
+		return s.RevokeUserTokens(ctx, userID, time.Time{})
+	}
+	return s.repo.RevokeUserRefreshTokens(ctx, userID)
+}
+
+func (s *AuthService) sendPasswordResetEmail(ctx context.Context, userID int64, email string) error {
+	link, err := s.issueActionLink(ctx, model.ActionToken{UserId: userID, Purpose: PurposePasswordReset},
+		s.passwordReset.TokenTTL, s.passwordReset.LinkURL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Open the link below to choose a new password:\n\n%s\n\n"+
+			"The link expires in %s. If you did not ask for a reset, you can ignore this email.",
+			link, s.passwordReset.TokenTTL),
+	})
+}
@@ -0,0 +1,125 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/mail"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testPasswordReset = PasswordReset{
+	TokenTTL: 15 * time.Minute,
+	LinkURL:  "http://localhost/reset-password",
+}
+
+func TestForgotPassword_SendsResetLink(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	mailer := new(MockMailer)
+	service := NewAuthService(repo, jwt, WithPasswordReset(mailer, testPasswordReset))
+
+	repo.On("GetUserByEmail", mock.Anything, "test@test.com").Return(&model.User{Id: 1, Email: "test@test.com"}, nil)
+	jwt.On("GenerateActionToken", int64(1), PurposePasswordReset, 15*time.Minute).
+		Return("reset", &security.Claims{UserID: 1, ID: "jti-1"}, nil)
+	repo.On("CreateActionToken", mock.Anything, mock.Anything).Return(nil)
+	mailer.On("Send", mock.Anything, mock.MatchedBy(func(msg mail.Message) bool {
+		return msg.To == "test@test.com" && assert.Contains(t, msg.Body, "reset-password?token=reset")
+	})).Return(nil)
+
+	assert.NoError(t, service.ForgotPassword(context.Background(), "test@test.com"))
+	// Письмо отправляется в фоне
+	service.Wait()
+	mailer.AssertExpectations(t)
+}
+
+func TestForgotPassword_UnknownEmail(t *testing.T) {
+	repo := new(MockRepo)
+	mailer := new(MockMailer)
+	service := NewAuthService(repo, nil, WithPasswordReset(mailer, testPasswordReset))
+
+	repo.On("GetUserByEmail", mock.Anything, "ghost@test.com").Return((*model.User)(nil), repository.ErrUserNotFound)
+
+	// Ответ не должен отличаться от случая с существующим email
+	assert.NoError(t, service.ForgotPassword(context.Background(), "ghost@test.com"))
+	service.Wait()
+	mailer.AssertNotCalled(t, "Send", mock.Anything, mock.Anything)
+}
+
+func TestResetPassword_RevokesSessions(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	revocations := new(MockRevocations)
+	service := NewAuthService(repo, jwt, WithRevocationStore(revocations))
+
+	jwt.On("ParseActionToken", "reset", PurposePasswordReset).Return(&security.Claims{UserID: 1, ID: "jti-1"}, nil)
+	repo.On("GetActionToken", mock.Anything, "jti-1", PurposePasswordReset).
+		Return(&model.ActionToken{Jti: "jti-1", UserId: 1}, nil)
+	repo.On("ConsumeActionToken", mock.Anything, "jti-1", PurposePasswordReset).
+		Return(&model.ActionToken{Jti: "jti-1", UserId: 1}, nil)
+	repo.On("GetUserByID", mock.Anything, int64(1)).Return(testUser(t), nil)
+	repo.On("UpdatePassword", mock.Anything, int64(1), mock.MatchedBy(func(hash string) bool {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte("newPassword")) == nil
+	})).Return(nil)
+	// Остальные ссылки для сброса пароля перестают действовать
+	repo.On("InvalidateActionTokens", mock.Anything, int64(1), PurposePasswordReset).Return(nil)
+	revocations.On("RevokeUserTokens", mock.Anything, int64(1), mock.Anything).Return(nil)
+	repo.On("RevokeUserRefreshTokens", mock.Anything, int64(1)).Return(nil)
+
+	assert.NoError(t, service.ResetPassword(context.Background(), "reset", "newPassword"))
+	repo.AssertExpectations(t)
+	revocations.AssertExpectations(t)
+}
+
+func TestResetPassword_InvalidToken(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	service := NewAuthService(repo, jwt)
+
+	jwt.On("ParseActionToken", "verify", PurposePasswordReset).Return(nil, assert.AnError)
+
+	err := service.ResetPassword(context.Background(), "verify", "newPassword")
+	assert.ErrorIs(t, err, repository.ErrActionTokenInvalid)
+	repo.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestResetPassword_PolicyViolationKeepsToken(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	service := NewAuthService(repo, jwt, WithPasswordPolicy(PasswordPolicy{MinLength: 8}))
+
+	jwt.On("ParseActionToken", "reset", PurposePasswordReset).Return(&security.Claims{UserID: 1, ID: "jti-1"}, nil)
+	repo.On("GetActionToken", mock.Anything, "jti-1", PurposePasswordReset).
+		Return(&model.ActionToken{Jti: "jti-1", UserId: 1}, nil)
+	repo.On("GetUserByID", mock.Anything, int64(1)).Return(testUser(t), nil)
+
+	err := service.ResetPassword(context.Background(), "reset", "short")
+
+	var policyErr *PasswordPolicyError
+	assert.True(t, errors.As(err, &policyErr))
+	// Ссылка остаётся действительной, пользователь может выбрать другой пароль
+	repo.AssertNotCalled(t, "ConsumeActionToken", mock.Anything, mock.Anything, mock.Anything)
+	repo.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestResetPassword_UsedTokenSkipsPolicy(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	service := NewAuthService(repo, jwt, WithPasswordPolicy(PasswordPolicy{MinLength: 8, History: 5}))
+
+	jwt.On("ParseActionToken", "reset", PurposePasswordReset).Return(&security.Claims{UserID: 1, ID: "jti-1"}, nil)
+	repo.On("GetActionToken", mock.Anything, "jti-1", PurposePasswordReset).Return(nil, repository.ErrActionTokenInvalid)
+
+	// Использованная ссылка не позволяет перебирать прошлые пароли
+	err := service.ResetPassword(context.Background(), "reset", "oldPassword1")
+	assert.ErrorIs(t, err, repository.ErrActionTokenInvalid)
+	repo.AssertNotCalled(t, "ListPasswordHistory", mock.Anything, mock.Anything, mock.Anything)
+	repo.AssertNotCalled(t, "GetUserByID", mock.Anything, mock.Anything)
+}
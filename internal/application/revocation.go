@@ -0,0 +1,85 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+)
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+type RevocationStore interface {
+	IsRevoked(ctx context.Context, claims *security.Claims) (bool, error)
+	RevokeToken(ctx context.Context, claims *security.Claims) error
+	RevokeUserTokens(ctx context.Context, userID int64, before time.Time) error
+}
+
+func WithRevocationStore(store RevocationStore) Option {
+	return func(s *AuthService) {
+		s.revocations = store
+	}
+}
+
+// AuthenticateAccessToken verifies the signature and checks the denylist.
+func (s *AuthService) AuthenticateAccessToken(ctx context.Context, token string) (*security.Claims, error) {
+	if token == "" {
+		return nil, errors.New("token must not be empty")
+	}
+
+	claims, err := s.jwtManager.ParseAccessToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.revocations != nil {
+		revoked, err := s.revocations.IsRevoked(ctx, claims)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+
+	return claims, nil
+}
+
+// RevokeAccessToken puts a single access token on the denylist until it expires.
+func (s *AuthService) RevokeAccessToken(ctx context.Context, token string) error {
+	if s.revocations == nil {
+		return errors.New("token revocation is not configured")
+	}
+
+	claims, err := s.jwtManager.ParseAccessToken(token)
+	if err != nil {
+		return err
+	}
+	if claims.ID == "" {
+		return errors.New("token has no jti and can only be revoked per user")
+	}
+
+	return s.revocations.RevokeToken(ctx, claims)
+}
+
+// RevokeUserTokens rejects every access token of the user issued before the given
+// time and ends all of their sessions. A zero or future time means now, since a
+// cutoff in the future would reject the user's next logins as well.
+func (s *AuthService) RevokeUserTokens(ctx context.Context, userID int64, before time.Time) error {
+	if userID == 0 {
+		return errors.New("userID must not be empty")
+	}
+	if s.revocations == nil {
+		return errors.New("token revocation is not configured")
+	}
+	if now := time.Now().UTC(); before.IsZero() || before.After(now) {
+		before = now
+	}
+
+	if err := s.revocations.RevokeUserTokens(ctx, userID, before); err != nil {
+		return err
+	}
+
+	return s.repo.RevokeUserRefreshTokens(ctx, userID)
+}
@@ -0,0 +1,100 @@
+package application
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockRevocations struct {
+	mock.Mock
+}
+
+func (m *MockRevocations) IsRevoked(ctx context.Context, claims *security.Claims) (bool, error) {
+	args := m.Called(ctx, claims)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRevocations) RevokeToken(ctx context.Context, claims *security.Claims) error {
+	args := m.Called(ctx, claims)
+	return args.Error(0)
+}
+
+func (m *MockRevocations) RevokeUserTokens(ctx context.Context, userID int64, before time.Time) error {
+	args := m.Called(ctx, userID, before)
+	return args.Error(0)
+}
+
+func TestValidateToken_Revoked(t *testing.T) {
+	jwt := new(MockJWT)
+	revocations := new(MockRevocations)
+	service := NewAuthService(nil, jwt, WithRevocationStore(revocations))
+
+	claims := &security.Claims{UserID: 1, ID: "jti-1"}
+	jwt.On("ParseAccessToken", "access").Return(claims, nil)
+	revocations.On("IsRevoked", mock.Anything, claims).Return(true, nil)
+
+	_, err := service.ValidateToken(context.Background(), "access")
+	assert.ErrorIs(t, err, ErrTokenRevoked)
+}
+
+func TestValidateToken_NotRevoked(t *testing.T) {
+	jwt := new(MockJWT)
+	revocations := new(MockRevocations)
+	service := NewAuthService(nil, jwt, WithRevocationStore(revocations))
+
+	claims := &security.Claims{UserID: 1, ID: "jti-1"}
+	jwt.On("ParseAccessToken", "access").Return(claims, nil)
+	revocations.On("IsRevoked", mock.Anything, claims).Return(false, nil)
+
+	userID, err := service.ValidateToken(context.Background(), "access")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), userID)
+}
+
+func TestRevokeAccessToken(t *testing.T) {
+	jwt := new(MockJWT)
+	revocations := new(MockRevocations)
+	service := NewAuthService(nil, jwt, WithRevocationStore(revocations))
+
+	claims := &security.Claims{UserID: 1, ID: "jti-1"}
+	jwt.On("ParseAccessToken", "access").Return(claims, nil)
+	revocations.On("RevokeToken", mock.Anything, claims).Return(nil)
+
+	assert.NoError(t, service.RevokeAccessToken(context.Background(), "access"))
+
+	jwt.On("ParseAccessToken", "legacy").Return(&security.Claims{UserID: 1}, nil)
+	assert.Error(t, service.RevokeAccessToken(context.Background(), "legacy"))
+}
+
+func TestRevokeUserTokens_EndsSessions(t *testing.T) {
+	repo := new(MockRepo)
+	revocations := new(MockRevocations)
+	service := NewAuthService(repo, nil, WithRevocationStore(revocations))
+
+	before := time.Now()
+	revocations.On("RevokeUserTokens", mock.Anything, int64(1), before).Return(nil)
+	repo.On("RevokeUserRefreshTokens", mock.Anything, int64(1)).Return(nil)
+
+	assert.NoError(t, service.RevokeUserTokens(context.Background(), 1, before))
+	repo.AssertExpectations(t)
+}
+
+func TestRevokeUserTokens_FutureCutoffClampedToNow(t *testing.T) {
+	repo := new(MockRepo)
+	revocations := new(MockRevocations)
+	service := NewAuthService(repo, nil, WithRevocationStore(revocations))
+
+	// Отсечка в будущем заблокировала бы и следующие входы пользователя
+	revocations.On("RevokeUserTokens", mock.Anything, int64(1), mock.MatchedBy(func(before time.Time) bool {
+		return !before.After(time.Now())
+	})).Return(nil)
+	repo.On("RevokeUserRefreshTokens", mock.Anything, int64(1)).Return(nil)
+
+	assert.NoError(t, service.RevokeUserTokens(context.Background(), 1, time.Now().Add(24*time.Hour)))
+	revocations.AssertExpectations(t)
+}
@@ -0,0 +1,90 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+)
+
+// Permissions checked by the auth service itself. Downstream services define their own.
+const (
+	PermissionManageRoles   = "roles:manage"
+	PermissionRevokeTokens  = "tokens:revoke"
+	PermissionManageUsers   = "users:manage"
+	PermissionManageClients = "clients:manage"
+)
+
+var ErrPermissionDenied = errors.New("permission denied")
+
+// AuthorizeToken authenticates the access token and returns its claims, including
+// the roles and permissions granted when it was issued. Tokens of service clients
+// are accepted too; their claims have no UserID, see Claims.IsService.
+func (s *AuthService) AuthorizeToken(ctx context.Context, token, audience string) (*security.Claims, error) {
+	claims, err := s.AuthenticateAccessToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if audience != "" && !claims.HasAudience(audience) {
+		return nil, fmt.Errorf("token is not valid for audience %q", audience)
+	}
+	if claims.UserID == 0 && !claims.IsService() {
+		return nil, errors.New("user not found")
+	}
+
+	return claims, nil
+}
+
+func (s *AuthService) ListRoles(ctx context.Context) ([]model.Role, error) {
+	return s.repo.ListRoles(ctx)
+}
+
+func (s *AuthService) SaveRole(ctx context.Context, role model.Role) (int64, error) {
+	if role.Name == "" {
+		return 0, errors.New("role name must not be empty")
+	}
+	return s.repo.SaveRole(ctx, role)
+}
+
+// AssignRole takes effect on the user's next login or token refresh.
+func (s *AuthService) AssignRole(ctx context.Context, userID int64, role string) error {
+	if userID == 0 || role == "" {
+		return errors.New("userID and role must not be empty")
+	}
+	return s.repo.AssignRole(ctx, userID, role)
+}
+
+// RevokeRole takes effect on the user's next token refresh. Revoke the user's access
+// tokens as well when the change must apply immediately.
+func (s *AuthService) RevokeRole(ctx context.Context, userID int64, role string) error {
+	if userID == 0 || role == "" {
+		return errors.New("userID and role must not be empty")
+	}
+	return s.repo.RevokeRole(ctx, userID, role)
+}
+
+func (s *AuthService) userAuthorization(ctx context.Context, userID int64) (security.Authorization, error) {
+	roles, err := s.repo.GetUserRoles(ctx, userID)
+	if err != nil {
+		return security.Authorization{}, err
+	}
+	permissions, err := s.repo.GetUserPermissions(ctx, userID)
+	if err != nil {
+		return security.Authorization{}, err
+	}
+
+	return security.Authorization{Roles: roles, Permissions: permissions}, nil
+}
+
+// clientAuthorization returns the user's own roles and permissions for first-party
+// tokens. Tokens issued to an OAuth client carry only the scopes the user consented
+// to: a third-party client must never act with the user's admin permissions.
+func (s *AuthService) clientAuthorization(ctx context.Context, userID int64, clientID, scope string) (security.Authorization, error) {
+	if clientID != "" {
+		return security.Authorization{ClientID: clientID, Scopes: strings.Fields(scope)}, nil
+	}
+	return s.userAuthorization(ctx, userID)
+}
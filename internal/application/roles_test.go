@@ -0,0 +1,43 @@
+package application
+
+import (
+	"context"
+	"testing"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAuthorizeToken_ReturnsPermissions(t *testing.T) {
+	jwt := new(MockJWT)
+	service := NewAuthService(nil, jwt)
+
+	claims := &security.Claims{
+		UserID:        1,
+		Audience:      []string{"chat"},
+		Authorization: security.Authorization{Roles: []string{"admin"}, Permissions: []string{PermissionRevokeTokens}},
+	}
+	jwt.On("ParseAccessToken", "access").Return(claims, nil)
+
+	got, err := service.AuthorizeToken(context.Background(), "access", "chat")
+	assert.NoError(t, err)
+	assert.True(t, got.HasPermission(PermissionRevokeTokens))
+
+	// Токен выпущен для другой аудитории
+	_, err = service.AuthorizeToken(context.Background(), "access", "billing")
+	assert.Error(t, err)
+}
+
+func TestAssignRole(t *testing.T) {
+	repo := new(MockRepo)
+	service := NewAuthService(repo, nil)
+
+	repo.On("AssignRole", mock.Anything, int64(1), "admin").Return(nil)
+	repo.On("AssignRole", mock.Anything, int64(1), "ghost").Return(repository.ErrRoleNotFound)
+
+	assert.NoError(t, service.AssignRole(context.Background(), 1, "admin"))
+	assert.ErrorIs(t, service.AssignRole(context.Background(), 1, "ghost"), repository.ErrRoleNotFound)
+	assert.Error(t, service.AssignRole(context.Background(), 0, "admin"))
+}
@@ -0,0 +1,30 @@
+package application
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+const (
+	EventRefreshTokenReuse = "refresh_token_reuse"
+)
+
+// SecurityEvent records something the security team should be able to alert on.
+type SecurityEvent struct {
+	Type       string            `json:"type"`
+	UserID     int64             `json:"user_id"`
+	Details    map[string]string `json:"details,omitempty"`
+	OccurredAt time.Time         `json:"occurred_at"`
+}
+
+type SecurityEventPublisher interface {
+	Publish(ctx context.Context, event SecurityEvent)
+}
+
+// LogSecurityEventPublisher writes events to the service log; it is the default publisher.
+type LogSecurityEventPublisher struct{}
+
+func (LogSecurityEventPublisher) Publish(_ context.Context, event SecurityEvent) {
+	log.Printf("security event %s: user_id=%d details=%v", event.Type, event.UserID, event.Details)
+}
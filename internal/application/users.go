@@ -0,0 +1,99 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrUserDisabled = errors.New("user is disabled")
+
+// DisableUser blocks every login of the user and ends their sessions. The account and
+// its data stay in place until EnableUser or DeleteUser.
+func (s *AuthService) DisableUser(ctx context.Context, userID int64) error {
+	if userID == 0 {
+		return errors.New("userID must not be empty")
+	}
+
+	if err := s.repo.SetUserDisabled(ctx, userID, true); err != nil {
+		return err
+	}
+	return s.endAllSessions(ctx, userID)
+}
+
+func (s *AuthService) EnableUser(ctx context.Context, userID int64) error {
+	if userID == 0 {
+		return errors.New("userID must not be empty")
+	}
+
+	return s.repo.SetUserDisabled(ctx, userID, false)
+}
+
+// DeleteUser removes the account for good. Its sessions and access tokens are revoked
+// first; without a revocation store, access tokens already issued stay valid until
+// they expire.
+func (s *AuthService) DeleteUser(ctx context.Context, userID int64) error {
+	if userID == 0 {
+		return errors.New("userID must not be empty")
+	}
+
+	if err := s.endAllSessions(ctx, userID); err != nil {
+		return err
+	}
+	return s.repo.DeleteUser(ctx, userID)
+}
+
+// SetPassword replaces the password without knowing the current one, e.g. when an
+// operator recovers an account. The password policy still applies and every session
+// of the user ends.
+func (s *AuthService) SetPassword(ctx context.Context, userID int64, password string) error {
+	if password == "" {
+		return errors.New("password must not be empty")
+	}
+
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.validatePassword(ctx, userID, user.Email, user.Password, password); err != nil {
+		return err
+	}
+
+	hash, err := s.passwords.Hash(password)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.UpdatePassword(ctx, userID, hash); err != nil {
+		return err
+	}
+	s.recordPassword(ctx, userID, hash)
+
+	return s.endAllSessions(ctx, userID)
+}
+
+// IssueAccessToken mints an access token with the user's current roles without a
+// login or a session, e.g. for operators debugging a client.
+func (s *AuthService) IssueAccessToken(ctx context.Context, userID int64) (string, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if user.DisabledAt != nil {
+		return "", ErrUserDisabled
+	}
+
+	authz, err := s.userAuthorization(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	return s.jwtManager.GenerateAccessToken(userID, authz)
+}
+
+// endAllSessions revokes the user's refresh tokens and, when revocation is
+// configured, the access tokens issued so far.
+func (s *AuthService) endAllSessions(ctx context.Context, userID int64) error {
+	if s.revocations == nil {
+		return s.repo.RevokeUserRefreshTokens(ctx, userID)
+	}
+	return s.RevokeUserTokens(ctx, userID, time.Time{})
+}
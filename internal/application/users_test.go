@@ -0,0 +1,108 @@
+package application
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestDisableUser_EndsSessions(t *testing.T) {
+	repo := new(MockRepo)
+	revocations := new(MockRevocations)
+	service := NewAuthService(repo, nil, WithRevocationStore(revocations))
+
+	repo.On("SetUserDisabled", mock.Anything, int64(1), true).Return(nil)
+	revocations.On("RevokeUserTokens", mock.Anything, int64(1), mock.Anything).Return(nil)
+	repo.On("RevokeUserRefreshTokens", mock.Anything, int64(1)).Return(nil)
+
+	assert.NoError(t, service.DisableUser(context.Background(), 1))
+	repo.AssertExpectations(t)
+	revocations.AssertExpectations(t)
+}
+
+func TestDisableUser_NotFound(t *testing.T) {
+	repo := new(MockRepo)
+	service := NewAuthService(repo, nil)
+
+	repo.On("SetUserDisabled", mock.Anything, int64(1), true).Return(repository.ErrUserNotFound)
+
+	assert.ErrorIs(t, service.DisableUser(context.Background(), 1), repository.ErrUserNotFound)
+	repo.AssertNotCalled(t, "RevokeUserRefreshTokens", mock.Anything, mock.Anything)
+}
+
+func TestDeleteUser_RevokesTokensFirst(t *testing.T) {
+	repo := new(MockRepo)
+	revocations := new(MockRevocations)
+	service := NewAuthService(repo, nil, WithRevocationStore(revocations))
+
+	var calls []string
+	revocations.On("RevokeUserTokens", mock.Anything, int64(1), mock.Anything).
+		Run(func(mock.Arguments) { calls = append(calls, "revoke") }).Return(nil)
+	repo.On("RevokeUserRefreshTokens", mock.Anything, int64(1)).Return(nil)
+	repo.On("DeleteUser", mock.Anything, int64(1)).
+		Run(func(mock.Arguments) { calls = append(calls, "delete") }).Return(nil)
+
+	assert.NoError(t, service.DeleteUser(context.Background(), 1))
+	// Уже выданные access токены отзываются до удаления аккаунта
+	assert.Equal(t, []string{"revoke", "delete"}, calls)
+}
+
+func TestLoginUser_Disabled(t *testing.T) {
+	repo := new(MockRepo)
+	service := NewAuthService(repo, new(MockJWT))
+
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.DefaultCost)
+	disabledAt := time.Now()
+	user := &model.User{Id: 1, Email: "test@test.com", Password: string(hashedPassword), DisabledAt: &disabledAt}
+
+	repo.On("GetUserByEmail", mock.Anything, "test@test.com").Return(user, nil)
+
+	// Даже с верным паролем отключённый пользователь не получает токены
+	_, err := service.LoginUser(context.Background(), model.User{Email: "test@test.com", Password: "123456"}, model.Device{})
+	assert.ErrorIs(t, err, ErrUserDisabled)
+	repo.AssertNotCalled(t, "CreateRefreshToken", mock.Anything, mock.Anything)
+}
+
+func TestSetPassword(t *testing.T) {
+	repo := new(MockRepo)
+	service := NewAuthService(repo, nil, WithPasswordPolicy(PasswordPolicy{MinLength: 8}))
+
+	user := &model.User{Id: 1, Email: "test@test.com", Password: "old-hash"}
+	repo.On("GetUserByID", mock.Anything, int64(1)).Return(user, nil)
+	repo.On("UpdatePassword", mock.Anything, int64(1), mock.AnythingOfType("string")).Return(nil).Once()
+	repo.On("RevokeUserRefreshTokens", mock.Anything, int64(1)).Return(nil).Once()
+
+	// Слишком короткий пароль отклоняется политикой
+	var policyErr *PasswordPolicyError
+	assert.ErrorAs(t, service.SetPassword(context.Background(), 1, "short"), &policyErr)
+
+	assert.NoError(t, service.SetPassword(context.Background(), 1, "long enough password"))
+	repo.AssertExpectations(t)
+}
+
+func TestIssueAccessToken(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	service := NewAuthService(repo, jwt)
+
+	repo.On("GetUserByID", mock.Anything, int64(1)).Return(&model.User{Id: 1}, nil)
+	repo.On("GetUserRoles", mock.Anything, int64(1)).Return([]string{"admin"}, nil)
+	repo.On("GetUserPermissions", mock.Anything, int64(1)).Return([]string{}, nil)
+	jwt.On("GenerateAccessToken", int64(1), mock.Anything).Return("access", nil)
+
+	token, err := service.IssueAccessToken(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "access", token)
+
+	disabledAt := time.Now()
+	repo.On("GetUserByID", mock.Anything, int64(2)).Return(&model.User{Id: 2, DisabledAt: &disabledAt}, nil)
+
+	_, err = service.IssueAccessToken(context.Background(), 2)
+	assert.ErrorIs(t, err, ErrUserDisabled)
+}
@@ -0,0 +1,426 @@
+package application
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const (
+	PurposePasskeyRegistration = "passkey_registration"
+	PurposePasskeyLogin        = "passkey_login"
+	PurposePasskeyMFA          = "passkey_mfa"
+)
+
+var (
+	ErrPasskeyInvalid     = errors.New("passkey verification failed")
+	ErrPasskeysDisabled   = errors.New("passkeys are not configured")
+	ErrNoPasskeysEnrolled = errors.New("no passkeys registered")
+)
+
+// WebAuthn configures passkey registration and login.
+type WebAuthn struct {
+	RelyingParty *webauthn.WebAuthn
+	// SessionTTL bounds the time between the begin and finish step of a ceremony.
+	SessionTTL time.Duration
+}
+
+func WithWebAuthn(cfg WebAuthn) Option {
+	return func(s *AuthService) {
+		s.webauthn = &cfg
+	}
+}
+
+// PasskeyCeremony is returned by the begin steps. Options is passed to
+// navigator.credentials.create or .get, SessionID back to the finish step.
+type PasskeyCeremony struct {
+	SessionID string      `json:"session_id"`
+	Options   interface{} `json:"options"`
+}
+
+// BeginPasskeyRegistration starts adding a passkey to a logged in user. Passkeys the
+// user already has are excluded so the same authenticator is not registered twice.
+func (s *AuthService) BeginPasskeyRegistration(ctx context.Context, userID int64) (*PasskeyCeremony, error) {
+	if s.webauthn == nil {
+		return nil, ErrPasskeysDisabled
+	}
+
+	user, err := s.passkeyUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	creation, session, err := s.webauthn.RelyingParty.BeginRegistration(user,
+		webauthn.WithExclusions(webauthn.Credentials(user.WebAuthnCredentials()).CredentialDescriptors()),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred))
+	if err != nil {
+		return nil, err
+	}
+
+	sessionID, err := s.saveWebAuthnSession(ctx, userID, PurposePasskeyRegistration, session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PasskeyCeremony{SessionID: sessionID, Options: creation}, nil
+}
+
+// FinishPasskeyRegistration verifies the authenticator's attestation response and
+// stores the new credential under name.
+func (s *AuthService) FinishPasskeyRegistration(ctx context.Context, userID int64, sessionID, name string, response []byte) (*model.WebAuthnCredential, error) {
+	if s.webauthn == nil {
+		return nil, ErrPasskeysDisabled
+	}
+
+	session, err := s.consumeWebAuthnSession(ctx, sessionID, PurposePasskeyRegistration)
+	if err != nil {
+		return nil, err
+	}
+	if !sameUserHandle(session.UserID, userID) {
+		return nil, repository.ErrWebAuthnSessionInvalid
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPasskeyInvalid, err)
+	}
+
+	user, err := s.passkeyUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	created, err := s.webauthn.RelyingParty.CreateCredential(user, *session, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPasskeyInvalid, err)
+	}
+
+	credential := fromWebAuthnCredential(userID, name, created)
+	id, err := s.repo.CreateWebAuthnCredential(ctx, credential)
+	if err != nil {
+		return nil, err
+	}
+	credential.Id = id
+
+	return &credential, nil
+}
+
+func (s *AuthService) ListPasskeys(ctx context.Context, userID int64) ([]model.WebAuthnCredential, error) {
+	return s.repo.ListWebAuthnCredentials(ctx, userID)
+}
+
+func (s *AuthService) DeletePasskey(ctx context.Context, userID, id int64) error {
+	return s.repo.DeleteWebAuthnCredential(ctx, userID, id)
+}
+
+// BeginPasskeyLogin starts a passwordless login. The user is not known yet: the
+// authenticator picks one of its discoverable credentials for this site.
+func (s *AuthService) BeginPasskeyLogin(ctx context.Context) (*PasskeyCeremony, error) {
+	if s.webauthn == nil {
+		return nil, ErrPasskeysDisabled
+	}
+
+	// The passkey is the only factor here, so it must have verified the user.
+	assertion, session, err := s.webauthn.RelyingParty.BeginDiscoverableLogin(
+		webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return nil, err
+	}
+
+	sessionID, err := s.saveWebAuthnSession(ctx, 0, PurposePasskeyLogin, session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PasskeyCeremony{SessionID: sessionID, Options: assertion}, nil
+}
+
+// FinishPasskeyLogin verifies the assertion and opens a session for the passkey's
+// owner. It is an alternative to LoginUser and skips the second factor, as a
+// user-verifying passkey already proves possession and knowledge or biometrics.
+func (s *AuthService) FinishPasskeyLogin(ctx context.Context, sessionID string, response []byte, device model.Device) (*Tokens, error) {
+	if s.webauthn == nil {
+		return nil, ErrPasskeysDisabled
+	}
+
+	session, err := s.consumeWebAuthnSession(ctx, sessionID, PurposePasskeyLogin)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPasskeyInvalid, err)
+	}
+
+	var owner *passkeyUser
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		stored, err := s.repo.GetWebAuthnCredential(ctx, rawID)
+		if err != nil {
+			return nil, err
+		}
+		if !sameUserHandle(userHandle, stored.UserId) {
+			return nil, errors.New("user handle does not match credential")
+		}
+		owner, err = s.passkeyUser(ctx, stored.UserId)
+		return owner, err
+	}
+
+	_, credential, err := s.webauthn.RelyingParty.ValidatePasskeyLogin(handler, *session, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPasskeyInvalid, err)
+	}
+	if err := s.recordPasskeyUse(ctx, credential); err != nil {
+		return nil, err
+	}
+	if owner.user.DisabledAt != nil {
+		return nil, ErrUserDisabled
+	}
+	if s.verification.Required && owner.user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+
+	return s.startSession(ctx, owner.user.Id, device)
+}
+
+// BeginPasskeyMFA starts using a passkey as the second factor of a password login.
+// The challenge token is only checked here and consumed by CompletePasskeyMFALogin.
+func (s *AuthService) BeginPasskeyMFA(ctx context.Context, challengeToken string) (*PasskeyCeremony, error) {
+	if s.webauthn == nil {
+		return nil, ErrPasskeysDisabled
+	}
+
+	claims, err := s.jwtManager.ParseActionToken(challengeToken, PurposeMFAChallenge)
+	if err != nil {
+		return nil, repository.ErrActionTokenInvalid
+	}
+
+	user, err := s.passkeyUser(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if len(user.credentials) == 0 {
+		return nil, ErrNoPasskeysEnrolled
+	}
+
+	assertion, session, err := s.webauthn.RelyingParty.BeginLogin(user)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionID, err := s.saveWebAuthnSession(ctx, claims.UserID, PurposePasskeyMFA, session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PasskeyCeremony{SessionID: sessionID, Options: assertion}, nil
+}
+
+// CompletePasskeyMFALogin is CompleteMFALogin with a passkey assertion instead of a
+// code. Like there, the challenge is used up even when the assertion is wrong.
+func (s *AuthService) CompletePasskeyMFALogin(ctx context.Context, challengeToken, sessionID string, response []byte, device model.Device) (*Tokens, error) {
+	if s.webauthn == nil {
+		return nil, ErrPasskeysDisabled
+	}
+
+	challenge, err := s.consumeActionToken(ctx, challengeToken, PurposeMFAChallenge)
+	if err != nil {
+		return nil, err
+	}
+	session, err := s.consumeWebAuthnSession(ctx, sessionID, PurposePasskeyMFA)
+	if err != nil {
+		return nil, err
+	}
+	if !sameUserHandle(session.UserID, challenge.UserId) {
+		return nil, repository.ErrWebAuthnSessionInvalid
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPasskeyInvalid, err)
+	}
+	user, err := s.passkeyUser(ctx, challenge.UserId)
+	if err != nil {
+		return nil, err
+	}
+	credential, err := s.webauthn.RelyingParty.ValidateLogin(user, *session, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrPasskeyInvalid, err)
+	}
+	if err := s.recordPasskeyUse(ctx, credential); err != nil {
+		return nil, err
+	}
+	s.resetLoginFailures(ctx, user.user.Email)
+
+	return s.startSession(ctx, challenge.UserId, device)
+}
+
+// recordPasskeyUse stores the new signature counter. A counter that did not move
+// forward means the private key was copied, so the login is refused.
+func (s *AuthService) recordPasskeyUse(ctx context.Context, credential *webauthn.Credential) error {
+	if credential.Authenticator.CloneWarning {
+		return fmt.Errorf("%w: signature counter went backwards", ErrPasskeyInvalid)
+	}
+	return s.repo.UpdateWebAuthnCredentialUsage(ctx, credential.ID, credential.Authenticator.SignCount,
+		credentialFlags(credential.Flags))
+}
+
+func (s *AuthService) hasPasskeys(ctx context.Context, userID int64) (bool, error) {
+	if s.webauthn == nil {
+		return false, nil
+	}
+	credentials, err := s.repo.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return len(credentials) > 0, nil
+}
+
+func (s *AuthService) saveWebAuthnSession(ctx context.Context, userID int64, purpose string, session *webauthn.SessionData) (string, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	id, err := newFamilyID()
+	if err != nil {
+		return "", err
+	}
+
+	err = s.repo.CreateWebAuthnSession(ctx, model.WebAuthnSession{
+		Id:        id,
+		UserId:    userID,
+		Purpose:   purpose,
+		Data:      string(data),
+		ExpiresAt: time.Now().Add(s.webauthn.SessionTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (s *AuthService) consumeWebAuthnSession(ctx context.Context, id, purpose string) (*webauthn.SessionData, error) {
+	if id == "" {
+		return nil, repository.ErrWebAuthnSessionInvalid
+	}
+
+	stored, err := s.repo.ConsumeWebAuthnSession(ctx, id, purpose)
+	if err != nil {
+		return nil, err
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(stored.Data), &session); err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (s *AuthService) passkeyUser(ctx context.Context, userID int64) (*passkeyUser, error) {
+	user, err := s.repo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	credentials, err := s.repo.ListWebAuthnCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &passkeyUser{user: user, credentials: credentials}, nil
+}
+
+// passkeyUser adapts a user and their credentials to webauthn.User.
+type passkeyUser struct {
+	user        *model.User
+	credentials []model.WebAuthnCredential
+}
+
+func (u *passkeyUser) WebAuthnID() []byte {
+	return userHandle(u.user.Id)
+}
+
+func (u *passkeyUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *passkeyUser) WebAuthnDisplayName() string {
+	return u.user.Email
+}
+
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, len(u.credentials))
+	for i, c := range u.credentials {
+		transports := make([]protocol.AuthenticatorTransport, len(c.Transports))
+		for j, t := range c.Transports {
+			transports[j] = protocol.AuthenticatorTransport(t)
+		}
+		credentials[i] = webauthn.Credential{
+			ID:              c.CredentialId,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       transports,
+			Flags:           webauthn.NewCredentialFlags(protocol.AuthenticatorFlags(c.Flags)),
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    c.AAGUID,
+				SignCount: c.SignCount,
+			},
+		}
+	}
+	return credentials
+}
+
+func fromWebAuthnCredential(userID int64, name string, c *webauthn.Credential) model.WebAuthnCredential {
+	transports := make([]string, len(c.Transport))
+	for i, t := range c.Transport {
+		transports[i] = string(t)
+	}
+	return model.WebAuthnCredential{
+		UserId:          userID,
+		CredentialId:    c.ID,
+		PublicKey:       c.PublicKey,
+		SignCount:       c.Authenticator.SignCount,
+		Transports:      transports,
+		AAGUID:          c.Authenticator.AAGUID,
+		AttestationType: c.AttestationType,
+		Flags:           credentialFlags(c.Flags),
+		Name:            name,
+	}
+}
+
+// credentialFlags packs the flags worth keeping into the authenticator data layout.
+func credentialFlags(f webauthn.CredentialFlags) uint8 {
+	var flags protocol.AuthenticatorFlags
+	if f.UserPresent {
+		flags |= protocol.FlagUserPresent
+	}
+	if f.UserVerified {
+		flags |= protocol.FlagUserVerified
+	}
+	if f.BackupEligible {
+		flags |= protocol.FlagBackupEligible
+	}
+	if f.BackupState {
+		flags |= protocol.FlagBackupState
+	}
+	return uint8(flags)
+}
+
+// userHandle is the user id sent to authenticators. It must not contain personal
+// data, so the numeric id is used rather than the email address.
+func userHandle(userID int64) []byte {
+	handle := make([]byte, 8)
+	binary.BigEndian.PutUint64(handle, uint64(userID))
+	return handle
+}
+
+func sameUserHandle(handle []byte, userID int64) bool {
+	return len(handle) == 8 && binary.BigEndian.Uint64(handle) == uint64(userID)
+}
@@ -0,0 +1,302 @@
+package application
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+const (
+	testRPID   = "localhost"
+	testOrigin = "http://localhost:3000"
+)
+
+func testWebAuthn(t *testing.T) WebAuthn {
+	rp, err := webauthn.New(&webauthn.Config{
+		RPID:          testRPID,
+		RPDisplayName: "Chat",
+		RPOrigins:     []string{testOrigin},
+	})
+	assert.NoError(t, err)
+	return WebAuthn{RelyingParty: rp, SessionTTL: 5 * time.Minute}
+}
+
+// softAuthenticator is a platform authenticator in software: one ES256 key and a
+// signature counter, answering ceremonies the way a browser would pass them on.
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	counter      uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	id := make([]byte, 16)
+	_, err = rand.Read(id)
+	assert.NoError(t, err)
+	return &softAuthenticator{key: key, credentialID: id}
+}
+
+func (a *softAuthenticator) register(t *testing.T, ceremony *PasskeyCeremony) []byte {
+	creation := ceremony.Options.(*protocol.CredentialCreation)
+	a.userHandle = creation.Response.User.ID.(protocol.URLEncodedBase64)
+
+	x, y := make([]byte, 32), make([]byte, 32)
+	a.key.PublicKey.X.FillBytes(x)
+	a.key.PublicKey.Y.FillBytes(y)
+	publicKey, err := webauthncbor.Marshal(map[int]interface{}{1: 2, 3: -7, -1: 1, -2: x, -3: y})
+	assert.NoError(t, err)
+
+	// UP, UV и AT: пользователь присутствует, проверен, есть данные ключа
+	authData := a.authData(0x45)
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, publicKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	assert.NoError(t, err)
+
+	return a.credential(t, map[string]interface{}{
+		"clientDataJSON":    clientData(t, "webauthn.create", creation.Response.Challenge),
+		"attestationObject": b64(attestation),
+		"transports":        []string{"internal"},
+	})
+}
+
+func (a *softAuthenticator) assert(t *testing.T, ceremony *PasskeyCeremony) []byte {
+	assertion := ceremony.Options.(*protocol.CredentialAssertion)
+
+	a.counter++
+	authData := a.authData(0x05)
+	data := clientData(t, "webauthn.get", assertion.Response.Challenge)
+	raw, err := base64.RawURLEncoding.DecodeString(data)
+	assert.NoError(t, err)
+	clientHash := sha256.Sum256(raw)
+	digest := sha256.Sum256(append(authData, clientHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	assert.NoError(t, err)
+
+	return a.credential(t, map[string]interface{}{
+		"clientDataJSON":    data,
+		"authenticatorData": b64(authData),
+		"signature":         b64(signature),
+		"userHandle":        b64(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) authData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	authData := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(authData, a.counter)
+}
+
+func (a *softAuthenticator) credential(t *testing.T, response map[string]interface{}) []byte {
+	body, err := json.Marshal(map[string]interface{}{
+		"id":       b64(a.credentialID),
+		"rawId":    b64(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	assert.NoError(t, err)
+	return body
+}
+
+func clientData(t *testing.T, typ string, challenge protocol.URLEncodedBase64) string {
+	body, err := json.Marshal(map[string]string{
+		"type":      typ,
+		"challenge": b64(challenge),
+		"origin":    testOrigin,
+	})
+	assert.NoError(t, err)
+	return b64(body)
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// mockWebAuthnSessions keeps ceremony sessions in memory like the sessions table.
+func mockWebAuthnSessions(repo *MockRepo) {
+	sessions := map[string]model.WebAuthnSession{}
+	repo.On("CreateWebAuthnSession", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		session := args.Get(1).(model.WebAuthnSession)
+		sessions[session.Id] = session
+	}).Return(nil)
+	consume := repo.On("ConsumeWebAuthnSession", mock.Anything, mock.Anything, mock.Anything)
+	consume.Run(func(args mock.Arguments) {
+		id, purpose := args.String(1), args.String(2)
+		session, ok := sessions[id]
+		delete(sessions, id)
+		if !ok || session.Purpose != purpose {
+			consume.ReturnArguments = mock.Arguments{nil, repository.ErrWebAuthnSessionInvalid}
+			return
+		}
+		consume.ReturnArguments = mock.Arguments{&session, nil}
+	})
+}
+
+// registerPasskey runs a registration ceremony and returns the stored credential.
+func registerPasskey(t *testing.T, service *AuthService, repo *MockRepo, authenticator *softAuthenticator) model.WebAuthnCredential {
+	var stored model.WebAuthnCredential
+	repo.On("ListWebAuthnCredentials", mock.Anything, int64(1)).Return([]model.WebAuthnCredential{}, nil).Twice()
+	repo.On("CreateWebAuthnCredential", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		stored = args.Get(1).(model.WebAuthnCredential)
+	}).Return(int64(5), nil).Once()
+
+	ceremony, err := service.BeginPasskeyRegistration(context.Background(), 1)
+	assert.NoError(t, err)
+
+	credential, err := service.FinishPasskeyRegistration(context.Background(), 1, ceremony.SessionID, "Laptop",
+		authenticator.register(t, ceremony))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), credential.Id)
+	assert.Equal(t, authenticator.credentialID, stored.CredentialId)
+	assert.Equal(t, []string{"internal"}, stored.Transports)
+
+	stored.Id = 5
+	return stored
+}
+
+func mockSession(repo *MockRepo, jwt *MockJWT) {
+	repo.On("GetUserRoles", mock.Anything, int64(1)).Return([]string{}, nil)
+	repo.On("GetUserPermissions", mock.Anything, int64(1)).Return([]string{}, nil)
+	jwt.On("GenerateAccessToken", int64(1), mock.Anything).Return("access", nil)
+	jwt.On("GenerateRefreshToken", int64(1)).Return("refresh", nil)
+	repo.On("CreateRefreshToken", mock.Anything, mock.Anything).Return(int64(10), nil)
+}
+
+func TestPasskeyRegistrationAndPasswordlessLogin(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	service := NewAuthService(repo, jwt, WithWebAuthn(testWebAuthn(t)))
+	mockWebAuthnSessions(repo)
+	repo.On("GetUserByID", mock.Anything, int64(1)).Return(testUser(t), nil)
+
+	authenticator := newSoftAuthenticator(t)
+	stored := registerPasskey(t, service, repo, authenticator)
+
+	repo.On("GetWebAuthnCredential", mock.Anything, authenticator.credentialID).Return(&stored, nil)
+	repo.On("ListWebAuthnCredentials", mock.Anything, int64(1)).Return([]model.WebAuthnCredential{stored}, nil)
+	repo.On("UpdateWebAuthnCredentialUsage", mock.Anything, authenticator.credentialID, uint32(1), mock.Anything).Return(nil).Once()
+	mockSession(repo, jwt)
+
+	ceremony, err := service.BeginPasskeyLogin(context.Background())
+	assert.NoError(t, err)
+	response := authenticator.assert(t, ceremony)
+
+	tokens, err := service.FinishPasskeyLogin(context.Background(), ceremony.SessionID, response, model.Device{})
+	assert.NoError(t, err)
+	assert.Equal(t, "access", tokens.AccessToken)
+
+	// Сессия церемонии одноразовая
+	_, err = service.FinishPasskeyLogin(context.Background(), ceremony.SessionID, response, model.Device{})
+	assert.ErrorIs(t, err, repository.ErrWebAuthnSessionInvalid)
+}
+
+func TestFinishPasskeyLogin_RejectsClonedAuthenticator(t *testing.T) {
+	repo := new(MockRepo)
+	service := NewAuthService(repo, nil, WithWebAuthn(testWebAuthn(t)))
+	mockWebAuthnSessions(repo)
+	repo.On("GetUserByID", mock.Anything, int64(1)).Return(testUser(t), nil)
+
+	authenticator := newSoftAuthenticator(t)
+	stored := registerPasskey(t, service, repo, authenticator)
+	// Сервер уже видел больший счётчик подписей
+	stored.SignCount = 10
+
+	repo.On("GetWebAuthnCredential", mock.Anything, authenticator.credentialID).Return(&stored, nil)
+	repo.On("ListWebAuthnCredentials", mock.Anything, int64(1)).Return([]model.WebAuthnCredential{stored}, nil)
+
+	ceremony, err := service.BeginPasskeyLogin(context.Background())
+	assert.NoError(t, err)
+
+	_, err = service.FinishPasskeyLogin(context.Background(), ceremony.SessionID, authenticator.assert(t, ceremony), model.Device{})
+	assert.ErrorIs(t, err, ErrPasskeyInvalid)
+	repo.AssertNotCalled(t, "UpdateWebAuthnCredentialUsage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestFinishPasskeyLogin_WrongKey(t *testing.T) {
+	repo := new(MockRepo)
+	service := NewAuthService(repo, nil, WithWebAuthn(testWebAuthn(t)))
+	mockWebAuthnSessions(repo)
+	repo.On("GetUserByID", mock.Anything, int64(1)).Return(testUser(t), nil)
+
+	authenticator := newSoftAuthenticator(t)
+	stored := registerPasskey(t, service, repo, authenticator)
+
+	repo.On("GetWebAuthnCredential", mock.Anything, authenticator.credentialID).Return(&stored, nil)
+	repo.On("ListWebAuthnCredentials", mock.Anything, int64(1)).Return([]model.WebAuthnCredential{stored}, nil)
+
+	ceremony, err := service.BeginPasskeyLogin(context.Background())
+	assert.NoError(t, err)
+
+	// Подпись чужим ключом с тем же идентификатором
+	forged := newSoftAuthenticator(t)
+	forged.credentialID = authenticator.credentialID
+	forged.userHandle = authenticator.userHandle
+
+	_, err = service.FinishPasskeyLogin(context.Background(), ceremony.SessionID, forged.assert(t, ceremony), model.Device{})
+	assert.ErrorIs(t, err, ErrPasskeyInvalid)
+}
+
+func TestLoginUser_PasskeyAsSecondFactor(t *testing.T) {
+	repo := new(MockRepo)
+	jwt := new(MockJWT)
+	service := NewAuthService(repo, jwt, WithWebAuthn(testWebAuthn(t)))
+	mockWebAuthnSessions(repo)
+	repo.On("GetUserByID", mock.Anything, int64(1)).Return(testUser(t), nil)
+
+	authenticator := newSoftAuthenticator(t)
+	stored := registerPasskey(t, service, repo, authenticator)
+
+	repo.On("GetUserByEmail", mock.Anything, "test@test.com").Return(testUser(t), nil)
+	// Хеш с MinCost обновляется до стоимости по умолчанию
+	repo.On("UpdatePassword", mock.Anything, int64(1), mock.Anything).Return(nil)
+	repo.On("ListWebAuthnCredentials", mock.Anything, int64(1)).Return([]model.WebAuthnCredential{stored}, nil)
+	jwt.On("GenerateActionToken", int64(1), PurposeMFAChallenge, 5*time.Minute).
+		Return("challenge", &security.Claims{UserID: 1, ID: "jti-1"}, nil)
+	repo.On("CreateActionToken", mock.Anything, mock.Anything).Return(nil)
+
+	_, err := service.LoginUser(context.Background(), model.User{Email: "test@test.com", Password: "123456"}, model.Device{})
+	var mfaErr *MFARequiredError
+	assert.True(t, errors.As(err, &mfaErr))
+	assert.Equal(t, []string{MFAMethodPasskey}, mfaErr.Methods)
+
+	jwt.On("ParseActionToken", "challenge", PurposeMFAChallenge).Return(&security.Claims{UserID: 1, ID: "jti-1"}, nil)
+	repo.On("ConsumeActionToken", mock.Anything, "jti-1", PurposeMFAChallenge).Return(&model.ActionToken{UserId: 1}, nil)
+	repo.On("UpdateWebAuthnCredentialUsage", mock.Anything, authenticator.credentialID, uint32(1), mock.Anything).Return(nil)
+	mockSession(repo, jwt)
+
+	ceremony, err := service.BeginPasskeyMFA(context.Background(), mfaErr.ChallengeToken)
+	assert.NoError(t, err)
+	assert.Len(t, ceremony.Options.(*protocol.CredentialAssertion).Response.AllowedCredentials, 1)
+
+	tokens, err := service.CompletePasskeyMFALogin(context.Background(), mfaErr.ChallengeToken, ceremony.SessionID,
+		authenticator.assert(t, ceremony), model.Device{})
+	assert.NoError(t, err)
+	assert.Equal(t, "access", tokens.AccessToken)
+}
@@ -0,0 +1,67 @@
+package breached
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const prefixLength = 5
+
+// PrefixStore looks passwords up in a local copy of a breached-password corpus laid
+// out as k-anonymity range files, the format Have I Been Pwned publishes: one file
+// per 5 hex character SHA-1 prefix, named "21BD1" or "21BD1.txt", holding
+// "SUFFIX:COUNT" lines. Only the file of the password's prefix is read per lookup.
+type PrefixStore struct {
+	dir string
+}
+
+func NewPrefixStore(dir string) (*PrefixStore, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("breached password corpus %s is not a directory", dir)
+	}
+	return &PrefixStore{dir: dir}, nil
+}
+
+// Contains reports whether password appears in the corpus.
+func (s *PrefixStore) Contains(_ context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:prefixLength], hash[prefixLength:]
+
+	f, err := s.open(prefix)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(line, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+func (s *PrefixStore) open(prefix string) (*os.File, error) {
+	f, err := os.Open(filepath.Join(s.dir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		return os.Open(filepath.Join(s.dir, prefix+".txt"))
+	}
+	return f, err
+}
@@ -0,0 +1,43 @@
+package breached
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixStore_Contains(t *testing.T) {
+	dir := t.TempDir()
+	// SHA-1("password") = 5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8
+	err := os.WriteFile(filepath.Join(dir, "5BAA6.txt"),
+		[]byte("003D68EB55068C33ACE09247EE4C639306B:3\r\n1E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824\r\n"), 0o600)
+	require.NoError(t, err)
+	// SHA-1("password1") начинается с E38AD, но его суффикса в файле нет
+	err = os.WriteFile(filepath.Join(dir, "E38AD"), []byte("0000000000000000000000000000000000A:1\n"), 0o600)
+	require.NoError(t, err)
+
+	store, err := NewPrefixStore(dir)
+	require.NoError(t, err)
+
+	found, err := store.Contains(context.Background(), "password")
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	found, err = store.Contains(context.Background(), "password1")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	// Файла с префиксом нет
+	found, err = store.Contains(context.Background(), "correct horse battery staple")
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestNewPrefixStore_MissingDir(t *testing.T) {
+	_, err := NewPrefixStore(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
@@ -1,10 +1,13 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"github.com/go-yaml/yaml"
 	"github.com/joho/godotenv"
 	"os"
+	"strconv"
+	"strings"
 )
 
 type Config struct {
@@ -12,17 +15,179 @@ type Config struct {
 }
 
 type appConfig struct {
-	GrpcAddr       string         `yaml:"grpc_addr"`
-	HttpAddr       string         `yaml:"http_addr"`
-	PrometheusAddr string         `yaml:"prometheus_addr"`
-	Database       databaseConfig `yaml:"database"`
-	Env            envConfig      `yaml:"environment"`
+	GrpcAddr string `yaml:"grpc_addr"`
+	HttpAddr string `yaml:"http_addr"`
+	// TrustedProxies are the addresses or CIDRs whose X-Forwarded-For header is
+	// believed when resolving the client IP; empty trusts no proxy.
+	TrustedProxies []string         `yaml:"trustedProxies"`
+	PrometheusAddr string           `yaml:"prometheus_addr"`
+	Database       databaseConfig   `yaml:"database"`
+	Env            envConfig        `yaml:"environment"`
+	Email          emailConfig      `yaml:"email"`
+	MFA            mfaConfig        `yaml:"mfa"`
+	WebAuthn       webAuthnConfig   `yaml:"webauthn"`
+	Lockout        lockoutConfig    `yaml:"lockout"`
+	RateLimit      rateLimitConfig  `yaml:"rateLimit"`
+	Passwords      passwordsConfig  `yaml:"passwords"`
+	OAuth          oauthConfig      `yaml:"oauth"`
+	Federation     federationConfig `yaml:"federation"`
 }
 type envConfig struct {
-	AccessTokenSecret  string `yaml:"accessTokenSecret"`
-	RefreshTokenSecret string `yaml:"refreshTokenSecret"`
-	AccessTokenTTL     string `yaml:"accessTokenTTL"`
-	RefreshTokenTTL    string `yaml:"refreshTokenTTL"`
+	AccessTokenSecret  string   `yaml:"accessTokenSecret"`
+	RefreshTokenSecret string   `yaml:"refreshTokenSecret"`
+	RefreshTokenPepper string   `yaml:"refreshTokenPepper"`
+	AccessTokenTTL     string   `yaml:"accessTokenTTL"`
+	RefreshTokenTTL    string   `yaml:"refreshTokenTTL"`
+	RevocationCacheTTL string   `yaml:"revocationCacheTTL"`
+	Issuer             string   `yaml:"issuer"`
+	Audience           []string `yaml:"audience"`
+	TrustedIssuers     []string `yaml:"trustedIssuers"`
+	AllowedAudiences   []string `yaml:"allowedAudiences"`
+	ClockSkew          string   `yaml:"clockSkew"`
+	SigningAlgorithm   string   `yaml:"signingAlgorithm"`
+	SigningKeyPath     string   `yaml:"signingKeyPath"`
+	// SigningKeys enables key rotation and takes precedence over SigningKeyPath.
+	SigningKeys           []signingKeyConfig `yaml:"signingKeys"`
+	SigningKeyGracePeriod string             `yaml:"signingKeyGracePeriod"`
+}
+
+type signingKeyConfig struct {
+	Kid       string `yaml:"kid"`
+	Path      string `yaml:"path"`
+	Active    bool   `yaml:"active"`
+	RetiredAt string `yaml:"retiredAt"`
+}
+
+type emailConfig struct {
+	// Mailer is "smtp" or "log"; the log mailer writes to LogPath, or stdout when empty.
+	Mailer                string           `yaml:"mailer"`
+	LogPath               string           `yaml:"logPath"`
+	RequireVerified       bool             `yaml:"requireVerified"`
+	VerificationTokenTTL  string           `yaml:"verificationTokenTTL"`
+	VerificationURL       string           `yaml:"verificationURL"`
+	PasswordResetTokenTTL string           `yaml:"passwordResetTokenTTL"`
+	PasswordResetURL      string           `yaml:"passwordResetURL"`
+	EmailChangeURL        string           `yaml:"emailChangeURL"`
+	Login                 emailLoginConfig `yaml:"login"`
+	SMTP                  smtpConfig       `yaml:"smtp"`
+}
+
+type emailLoginConfig struct {
+	// Enabled turns on passwordless login with a magic link or code sent by email.
+	Enabled       bool   `yaml:"enabled"`
+	TokenTTL      string `yaml:"tokenTTL"`
+	URL           string `yaml:"url"`
+	MaxRequests   int    `yaml:"maxRequests"`
+	RequestWindow string `yaml:"requestWindow"`
+	MaxAttempts   int    `yaml:"maxAttempts"`
+}
+
+type smtpConfig struct {
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+type mfaConfig struct {
+	Issuer       string `yaml:"issuer"`
+	ChallengeTTL string `yaml:"challengeTTL"`
+	// EncryptionKey protects TOTP secrets at rest; enrolment is disabled while it is empty.
+	EncryptionKey string `yaml:"encryptionKey"`
+}
+
+type webAuthnConfig struct {
+	// RPID is the domain passkeys are bound to; passkeys are disabled while it is empty.
+	RPID          string   `yaml:"rpID"`
+	RPDisplayName string   `yaml:"rpDisplayName"`
+	RPOrigins     []string `yaml:"rpOrigins"`
+	SessionTTL    string   `yaml:"sessionTTL"`
+}
+
+type lockoutConfig struct {
+	// Store is "memory" for a single replica or "sql" to share counters between replicas.
+	Store      string `yaml:"store"`
+	Threshold  int    `yaml:"threshold"`
+	BaseDelay  string `yaml:"baseDelay"`
+	MaxDelay   string `yaml:"maxDelay"`
+	ResetAfter string `yaml:"resetAfter"`
+}
+
+type rateLimitConfig struct {
+	// Store keeps the token buckets; "memory" is the only built-in store.
+	Store string `yaml:"store"`
+	// Rules are matched in order, the first matching route wins; no rules disables limiting.
+	Rules []rateLimitRuleConfig `yaml:"rules"`
+}
+
+type rateLimitRuleConfig struct {
+	Route    string `yaml:"route"`
+	Key      string `yaml:"key"`
+	Requests int    `yaml:"requests"`
+	Window   string `yaml:"window"`
+	Burst    int    `yaml:"burst"`
+}
+
+type passwordsConfig struct {
+	// Algorithm hashes new passwords, "argon2id" or "bcrypt"; hashes of the other
+	// algorithm or older parameters are upgraded on the next login.
+	Algorithm  string         `yaml:"algorithm"`
+	Argon2id   argon2idConfig `yaml:"argon2id"`
+	BcryptCost int            `yaml:"bcryptCost"`
+	// Pepper is mixed into every password before hashing; changing it invalidates
+	// hashes made with the old one.
+	Pepper string               `yaml:"pepper"`
+	Policy passwordPolicyConfig `yaml:"policy"`
+}
+
+type passwordPolicyConfig struct {
+	MinLength     int  `yaml:"minLength"`
+	MaxLength     int  `yaml:"maxLength"`
+	RequireUpper  bool `yaml:"requireUpper"`
+	RequireLower  bool `yaml:"requireLower"`
+	RequireDigit  bool `yaml:"requireDigit"`
+	RequireSymbol bool `yaml:"requireSymbol"`
+	DisallowEmail bool `yaml:"disallowEmail"`
+	History       int  `yaml:"history"`
+	// BreachedCorpusDir holds k-anonymity range files named by SHA-1 prefix; empty
+	// disables the breached password check.
+	BreachedCorpusDir string `yaml:"breachedCorpusDir"`
+}
+
+type argon2idConfig struct {
+	// Memory in KiB
+	Memory      uint32 `yaml:"memory"`
+	Iterations  uint32 `yaml:"iterations"`
+	Parallelism uint8  `yaml:"parallelism"`
+	SaltLength  uint32 `yaml:"saltLength"`
+	KeyLength   uint32 `yaml:"keyLength"`
+}
+
+type oauthConfig struct {
+	// Enabled serves the /oauth endpoints (authorize, token, introspect, revoke) for registered clients.
+	Enabled bool   `yaml:"enabled"`
+	CodeTTL string `yaml:"codeTTL"`
+}
+
+type federationConfig struct {
+	// StateTTL is the time users have to log in at the provider.
+	StateTTL  string                     `yaml:"stateTTL"`
+	Providers []federationProviderConfig `yaml:"providers"`
+}
+
+type federationProviderConfig struct {
+	// Name appears in URLs and is stored with linked accounts, do not rename it.
+	Name string `yaml:"name"`
+	// Type is "oidc" for OpenID Connect providers or "github".
+	Type         string   `yaml:"type"`
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"clientID"`
+	ClientSecret string   `yaml:"clientSecret"`
+	RedirectURL  string   `yaml:"redirectURL"`
+	Scopes       []string `yaml:"scopes"`
+	AllowSignup  bool     `yaml:"allowSignup"`
+	LinkByEmail  bool     `yaml:"linkByEmail"`
 }
 
 type databaseConfig struct {
@@ -31,30 +196,71 @@ type databaseConfig struct {
 	Username string `yaml:"username"`
 	Password string `yaml:"password"`
 	Database string `yaml:"database"`
+	// AutoMigrate applies pending migrations on startup.
+	AutoMigrate bool `yaml:"autoMigrate"`
 }
 
 func MustLoad() *Config {
+	cfg, err := Load()
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Println(*cfg)
+
+	return cfg
+}
+
+// Load reads the config without panicking so it can be re-read at runtime, e.g. on SIGHUP.
+func Load() (*Config, error) {
 	err := godotenv.Load(".env")
 	cfgPath := os.Getenv("CONFIG_PATH")
 
 	if cfgPath == "" {
-		panic("CONFIG_PATH environment variable not set")
+		return nil, errors.New("CONFIG_PATH environment variable not set")
 	}
 
 	cfgFile, err := os.Open(cfgPath)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	defer cfgFile.Close()
 
 	var cfg Config
 	yamlParser := yaml.NewDecoder(cfgFile)
 	if err := yamlParser.Decode(&cfg); err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	cfg.App.Env.RefreshTokenSecret = os.Getenv("REFRESH_TOKEN_SECRET")
 	cfg.App.Env.AccessTokenSecret = os.Getenv("ACCESS_TOKEN_SECRET")
+	cfg.App.Env.RefreshTokenPepper = os.Getenv("REFRESH_TOKEN_PEPPER")
+	if v := os.Getenv("SIGNING_ALGORITHM"); v != "" {
+		cfg.App.Env.SigningAlgorithm = v
+	}
+	if v := os.Getenv("SIGNING_KEY_PATH"); v != "" {
+		cfg.App.Env.SigningKeyPath = v
+	}
+
+	if v := os.Getenv("SMTP_USERNAME"); v != "" {
+		cfg.App.Email.SMTP.Username = v
+	}
+	if v := os.Getenv("SMTP_PASSWORD"); v != "" {
+		cfg.App.Email.SMTP.Password = v
+	}
+
+	if v := os.Getenv("PASSWORD_PEPPER"); v != "" {
+		cfg.App.Passwords.Pepper = v
+	}
+	if v := os.Getenv("MFA_ENCRYPTION_KEY"); v != "" {
+		cfg.App.MFA.EncryptionKey = v
+	}
+
+	for i, provider := range cfg.App.Federation.Providers {
+		if v := os.Getenv(federationSecretEnv(provider.Name)); v != "" {
+			cfg.App.Federation.Providers[i].ClientSecret = v
+		}
+	}
 
 	cfg.App.GrpcAddr = os.Getenv("GRPC_ADDR")
 	cfg.App.HttpAddr = os.Getenv("HTTP_ADDR")
@@ -64,8 +270,15 @@ func MustLoad() *Config {
 	cfg.App.Database.Username = os.Getenv("DB_USERNAME")
 	cfg.App.Database.Password = os.Getenv("DB_PASSWORD")
 	cfg.App.Database.Database = os.Getenv("DB_NAME")
+	if v, err := strconv.ParseBool(os.Getenv("DB_AUTO_MIGRATE")); err == nil {
+		cfg.App.Database.AutoMigrate = v
+	}
 
-	fmt.Println(cfg)
+	return &cfg, nil
+}
 
-	return &cfg
+// federationSecretEnv names the variable holding a provider's client secret, e.g.
+// FEDERATION_GOOGLE_CLIENT_SECRET for the provider named google.
+func federationSecretEnv(name string) string {
+	return "FEDERATION_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name)) + "_CLIENT_SECRET"
 }
@@ -84,3 +84,46 @@ func TestMustLoad_Success(t *testing.T) {
 		t.Errorf("expected DB username to be 'admin', got %s", cfg.App.Database.Username)
 	}
 }
+
+func TestLoad_FederationSecretFromEnv(t *testing.T) {
+	tmpFile := "tmp_federation_config.yml"
+	yamlContent := `application:
+  federation:
+    stateTTL: "10m"
+    providers:
+      - name: "google-workspace"
+        type: "oidc"
+        issuer: "https://accounts.google.com"
+        clientID: "client"
+        clientSecret: "from-file"
+      - name: "github"
+        type: "github"
+        clientID: "client"
+        clientSecret: "from-file"
+`
+	if err := os.WriteFile(tmpFile, []byte(yamlContent), 0644); err != nil {
+		t.Fatalf("failed to create temp config file: %v", err)
+	}
+	defer os.Remove(tmpFile)
+
+	old := os.Getenv("CONFIG_PATH")
+	defer os.Setenv("CONFIG_PATH", old)
+	os.Setenv("CONFIG_PATH", tmpFile)
+	t.Setenv("FEDERATION_GOOGLE_WORKSPACE_CLIENT_SECRET", "from-env")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	providers := cfg.App.Federation.Providers
+	if len(providers) != 2 {
+		t.Fatalf("expected 2 providers, got %d", len(providers))
+	}
+	if providers[0].ClientSecret != "from-env" {
+		t.Errorf("expected secret from environment, got %s", providers[0].ClientSecret)
+	}
+	if providers[1].ClientSecret != "from-file" {
+		t.Errorf("expected secret from file, got %s", providers[1].ClientSecret)
+	}
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations/*.sql
+var embeddedMigrations embed.FS
+
+// Migration is one versioned SQL file, written in goose format: the statements after
+// "-- +goose Up" apply it and the ones after "-- +goose Down" revert it.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// loadMigrations reads every NNN_name.sql file in fsys, ordered by version.
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]Migration, 0, len(files))
+	seen := make(map[int64]string)
+	for _, file := range files {
+		prefix, _, ok := strings.Cut(path.Base(file), "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: file name must start with a positive version", file)
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", other, file, version)
+		}
+		seen[version] = file
+
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		up, down, err := parseMigration(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", file, err)
+		}
+
+		migrations = append(migrations, Migration{
+			Version: version,
+			Name:    strings.TrimSuffix(path.Base(file), ".sql"),
+			Up:      up,
+			Down:    down,
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func parseMigration(content string) (up, down string, err error) {
+	var (
+		section        *strings.Builder
+		upSQL, downSQL strings.Builder
+		hasUp          bool
+	)
+
+	for _, line := range strings.SplitAfter(content, "\n") {
+		switch strings.TrimSpace(line) {
+		case "-- +goose Up":
+			section, hasUp = &upSQL, true
+			continue
+		case "-- +goose Down":
+			section = &downSQL
+			continue
+		}
+		if section != nil {
+			section.WriteString(line)
+		}
+	}
+
+	if !hasUp || strings.TrimSpace(upSQL.String()) == "" {
+		return "", "", fmt.Errorf("no -- +goose Up section")
+	}
+	return strings.TrimSpace(upSQL.String()), strings.TrimSpace(downSQL.String()), nil
+}
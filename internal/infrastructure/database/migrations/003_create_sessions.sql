@@ -0,0 +1,24 @@
+-- +goose Up
+ALTER TABLE refresh_tokens DROP CONSTRAINT IF EXISTS refresh_tokens_user_id_key;
+
+ALTER TABLE refresh_tokens
+    ADD COLUMN device_name  VARCHAR(255)             NOT NULL DEFAULT '',
+    ADD COLUMN user_agent   TEXT                     NOT NULL DEFAULT '',
+    ADD COLUMN ip           VARCHAR(45)              NOT NULL DEFAULT '',
+    ADD COLUMN last_used_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now();
+
+CREATE UNIQUE INDEX refresh_tokens_token_index ON refresh_tokens (token);
+CREATE INDEX refresh_tokens_user_id_index ON refresh_tokens (user_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS refresh_tokens_user_id_index;
+DROP INDEX IF EXISTS refresh_tokens_token_index;
+
+ALTER TABLE refresh_tokens
+    DROP COLUMN IF EXISTS device_name,
+    DROP COLUMN IF EXISTS user_agent,
+    DROP COLUMN IF EXISTS ip,
+    DROP COLUMN IF EXISTS last_used_at;
+
+DELETE FROM refresh_tokens a USING refresh_tokens b WHERE a.user_id = b.user_id AND a.id < b.id;
+ALTER TABLE refresh_tokens ADD CONSTRAINT refresh_tokens_user_id_key UNIQUE (user_id);
@@ -0,0 +1,22 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+    ADD COLUMN family_id  VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN parent_id  INTEGER REFERENCES refresh_tokens (id) ON DELETE SET NULL,
+    ADD COLUMN rotated_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN revoked_at TIMESTAMP WITH TIME ZONE;
+
+-- Existing sessions become the root of their own family
+UPDATE refresh_tokens SET family_id = id::text WHERE family_id = '';
+
+CREATE INDEX refresh_tokens_family_id_index ON refresh_tokens (family_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS refresh_tokens_family_id_index;
+
+DELETE FROM refresh_tokens WHERE rotated_at IS NOT NULL OR revoked_at IS NOT NULL;
+
+ALTER TABLE refresh_tokens
+    DROP COLUMN IF EXISTS family_id,
+    DROP COLUMN IF EXISTS parent_id,
+    DROP COLUMN IF EXISTS rotated_at,
+    DROP COLUMN IF EXISTS revoked_at;
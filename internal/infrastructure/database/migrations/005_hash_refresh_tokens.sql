@@ -0,0 +1,18 @@
+-- +goose Up
+-- Raw tokens stay readable until the service backfills token_hash on startup
+-- (Repository.HashLegacyRefreshTokens) and clears the token column.
+ALTER TABLE refresh_tokens ADD COLUMN token_hash VARCHAR(64);
+ALTER TABLE refresh_tokens ALTER COLUMN token DROP NOT NULL;
+
+DROP INDEX IF EXISTS refresh_tokens_token_index;
+CREATE UNIQUE INDEX refresh_tokens_token_hash_index ON refresh_tokens (token_hash);
+
+-- +goose Down
+-- Hashed tokens cannot be recovered, those sessions have to log in again
+DELETE FROM refresh_tokens WHERE token IS NULL;
+
+DROP INDEX IF EXISTS refresh_tokens_token_hash_index;
+CREATE UNIQUE INDEX refresh_tokens_token_index ON refresh_tokens (token);
+
+ALTER TABLE refresh_tokens ALTER COLUMN token SET NOT NULL;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS token_hash;
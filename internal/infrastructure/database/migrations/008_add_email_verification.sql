@@ -0,0 +1,24 @@
+-- +goose Up
+ALTER TABLE users
+    ADD COLUMN email_verified_at TIMESTAMP WITH TIME ZONE;
+
+-- Accounts created before verification existed are treated as verified.
+UPDATE users SET email_verified_at = created_at;
+
+-- Signed action tokens are only usable once: the row is claimed on first use.
+CREATE TABLE IF NOT EXISTS action_tokens
+(
+    jti        VARCHAR(64) PRIMARY KEY,
+    user_id    INTEGER                  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    purpose    VARCHAR(32)              NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at    TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX action_tokens_expires_at_index ON action_tokens (expires_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS action_tokens;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS email_verified_at;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- Holds data the action applies when the token is used, e.g. the new address of an email change.
+ALTER TABLE action_tokens
+    ADD COLUMN payload VARCHAR(255) NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE action_tokens
+    DROP COLUMN IF EXISTS payload;
@@ -0,0 +1,35 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS webauthn_credentials
+(
+    id               SERIAL PRIMARY KEY,
+    user_id          INTEGER                  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    credential_id    BYTEA                    NOT NULL UNIQUE,
+    -- COSE encoded public key as returned by the authenticator
+    public_key       BYTEA                    NOT NULL,
+    sign_count       BIGINT                   NOT NULL DEFAULT 0,
+    transports       TEXT[]                   NOT NULL DEFAULT '{}',
+    aaguid           BYTEA,
+    attestation_type VARCHAR(32)              NOT NULL DEFAULT '',
+    -- Authenticator data flags byte, backup eligibility must never change
+    flags            SMALLINT                 NOT NULL DEFAULT 0,
+    name             VARCHAR(255)             NOT NULL DEFAULT '',
+    created_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    last_used_at     TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON webauthn_credentials (user_id);
+
+-- Challenges of ceremonies in progress. user_id is empty for passwordless logins,
+-- where the user is only known once the authenticator answers.
+CREATE TABLE IF NOT EXISTS webauthn_sessions
+(
+    id         VARCHAR(64) PRIMARY KEY,
+    user_id    INTEGER REFERENCES users (id) ON DELETE CASCADE,
+    purpose    VARCHAR(32)              NOT NULL,
+    data       TEXT                     NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS webauthn_sessions;
+DROP TABLE IF EXISTS webauthn_credentials;
@@ -0,0 +1,21 @@
+-- +goose Up
+-- One row per passwordless login email. The mail carries both a magic link, whose
+-- token is identified by jti, and a short code; using either one uses up the row.
+CREATE TABLE IF NOT EXISTS login_codes
+(
+    id         SERIAL PRIMARY KEY,
+    user_id    INTEGER                  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    jti        VARCHAR(64)              NOT NULL UNIQUE,
+    -- HMAC of the code, see security.TokenHasher
+    code_hash  VARCHAR(64)              NOT NULL,
+    -- Wrong codes entered while this one was active
+    attempts   INTEGER                  NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at    TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_codes_user_id ON login_codes (user_id, created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS login_codes;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- Failed logins per throttling key, e.g. "account:<email>" or "ip:<address>", shared
+-- by all replicas. Rows are removed on a successful login or once they go stale.
+CREATE TABLE IF NOT EXISTS login_attempts
+(
+    key             VARCHAR(320) PRIMARY KEY,
+    failures        INTEGER                  NOT NULL,
+    last_failure_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_last_failure_at ON login_attempts (last_failure_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS login_attempts;
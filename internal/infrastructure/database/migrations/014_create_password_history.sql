@@ -0,0 +1,15 @@
+-- +goose Up
+-- Hashes of each user's most recent passwords, newest included, so the password
+-- policy can refuse reusing them. Only the configured number of rows is kept.
+CREATE TABLE IF NOT EXISTS password_history
+(
+    id            SERIAL PRIMARY KEY,
+    user_id       INTEGER                  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    password_hash VARCHAR(255)             NOT NULL,
+    created_at    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_password_history_user_id ON password_history (user_id, id);
+
+-- +goose Down
+DROP TABLE IF EXISTS password_history;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- Disabled accounts keep their data but cannot log in until enabled again.
+ALTER TABLE users
+    ADD COLUMN disabled_at TIMESTAMP WITH TIME ZONE;
+
+-- +goose Down
+ALTER TABLE users
+    DROP COLUMN IF EXISTS disabled_at;
@@ -0,0 +1,48 @@
+-- +goose Up
+-- Applications allowed to use the OAuth authorization code flow. Public clients,
+-- such as mobile and browser apps, have no secret and rely on PKCE alone.
+CREATE TABLE IF NOT EXISTS oauth_clients
+(
+    id            VARCHAR(64) PRIMARY KEY,
+    name          VARCHAR(255)             NOT NULL,
+    -- PasswordHasher output, NULL for public clients
+    secret_hash   TEXT,
+    redirect_uris TEXT[]                   NOT NULL,
+    scopes        TEXT[]                   NOT NULL DEFAULT '{}',
+    created_at    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes
+(
+    -- HMAC of the code, see security.TokenHasher
+    code_hash             VARCHAR(64) PRIMARY KEY,
+    client_id             VARCHAR(64)              NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    user_id               INTEGER                  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    redirect_uri          TEXT                     NOT NULL,
+    scope                 TEXT                     NOT NULL DEFAULT '',
+    code_challenge        VARCHAR(128)             NOT NULL,
+    code_challenge_method VARCHAR(16)              NOT NULL,
+    expires_at            TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at               TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX oauth_authorization_codes_expires_at_index ON oauth_authorization_codes (expires_at);
+
+-- Sessions opened through OAuth can only be refreshed by the client they were issued to.
+ALTER TABLE refresh_tokens
+    ADD COLUMN client_id VARCHAR(64) REFERENCES oauth_clients (id) ON DELETE CASCADE,
+    ADD COLUMN scope     TEXT NOT NULL DEFAULT '';
+
+INSERT INTO permissions (name) VALUES ('clients:manage');
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT r.id, p.id FROM roles r CROSS JOIN permissions p WHERE r.name = 'admin' AND p.name = 'clients:manage';
+
+-- +goose Down
+DELETE FROM permissions WHERE name = 'clients:manage';
+
+ALTER TABLE refresh_tokens
+    DROP COLUMN IF EXISTS scope,
+    DROP COLUMN IF EXISTS client_id;
+
+DROP TABLE IF EXISTS oauth_authorization_codes;
+DROP TABLE IF EXISTS oauth_clients;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- OpenID Connect echoes the nonce of the authorization request in the ID token and
+-- reports when the user logged in.
+ALTER TABLE oauth_authorization_codes
+    ADD COLUMN nonce     TEXT                     NOT NULL DEFAULT '',
+    ADD COLUMN auth_time TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now();
+
+-- +goose Down
+ALTER TABLE oauth_authorization_codes
+    DROP COLUMN IF EXISTS auth_time,
+    DROP COLUMN IF EXISTS nonce;
@@ -0,0 +1,16 @@
+-- +goose Up
+-- Service clients only use the client credentials grant and have no redirect URIs.
+ALTER TABLE oauth_clients
+    ADD COLUMN grant_types TEXT[] NOT NULL DEFAULT '{authorization_code,refresh_token}';
+
+-- Access tokens of service clients have no user, but can be revoked one by one.
+ALTER TABLE revoked_tokens
+    ALTER COLUMN user_id DROP NOT NULL;
+
+-- +goose Down
+DELETE FROM revoked_tokens WHERE user_id IS NULL;
+ALTER TABLE revoked_tokens
+    ALTER COLUMN user_id SET NOT NULL;
+
+ALTER TABLE oauth_clients
+    DROP COLUMN IF EXISTS grant_types;
@@ -0,0 +1,36 @@
+-- +goose Up
+-- Accounts at upstream identity providers linked to users. Accounts are matched by the
+-- provider's subject only, never by email, which the provider may let change hands.
+CREATE TABLE IF NOT EXISTS identities
+(
+    id            SERIAL PRIMARY KEY,
+    user_id       INTEGER                  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    provider      VARCHAR(64)              NOT NULL,
+    subject       VARCHAR(255)             NOT NULL,
+    -- Email the provider reported at the last login, for display only
+    email         VARCHAR(255)             NOT NULL DEFAULT '',
+    created_at    TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    last_login_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (provider, subject),
+    -- One account per provider and user keeps linking unambiguous
+    UNIQUE (user_id, provider)
+);
+
+-- Redirects to a provider in progress. user_id is set when a logged in user links a
+-- provider to their account and empty for logins.
+CREATE TABLE IF NOT EXISTS federated_logins
+(
+    -- HMAC of the state parameter, see security.TokenHasher
+    state_hash    VARCHAR(64) PRIMARY KEY,
+    provider      VARCHAR(64)              NOT NULL,
+    code_verifier VARCHAR(128)             NOT NULL,
+    nonce         VARCHAR(64)              NOT NULL,
+    user_id       INTEGER REFERENCES users (id) ON DELETE CASCADE,
+    expires_at    TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX federated_logins_expires_at_index ON federated_logins (expires_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS federated_logins;
+DROP TABLE IF EXISTS identities;
@@ -0,0 +1,11 @@
+-- +goose Up
+-- A deleted user's access tokens stay valid until they expire, so their cutoff must
+-- outlive the account; garbage collection removes it once no token can match.
+-- User ids are never reused, so the row cannot affect another account.
+ALTER TABLE user_token_revocations
+    DROP CONSTRAINT IF EXISTS user_token_revocations_user_id_fkey;
+
+-- +goose Down
+DELETE FROM user_token_revocations r WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = r.user_id);
+ALTER TABLE user_token_revocations
+    ADD CONSTRAINT user_token_revocations_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
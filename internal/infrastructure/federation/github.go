@@ -0,0 +1,85 @@
+package federation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// GitHubProvider signs users in with GitHub, which speaks plain OAuth 2.0 without ID
+// tokens. The identity is read from the REST API with the access token instead.
+type GitHubProvider struct {
+	cfg    Config
+	client *http.Client
+
+	authURL  string
+	tokenURL string
+	apiURL   string
+}
+
+func NewGitHubProvider(cfg Config, client *http.Client) *GitHubProvider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"read:user", "user:email"}
+	}
+	return &GitHubProvider{
+		cfg:      cfg,
+		client:   client,
+		authURL:  "https://github.com/login/oauth/authorize",
+		tokenURL: "https://github.com/login/oauth/access_token",
+		apiURL:   "https://api.github.com",
+	}
+}
+
+// AuthCodeURL ignores nonce, GitHub has no use for it.
+func (p *GitHubProvider) AuthCodeURL(_ context.Context, state, codeChallenge, _ string) (string, error) {
+	return authCodeURL(p.authURL, p.cfg, state, codeChallenge, "")
+}
+
+// Exchange takes the email from the user's primary address, which is only reported
+// as verified through the emails endpoint; the profile email is unverified.
+func (p *GitHubProvider) Exchange(ctx context.Context, code, codeVerifier, _ string) (*Identity, error) {
+	tokens, err := exchangeCode(ctx, p.client, p.tokenURL, p.cfg, code, codeVerifier)
+	if err != nil {
+		return nil, err
+	}
+
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	}
+	if err := getJSON(ctx, p.client, p.apiURL+"/user", tokens.AccessToken, &user); err != nil {
+		return nil, err
+	}
+	if user.ID == 0 {
+		return nil, fmt.Errorf("%w: github user has no id", ErrInvalidResponse)
+	}
+
+	identity := &Identity{
+		Subject: strconv.FormatInt(user.ID, 10),
+		Email:   user.Email,
+		Name:    user.Name,
+	}
+	if identity.Name == "" {
+		identity.Name = user.Login
+	}
+
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, p.client, p.apiURL+"/user/emails", tokens.AccessToken, &emails); err != nil {
+		return nil, err
+	}
+	for _, e := range emails {
+		if e.Primary {
+			identity.Email = e.Email
+			identity.EmailVerified = e.Verified
+		}
+	}
+
+	return identity, nil
+}
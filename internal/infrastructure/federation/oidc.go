@@ -0,0 +1,253 @@
+package federation
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// leeway tolerates clock skew between us and the provider when checking exp and nbf.
+const leeway = time.Minute
+
+// jwksRefreshInterval limits how often an unknown kid makes us refetch the provider's
+// keys, so tokens with made up kids cannot be used to hammer its JWKS endpoint.
+const jwksRefreshInterval = time.Minute
+
+// idTokenAlgorithms are the asymmetric algorithms accepted on ID tokens. HMAC is left
+// out on purpose: a public key must never be usable as a shared secret.
+var idTokenAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// OIDCProvider signs users in with an OpenID Connect provider such as Google or
+// Keycloak. The endpoints are discovered from the issuer on first use and the ID
+// token is verified against the provider's published keys.
+type OIDCProvider struct {
+	cfg    Config
+	client *http.Client
+
+	mu        sync.Mutex
+	metadata  *oidcMetadata
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// oidcMetadata is the part of the discovery document we use.
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+func NewOIDCProvider(cfg Config, client *http.Client) *OIDCProvider {
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	} else if !contains(cfg.Scopes, "openid") {
+		cfg.Scopes = append([]string{"openid"}, cfg.Scopes...)
+	}
+	return &OIDCProvider{cfg: cfg, client: client}
+}
+
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, codeChallenge, nonce string) (string, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return authCodeURL(metadata.AuthorizationEndpoint, p.cfg, state, codeChallenge, nonce)
+}
+
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := exchangeCode(ctx, p.client, metadata.TokenEndpoint, p.cfg, code, codeVerifier)
+	if err != nil {
+		return nil, err
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: no id token", ErrInvalidResponse)
+	}
+
+	claims, err := p.verifyIDToken(ctx, metadata, tokens.IDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+	identity := identityFromClaims(claims)
+
+	// Some providers only put the email in the userinfo response.
+	if identity.Email == "" && metadata.UserinfoEndpoint != "" {
+		var info map[string]interface{}
+		if err := getJSON(ctx, p.client, metadata.UserinfoEndpoint, tokens.AccessToken, &info); err != nil {
+			return nil, err
+		}
+		fromUserinfo := identityFromClaims(info)
+		// OpenID Connect Core section 5.3.2: the response may belong to someone else.
+		if fromUserinfo.Subject != identity.Subject {
+			return nil, fmt.Errorf("%w: userinfo sub does not match the id token", ErrInvalidResponse)
+		}
+		identity = fromUserinfo
+	}
+
+	return identity, nil
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var metadata oidcMetadata
+	endpoint := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := getJSON(ctx, p.client, endpoint, "", &metadata); err != nil {
+		return nil, err
+	}
+	// OpenID Connect Discovery section 4.3.
+	if metadata.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("%w: discovery document is for issuer %q", ErrInvalidResponse, metadata.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: discovery document lacks required endpoints", ErrInvalidResponse)
+	}
+
+	p.metadata = &metadata
+	return p.metadata, nil
+}
+
+// verifyIDToken applies the checks of OpenID Connect Core section 3.1.3.7.
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, metadata *oidcMetadata, raw, nonce string) (jwt.MapClaims, error) {
+	parser := &jwt.Parser{ValidMethods: idTokenAlgorithms, SkipClaimsValidation: true}
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, metadata.JWKSURI, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: id token: %v", ErrInvalidResponse, err)
+	}
+
+	now := time.Now()
+	if iss, _ := claims["iss"].(string); iss != metadata.Issuer {
+		return nil, fmt.Errorf("%w: id token issued by %q", ErrInvalidResponse, iss)
+	}
+	audience := audienceClaim(claims["aud"])
+	if !contains(audience, p.cfg.ClientID) {
+		return nil, fmt.Errorf("%w: id token is not for this client", ErrInvalidResponse)
+	}
+	if azp, ok := claims["azp"].(string); (ok || len(audience) > 1) && azp != p.cfg.ClientID {
+		return nil, fmt.Errorf("%w: id token was authorized for another party", ErrInvalidResponse)
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(leeway)) {
+		return nil, fmt.Errorf("%w: id token is expired", ErrInvalidResponse)
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(leeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, fmt.Errorf("%w: id token is not valid yet", ErrInvalidResponse)
+	}
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, fmt.Errorf("%w: id token nonce does not match", ErrInvalidResponse)
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, fmt.Errorf("%w: id token has no sub", ErrInvalidResponse)
+	}
+
+	return claims, nil
+}
+
+// key returns the provider's key with the given id, refetching the key set when the
+// id is unknown since providers rotate keys without notice. Tokens without kid are
+// accepted only while the provider publishes a single key.
+func (p *OIDCProvider) key(ctx context.Context, jwksURI, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.fetchedAt) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var jwks security.JWKS
+	if err := getJSON(ctx, p.client, jwksURI, "", &jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// Keys of types we cannot use are skipped rather than failing the whole set.
+		if key, err := jwk.PublicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	p.keys = keys
+	p.fetchedAt = time.Now()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *OIDCProvider) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func identityFromClaims(claims map[string]interface{}) *Identity {
+	identity := &Identity{}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Email, _ = claims["email"].(string)
+	identity.Name, _ = claims["name"].(string)
+	// Some providers send email_verified as a string.
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		identity.EmailVerified = verified == "true"
+	}
+	return identity
+}
+
+// audienceClaim accepts aud as a single string or an array, RFC 7519 section 4.1.3.
+func audienceClaim(aud interface{}) []string {
+	switch v := aud.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		audience := make([]string, 0, len(v))
+		for _, a := range v {
+			if s, ok := a.(string); ok {
+				audience = append(audience, s)
+			}
+		}
+		return audience
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
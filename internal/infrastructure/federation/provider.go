@@ -0,0 +1,171 @@
+package federation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Provider types accepted in Config.Type.
+const (
+	TypeOIDC   = "oidc"
+	TypeGitHub = "github"
+)
+
+var ErrInvalidResponse = errors.New("invalid identity provider response")
+
+// Identity is the account a user proved to own at an upstream provider.
+type Identity struct {
+	// Subject is the provider's stable id of the account. Emails can change hands,
+	// so accounts are only ever matched by Subject.
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Provider is an upstream identity provider users sign in with through the
+// authorization code flow with PKCE.
+type Provider interface {
+	// AuthCodeURL returns the authorization request the user's browser is sent to.
+	AuthCodeURL(ctx context.Context, state, codeChallenge, nonce string) (string, error)
+	// Exchange redeems the code of the callback and returns the verified identity.
+	// nonce must be the one passed to AuthCodeURL.
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*Identity, error)
+}
+
+// Config describes how we are registered as a client at a provider.
+type Config struct {
+	Type string
+	// Issuer is the OpenID Connect issuer the endpoints are discovered from.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the page that receives the callback and posts code and state back.
+	RedirectURL string
+	// Scopes default to what the provider type needs for the user's id and email.
+	Scopes []string
+}
+
+// NewProvider builds the provider of cfg.Type. A nil client gets a 10 second timeout.
+func NewProvider(cfg Config, client *http.Client) (Provider, error) {
+	if cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, errors.New("client id and redirect url are required")
+	}
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	switch cfg.Type {
+	case TypeOIDC:
+		if cfg.Issuer == "" {
+			return nil, errors.New("issuer is required for oidc providers")
+		}
+		return NewOIDCProvider(cfg, client), nil
+	case TypeGitHub:
+		return NewGitHubProvider(cfg, client), nil
+	default:
+		return nil, fmt.Errorf("unknown provider type %q", cfg.Type)
+	}
+}
+
+func authCodeURL(endpoint string, cfg Config, state, codeChallenge, nonce string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", cfg.ClientID)
+	q.Set("redirect_uri", cfg.RedirectURL)
+	q.Set("scope", strings.Join(cfg.Scopes, " "))
+	q.Set("state", state)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+	if nonce != "" {
+		q.Set("nonce", nonce)
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String(), nil
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// exchangeCode authenticates with client_secret_post, which every supported
+// provider accepts.
+func exchangeCode(ctx context.Context, client *http.Client, tokenURL string, cfg Config, code, codeVerifier string) (*tokenResponse, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {cfg.RedirectURL},
+		"client_id":     {cfg.ClientID},
+		"code_verifier": {codeVerifier},
+	}
+	if cfg.ClientSecret != "" {
+		form.Set("client_secret", cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var tokens tokenResponse
+	if err := doJSON(client, req, &tokens); err != nil {
+		return nil, err
+	}
+	// GitHub reports errors with status 200.
+	if tokens.Error != "" {
+		return nil, fmt.Errorf("%w: %s: %s", ErrInvalidResponse, tokens.Error, tokens.ErrorDescription)
+	}
+	if tokens.AccessToken == "" {
+		return nil, fmt.Errorf("%w: no access token", ErrInvalidResponse)
+	}
+
+	return &tokens, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, endpoint, accessToken string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	return doJSON(client, req, v)
+}
+
+func doJSON(client *http.Client, req *http.Request, v interface{}) error {
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body := io.LimitReader(resp.Body, 1<<20)
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(body, 512))
+		return fmt.Errorf("%w: %s %s returned %s: %s", ErrInvalidResponse, req.Method, req.URL.Redacted(), resp.Status, detail)
+	}
+	if err := json.NewDecoder(body).Decode(v); err != nil {
+		return fmt.Errorf("%w: %s %s: %v", ErrInvalidResponse, req.Method, req.URL.Redacted(), err)
+	}
+	return nil
+}
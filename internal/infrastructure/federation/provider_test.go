@@ -0,0 +1,211 @@
+package federation
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockOIDC — локальный OIDC провайдер: discovery, JWKS, token и userinfo эндпоинты
+type mockOIDC struct {
+	*httptest.Server
+	key        *security.SigningKey
+	privateKey *rsa.PrivateKey
+	// claims попадают в следующий выданный ID токен
+	claims   jwt.MapClaims
+	userinfo map[string]interface{}
+}
+
+func newMockOIDC(t *testing.T) *mockOIDC {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	key, err := security.NewAsymmetricKey("", rsaKey, security.AlgorithmRS256)
+	require.NoError(t, err)
+
+	m := &mockOIDC{key: key, privateKey: rsaKey}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"userinfo_endpoint":      m.URL + "/userinfo",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		jwk, _ := security.NewJWK(m.key)
+		json.NewEncoder(w).Encode(security.JWKS{Keys: []security.JWK{jwk}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		// Провайдер проверяет PKCE и секрет клиента
+		if r.PostFormValue("code") != "code" || r.PostFormValue("code_verifier") != "verifier" ||
+			r.PostFormValue("client_secret") != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(m.key.Method, m.claims)
+		token.Header["kid"] = m.key.Kid
+		idToken, err := token.SignedString(m.privateKey)
+		require.NoError(t, err)
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "upstream-access", "id_token": idToken})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer upstream-access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(m.userinfo)
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+
+	m.claims = m.validClaims()
+	return m
+}
+
+func (m *mockOIDC) validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            m.URL,
+		"aud":            "auth-service",
+		"sub":            "upstream-1",
+		"email":          "test@test.com",
+		"email_verified": true,
+		"nonce":          "nonce",
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"iat":            time.Now().Unix(),
+	}
+}
+
+func (m *mockOIDC) provider(t *testing.T) Provider {
+	provider, err := NewProvider(Config{
+		Type:         TypeOIDC,
+		Issuer:       m.URL,
+		ClientID:     "auth-service",
+		ClientSecret: "secret",
+		RedirectURL:  "https://app.example.com/login/callback",
+	}, m.Client())
+	require.NoError(t, err)
+	return provider
+}
+
+func TestOIDCProvider_AuthCodeURL(t *testing.T) {
+	m := newMockOIDC(t)
+
+	raw, err := m.provider(t).AuthCodeURL(context.Background(), "state", "challenge", "nonce")
+	require.NoError(t, err)
+	u, err := url.Parse(raw)
+	require.NoError(t, err)
+	assert.Equal(t, m.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+	assert.Equal(t, "openid email profile", u.Query().Get("scope"))
+	assert.Equal(t, "challenge", u.Query().Get("code_challenge"))
+	assert.Equal(t, "S256", u.Query().Get("code_challenge_method"))
+	assert.Equal(t, "nonce", u.Query().Get("nonce"))
+	assert.Equal(t, "state", u.Query().Get("state"))
+}
+
+func TestOIDCProvider_Exchange(t *testing.T) {
+	m := newMockOIDC(t)
+	provider := m.provider(t)
+
+	identity, err := provider.Exchange(context.Background(), "code", "verifier", "nonce")
+	require.NoError(t, err)
+	assert.Equal(t, &Identity{Subject: "upstream-1", Email: "test@test.com", EmailVerified: true}, identity)
+
+	_, err = provider.Exchange(context.Background(), "code", "wrong-verifier", "nonce")
+	assert.ErrorIs(t, err, ErrInvalidResponse)
+
+	// Каждое нарушение проверок ID токена отклоняется
+	cases := map[string]func(jwt.MapClaims){
+		"nonce":    func(c jwt.MapClaims) { c["nonce"] = "other" },
+		"audience": func(c jwt.MapClaims) { c["aud"] = "other-client" },
+		"issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+		"expired":  func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"azp":      func(c jwt.MapClaims) { c["aud"] = []string{"auth-service", "other"}; c["azp"] = "other" },
+		"no sub":   func(c jwt.MapClaims) { delete(c, "sub") },
+	}
+	for name, mutate := range cases {
+		t.Run(name, func(t *testing.T) {
+			m.claims = m.validClaims()
+			mutate(m.claims)
+			_, err := provider.Exchange(context.Background(), "code", "verifier", "nonce")
+			assert.ErrorIs(t, err, ErrInvalidResponse)
+		})
+	}
+}
+
+func TestOIDCProvider_ExchangeRejectsForeignKey(t *testing.T) {
+	m := newMockOIDC(t)
+	provider := m.provider(t)
+	// Прогреваем кэш ключей, затем провайдер подписывает чужим ключом с тем же kid
+	_, err := provider.Exchange(context.Background(), "code", "verifier", "nonce")
+	require.NoError(t, err)
+
+	m.privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	_, err = provider.Exchange(context.Background(), "code", "verifier", "nonce")
+	assert.ErrorIs(t, err, ErrInvalidResponse)
+}
+
+func TestOIDCProvider_EmailFromUserinfo(t *testing.T) {
+	m := newMockOIDC(t)
+	delete(m.claims, "email")
+	delete(m.claims, "email_verified")
+	m.userinfo = map[string]interface{}{"sub": "upstream-1", "email": "test@test.com", "email_verified": "true", "name": "Test"}
+
+	identity, err := m.provider(t).Exchange(context.Background(), "code", "verifier", "nonce")
+	require.NoError(t, err)
+	assert.Equal(t, &Identity{Subject: "upstream-1", Email: "test@test.com", EmailVerified: true, Name: "Test"}, identity)
+
+	// Ответ userinfo о другом пользователе не принимается
+	m.userinfo["sub"] = "upstream-2"
+	_, err = m.provider(t).Exchange(context.Background(), "code", "verifier", "nonce")
+	assert.ErrorIs(t, err, ErrInvalidResponse)
+}
+
+func TestGitHubProvider_Exchange(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != "code" {
+			// GitHub отвечает на ошибки статусом 200
+			json.NewEncoder(w).Encode(map[string]string{"error": "bad_verification_code"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "gh-token"})
+	})
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": 42, "login": "octocat", "email": "public@test.com"})
+	})
+	mux.HandleFunc("/user/emails", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]map[string]interface{}{
+			{"email": "old@test.com", "primary": false, "verified": true},
+			{"email": "test@test.com", "primary": true, "verified": true},
+		})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	provider := NewGitHubProvider(Config{ClientID: "id", ClientSecret: "secret", RedirectURL: "https://app.example.com/cb"}, srv.Client())
+	provider.tokenURL = srv.URL + "/login/oauth/access_token"
+	provider.apiURL = srv.URL
+
+	identity, err := provider.Exchange(context.Background(), "code", "verifier", "")
+	require.NoError(t, err)
+	assert.Equal(t, &Identity{Subject: "42", Email: "test@test.com", EmailVerified: true, Name: "octocat"}, identity)
+
+	_, err = provider.Exchange(context.Background(), "wrong", "verifier", "")
+	assert.ErrorIs(t, err, ErrInvalidResponse)
+}
@@ -3,6 +3,7 @@ package grpc
 import (
 	"context"
 	"github.com/danilkompaniets/auth-service/internal/infrastructure/config"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/ratelimit"
 	grpc2 "github.com/danilkompaniets/auth-service/internal/interfaces/grpc"
 	gen_auth "github.com/danilkompaniets/go-chat-common/gen/gen-auth"
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
@@ -14,20 +15,27 @@ import (
 type GRPCApp struct {
 	handler    *grpc2.AuthGRPCHandler
 	cfg        config.Config
+	limiter    *ratelimit.Limiter
 	grpcServer *grpc.Server
 	listener   net.Listener
 }
 
-func NewGRPCApp(handler *grpc2.AuthGRPCHandler, cfg config.Config) *GRPCApp {
+func NewGRPCApp(handler *grpc2.AuthGRPCHandler, cfg config.Config, limiter *ratelimit.Limiter) *GRPCApp {
 	return &GRPCApp{
 		handler: handler,
 		cfg:     cfg,
+		limiter: limiter,
 	}
 }
 
 func (a *GRPCApp) Run() error {
+	unary := []grpc.UnaryServerInterceptor{grpc_prometheus.UnaryServerInterceptor}
+	if a.limiter != nil {
+		unary = append(unary, ratelimit.UnaryServerInterceptor(a.limiter))
+	}
+
 	a.grpcServer = grpc.NewServer(
-		grpc.UnaryInterceptor(grpc_prometheus.UnaryServerInterceptor),
+		grpc.ChainUnaryInterceptor(unary...),
 		grpc.StreamInterceptor(grpc_prometheus.StreamServerInterceptor),
 	)
 
@@ -1,7 +1,11 @@
 package http
 
 import (
+	"fmt"
+
+	"github.com/danilkompaniets/auth-service/internal/application"
 	"github.com/danilkompaniets/auth-service/internal/infrastructure/config"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/ratelimit"
 	"github.com/danilkompaniets/auth-service/internal/interfaces/http"
 	"github.com/gin-gonic/gin"
 )
@@ -11,17 +15,80 @@ type router struct {
 	handler gin.HandlerFunc
 }
 
-func SetupRoutes(handler *http.HttpHandler) *gin.Engine {
+// SetupRoutes believes X-Forwarded-For only from trustedProxies. Everything keyed by
+// client IP, like rate limits and lockouts, depends on it, so nil trusts no proxy.
+func SetupRoutes(handler *http.HttpHandler, limiter *ratelimit.Limiter, trustedProxies []string) (*gin.Engine, error) {
 	router := gin.New()
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
 	router.Use(gin.Recovery())
 	router.Use(gin.Logger())
 	router.Use(gin.Logger())
 
+	limit := handler.RateLimit(limiter)
+
+	router.GET("/.well-known/jwks.json", limit, handler.JWKS)
+	router.GET("/.well-known/openid-configuration", limit, handler.OpenIDConfiguration)
+	router.GET("/oauth/authorize", limit, handler.Authorize)
+	router.POST("/oauth/authorize", limit, handler.ApproveAuthorization)
+	router.POST("/oauth/token", limit, handler.Token)
+	router.POST("/oauth/introspect", limit, handler.Introspect)
+	router.POST("/oauth/revoke", limit, handler.Revoke)
+	router.GET("/userinfo", handler.RequireOAuthToken(), limit, handler.UserInfo)
+	router.POST("/userinfo", handler.RequireOAuthToken(), limit, handler.UserInfo)
+
 	api := router.Group("api/v1/auth")
-	api.POST("/login", handler.Login)
-	api.POST("/register", handler.Register)
-	api.POST("/refresh-token", handler.RefreshTokens)
-	api.POST("/logout", handler.Logout)
+	public := api.Group("", limit)
+	public.POST("/login", handler.Login)
+	public.POST("/login/mfa", handler.CompleteMFALogin)
+	public.POST("/login/mfa/passkey/begin", handler.BeginPasskeyMFA)
+	public.POST("/login/mfa/passkey/finish", handler.CompletePasskeyMFALogin)
+	public.POST("/login/email", handler.RequestEmailLogin)
+	public.POST("/login/email/code", handler.LoginWithEmailCode)
+	public.POST("/login/email/link", handler.LoginWithEmailLink)
+	public.POST("/login/passkey/begin", handler.BeginPasskeyLogin)
+	public.POST("/login/passkey/finish", handler.FinishPasskeyLogin)
+	public.GET("/federation/providers", handler.FederationProviders)
+	public.POST("/federation/providers/:provider/begin", handler.BeginFederatedLogin)
+	public.POST("/federation/callback", handler.CompleteFederatedLogin)
+	public.POST("/register", handler.Register)
+	public.POST("/refresh-token", handler.RefreshTokens)
+	public.POST("/logout", handler.Logout)
+	public.POST("/tokens/revoke", handler.RevokeToken)
+	public.GET("/verify-email", handler.VerifyEmail)
+	public.POST("/verify-email/resend", handler.ResendVerificationEmail)
+	public.POST("/password/forgot", handler.ForgotPassword)
+	public.POST("/password/reset", handler.ResetPassword)
+	public.GET("/email/confirm", handler.ConfirmEmailChange)
+
+	protected := api.Group("", handler.RequireAuth(), limit)
+	protected.POST("/tokens/revoke-all", handler.RevokeAllTokens)
+	protected.POST("/password/change", handler.ChangePassword)
+	protected.POST("/email/change", handler.ChangeEmail)
+	protected.POST("/mfa/totp/enroll", handler.EnrollTOTP)
+	protected.POST("/mfa/totp/confirm", handler.ConfirmTOTP)
+	protected.GET("/passkeys", handler.ListPasskeys)
+	protected.POST("/passkeys/register/begin", handler.BeginPasskeyRegistration)
+	protected.POST("/passkeys/register/finish", handler.FinishPasskeyRegistration)
+	protected.DELETE("/passkeys/:id", handler.DeletePasskey)
+	protected.GET("/identities", handler.ListIdentities)
+	protected.POST("/identities/providers/:provider/begin", handler.BeginIdentityLink)
+	protected.POST("/identities/callback", handler.CompleteIdentityLink)
+	protected.DELETE("/identities/:id", handler.UnlinkIdentity)
+
+	admin := protected.Group("/admin")
+	admin.GET("/roles", handler.RequirePermission(application.PermissionManageRoles), handler.ListRoles)
+	admin.PUT("/roles/:name", handler.RequirePermission(application.PermissionManageRoles), handler.SaveRole)
+	admin.POST("/users/:id/roles", handler.RequirePermission(application.PermissionManageRoles), handler.AssignRole)
+	admin.DELETE("/users/:id/roles/:role", handler.RequirePermission(application.PermissionManageRoles), handler.RevokeRole)
+	admin.POST("/users/:id/tokens/revoke", handler.RequirePermission(application.PermissionRevokeTokens), handler.RevokeUserTokens)
+	admin.DELETE("/users/:id/mfa", handler.RequirePermission(application.PermissionManageUsers), handler.ResetMFA)
+	admin.POST("/users/:id/unlock", handler.RequirePermission(application.PermissionManageUsers), handler.UnlockUser)
+	admin.DELETE("/lockouts/ip/:ip", handler.RequirePermission(application.PermissionManageUsers), handler.UnlockIP)
+	admin.GET("/oauth/clients", handler.RequirePermission(application.PermissionManageClients), handler.ListOAuthClients)
+	admin.POST("/oauth/clients", handler.RequirePermission(application.PermissionManageClients), handler.RegisterOAuthClient)
+	admin.DELETE("/oauth/clients/:id", handler.RequirePermission(application.PermissionManageClients), handler.DeleteOAuthClient)
 
-	return router
+	return router, nil
 }
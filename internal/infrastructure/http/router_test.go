@@ -0,0 +1,95 @@
+package http
+
+import (
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/application"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/ratelimit"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+	"github.com/danilkompaniets/auth-service/internal/interfaces/http"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdminRoutes_RejectOAuthClientTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	jwt := security.NewJWTManager("access", "refresh", time.Minute, time.Hour)
+	router, err := SetupRoutes(http.NewHttpHandler(application.NewAuthService(nil, jwt)), nil, nil)
+	require.NoError(t, err)
+
+	// Токен выдан OAuth клиенту, но несёт права администратора
+	token, err := jwt.GenerateAccessToken(1, security.Authorization{
+		Roles:       []string{"admin"},
+		Permissions: []string{application.PermissionManageRoles},
+		ClientID:    "grafana",
+		Scopes:      []string{"openid"},
+	})
+	require.NoError(t, err)
+
+	for _, path := range []string{"/api/v1/auth/admin/roles", "/api/v1/auth/passkeys"} {
+		req := httptest.NewRequest(nethttp.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, nethttp.StatusForbidden, rec.Code, path)
+	}
+}
+
+func TestRateLimit_IgnoresForwardedForFromUntrustedPeers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter, err := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), []ratelimit.Rule{
+		{Route: "*", Key: ratelimit.KeyIP, Limit: ratelimit.Limit{Requests: 1, Window: time.Minute}},
+	})
+	require.NoError(t, err)
+	router, err := SetupRoutes(http.NewHttpHandler(application.NewAuthService(nil, nil)), limiter, nil)
+	require.NoError(t, err)
+
+	// Каждый запрос подставляет новый X-Forwarded-For, но приходит с того же адреса
+	codes := make([]int, 0, 2)
+	for _, forwarded := range []string{"203.0.113.1", "203.0.113.2"} {
+		req := httptest.NewRequest(nethttp.MethodGet, "/api/v1/auth/federation/providers", nil)
+		req.RemoteAddr = "198.51.100.7:4000"
+		req.Header.Set("X-Forwarded-For", forwarded)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		codes = append(codes, rec.Code)
+	}
+
+	assert.Equal(t, []int{nethttp.StatusOK, nethttp.StatusTooManyRequests}, codes)
+}
+
+func TestRefreshTokens_InvalidTokenIsUnauthorized(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	jwt := security.NewJWTManager("access", "refresh", time.Minute, time.Hour)
+	router, err := SetupRoutes(http.NewHttpHandler(application.NewAuthService(nil, jwt)), nil, nil)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(nethttp.MethodPost, "/api/v1/auth/refresh-token", nil)
+	req.AddCookie(&nethttp.Cookie{Name: "refresh_token", Value: "garbage"})
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	// Клиент должен войти заново, а не повторять запрос
+	assert.Equal(t, nethttp.StatusUnauthorized, rec.Code)
+}
+
+func TestLogout_WithoutTokenIsUnauthorized(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router, err := SetupRoutes(http.NewHttpHandler(application.NewAuthService(nil, nil)), nil, nil)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(nethttp.MethodPost, "/api/v1/auth/logout", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, nethttp.StatusUnauthorized, rec.Code)
+	// Кука всё равно стирается
+	assert.Contains(t, rec.Header().Get("Set-Cookie"), "refresh_token=;")
+}
@@ -3,6 +3,7 @@ package http
 import (
 	"context"
 	"github.com/danilkompaniets/auth-service/internal/application"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/ratelimit"
 	http2 "github.com/danilkompaniets/auth-service/internal/interfaces/http"
 	"net/http"
 	"time"
@@ -13,9 +14,12 @@ type HttpApplication struct {
 	service *application.AuthService
 }
 
-func NewHttpApplication(service *application.AuthService) *HttpApplication {
+func NewHttpApplication(service *application.AuthService, limiter *ratelimit.Limiter, trustedProxies []string) (*HttpApplication, error) {
 	handler := http2.NewHttpHandler(service)
-	r := SetupRoutes(handler)
+	r, err := SetupRoutes(handler, limiter, trustedProxies)
+	if err != nil {
+		return nil, err
+	}
 
 	return &HttpApplication{
 		service: service,
@@ -25,7 +29,7 @@ func NewHttpApplication(service *application.AuthService) *HttpApplication {
 			WriteTimeout: 10 * time.Second,
 			IdleTimeout:  120 * time.Second,
 		},
-	}
+	}, nil
 }
 
 func (app *HttpApplication) Run(port string) error {
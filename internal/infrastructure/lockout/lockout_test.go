@@ -0,0 +1,129 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockRepo struct {
+	mock.Mock
+}
+
+func (m *MockRepo) RecordLoginFailure(ctx context.Context, key string, at time.Time, resetBefore time.Time) (int, error) {
+	args := m.Called(ctx, key, at, resetBefore)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockRepo) GetLoginFailures(ctx context.Context, key string) (int, time.Time, error) {
+	args := m.Called(ctx, key)
+	return args.Int(0), args.Get(1).(time.Time), args.Error(2)
+}
+
+func (m *MockRepo) ResetLoginFailures(ctx context.Context, key string) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+func (m *MockRepo) DeleteLoginFailuresBefore(ctx context.Context, before time.Time) (int64, error) {
+	args := m.Called(ctx, before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+var testPolicy = Policy{Threshold: 3, BaseDelay: time.Minute, MaxDelay: 10 * time.Minute, ResetAfter: time.Hour}
+
+func TestPolicy_Delay(t *testing.T) {
+	assert.Zero(t, testPolicy.Delay(2))
+	assert.Equal(t, time.Minute, testPolicy.Delay(3))
+	assert.Equal(t, 2*time.Minute, testPolicy.Delay(4))
+	assert.Equal(t, 8*time.Minute, testPolicy.Delay(6))
+	// Рост ограничен MaxDelay
+	assert.Equal(t, 10*time.Minute, testPolicy.Delay(7))
+	assert.Equal(t, 10*time.Minute, testPolicy.Delay(100))
+}
+
+func TestMemoryTracker_LocksOutAfterThreshold(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	tracker := NewMemoryTracker(testPolicy)
+	tracker.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		lockout, err := tracker.RecordFailure(ctx, "account:a@b.c")
+		assert.NoError(t, err)
+		assert.Zero(t, lockout)
+	}
+
+	lockout, err := tracker.RecordFailure(ctx, "account:a@b.c")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, lockout)
+
+	remaining, err := tracker.Check(ctx, "account:a@b.c")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, remaining)
+
+	// Другие ключи не затронуты
+	remaining, _ = tracker.Check(ctx, "ip:10.0.0.1")
+	assert.Zero(t, remaining)
+
+	// После истечения блокировки попытки снова разрешены
+	now = now.Add(time.Minute)
+	remaining, _ = tracker.Check(ctx, "account:a@b.c")
+	assert.Zero(t, remaining)
+
+	// Следующая неудача удваивает блокировку
+	lockout, _ = tracker.RecordFailure(ctx, "account:a@b.c")
+	assert.Equal(t, 2*time.Minute, lockout)
+}
+
+func TestMemoryTracker_ResetAndExpiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	tracker := NewMemoryTracker(testPolicy)
+	tracker.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		tracker.RecordFailure(ctx, "account:a@b.c")
+	}
+	assert.NoError(t, tracker.Reset(ctx, "account:a@b.c"))
+	remaining, _ := tracker.Check(ctx, "account:a@b.c")
+	assert.Zero(t, remaining)
+
+	// Неудачи старше ResetAfter забываются
+	tracker.RecordFailure(ctx, "account:a@b.c")
+	tracker.RecordFailure(ctx, "account:a@b.c")
+	now = now.Add(time.Hour)
+	lockout, _ := tracker.RecordFailure(ctx, "account:a@b.c")
+	assert.Zero(t, lockout)
+}
+
+func TestSQLTracker_RecordFailureAndCheck(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	repo := new(MockRepo)
+	tracker := NewSQLTracker(repo, testPolicy)
+	tracker.now = func() time.Time { return now }
+
+	repo.On("RecordLoginFailure", ctx, "ip:10.0.0.1", now, now.Add(-time.Hour)).Return(4, nil)
+	lockout, err := tracker.RecordFailure(ctx, "ip:10.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Minute, lockout)
+
+	repo.On("GetLoginFailures", ctx, "ip:10.0.0.1").Return(4, now.Add(-30*time.Second), nil)
+	remaining, err := tracker.Check(ctx, "ip:10.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, 90*time.Second, remaining)
+
+	repo.On("GetLoginFailures", ctx, "ip:10.0.0.2").Return(0, time.Time{}, nil)
+	remaining, err = tracker.Check(ctx, "ip:10.0.0.2")
+	assert.NoError(t, err)
+	assert.Zero(t, remaining)
+
+	repo.On("ResetLoginFailures", ctx, "ip:10.0.0.1").Return(nil)
+	assert.NoError(t, tracker.Reset(ctx, "ip:10.0.0.1"))
+
+	repo.AssertExpectations(t)
+}
@@ -0,0 +1,86 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryTracker keeps failed logins in process memory. Each replica counts on its
+// own, so use SQLTracker when running more than one.
+type MemoryTracker struct {
+	policy Policy
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]entry
+}
+
+type entry struct {
+	failures int
+	last     time.Time
+}
+
+func NewMemoryTracker(policy Policy) *MemoryTracker {
+	return &MemoryTracker{policy: policy, now: time.Now, entries: make(map[string]entry)}
+}
+
+func (t *MemoryTracker) Check(_ context.Context, key string) (time.Duration, error) {
+	t.mu.Lock()
+	e, ok := t.entries[key]
+	t.mu.Unlock()
+	if !ok {
+		return 0, nil
+	}
+
+	lockout := t.policy.remaining(e.failures, e.last, t.now())
+	observeCheck(key, lockout)
+	return lockout, nil
+}
+
+func (t *MemoryTracker) RecordFailure(_ context.Context, key string) (time.Duration, error) {
+	now := t.now()
+
+	t.mu.Lock()
+	e := t.entries[key]
+	if now.Sub(e.last) >= t.policy.ResetAfter {
+		e.failures = 0
+	}
+	e.failures++
+	e.last = now
+	t.entries[key] = e
+	t.mu.Unlock()
+
+	lockout := t.policy.Delay(e.failures)
+	observeFailure(key, lockout)
+	return lockout, nil
+}
+
+func (t *MemoryTracker) Reset(_ context.Context, key string) error {
+	t.mu.Lock()
+	delete(t.entries, key)
+	t.mu.Unlock()
+	return nil
+}
+
+// Run forgets stale failures every interval until ctx is cancelled.
+func (t *MemoryTracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cutoff := t.now().Add(-t.policy.ResetAfter)
+			t.mu.Lock()
+			for key, e := range t.entries {
+				if e.last.Before(cutoff) {
+					delete(t.entries, key)
+				}
+			}
+			t.mu.Unlock()
+		}
+	}
+}
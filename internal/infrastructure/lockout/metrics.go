@@ -0,0 +1,36 @@
+package lockout
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	failuresTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_login_failures_total",
+		Help: "Failed login attempts by throttling scope.",
+	}, []string{"scope"})
+	lockoutsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_login_lockouts_total",
+		Help: "Failed logins that started or extended a lockout, by throttling scope.",
+	}, []string{"scope"})
+	rejectedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_login_rejected_total",
+		Help: "Login attempts rejected because of an active lockout, by throttling scope.",
+	}, []string{"scope"})
+)
+
+func observeFailure(key string, lockout time.Duration) {
+	failuresTotal.WithLabelValues(scope(key)).Inc()
+	if lockout > 0 {
+		lockoutsTotal.WithLabelValues(scope(key)).Inc()
+	}
+}
+
+func observeCheck(key string, lockout time.Duration) {
+	if lockout > 0 {
+		rejectedTotal.WithLabelValues(scope(key)).Inc()
+	}
+}
@@ -0,0 +1,52 @@
+package lockout
+
+import (
+	"strings"
+	"time"
+)
+
+// Policy decides how long a key is locked out after repeated failed logins. The
+// first Threshold-1 failures are free, then every further failure doubles the
+// lockout, starting at BaseDelay and capped at MaxDelay.
+type Policy struct {
+	Threshold int
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// ResetAfter without a failure forgets the earlier ones.
+	ResetAfter time.Duration
+}
+
+// Delay returns the lockout that follows the given number of failures.
+func (p Policy) Delay(failures int) time.Duration {
+	if failures < p.Threshold {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.Threshold; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// remaining is how much of the lockout after the last failure is left at now.
+func (p Policy) remaining(failures int, last, now time.Time) time.Duration {
+	if now.Sub(last) >= p.ResetAfter {
+		return 0
+	}
+	if left := last.Add(p.Delay(failures)).Sub(now); left > 0 {
+		return left
+	}
+	return 0
+}
+
+// scope is the kind of key, e.g. "account" or "ip", used as the metrics label.
+func scope(key string) string {
+	if i := strings.IndexByte(key, ':'); i > 0 {
+		return key[:i]
+	}
+	return "other"
+}
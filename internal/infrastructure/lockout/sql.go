@@ -0,0 +1,68 @@
+package lockout
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+)
+
+// SQLTracker keeps failed logins in the database so every replica sees the same
+// counters and lockouts.
+type SQLTracker struct {
+	repo   repository.LoginAttemptRepository
+	policy Policy
+	now    func() time.Time
+}
+
+func NewSQLTracker(repo repository.LoginAttemptRepository, policy Policy) *SQLTracker {
+	return &SQLTracker{repo: repo, policy: policy, now: time.Now}
+}
+
+func (t *SQLTracker) Check(ctx context.Context, key string) (time.Duration, error) {
+	failures, last, err := t.repo.GetLoginFailures(ctx, key)
+	if err != nil || failures == 0 {
+		return 0, err
+	}
+
+	lockout := t.policy.remaining(failures, last, t.now())
+	observeCheck(key, lockout)
+	return lockout, nil
+}
+
+func (t *SQLTracker) RecordFailure(ctx context.Context, key string) (time.Duration, error) {
+	now := t.now()
+
+	failures, err := t.repo.RecordLoginFailure(ctx, key, now, now.Add(-t.policy.ResetAfter))
+	if err != nil {
+		return 0, err
+	}
+
+	lockout := t.policy.Delay(failures)
+	observeFailure(key, lockout)
+	return lockout, nil
+}
+
+func (t *SQLTracker) Reset(ctx context.Context, key string) error {
+	return t.repo.ResetLoginFailures(ctx, key)
+}
+
+// Run deletes stale failures every interval until ctx is cancelled.
+func (t *SQLTracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := t.repo.DeleteLoginFailuresBefore(ctx, t.now().Add(-t.policy.ResetAfter)); err != nil {
+				log.Printf("login attempt cleanup failed: %v", err)
+			} else if n > 0 {
+				log.Printf("login attempt cleanup removed %d entries", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogMailer(t *testing.T) {
+	var buf bytes.Buffer
+	mailer := NewLogMailer(&buf)
+
+	err := mailer.Send(context.Background(), Message{To: "test@test.com", Subject: "Hello", Body: "link"})
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "To: test@test.com")
+	assert.Contains(t, buf.String(), "link")
+}
+
+func TestSMTPMailer(t *testing.T) {
+	mailer := NewSMTPMailer(SMTPConfig{Host: "smtp.test", Port: "587", Username: "user", Password: "pass", From: "noreply@test.com"})
+
+	var sent []byte
+	mailer.send = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		assert.Equal(t, "smtp.test:587", addr)
+		assert.NotNil(t, a)
+		assert.Equal(t, "noreply@test.com", from)
+		assert.Equal(t, []string{"test@test.com"}, to)
+		sent = msg
+		return nil
+	}
+
+	err := mailer.Send(context.Background(), Message{To: "test@test.com", Subject: "Hello", Body: "line1\nline2"})
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(sent), "From: noreply@test.com\r\n"))
+	assert.Contains(t, string(sent), "line1\r\nline2")
+
+	// Ошибка SMTP сервера
+	mailer.send = func(string, smtp.Auth, string, []string, []byte) error {
+		return errors.New("connection refused")
+	}
+	err = mailer.Send(context.Background(), Message{To: "test@test.com"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor rejects calls over their limit with ResourceExhausted and
+// a retry-after trailer in seconds.
+func UnaryServerInterceptor(limiter *Limiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		wait := limiter.Allow(ctx, info.FullMethod, grpcKeys(ctx))
+		if wait > 0 {
+			seconds := strconv.Itoa(int(math.Ceil(wait.Seconds())))
+			_ = grpc.SetTrailer(ctx, metadata.Pairs("retry-after", seconds))
+			return nil, status.Error(codes.ResourceExhausted, fmt.Sprintf("rate limit exceeded, retry in %ss", seconds))
+		}
+		return handler(ctx, req)
+	}
+}
+
+// grpcKeys takes the client id from the common name of a verified TLS client
+// certificate. Ids callers merely claim, e.g. in metadata, are ignored: a fresh one
+// per call would get a fresh bucket, so such callers are counted by peer IP.
+func grpcKeys(ctx context.Context) Keys {
+	var keys Keys
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return keys
+	}
+	if p.Addr != nil {
+		keys.IP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(keys.IP); err == nil {
+			keys.IP = host
+		}
+	}
+	if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.VerifiedChains) > 0 {
+		keys.ClientID = tlsInfo.State.VerifiedChains[0][0].Subject.CommonName
+	}
+	return keys
+}
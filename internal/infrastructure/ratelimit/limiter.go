@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"time"
+)
+
+// Key kinds a rule can count requests by.
+const (
+	KeyIP     = "ip"
+	KeyUser   = "user"
+	KeyClient = "client"
+)
+
+// Limit allows Requests per Window on average with bursts of up to Burst requests.
+type Limit struct {
+	Requests int
+	Window   time.Duration
+	Burst    int
+}
+
+// Rule limits the requests to the routes matching Route. HTTP routes are written as
+// "METHOD /path" with gin's path parameters, gRPC routes as the full method name.
+// Route is a path.Match pattern; "*" matches every route.
+type Rule struct {
+	Route string
+	Key   string
+	Limit Limit
+}
+
+// Keys identify the caller of a request; empty values are unknown. UserID and
+// ClientID must be authenticated, never taken from what the caller merely claims.
+type Keys struct {
+	IP       string
+	UserID   string
+	ClientID string
+}
+
+// Store keeps the token buckets. MemoryStore is the default.
+type Store interface {
+	// Take removes a token from key's bucket and returns how long to wait for the
+	// next one when the bucket is empty, zero when the request is allowed.
+	Take(ctx context.Context, key string, limit Limit) (time.Duration, error)
+}
+
+// Limiter applies the first rule matching a route. Routes without a rule are not limited.
+type Limiter struct {
+	store Store
+	rules []Rule
+}
+
+func NewLimiter(store Store, rules []Rule) (*Limiter, error) {
+	for _, rule := range rules {
+		if _, err := path.Match(rule.Route, ""); err != nil {
+			return nil, fmt.Errorf("invalid rate limit route %q: %w", rule.Route, err)
+		}
+		switch rule.Key {
+		case KeyIP, KeyUser, KeyClient:
+		default:
+			return nil, fmt.Errorf("unknown rate limit key %q for route %q", rule.Key, rule.Route)
+		}
+		if rule.Limit.Requests <= 0 || rule.Limit.Window <= 0 {
+			return nil, fmt.Errorf("rate limit for route %q needs positive requests and window", rule.Route)
+		}
+	}
+
+	return &Limiter{store: store, rules: rules}, nil
+}
+
+// Allow counts the request and returns how long the caller must wait before
+// retrying, zero when the request may proceed. Store errors let the request through.
+func (l *Limiter) Allow(ctx context.Context, route string, keys Keys) time.Duration {
+	rule, ok := l.match(route)
+	if !ok {
+		return 0
+	}
+
+	wait, err := l.store.Take(ctx, rule.Route+"|"+bucketKey(rule.Key, keys), rule.Limit)
+	if err != nil {
+		log.Printf("rate limit check failed: %v", err)
+		return 0
+	}
+	return wait
+}
+
+func (l *Limiter) match(route string) (Rule, bool) {
+	for _, rule := range l.rules {
+		if rule.Route == "*" {
+			return rule, true
+		}
+		if ok, _ := path.Match(rule.Route, route); ok {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// bucketKey picks the caller identity the rule counts by, falling back to the
+// client IP when the request does not carry it.
+func bucketKey(kind string, keys Keys) string {
+	switch {
+	case kind == KeyUser && keys.UserID != "":
+		return "user:" + keys.UserID
+	case kind == KeyClient && keys.ClientID != "":
+		return "client:" + keys.ClientID
+	default:
+		return "ip:" + keys.IP
+	}
+}
@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type MockStore struct {
+	mock.Mock
+}
+
+func (m *MockStore) Take(ctx context.Context, key string, limit Limit) (time.Duration, error) {
+	args := m.Called(ctx, key, limit)
+	return args.Get(0).(time.Duration), args.Error(1)
+}
+
+func TestMemoryStore_TokenBucket(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limit := Limit{Requests: 2, Window: time.Second, Burst: 3}
+
+	// Сначала доступен весь burst
+	for i := 0; i < 3; i++ {
+		wait, err := store.Take(ctx, "k", limit)
+		assert.NoError(t, err)
+		assert.Zero(t, wait)
+	}
+
+	wait, _ := store.Take(ctx, "k", limit)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	// Другой ключ считается отдельно
+	wait, _ = store.Take(ctx, "other", limit)
+	assert.Zero(t, wait)
+
+	// Токены пополняются со скоростью Requests/Window
+	now = now.Add(500 * time.Millisecond)
+	wait, _ = store.Take(ctx, "k", limit)
+	assert.Zero(t, wait)
+	wait, _ = store.Take(ctx, "k", limit)
+	assert.Equal(t, 500*time.Millisecond, wait)
+}
+
+func TestNewLimiter_RejectsInvalidRules(t *testing.T) {
+	_, err := NewLimiter(NewMemoryStore(), []Rule{{Route: "*", Key: "session", Limit: Limit{Requests: 1, Window: time.Second}}})
+	assert.Error(t, err)
+
+	_, err = NewLimiter(NewMemoryStore(), []Rule{{Route: "*", Key: KeyIP}})
+	assert.Error(t, err)
+
+	_, err = NewLimiter(NewMemoryStore(), []Rule{{Route: "[", Key: KeyIP, Limit: Limit{Requests: 1, Window: time.Second}}})
+	assert.Error(t, err)
+}
+
+func TestLimiter_MatchesFirstRuleAndKey(t *testing.T) {
+	ctx := context.Background()
+	store := new(MockStore)
+	register := Limit{Requests: 5, Window: time.Hour}
+	validate := Limit{Requests: 100, Window: time.Second}
+	fallback := Limit{Requests: 300, Window: time.Minute}
+	limiter, err := NewLimiter(store, []Rule{
+		{Route: "POST /api/v1/auth/register", Key: KeyIP, Limit: register},
+		{Route: "/*/ValidateToken", Key: KeyClient, Limit: validate},
+		{Route: "GET /api/v1/auth/passkeys", Key: KeyUser, Limit: fallback},
+		{Route: "*", Key: KeyIP, Limit: fallback},
+	})
+	assert.NoError(t, err)
+
+	store.On("Take", ctx, "POST /api/v1/auth/register|ip:10.0.0.1", register).Return(time.Minute, nil)
+	assert.Equal(t, time.Minute, limiter.Allow(ctx, "POST /api/v1/auth/register", Keys{IP: "10.0.0.1"}))
+
+	store.On("Take", ctx, "/*/ValidateToken|client:chat", validate).Return(time.Duration(0), nil)
+	assert.Zero(t, limiter.Allow(ctx, "/auth.AuthService/ValidateToken", Keys{IP: "10.0.0.2", ClientID: "chat"}))
+
+	store.On("Take", ctx, "GET /api/v1/auth/passkeys|user:7", fallback).Return(time.Duration(0), nil)
+	assert.Zero(t, limiter.Allow(ctx, "GET /api/v1/auth/passkeys", Keys{IP: "10.0.0.2", UserID: "7"}))
+
+	// Без client id вызов считается по IP
+	store.On("Take", ctx, "/*/ValidateToken|ip:10.0.0.3", validate).Return(time.Duration(0), nil)
+	assert.Zero(t, limiter.Allow(ctx, "/auth.AuthService/ValidateToken", Keys{IP: "10.0.0.3"}))
+
+	store.On("Take", ctx, "*|ip:10.0.0.1", fallback).Return(time.Duration(0), nil)
+	assert.Zero(t, limiter.Allow(ctx, "POST /api/v1/auth/login", Keys{IP: "10.0.0.1"}))
+
+	store.AssertExpectations(t)
+}
+
+func TestLimiter_StoreErrorAllows(t *testing.T) {
+	store := new(MockStore)
+	limiter, _ := NewLimiter(store, []Rule{{Route: "*", Key: KeyIP, Limit: Limit{Requests: 1, Window: time.Second}}})
+	store.On("Take", mock.Anything, mock.Anything, mock.Anything).Return(time.Duration(0), errors.New("store down"))
+
+	assert.Zero(t, limiter.Allow(context.Background(), "POST /api/v1/auth/login", Keys{IP: "10.0.0.1"}))
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	limiter, _ := NewLimiter(NewMemoryStore(), []Rule{{Route: "*", Key: KeyClient, Limit: Limit{Requests: 1, Window: time.Minute}}})
+	interceptor := UnaryServerInterceptor(limiter)
+	info := &grpc.UnaryServerInfo{FullMethod: "/auth.AuthService/ValidateToken"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+
+	addr := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5000}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-client-id", "chat"))
+
+	resp, err := interceptor(ctx, nil, info, handler)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", resp)
+
+	_, err = interceptor(ctx, nil, info, handler)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// Непроверенный client id не даёт нового лимита: вызов считается по IP
+	other := metadata.NewIncomingContext(ctx, metadata.Pairs("x-client-id", "billing"))
+	_, err = interceptor(other, nil, info, handler)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	// Клиент с проверенным сертификатом считается отдельно
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}}
+	verified := peer.NewContext(context.Background(), &peer.Peer{
+		Addr:     addr,
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}},
+	})
+	_, err = interceptor(verified, nil, info, handler)
+	assert.NoError(t, err)
+}
@@ -3,5 +3,22 @@ package repository
 import "errors"
 
 var (
-	ErrUserNotFound = errors.New("user not found")
+	ErrUserNotFound           = errors.New("user not found")
+	ErrRefreshTokenNotFound   = errors.New("refresh token not found")
+	ErrRefreshTokenRotated    = errors.New("refresh token already rotated or revoked")
+	ErrRoleNotFound           = errors.New("role not found")
+	ErrActionTokenInvalid     = errors.New("token is invalid, expired or already used")
+	ErrEmailTaken             = errors.New("email is already in use")
+	ErrMFANotFound            = errors.New("mfa is not enrolled")
+	ErrMFACodeReused          = errors.New("mfa code has already been used")
+	ErrRecoveryCodeInvalid    = errors.New("recovery code is invalid or already used")
+	ErrCredentialNotFound     = errors.New("webauthn credential not found")
+	ErrCredentialExists       = errors.New("webauthn credential is already registered")
+	ErrWebAuthnSessionInvalid = errors.New("webauthn session is invalid or expired")
+	ErrLoginCodeInvalid       = errors.New("login code is invalid, expired or already used")
+	ErrOAuthClientNotFound    = errors.New("oauth client not found")
+	ErrAuthCodeInvalid        = errors.New("authorization code is invalid, expired or already used")
+	ErrIdentityNotFound       = errors.New("identity not found")
+	ErrIdentityExists         = errors.New("identity is already linked")
+	ErrFederatedLoginInvalid  = errors.New("login state is invalid, expired or already used")
 )
@@ -3,12 +3,154 @@ package repository
 import (
 	"context"
 	"github.com/danilkompaniets/auth-service/pkg/model"
+	"time"
 )
 
 type AuthRepository interface {
 	CreateUser(ctx context.Context, user model.User) (int64, error)
-	DeleteRefreshToken(ctx context.Context, userID int64) error
-	SaveRefreshToken(ctx context.Context, userID int64, token string) error
-	GetRefreshToken(ctx context.Context, userID int64) (string, error)
+	CreateRefreshToken(ctx context.Context, token model.RefreshToken) (int64, error)
+	GetRefreshToken(ctx context.Context, token string) (*model.RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, parentID int64, next model.RefreshToken) (int64, error)
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+	RevokeUserRefreshTokens(ctx context.Context, userID int64) error
+	RevokeOtherRefreshTokens(ctx context.Context, userID int64, keepFamilyID string) error
 	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+	GetUserByID(ctx context.Context, userID int64) (*model.User, error)
+	MarkEmailVerified(ctx context.Context, userID int64) error
+	UpdatePassword(ctx context.Context, userID int64, passwordHash string) error
+	// UpdateEmail also marks the new address as verified and returns ErrEmailTaken
+	// when another account uses it.
+	UpdateEmail(ctx context.Context, userID int64, email string) error
+	// SetUserDisabled disables the account or enables it again. Disabled accounts keep
+	// their data but cannot log in.
+	SetUserDisabled(ctx context.Context, userID int64, disabled bool) error
+	// DeleteUser removes the account and, through cascading keys, everything tied to it.
+	DeleteUser(ctx context.Context, userID int64) error
+	RoleRepository
+	ActionTokenRepository
+	MFARepository
+	WebAuthnRepository
+	LoginCodeRepository
+	PasswordHistoryRepository
+	OAuthRepository
+	IdentityRepository
+}
+
+type IdentityRepository interface {
+	// CreateIdentity returns ErrIdentityExists when the provider account is linked to
+	// any user or the user already has an account at the provider.
+	CreateIdentity(ctx context.Context, identity model.Identity) (int64, error)
+	// CreateUserWithIdentity signs a user up through a provider in one transaction and
+	// returns ErrEmailTaken when another account uses the email.
+	CreateUserWithIdentity(ctx context.Context, user model.User, identity model.Identity) (int64, error)
+	GetIdentity(ctx context.Context, provider, subject string) (*model.Identity, error)
+	ListIdentities(ctx context.Context, userID int64) ([]model.Identity, error)
+	// RecordIdentityLogin stores the email the provider reported and the login time.
+	RecordIdentityLogin(ctx context.Context, id int64, email string) error
+	DeleteIdentity(ctx context.Context, userID, id int64) error
+	// CreateFederatedLogin stores the state hashed and drops expired logins.
+	CreateFederatedLogin(ctx context.Context, login model.FederatedLogin) error
+	// ConsumeFederatedLogin deletes the login and returns it, or ErrFederatedLoginInvalid
+	// when it is unknown or expired.
+	ConsumeFederatedLogin(ctx context.Context, state string) (*model.FederatedLogin, error)
+}
+
+type OAuthRepository interface {
+	CreateOAuthClient(ctx context.Context, client model.OAuthClient) error
+	GetOAuthClient(ctx context.Context, clientID string) (*model.OAuthClient, error)
+	ListOAuthClients(ctx context.Context) ([]model.OAuthClient, error)
+	// DeleteOAuthClient also ends every session opened through the client.
+	DeleteOAuthClient(ctx context.Context, clientID string) error
+	// CreateAuthorizationCode stores the code hashed and drops expired codes.
+	CreateAuthorizationCode(ctx context.Context, code model.AuthorizationCode) error
+	// ConsumeAuthorizationCode marks the code used and returns it, or ErrAuthCodeInvalid
+	// when it is unknown, expired or already used.
+	ConsumeAuthorizationCode(ctx context.Context, code string) (*model.AuthorizationCode, error)
+}
+
+type PasswordHistoryRepository interface {
+	// AddPasswordHistory records a new password hash and drops all but the user's
+	// keep most recent entries.
+	AddPasswordHistory(ctx context.Context, userID int64, passwordHash string, keep int) error
+	// ListPasswordHistory returns up to limit hashes, newest first.
+	ListPasswordHistory(ctx context.Context, userID int64, limit int) ([]string, error)
+}
+
+type LoginCodeRepository interface {
+	// CreateLoginCode stores the code hashed and retires the user's earlier codes, so
+	// only the latest email works.
+	CreateLoginCode(ctx context.Context, code model.LoginCode) error
+	CountLoginCodesSince(ctx context.Context, userID int64, since time.Time) (int, error)
+	// ConsumeLoginLink uses up the code whose magic link carries jti.
+	ConsumeLoginLink(ctx context.Context, jti string) (*model.LoginCode, error)
+	// ConsumeLoginCode uses up the user's active code if it matches and has seen fewer
+	// than maxAttempts wrong guesses. A mismatch counts as a wrong guess and returns
+	// ErrLoginCodeInvalid.
+	ConsumeLoginCode(ctx context.Context, userID int64, code string, maxAttempts int) (*model.LoginCode, error)
+}
+
+type WebAuthnRepository interface {
+	ListWebAuthnCredentials(ctx context.Context, userID int64) ([]model.WebAuthnCredential, error)
+	GetWebAuthnCredential(ctx context.Context, credentialID []byte) (*model.WebAuthnCredential, error)
+	// CreateWebAuthnCredential returns ErrCredentialExists when the credential id is
+	// already registered to any account.
+	CreateWebAuthnCredential(ctx context.Context, credential model.WebAuthnCredential) (int64, error)
+	UpdateWebAuthnCredentialUsage(ctx context.Context, credentialID []byte, signCount uint32, flags uint8) error
+	DeleteWebAuthnCredential(ctx context.Context, userID, id int64) error
+	CreateWebAuthnSession(ctx context.Context, session model.WebAuthnSession) error
+	// ConsumeWebAuthnSession deletes the session and returns it, or ErrWebAuthnSessionInvalid
+	// when it is unknown, expired or was started for another purpose.
+	ConsumeWebAuthnSession(ctx context.Context, id, purpose string) (*model.WebAuthnSession, error)
+}
+
+type MFARepository interface {
+	GetMFA(ctx context.Context, userID int64) (*model.MFA, error)
+	// SaveMFA stores a new, unconfirmed enrolment, replacing any previous one.
+	SaveMFA(ctx context.Context, mfa model.MFA) error
+	ConfirmMFA(ctx context.Context, userID int64) error
+	// UseMFAStep records an accepted TOTP step and returns ErrMFACodeReused unless it
+	// is later than every step accepted before.
+	UseMFAStep(ctx context.Context, userID int64, step int64) error
+	// DeleteMFA removes the enrolment together with its recovery codes.
+	DeleteMFA(ctx context.Context, userID int64) error
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, codes []string) error
+	UseRecoveryCode(ctx context.Context, userID int64, code string) error
+}
+
+type ActionTokenRepository interface {
+	CreateActionToken(ctx context.Context, token model.ActionToken) error
+	// ConsumeActionToken marks the token used and returns it, or ErrActionTokenInvalid
+	// when it is unknown, expired, already used or issued for another purpose.
+	ConsumeActionToken(ctx context.Context, jti, purpose string) (*model.ActionToken, error)
+	// GetActionToken is ConsumeActionToken without using the token up.
+	GetActionToken(ctx context.Context, jti, purpose string) (*model.ActionToken, error)
+	// InvalidateActionTokens uses up every outstanding token of the user issued for purpose.
+	InvalidateActionTokens(ctx context.Context, userID int64, purpose string) error
+}
+
+type RoleRepository interface {
+	GetUserRoles(ctx context.Context, userID int64) ([]string, error)
+	GetUserPermissions(ctx context.Context, userID int64) ([]string, error)
+	AssignRole(ctx context.Context, userID int64, role string) error
+	RevokeRole(ctx context.Context, userID int64, role string) error
+	ListRoles(ctx context.Context) ([]model.Role, error)
+	SaveRole(ctx context.Context, role model.Role) (int64, error)
+}
+
+type TokenRevocationRepository interface {
+	RevokeToken(ctx context.Context, jti string, userID int64, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	RevokeUserTokensBefore(ctx context.Context, userID int64, before time.Time) error
+	GetUserTokensRevokedBefore(ctx context.Context, userID int64) (time.Time, error)
+	DeleteExpiredRevocations(ctx context.Context, expiredBefore time.Time, issuedCutoffBefore time.Time) (int64, error)
+}
+
+type LoginAttemptRepository interface {
+	// RecordLoginFailure counts a failed login for key at the given time and returns
+	// the number of failures. Failures older than resetBefore are forgotten first.
+	RecordLoginFailure(ctx context.Context, key string, at time.Time, resetBefore time.Time) (int, error)
+	// GetLoginFailures returns zero failures when key has none recorded.
+	GetLoginFailures(ctx context.Context, key string) (int, time.Time, error)
+	ResetLoginFailures(ctx context.Context, key string) error
+	DeleteLoginFailuresBefore(ctx context.Context, before time.Time) (int64, error)
 }
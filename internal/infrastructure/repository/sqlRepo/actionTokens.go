@@ -0,0 +1,68 @@
+package sqlRepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+)
+
+func (r *Repository) CreateActionToken(ctx context.Context, token model.ActionToken) error {
+	query := `
+		INSERT INTO action_tokens (jti, user_id, purpose, payload, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	_, err := r.db.ExecContext(ctx, query, token.Jti, token.UserId, token.Purpose, token.Payload, token.ExpiresAt)
+	return err
+}
+
+// ConsumeActionToken claims the token in a single statement so two concurrent
+// requests cannot both use it.
+func (r *Repository) ConsumeActionToken(ctx context.Context, jti, purpose string) (*model.ActionToken, error) {
+	query := `
+		UPDATE action_tokens SET used_at = NOW()
+		WHERE jti = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id, payload, expires_at, used_at
+	`
+
+	token := model.ActionToken{Jti: jti, Purpose: purpose}
+	err := r.db.QueryRowContext(ctx, query, jti, purpose).Scan(&token.UserId, &token.Payload, &token.ExpiresAt, &token.UsedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrActionTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (r *Repository) GetActionToken(ctx context.Context, jti, purpose string) (*model.ActionToken, error) {
+	query := `
+		SELECT user_id, payload, expires_at
+		FROM action_tokens
+		WHERE jti = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+	`
+
+	token := model.ActionToken{Jti: jti, Purpose: purpose}
+	err := r.db.QueryRowContext(ctx, query, jti, purpose).Scan(&token.UserId, &token.Payload, &token.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrActionTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (r *Repository) InvalidateActionTokens(ctx context.Context, userID int64, purpose string) error {
+	query := `
+		UPDATE action_tokens SET used_at = NOW()
+		WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL
+	`
+	_, err := r.db.ExecContext(ctx, query, userID, purpose)
+	return err
+}
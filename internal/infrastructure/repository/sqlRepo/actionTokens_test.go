@@ -0,0 +1,106 @@
+package sqlRepo
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateActionToken(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	expiresAt := time.Now().Add(time.Hour)
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO action_tokens (jti, user_id, purpose, payload, expires_at)`)).
+		WithArgs("jti-1", int64(1), "email_verification", "", expiresAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.CreateActionToken(context.Background(), model.ActionToken{
+		Jti:       "jti-1",
+		UserId:    1,
+		Purpose:   "email_verification",
+		ExpiresAt: expiresAt,
+	})
+	assert.NoError(t, err)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestConsumeActionToken(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	query := regexp.QuoteMeta(`UPDATE action_tokens SET used_at = NOW()`)
+	now := time.Now()
+
+	mock.ExpectQuery(query).
+		WithArgs("jti-1", "email_verification").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "payload", "expires_at", "used_at"}).AddRow(1, "", now.Add(time.Hour), now))
+
+	token, err := repo.ConsumeActionToken(context.Background(), "jti-1", "email_verification")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), token.UserId)
+
+	// Повторное использование
+	mock.ExpectQuery(query).
+		WithArgs("jti-1", "email_verification").
+		WillReturnError(sql.ErrNoRows)
+
+	token, err = repo.ConsumeActionToken(context.Background(), "jti-1", "email_verification")
+	assert.Nil(t, token)
+	assert.ErrorIs(t, err, repository.ErrActionTokenInvalid)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestGetActionToken(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	query := regexp.QuoteMeta(`SELECT user_id, payload, expires_at`)
+	expiresAt := time.Now().Add(time.Hour)
+
+	mock.ExpectQuery(query).
+		WithArgs("jti-1", "password_reset").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "payload", "expires_at"}).AddRow(1, "", expiresAt))
+
+	token, err := repo.GetActionToken(context.Background(), "jti-1", "password_reset")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), token.UserId)
+
+	// Использованный или просроченный токен
+	mock.ExpectQuery(query).
+		WithArgs("jti-2", "password_reset").
+		WillReturnError(sql.ErrNoRows)
+
+	token, err = repo.GetActionToken(context.Background(), "jti-2", "password_reset")
+	assert.Nil(t, token)
+	assert.ErrorIs(t, err, repository.ErrActionTokenInvalid)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestInvalidateActionTokens(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE action_tokens SET used_at = NOW()`)).
+		WithArgs(int64(1), "password_reset").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	err := repo.InvalidateActionTokens(context.Background(), 1, "password_reset")
+	assert.NoError(t, err)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
@@ -0,0 +1,176 @@
+package sqlRepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/lib/pq"
+)
+
+const identityColumns = `id, user_id, provider, subject, email, created_at, last_login_at`
+
+func (r *Repository) CreateIdentity(ctx context.Context, identity model.Identity) (int64, error) {
+	return r.createIdentity(ctx, r.db, identity)
+}
+
+func (r *Repository) createIdentity(ctx context.Context, db queryRower, identity model.Identity) (int64, error) {
+	query := `
+		INSERT INTO identities (user_id, provider, subject, email, created_at, last_login_at)
+		VALUES ($1, $2, $3, $4, NOW(), NOW())
+		RETURNING id
+	`
+
+	var id int64
+	err := db.QueryRowContext(ctx, query, identity.UserId, identity.Provider, identity.Subject, identity.Email).Scan(&id)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return 0, repository.ErrIdentityExists
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (r *Repository) CreateUserWithIdentity(ctx context.Context, user model.User, identity model.Identity) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO users (email, password, email_verified_at, created_at, updated_at)
+		VALUES ($1, $2, $3, NOW(), NOW())
+		RETURNING id
+	`
+	var userID int64
+	err = tx.QueryRowContext(ctx, query, user.Email, user.Password, user.EmailVerifiedAt).Scan(&userID)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return 0, repository.ErrEmailTaken
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	identity.UserId = userID
+	if _, err := r.createIdentity(ctx, tx, identity); err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+func (r *Repository) GetIdentity(ctx context.Context, provider, subject string) (*model.Identity, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+identityColumns+` FROM identities WHERE provider = $1 AND subject = $2`,
+		provider, subject)
+
+	identity, err := scanIdentity(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrIdentityNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return identity, nil
+}
+
+func (r *Repository) ListIdentities(ctx context.Context, userID int64) ([]model.Identity, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+identityColumns+` FROM identities WHERE user_id = $1 ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []model.Identity{}
+	for rows.Next() {
+		identity, err := scanIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, *identity)
+	}
+
+	return identities, rows.Err()
+}
+
+func (r *Repository) RecordIdentityLogin(ctx context.Context, id int64, email string) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE identities SET email = $2, last_login_at = NOW() WHERE id = $1`, id, email)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res, repository.ErrIdentityNotFound)
+}
+
+func (r *Repository) DeleteIdentity(ctx context.Context, userID, id int64) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM identities WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res, repository.ErrIdentityNotFound)
+}
+
+func (r *Repository) CreateFederatedLogin(ctx context.Context, login model.FederatedLogin) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM federated_logins WHERE expires_at < NOW()`); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO federated_logins (state_hash, provider, code_verifier, nonce, user_id, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	userID := sql.NullInt64{Int64: login.UserId, Valid: login.UserId != 0}
+	_, err = tx.ExecContext(ctx, query, r.hasher.Hash(login.State), login.Provider, login.CodeVerifier, login.Nonce,
+		userID, login.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ConsumeFederatedLogin deletes the login in the same statement that reads it, so a
+// state can only be redeemed once.
+func (r *Repository) ConsumeFederatedLogin(ctx context.Context, state string) (*model.FederatedLogin, error) {
+	query := `
+		DELETE FROM federated_logins
+		WHERE state_hash = $1 AND expires_at > NOW()
+		RETURNING provider, code_verifier, nonce, user_id, expires_at
+	`
+
+	login := model.FederatedLogin{State: state}
+	var userID sql.NullInt64
+	err := r.db.QueryRowContext(ctx, query, r.hasher.Hash(state)).Scan(&login.Provider, &login.CodeVerifier, &login.Nonce,
+		&userID, &login.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrFederatedLoginInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	login.UserId = userID.Int64
+
+	return &login, nil
+}
+
+func scanIdentity(row rowScanner) (*model.Identity, error) {
+	var identity model.Identity
+	err := row.Scan(&identity.Id, &identity.UserId, &identity.Provider, &identity.Subject, &identity.Email,
+		&identity.CreatedAt, &identity.LastLoginAt)
+	if err != nil {
+		return nil, err
+	}
+	return &identity, nil
+}
@@ -0,0 +1,183 @@
+package sqlRepo
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ repository.IdentityRepository = (*Repository)(nil)
+
+var identityRows = []string{"id", "user_id", "provider", "subject", "email", "created_at", "last_login_at"}
+
+func TestGetIdentity(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	query := regexp.QuoteMeta(`FROM identities WHERE provider = $1 AND subject = $2`)
+	now := time.Now()
+
+	mock.ExpectQuery(query).
+		WithArgs("google", "upstream-1").
+		WillReturnRows(sqlmock.NewRows(identityRows).AddRow(3, 1, "google", "upstream-1", "test@test.com", now, now))
+
+	identity, err := repo.GetIdentity(context.Background(), "google", "upstream-1")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), identity.UserId)
+	assert.Equal(t, "test@test.com", identity.Email)
+
+	// Неизвестная учётная запись провайдера
+	mock.ExpectQuery(query).
+		WithArgs("google", "upstream-2").
+		WillReturnError(sql.ErrNoRows)
+
+	identity, err = repo.GetIdentity(context.Background(), "google", "upstream-2")
+	assert.Nil(t, identity)
+	assert.ErrorIs(t, err, repository.ErrIdentityNotFound)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestCreateIdentity(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	query := regexp.QuoteMeta(`INSERT INTO identities`)
+	identity := model.Identity{UserId: 1, Provider: "google", Subject: "upstream-1", Email: "test@test.com"}
+
+	mock.ExpectQuery(query).
+		WithArgs(int64(1), "google", "upstream-1", "test@test.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+
+	id, err := repo.CreateIdentity(context.Background(), identity)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), id)
+
+	// Учётная запись уже привязана
+	mock.ExpectQuery(query).
+		WillReturnError(&pq.Error{Code: uniqueViolation})
+
+	_, err = repo.CreateIdentity(context.Background(), identity)
+	assert.ErrorIs(t, err, repository.ErrIdentityExists)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestCreateUserWithIdentity(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	verifiedAt := time.Now()
+	user := model.User{Email: "test@test.com", EmailVerifiedAt: &verifiedAt}
+	identity := model.Identity{Provider: "google", Subject: "upstream-1", Email: "test@test.com"}
+
+	// Пользователь и привязка создаются в одной транзакции
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO users`)).
+		WithArgs("test@test.com", "", &verifiedAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO identities`)).
+		WithArgs(int64(7), "google", "upstream-1", "test@test.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectCommit()
+
+	id, err := repo.CreateUserWithIdentity(context.Background(), user, identity)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), id)
+
+	// Email уже занят — транзакция откатывается
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO users`)).
+		WillReturnError(&pq.Error{Code: uniqueViolation})
+	mock.ExpectRollback()
+
+	_, err = repo.CreateUserWithIdentity(context.Background(), user, identity)
+	assert.ErrorIs(t, err, repository.ErrEmailTaken)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestDeleteIdentity(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	query := regexp.QuoteMeta(`DELETE FROM identities WHERE id = $1 AND user_id = $2`)
+
+	mock.ExpectExec(query).
+		WithArgs(int64(3), int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, repo.DeleteIdentity(context.Background(), 1, 3))
+
+	// Чужая привязка не удаляется
+	mock.ExpectExec(query).
+		WithArgs(int64(3), int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.ErrorIs(t, repo.DeleteIdentity(context.Background(), 2, 3), repository.ErrIdentityNotFound)
+
+	err := mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestCreateFederatedLogin(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	expires := time.Now().Add(10 * time.Minute)
+	login := model.FederatedLogin{State: "state-1", Provider: "google", CodeVerifier: "verifier", Nonce: "nonce", ExpiresAt: expires}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM federated_logins WHERE expires_at < NOW()`)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	// В базе хранится только хеш state, вход без пользователя пишет NULL
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO federated_logins`)).
+		WithArgs(testHasher.Hash("state-1"), "google", "verifier", "nonce", sql.NullInt64{}, expires).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, repo.CreateFederatedLogin(context.Background(), login))
+
+	err := mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestConsumeFederatedLogin(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	query := regexp.QuoteMeta(`DELETE FROM federated_logins`)
+	expires := time.Now().Add(time.Minute)
+
+	// Привязка к существующему пользователю
+	mock.ExpectQuery(query).
+		WithArgs(testHasher.Hash("state-1")).
+		WillReturnRows(sqlmock.NewRows([]string{"provider", "code_verifier", "nonce", "user_id", "expires_at"}).
+			AddRow("google", "verifier", "nonce", 1, expires))
+
+	login, err := repo.ConsumeFederatedLogin(context.Background(), "state-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "google", login.Provider)
+	assert.Equal(t, "verifier", login.CodeVerifier)
+	assert.Equal(t, int64(1), login.UserId)
+
+	// Повторное использование
+	mock.ExpectQuery(query).
+		WithArgs(testHasher.Hash("state-1")).
+		WillReturnError(sql.ErrNoRows)
+
+	_, err = repo.ConsumeFederatedLogin(context.Background(), "state-1")
+	assert.ErrorIs(t, err, repository.ErrFederatedLoginInvalid)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
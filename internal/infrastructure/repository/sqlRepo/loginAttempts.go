@@ -0,0 +1,52 @@
+package sqlRepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// RecordLoginFailure increments the counter in one statement so concurrent failures
+// on different replicas are all counted.
+func (r *Repository) RecordLoginFailure(ctx context.Context, key string, at time.Time, resetBefore time.Time) (int, error) {
+	query := `
+		INSERT INTO login_attempts (key, failures, last_failure_at)
+		VALUES ($1, 1, $2)
+		ON CONFLICT (key) DO UPDATE
+		SET failures = CASE WHEN login_attempts.last_failure_at < $3 THEN 1 ELSE login_attempts.failures + 1 END,
+			last_failure_at = EXCLUDED.last_failure_at
+		RETURNING failures
+	`
+
+	var failures int
+	err := r.db.QueryRowContext(ctx, query, key, at, resetBefore).Scan(&failures)
+	return failures, err
+}
+
+func (r *Repository) GetLoginFailures(ctx context.Context, key string) (int, time.Time, error) {
+	query := `SELECT failures, last_failure_at FROM login_attempts WHERE key = $1`
+
+	var (
+		failures int
+		last     time.Time
+	)
+	err := r.db.QueryRowContext(ctx, query, key).Scan(&failures, &last)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, time.Time{}, nil
+	}
+	return failures, last, err
+}
+
+func (r *Repository) ResetLoginFailures(ctx context.Context, key string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM login_attempts WHERE key = $1`, key)
+	return err
+}
+
+func (r *Repository) DeleteLoginFailuresBefore(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM login_attempts WHERE last_failure_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,51 @@
+package sqlRepo
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ repository.LoginAttemptRepository = (*Repository)(nil)
+
+func TestRecordLoginFailure(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	now := time.Now()
+	resetBefore := now.Add(-time.Hour)
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO login_attempts (key, failures, last_failure_at)`)).
+		WithArgs("account:test@test.com", now, resetBefore).
+		WillReturnRows(sqlmock.NewRows([]string{"failures"}).AddRow(3))
+
+	failures, err := repo.RecordLoginFailure(context.Background(), "account:test@test.com", now, resetBefore)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, failures)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestGetLoginFailures_None(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	// Неудачных попыток не было
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT failures, last_failure_at FROM login_attempts WHERE key = $1`)).
+		WithArgs("ip:10.0.0.1").
+		WillReturnError(sql.ErrNoRows)
+
+	failures, last, err := repo.GetLoginFailures(context.Background(), "ip:10.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, failures)
+	assert.True(t, last.IsZero())
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
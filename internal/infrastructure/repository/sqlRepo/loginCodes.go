@@ -0,0 +1,87 @@
+package sqlRepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+)
+
+func (r *Repository) CreateLoginCode(ctx context.Context, code model.LoginCode) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE login_codes SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`, code.UserId)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO login_codes (user_id, jti, code_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`
+	if _, err := tx.ExecContext(ctx, query, code.UserId, code.Jti, r.hasher.Hash(code.Code), code.ExpiresAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *Repository) CountLoginCodesSince(ctx context.Context, userID int64, since time.Time) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM login_codes WHERE user_id = $1 AND created_at > $2`,
+		userID, since).Scan(&count)
+	return count, err
+}
+
+func (r *Repository) ConsumeLoginLink(ctx context.Context, jti string) (*model.LoginCode, error) {
+	query := `
+		UPDATE login_codes SET used_at = NOW()
+		WHERE jti = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING id, user_id, jti, attempts, expires_at, used_at, created_at
+	`
+	return scanLoginCode(r.db.QueryRowContext(ctx, query, jti))
+}
+
+// ConsumeLoginCode claims the code in a single statement so two concurrent requests
+// cannot both use it. Only if that fails is the guess counted.
+func (r *Repository) ConsumeLoginCode(ctx context.Context, userID int64, code string, maxAttempts int) (*model.LoginCode, error) {
+	query := `
+		UPDATE login_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL AND expires_at > NOW() AND attempts < $3
+		RETURNING id, user_id, jti, attempts, expires_at, used_at, created_at
+	`
+	consumed, err := scanLoginCode(r.db.QueryRowContext(ctx, query, userID, r.hasher.Hash(code), maxAttempts))
+	if !errors.Is(err, repository.ErrLoginCodeInvalid) {
+		return consumed, err
+	}
+
+	_, err = r.db.ExecContext(ctx, `
+		UPDATE login_codes SET attempts = attempts + 1
+		WHERE user_id = $1 AND used_at IS NULL AND expires_at > NOW()
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, repository.ErrLoginCodeInvalid
+}
+
+func scanLoginCode(row *sql.Row) (*model.LoginCode, error) {
+	var code model.LoginCode
+	err := row.Scan(&code.Id, &code.UserId, &code.Jti, &code.Attempts, &code.ExpiresAt, &code.UsedAt, &code.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrLoginCodeInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &code, nil
+}
@@ -0,0 +1,87 @@
+package sqlRepo
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ repository.LoginCodeRepository = (*Repository)(nil)
+
+func TestCreateLoginCode_RetiresEarlierCodes(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	expires := time.Now().Add(10 * time.Minute)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE login_codes SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`)).
+		WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// В базе хранится только хеш кода
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO login_codes (user_id, jti, code_hash, expires_at)`)).
+		WithArgs(int64(1), "jti-1", testHasher.Hash("123456"), expires).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err := repo.CreateLoginCode(context.Background(), model.LoginCode{UserId: 1, Jti: "jti-1", Code: "123456", ExpiresAt: expires})
+	assert.NoError(t, err)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestConsumeLoginCode(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	consume := regexp.QuoteMeta(`UPDATE login_codes SET used_at = NOW()`)
+	now := time.Now()
+
+	mock.ExpectQuery(consume).
+		WithArgs(int64(1), testHasher.Hash("123456"), 5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "jti", "attempts", "expires_at", "used_at", "created_at"}).
+			AddRow(1, 1, "jti-1", 0, now.Add(time.Minute), now, now))
+
+	code, err := repo.ConsumeLoginCode(context.Background(), 1, "123456", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "jti-1", code.Jti)
+
+	// Неверный код считается попыткой
+	mock.ExpectQuery(consume).
+		WithArgs(int64(1), testHasher.Hash("000000"), 5).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE login_codes SET attempts = attempts + 1`)).
+		WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	code, err = repo.ConsumeLoginCode(context.Background(), 1, "000000", 5)
+	assert.Nil(t, code)
+	assert.ErrorIs(t, err, repository.ErrLoginCodeInvalid)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestConsumeLoginLink_Used(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`WHERE jti = $1 AND used_at IS NULL AND expires_at > NOW()`)).
+		WithArgs("jti-1").
+		WillReturnError(sql.ErrNoRows)
+
+	code, err := repo.ConsumeLoginLink(context.Background(), "jti-1")
+	assert.Nil(t, code)
+	assert.ErrorIs(t, err, repository.ErrLoginCodeInvalid)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
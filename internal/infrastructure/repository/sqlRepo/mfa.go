@@ -0,0 +1,109 @@
+package sqlRepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+)
+
+func (r *Repository) GetMFA(ctx context.Context, userID int64) (*model.MFA, error) {
+	query := `
+		SELECT user_id, secret_encrypted, last_used_step, confirmed_at, created_at
+		FROM user_mfa WHERE user_id = $1
+	`
+
+	var mfa model.MFA
+	err := r.db.QueryRowContext(ctx, query, userID).
+		Scan(&mfa.UserId, &mfa.SecretEncrypted, &mfa.LastUsedStep, &mfa.ConfirmedAt, &mfa.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrMFANotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &mfa, nil
+}
+
+func (r *Repository) SaveMFA(ctx context.Context, mfa model.MFA) error {
+	query := `
+		INSERT INTO user_mfa (user_id, secret_encrypted, last_used_step, confirmed_at, created_at)
+		VALUES ($1, $2, 0, NULL, NOW())
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret_encrypted = EXCLUDED.secret_encrypted, last_used_step = 0, confirmed_at = NULL, created_at = NOW()
+	`
+	_, err := r.db.ExecContext(ctx, query, mfa.UserId, mfa.SecretEncrypted)
+	return err
+}
+
+func (r *Repository) ConfirmMFA(ctx context.Context, userID int64) error {
+	res, err := r.db.ExecContext(ctx, `UPDATE user_mfa SET confirmed_at = NOW() WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res, repository.ErrMFANotFound)
+}
+
+func (r *Repository) UseMFAStep(ctx context.Context, userID int64, step int64) error {
+	query := `UPDATE user_mfa SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2`
+
+	res, err := r.db.ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res, repository.ErrMFACodeReused)
+}
+
+func (r *Repository) DeleteMFA(ctx context.Context, userID int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReplaceRecoveryCodes stores only HMAC hashes of the codes, like refresh tokens.
+func (r *Repository) ReplaceRecoveryCodes(ctx context.Context, userID int64, codes []string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	for _, code := range codes {
+		_, err := tx.ExecContext(ctx, `INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`,
+			userID, r.hasher.Hash(code))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *Repository) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	query := `
+		UPDATE mfa_recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+	res, err := r.db.ExecContext(ctx, query, userID, r.hasher.Hash(code))
+	if err != nil {
+		return err
+	}
+	return expectAffected(res, repository.ErrRecoveryCodeInvalid)
+}
@@ -0,0 +1,96 @@
+package sqlRepo
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ repository.MFARepository = (*Repository)(nil)
+
+func TestGetMFA(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	query := regexp.QuoteMeta(`SELECT user_id, secret_encrypted, last_used_step, confirmed_at, created_at`)
+	now := time.Now()
+
+	mock.ExpectQuery(query).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "secret_encrypted", "last_used_step", "confirmed_at", "created_at"}).
+			AddRow(1, "sealed", 42, now, now))
+
+	mfa, err := repo.GetMFA(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "sealed", mfa.SecretEncrypted)
+	assert.NotNil(t, mfa.ConfirmedAt)
+
+	// MFA не подключена
+	mock.ExpectQuery(query).
+		WithArgs(int64(2)).
+		WillReturnError(sql.ErrNoRows)
+
+	mfa, err = repo.GetMFA(context.Background(), 2)
+	assert.Nil(t, mfa)
+	assert.ErrorIs(t, err, repository.ErrMFANotFound)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestUseMFAStep_RejectsReplay(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	query := regexp.QuoteMeta(`UPDATE user_mfa SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2`)
+	mock.ExpectExec(query).
+		WithArgs(int64(1), int64(100)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(query).
+		WithArgs(int64(1), int64(100)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(t, repo.UseMFAStep(context.Background(), 1, 100))
+	assert.ErrorIs(t, repo.UseMFAStep(context.Background(), 1, 100), repository.ErrMFACodeReused)
+
+	err := mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`)).
+		WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`)).
+		WithArgs(int64(1), testHasher.Hash("code-1")).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	err := repo.ReplaceRecoveryCodes(context.Background(), 1, []string{"code-1"})
+	assert.NoError(t, err)
+
+	// Код хранится только в виде хэша и используется один раз
+	query := regexp.QuoteMeta(`UPDATE mfa_recovery_codes SET used_at = NOW()`)
+	mock.ExpectExec(query).
+		WithArgs(int64(1), testHasher.Hash("code-1")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(query).
+		WithArgs(int64(1), testHasher.Hash("code-1")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(t, repo.UseRecoveryCode(context.Background(), 1, "code-1"))
+	assert.ErrorIs(t, repo.UseRecoveryCode(context.Background(), 1, "code-1"), repository.ErrRecoveryCodeInvalid)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
@@ -0,0 +1,117 @@
+package sqlRepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/lib/pq"
+)
+
+const oauthClientColumns = `id, name, COALESCE(secret_hash, ''), redirect_uris, scopes, grant_types, created_at`
+
+func (r *Repository) CreateOAuthClient(ctx context.Context, client model.OAuthClient) error {
+	query := `
+		INSERT INTO oauth_clients (id, name, secret_hash, redirect_uris, scopes, grant_types, created_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7)
+	`
+	_, err := r.db.ExecContext(ctx, query, client.Id, client.Name, client.SecretHash,
+		pq.Array(client.RedirectURIs), pq.Array(client.Scopes), pq.Array(client.GrantTypes), client.CreatedAt)
+	return err
+}
+
+func (r *Repository) GetOAuthClient(ctx context.Context, clientID string) (*model.OAuthClient, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+oauthClientColumns+` FROM oauth_clients WHERE id = $1`, clientID)
+
+	var client model.OAuthClient
+	err := row.Scan(&client.Id, &client.Name, &client.SecretHash, pq.Array(&client.RedirectURIs), pq.Array(&client.Scopes),
+		pq.Array(&client.GrantTypes), &client.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrOAuthClientNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &client, nil
+}
+
+func (r *Repository) ListOAuthClients(ctx context.Context) ([]model.OAuthClient, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+oauthClientColumns+` FROM oauth_clients ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []model.OAuthClient{}
+	for rows.Next() {
+		var client model.OAuthClient
+		if err := rows.Scan(&client.Id, &client.Name, &client.SecretHash, pq.Array(&client.RedirectURIs), pq.Array(&client.Scopes),
+			pq.Array(&client.GrantTypes), &client.CreatedAt); err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+
+	return clients, rows.Err()
+}
+
+// DeleteOAuthClient relies on cascading keys to remove the client's codes and sessions.
+func (r *Repository) DeleteOAuthClient(ctx context.Context, clientID string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM oauth_clients WHERE id = $1`, clientID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res, repository.ErrOAuthClientNotFound)
+}
+
+func (r *Repository) CreateAuthorizationCode(ctx context.Context, code model.AuthorizationCode) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM oauth_authorization_codes WHERE expires_at < NOW()`); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scope,
+		                                       code_challenge, code_challenge_method, nonce, auth_time, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+	_, err = tx.ExecContext(ctx, query, r.hasher.Hash(code.Code), code.ClientId, code.UserId, code.RedirectURI, code.Scope,
+		code.CodeChallenge, code.CodeChallengeMethod, code.Nonce, code.AuthTime, code.ExpiresAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ConsumeAuthorizationCode claims the code in a single statement so two concurrent
+// token requests cannot both redeem it.
+func (r *Repository) ConsumeAuthorizationCode(ctx context.Context, code string) (*model.AuthorizationCode, error) {
+	query := `
+		UPDATE oauth_authorization_codes SET used_at = NOW()
+		WHERE code_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING client_id, user_id, redirect_uri, scope, code_challenge, code_challenge_method, nonce, auth_time,
+		          expires_at, used_at
+	`
+
+	consumed := model.AuthorizationCode{Code: code}
+	err := r.db.QueryRowContext(ctx, query, r.hasher.Hash(code)).Scan(&consumed.ClientId, &consumed.UserId, &consumed.RedirectURI,
+		&consumed.Scope, &consumed.CodeChallenge, &consumed.CodeChallengeMethod, &consumed.Nonce, &consumed.AuthTime,
+		&consumed.ExpiresAt, &consumed.UsedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrAuthCodeInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &consumed, nil
+}
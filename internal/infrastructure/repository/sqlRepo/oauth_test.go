@@ -0,0 +1,138 @@
+package sqlRepo
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ repository.OAuthRepository = (*Repository)(nil)
+
+func TestCreateOAuthClient(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	now := time.Now()
+	client := model.OAuthClient{Id: "chat-web", Name: "Chat", RedirectURIs: []string{"https://chat.example.com/cb"},
+		GrantTypes: []string{"authorization_code", "refresh_token"}, CreatedAt: now}
+
+	// У публичного клиента секрета нет
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO oauth_clients (id, name, secret_hash, redirect_uris, scopes, grant_types, created_at)`)).
+		WithArgs("chat-web", "Chat", "", pq.Array(client.RedirectURIs), pq.Array([]string(nil)), pq.Array(client.GrantTypes), now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, repo.CreateOAuthClient(context.Background(), client))
+
+	err := mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestGetOAuthClient(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	query := regexp.QuoteMeta(`SELECT id, name, COALESCE(secret_hash, ''), redirect_uris, scopes, grant_types, created_at FROM oauth_clients WHERE id = $1`)
+	mock.ExpectQuery(query).
+		WithArgs("chat-web").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "secret_hash", "redirect_uris", "scopes", "grant_types", "created_at"}).
+			AddRow("chat-web", "Chat", "", "{https://chat.example.com/cb,http://127.0.0.1/cb}", "{openid}", "{authorization_code}", time.Now()))
+
+	client, err := repo.GetOAuthClient(context.Background(), "chat-web")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://chat.example.com/cb", "http://127.0.0.1/cb"}, client.RedirectURIs)
+	assert.Equal(t, []string{"openid"}, client.Scopes)
+	assert.Equal(t, []string{"authorization_code"}, client.GrantTypes)
+
+	// Ошибка: клиент не найден
+	mock.ExpectQuery(query).
+		WithArgs("unknown").
+		WillReturnError(sql.ErrNoRows)
+
+	_, err = repo.GetOAuthClient(context.Background(), "unknown")
+	assert.Equal(t, repository.ErrOAuthClientNotFound, err)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestDeleteOAuthClient(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	query := regexp.QuoteMeta(`DELETE FROM oauth_clients WHERE id = $1`)
+	mock.ExpectExec(query).
+		WithArgs("chat-web").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(query).
+		WithArgs("unknown").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(t, repo.DeleteOAuthClient(context.Background(), "chat-web"))
+	assert.ErrorIs(t, repo.DeleteOAuthClient(context.Background(), "unknown"), repository.ErrOAuthClientNotFound)
+
+	err := mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestCreateAuthorizationCode(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	authTime := time.Now()
+	expires := authTime.Add(time.Minute)
+	code := model.AuthorizationCode{Code: "code-1", ClientId: "chat-web", UserId: 1, RedirectURI: "https://chat.example.com/cb",
+		CodeChallenge: "challenge", CodeChallengeMethod: "S256", Nonce: "n-1", AuthTime: authTime, ExpiresAt: expires}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM oauth_authorization_codes WHERE expires_at < NOW()`)).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	// В базе хранится только хеш кода
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO oauth_authorization_codes`)).
+		WithArgs(testHasher.Hash("code-1"), "chat-web", int64(1), code.RedirectURI, "", "challenge", "S256", "n-1", authTime, expires).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, repo.CreateAuthorizationCode(context.Background(), code))
+
+	err := mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestConsumeAuthorizationCode(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	query := regexp.QuoteMeta(`UPDATE oauth_authorization_codes SET used_at = NOW()`)
+	now := time.Now()
+
+	mock.ExpectQuery(query).
+		WithArgs(testHasher.Hash("code-1")).
+		WillReturnRows(sqlmock.NewRows([]string{"client_id", "user_id", "redirect_uri", "scope", "code_challenge",
+			"code_challenge_method", "nonce", "auth_time", "expires_at", "used_at"}).
+			AddRow("chat-web", 1, "https://chat.example.com/cb", "openid", "challenge", "S256", "n-1", now, now.Add(time.Minute), now))
+
+	code, err := repo.ConsumeAuthorizationCode(context.Background(), "code-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "chat-web", code.ClientId)
+	assert.Equal(t, "challenge", code.CodeChallenge)
+	assert.Equal(t, "n-1", code.Nonce)
+
+	// Повторное использование кода
+	mock.ExpectQuery(query).
+		WithArgs(testHasher.Hash("code-1")).
+		WillReturnError(sql.ErrNoRows)
+
+	_, err = repo.ConsumeAuthorizationCode(context.Background(), "code-1")
+	assert.Equal(t, repository.ErrAuthCodeInvalid, err)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
@@ -0,0 +1,50 @@
+package sqlRepo
+
+import (
+	"context"
+)
+
+func (r *Repository) AddPasswordHistory(ctx context.Context, userID int64, passwordHash string, keep int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO password_history (user_id, password_hash) VALUES ($1, $2)`, userID, passwordHash)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		DELETE FROM password_history
+		WHERE user_id = $1 AND id NOT IN (
+			SELECT id FROM password_history WHERE user_id = $1 ORDER BY id DESC LIMIT $2
+		)
+	`
+	if _, err := tx.ExecContext(ctx, query, userID, keep); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *Repository) ListPasswordHistory(ctx context.Context, userID int64, limit int) ([]string, error) {
+	query := `SELECT password_hash FROM password_history WHERE user_id = $1 ORDER BY id DESC LIMIT $2`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, rows.Err()
+}
@@ -0,0 +1,47 @@
+package sqlRepo
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddPasswordHistory_TrimsOldEntries(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO password_history (user_id, password_hash) VALUES ($1, $2)`)).
+		WithArgs(int64(1), "hash").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	// Остаются только keep последних хешей
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM password_history`)).
+		WithArgs(int64(1), 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	err := repo.AddPasswordHistory(context.Background(), 1, "hash", 5)
+	assert.NoError(t, err)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestListPasswordHistory(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT password_hash FROM password_history WHERE user_id = $1 ORDER BY id DESC LIMIT $2`)).
+		WithArgs(int64(1), 3).
+		WillReturnRows(sqlmock.NewRows([]string{"password_hash"}).AddRow("new").AddRow("old"))
+
+	hashes, err := repo.ListPasswordHistory(context.Background(), 1, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"new", "old"}, hashes)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
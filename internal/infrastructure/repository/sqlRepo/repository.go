@@ -5,26 +5,34 @@ import (
 	"database/sql"
 	"errors"
 	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
 	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/lib/pq"
+	"time"
 )
 
+// uniqueViolation is the PostgreSQL error code for a UNIQUE constraint failure.
+const uniqueViolation = "23505"
+
 type Repository struct {
-	db *sql.DB
+	db     *sql.DB
+	hasher *security.TokenHasher
 }
 
-func NewAuthRepository(db *sql.DB) *Repository {
-	return &Repository{db: db}
+// NewAuthRepository stores bearer tokens only as hashes produced by hasher.
+func NewAuthRepository(db *sql.DB, hasher *security.TokenHasher) *Repository {
+	return &Repository{db: db, hasher: hasher}
 }
 
 func (r *Repository) CreateUser(ctx context.Context, user model.User) (int64, error) {
 	query := `
-		INSERT INTO users (email, password, created_at, updated_at)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO users (email, password, email_verified_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id
 	`
 
 	var id int64
-	err := r.db.QueryRowContext(ctx, query, user.Email, user.Password, user.CreatedAt, user.UpdatedAt).Scan(&id)
+	err := r.db.QueryRowContext(ctx, query, user.Email, user.Password, user.EmailVerifiedAt, user.CreatedAt, user.UpdatedAt).Scan(&id)
 	if err != nil {
 		return 0, err
 	}
@@ -32,40 +40,167 @@ func (r *Repository) CreateUser(ctx context.Context, user model.User) (int64, er
 	return id, nil
 }
 
-func (r *Repository) DeleteRefreshToken(ctx context.Context, userID int64) error {
-	query := `DELETE FROM refresh_tokens WHERE user_id = $1`
-	_, err := r.db.ExecContext(ctx, query, userID)
+func (r *Repository) CreateRefreshToken(ctx context.Context, token model.RefreshToken) (int64, error) {
+	return r.createRefreshToken(ctx, r.db, token)
+}
+
+func (r *Repository) GetRefreshToken(ctx context.Context, token string) (*model.RefreshToken, error) {
+	query := `
+		SELECT id, user_id, family_id, COALESCE(parent_id, 0), device_name, user_agent, ip,
+		       COALESCE(client_id, ''), scope, created_at, last_used_at, rotated_at, revoked_at
+		FROM refresh_tokens WHERE token_hash = $1
+	`
+
+	row := r.db.QueryRowContext(ctx, query, r.hasher.Hash(token))
+
+	rt := model.RefreshToken{Token: token}
+	err := row.Scan(&rt.Id, &rt.UserId, &rt.FamilyId, &rt.ParentId, &rt.DeviceName, &rt.UserAgent, &rt.IP,
+		&rt.ClientId, &rt.Scope, &rt.CreatedAt, &rt.LastUsedAt, &rt.RotatedAt, &rt.RevokedAt)
+
 	if errors.Is(err, sql.ErrNoRows) {
-		return repository.ErrUserNotFound
+		return nil, repository.ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &rt, nil
+}
+
+// RotateRefreshToken marks the parent as rotated and stores its successor in one
+// transaction. The parent is only claimed while it is still live, so of two
+// concurrent refreshes with the same token exactly one wins.
+func (r *Repository) RotateRefreshToken(ctx context.Context, parentID int64, next model.RefreshToken) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE refresh_tokens SET rotated_at = NOW(), last_used_at = NOW()
+		WHERE id = $1 AND rotated_at IS NULL AND revoked_at IS NULL
+	`
+	res, err := tx.ExecContext(ctx, query, parentID)
+	if err != nil {
+		return 0, err
+	}
+	if err := expectAffected(res, repository.ErrRefreshTokenRotated); err != nil {
+		return 0, err
 	}
+
+	next.ParentId = parentID
+	id, err := r.createRefreshToken(ctx, tx, next)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+func (r *Repository) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, familyID)
 	return err
 }
 
-func (r *Repository) GetRefreshToken(ctx context.Context, userID int64) (string, error) {
-	query := `SELECT token FROM refresh_tokens WHERE user_id = $1`
+func (r *Repository) RevokeUserRefreshTokens(ctx context.Context, userID int64) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	_, err := r.db.ExecContext(ctx, query, userID)
+	return err
+}
 
-	row := r.db.QueryRowContext(ctx, query, userID)
+// RevokeOtherRefreshTokens ends every session of the user except the keepFamilyID one.
+func (r *Repository) RevokeOtherRefreshTokens(ctx context.Context, userID int64, keepFamilyID string) error {
+	query := `
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE user_id = $1 AND family_id <> $2 AND revoked_at IS NULL
+	`
+	_, err := r.db.ExecContext(ctx, query, userID, keepFamilyID)
+	return err
+}
 
-	var refreshToken string
-	err := row.Scan(&refreshToken)
+// DeleteStaleRefreshTokens drops rotated and revoked tokens created before the given
+// time. Once a token's JWT has expired it fails verification before its row is read,
+// so the row is no longer needed to detect reuse.
+func (r *Repository) DeleteStaleRefreshTokens(ctx context.Context, createdBefore time.Time) (int64, error) {
+	query := `
+		DELETE FROM refresh_tokens
+		WHERE (rotated_at IS NOT NULL OR revoked_at IS NOT NULL) AND created_at < $1
+	`
+	res, err := r.db.ExecContext(ctx, query, createdBefore)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
 
-	if errors.Is(err, sql.ErrNoRows) {
-		return "", repository.ErrUserNotFound
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// HashLegacyRefreshTokens replaces raw tokens stored before hashing was introduced
+// with their hashes. It is idempotent and cheap once every row is converted.
+func (r *Repository) HashLegacyRefreshTokens(ctx context.Context) (int, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, token FROM refresh_tokens WHERE token_hash IS NULL AND token IS NOT NULL`)
+	if err != nil {
+		return 0, err
+	}
+
+	legacy := make(map[int64]string)
+	for rows.Next() {
+		var (
+			id    int64
+			token string
+		)
+		if err := rows.Scan(&id, &token); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		legacy[id] = token
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
 	}
+
+	for id, token := range legacy {
+		query := `UPDATE refresh_tokens SET token_hash = $2, token = NULL WHERE id = $1`
+		if _, err := r.db.ExecContext(ctx, query, id, r.hasher.Hash(token)); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(legacy), nil
+}
+
+func (r *Repository) createRefreshToken(ctx context.Context, db queryRower, token model.RefreshToken) (int64, error) {
+	query := `
+		INSERT INTO refresh_tokens (user_id, token_hash, family_id, parent_id, device_name, user_agent, ip,
+		                            client_id, scope, created_at, last_used_at)
+		VALUES ($1, $2, $3, NULLIF($4, 0), $5, $6, $7, NULLIF($8, ''), $9, $10, $11)
+		RETURNING id
+	`
+
+	var id int64
+	err := db.QueryRowContext(ctx, query,
+		token.UserId, r.hasher.Hash(token.Token), token.FamilyId, token.ParentId, token.DeviceName, token.UserAgent, token.IP,
+		token.ClientId, token.Scope, token.CreatedAt, token.LastUsedAt,
+	).Scan(&id)
 	if err != nil {
-		return "", err
+		return 0, err
 	}
 
-	return refreshToken, nil
+	return id, nil
 }
 
 func (r *Repository) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
-	query := `SELECT id, email, password, created_at, updated_at FROM users WHERE email = $1;`
+	query := `SELECT id, email, password, email_verified_at, disabled_at, created_at, updated_at FROM users WHERE email = $1;`
 
 	row := r.db.QueryRowContext(ctx, query, email)
 
 	var user model.User
-	err := row.Scan(&user.Id, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt)
+	err := row.Scan(&user.Id, &user.Email, &user.Password, &user.EmailVerifiedAt, &user.DisabledAt, &user.CreatedAt, &user.UpdatedAt)
 
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, repository.ErrUserNotFound
@@ -74,13 +209,90 @@ func (r *Repository) GetUserByEmail(ctx context.Context, email string) (*model.U
 	return &user, err
 }
 
-func (r *Repository) SaveRefreshToken(ctx context.Context, userID int64, token string) error {
+func (r *Repository) GetUserByID(ctx context.Context, userID int64) (*model.User, error) {
+	query := `SELECT id, email, password, email_verified_at, disabled_at, created_at, updated_at FROM users WHERE id = $1;`
+
+	row := r.db.QueryRowContext(ctx, query, userID)
+
+	var user model.User
+	err := row.Scan(&user.Id, &user.Email, &user.Password, &user.EmailVerifiedAt, &user.DisabledAt, &user.CreatedAt, &user.UpdatedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (r *Repository) UpdateEmail(ctx context.Context, userID int64, email string) error {
+	query := `UPDATE users SET email = $2, email_verified_at = NOW(), updated_at = NOW() WHERE id = $1`
+
+	res, err := r.db.ExecContext(ctx, query, userID, email)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return repository.ErrEmailTaken
+	}
+	if err != nil {
+		return err
+	}
+	return expectAffected(res, repository.ErrUserNotFound)
+}
+
+func (r *Repository) MarkEmailVerified(ctx context.Context, userID int64) error {
 	query := `
-		INSERT INTO refresh_tokens (user_id, token)
-		VALUES ($1, $2)
-		ON CONFLICT (user_id) DO UPDATE
-		SET token = EXCLUDED.token, created_at = NOW()
+		UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+		WHERE id = $1
 	`
-	_, err := r.db.ExecContext(ctx, query, userID, token)
-	return err
+	res, err := r.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res, repository.ErrUserNotFound)
+}
+
+func (r *Repository) UpdatePassword(ctx context.Context, userID int64, passwordHash string) error {
+	query := `UPDATE users SET password = $2, updated_at = NOW() WHERE id = $1`
+
+	res, err := r.db.ExecContext(ctx, query, userID, passwordHash)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res, repository.ErrUserNotFound)
+}
+
+func expectAffected(res sql.Result, notFound error) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
+
+// SetUserDisabled sets disabled_at when disabled and clears it otherwise. Disabling an
+// already disabled account keeps the original time.
+func (r *Repository) SetUserDisabled(ctx context.Context, userID int64, disabled bool) error {
+	query := `UPDATE users SET disabled_at = NULL, updated_at = NOW() WHERE id = $1`
+	if disabled {
+		query = `UPDATE users SET disabled_at = COALESCE(disabled_at, NOW()), updated_at = NOW() WHERE id = $1`
+	}
+
+	res, err := r.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res, repository.ErrUserNotFound)
+}
+
+func (r *Repository) DeleteUser(ctx context.Context, userID int64) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res, repository.ErrUserNotFound)
 }
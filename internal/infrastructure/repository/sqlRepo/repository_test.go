@@ -9,19 +9,25 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
 	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 )
 
-func setupMockDB(t *testing.T) (repository.AuthRepository, sqlmock.Sqlmock, func()) {
+var testHasher = security.NewTokenHasher("test-pepper")
+
+func setupMockDB(t *testing.T) (*Repository, sqlmock.Sqlmock, func()) {
 	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
 
-	repo := NewAuthRepository(db)
+	repo := NewAuthRepository(db, testHasher)
 
 	return repo, mock, func() { db.Close() }
 }
 
+var _ repository.AuthRepository = (*Repository)(nil)
+
 func TestCreateUser(t *testing.T) {
 	repo, mock, closeDB := setupMockDB(t)
 	defer closeDB()
@@ -34,10 +40,10 @@ func TestCreateUser(t *testing.T) {
 	}
 
 	mock.ExpectQuery(regexp.QuoteMeta(
-		`INSERT INTO users (email, password, created_at, updated_at)
-		VALUES ($1, $2, $3, $4)
+		`INSERT INTO users (email, password, email_verified_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id`)).
-		WithArgs(user.Email, user.Password, user.CreatedAt, user.UpdatedAt).
+		WithArgs(user.Email, user.Password, user.EmailVerifiedAt, user.CreatedAt, user.UpdatedAt).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 
 	id, err := repo.CreateUser(context.Background(), user)
@@ -48,16 +54,38 @@ func TestCreateUser(t *testing.T) {
 	assert.NoError(t, err)
 }
 
-func TestDeleteRefreshToken(t *testing.T) {
+var insertRefreshTokenQuery = regexp.QuoteMeta(`
+		INSERT INTO refresh_tokens (user_id, token_hash, family_id, parent_id, device_name, user_agent, ip,
+		                            client_id, scope, created_at, last_used_at)
+		VALUES ($1, $2, $3, NULLIF($4, 0), $5, $6, $7, NULLIF($8, ''), $9, $10, $11)
+		RETURNING id`)
+
+func TestCreateRefreshToken(t *testing.T) {
 	repo, mock, closeDB := setupMockDB(t)
 	defer closeDB()
 
-	userID := int64(1)
-	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM refresh_tokens WHERE user_id = $1`)).
-		WithArgs(userID).
-		WillReturnResult(sqlmock.NewResult(0, 1))
+	now := time.Now()
+	token := model.RefreshToken{
+		UserId:     1,
+		Token:      "refresh-token-123",
+		FamilyId:   "family-1",
+		DeviceName: "laptop",
+		UserAgent:  "curl/8.0",
+		IP:         "10.0.0.1",
+		CreatedAt:  now,
+		LastUsedAt: now,
+	}
 
-	err := repo.DeleteRefreshToken(context.Background(), userID)
+	mock.ExpectQuery(insertRefreshTokenQuery).
+		WithArgs(token.UserId, testHasher.Hash(token.Token), token.FamilyId, int64(0), token.DeviceName, token.UserAgent, token.IP,
+			token.ClientId, token.Scope, token.CreatedAt, token.LastUsedAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+
+	id, err := repo.CreateRefreshToken(context.Background(), token)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), id)
+
+	err = mock.ExpectationsWereMet()
 	assert.NoError(t, err)
 }
 
@@ -65,25 +93,141 @@ func TestGetRefreshToken(t *testing.T) {
 	repo, mock, closeDB := setupMockDB(t)
 	defer closeDB()
 
-	userID := int64(1)
-	expectedToken := "refresh-token-123"
+	token := "refresh-token-123"
+	now := time.Now()
+	query := regexp.QuoteMeta(`
+		SELECT id, user_id, family_id, COALESCE(parent_id, 0), device_name, user_agent, ip,
+		       COALESCE(client_id, ''), scope, created_at, last_used_at, rotated_at, revoked_at
+		FROM refresh_tokens WHERE token_hash = $1`)
+	columns := []string{"id", "user_id", "family_id", "parent_id", "device_name", "user_agent", "ip",
+		"client_id", "scope", "created_at", "last_used_at", "rotated_at", "revoked_at"}
 
 	// Тест успешного запроса
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT token FROM refresh_tokens WHERE user_id = $1`)).
-		WithArgs(userID).
-		WillReturnRows(sqlmock.NewRows([]string{"token"}).AddRow(expectedToken))
+	mock.ExpectQuery(query).
+		WithArgs(testHasher.Hash(token)).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(5, 1, "family-1", 4, "phone", "ios", "10.0.0.2", "chat-web", "openid", now, now, now, nil))
 
-	token, err := repo.GetRefreshToken(context.Background(), userID)
+	rt, err := repo.GetRefreshToken(context.Background(), token)
 	assert.NoError(t, err)
-	assert.Equal(t, expectedToken, token)
+	assert.Equal(t, int64(5), rt.Id)
+	assert.Equal(t, token, rt.Token)
+	assert.Equal(t, int64(4), rt.ParentId)
+	assert.Equal(t, "family-1", rt.FamilyId)
+	assert.Equal(t, "chat-web", rt.ClientId)
+	assert.NotNil(t, rt.RotatedAt)
+	assert.Nil(t, rt.RevokedAt)
 
 	// Тест ошибки: нет записи
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT token FROM refresh_tokens WHERE user_id = $1`)).
-		WithArgs(userID).
+	mock.ExpectQuery(query).
+		WithArgs(testHasher.Hash(token)).
 		WillReturnError(sql.ErrNoRows)
 
-	_, err = repo.GetRefreshToken(context.Background(), userID)
-	assert.Equal(t, repository.ErrUserNotFound, err)
+	_, err = repo.GetRefreshToken(context.Background(), token)
+	assert.Equal(t, repository.ErrRefreshTokenNotFound, err)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	now := time.Now()
+	next := model.RefreshToken{UserId: 1, Token: "new", FamilyId: "family-1", CreatedAt: now, LastUsedAt: now}
+	claimQuery := regexp.QuoteMeta(`
+		UPDATE refresh_tokens SET rotated_at = NOW(), last_used_at = NOW()
+		WHERE id = $1 AND rotated_at IS NULL AND revoked_at IS NULL`)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(claimQuery).
+		WithArgs(int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(insertRefreshTokenQuery).
+		WithArgs(next.UserId, testHasher.Hash(next.Token), next.FamilyId, int64(5), "", "", "", "", "", now, now).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(6))
+	mock.ExpectCommit()
+
+	id, err := repo.RotateRefreshToken(context.Background(), 5, next)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), id)
+
+	// Токен уже был обновлён другим запросом
+	mock.ExpectBegin()
+	mock.ExpectExec(claimQuery).
+		WithArgs(int64(5)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	_, err = repo.RotateRefreshToken(context.Background(), 5, next)
+	assert.Equal(t, repository.ErrRefreshTokenRotated, err)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestHashLegacyRefreshTokens(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, token FROM refresh_tokens WHERE token_hash IS NULL AND token IS NOT NULL`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "token"}).AddRow(3, "legacy-token"))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE refresh_tokens SET token_hash = $2, token = NULL WHERE id = $1`)).
+		WithArgs(int64(3), testHasher.Hash("legacy-token")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	n, err := repo.HashLegacyRefreshTokens(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestDeleteStaleRefreshTokens(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	createdBefore := time.Now().Add(-30 * 24 * time.Hour)
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM refresh_tokens`)).
+		WithArgs(createdBefore).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+
+	n, err := repo.DeleteStaleRefreshTokens(context.Background(), createdBefore)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), n)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestRevokeRefreshTokenFamily(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`)).
+		WithArgs("family-1").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	err := repo.RevokeRefreshTokenFamily(context.Background(), "family-1")
+	assert.NoError(t, err)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestRevokeUserRefreshTokens(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	userID := int64(1)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`)).
+		WithArgs(userID).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	err := repo.RevokeUserRefreshTokens(context.Background(), userID)
+	assert.NoError(t, err)
 
 	err = mock.ExpectationsWereMet()
 	assert.NoError(t, err)
@@ -97,17 +241,18 @@ func TestGetUserByEmail(t *testing.T) {
 	now := time.Now()
 
 	// Успешный кейс
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, email, password, created_at, updated_at FROM users WHERE email = $1;`)).
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, email, password, email_verified_at, disabled_at, created_at, updated_at FROM users WHERE email = $1;`)).
 		WithArgs(email).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password", "created_at", "updated_at"}).
-			AddRow(1, email, "hashedPassword", now, now))
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password", "email_verified_at", "disabled_at", "created_at", "updated_at"}).
+			AddRow(1, email, "hashedPassword", now, nil, now, now))
 
 	user, err := repo.GetUserByEmail(context.Background(), email)
 	assert.NoError(t, err)
 	assert.Equal(t, email, user.Email)
+	assert.NotNil(t, user.EmailVerifiedAt)
 
 	// Ошибка: не найден
-	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, email, password, created_at, updated_at FROM users WHERE email = $1;`)).
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, email, password, email_verified_at, disabled_at, created_at, updated_at FROM users WHERE email = $1;`)).
 		WithArgs(email).
 		WillReturnError(sql.ErrNoRows)
 
@@ -119,24 +264,150 @@ func TestGetUserByEmail(t *testing.T) {
 	assert.NoError(t, err)
 }
 
-func TestSaveRefreshToken(t *testing.T) {
+func TestMarkEmailVerified(t *testing.T) {
 	repo, mock, closeDB := setupMockDB(t)
 	defer closeDB()
 
-	userID := int64(1)
-	token := "refresh-token-123"
+	query := regexp.QuoteMeta(`UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()`)
+	mock.ExpectExec(query).
+		WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(query).
+		WithArgs(int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(t, repo.MarkEmailVerified(context.Background(), 1))
+	assert.ErrorIs(t, repo.MarkEmailVerified(context.Background(), 2), repository.ErrUserNotFound)
+
+	err := mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestUpdatePassword(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET password = $2, updated_at = NOW() WHERE id = $1`)).
+		WithArgs(int64(1), "newHash").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.UpdatePassword(context.Background(), 1, "newHash")
+	assert.NoError(t, err)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestGetUserByID(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	query := regexp.QuoteMeta(`SELECT id, email, password, email_verified_at, disabled_at, created_at, updated_at FROM users WHERE id = $1;`)
+	now := time.Now()
+
+	mock.ExpectQuery(query).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password", "email_verified_at", "disabled_at", "created_at", "updated_at"}).
+			AddRow(1, "test@example.com", "hashedPassword", nil, now, now, now))
+
+	user, err := repo.GetUserByID(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "test@example.com", user.Email)
+	assert.Nil(t, user.EmailVerifiedAt)
+	assert.NotNil(t, user.DisabledAt)
+
+	mock.ExpectQuery(query).
+		WithArgs(int64(2)).
+		WillReturnError(sql.ErrNoRows)
+
+	user, err = repo.GetUserByID(context.Background(), 2)
+	assert.Nil(t, user)
+	assert.Equal(t, repository.ErrUserNotFound, err)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestUpdateEmail(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	query := regexp.QuoteMeta(`UPDATE users SET email = $2, email_verified_at = NOW(), updated_at = NOW() WHERE id = $1`)
+
+	mock.ExpectExec(query).
+		WithArgs(int64(1), "new@example.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.UpdateEmail(context.Background(), 1, "new@example.com")
+	assert.NoError(t, err)
+
+	// Email уже занят другим пользователем
+	mock.ExpectExec(query).
+		WithArgs(int64(1), "taken@example.com").
+		WillReturnError(&pq.Error{Code: "23505"})
+
+	err = repo.UpdateEmail(context.Background(), 1, "taken@example.com")
+	assert.ErrorIs(t, err, repository.ErrEmailTaken)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestRevokeOtherRefreshTokens(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
 
 	mock.ExpectExec(regexp.QuoteMeta(`
-		INSERT INTO refresh_tokens (user_id, token)
-		VALUES ($1, $2)
-		ON CONFLICT (user_id) DO UPDATE
-		SET token = EXCLUDED.token, created_at = NOW()`)).
-		WithArgs(userID, token).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE user_id = $1 AND family_id <> $2 AND revoked_at IS NULL`)).
+		WithArgs(int64(1), "family-1").
+		WillReturnResult(sqlmock.NewResult(0, 3))
 
-	err := repo.SaveRefreshToken(context.Background(), userID, token)
+	err := repo.RevokeOtherRefreshTokens(context.Background(), 1, "family-1")
 	assert.NoError(t, err)
 
 	err = mock.ExpectationsWereMet()
 	assert.NoError(t, err)
 }
+
+func TestSetUserDisabled(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET disabled_at = COALESCE(disabled_at, NOW()), updated_at = NOW() WHERE id = $1`)).
+		WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET disabled_at = NULL, updated_at = NOW() WHERE id = $1`)).
+		WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// Ошибка: пользователь не найден
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET disabled_at = COALESCE(disabled_at, NOW()), updated_at = NOW() WHERE id = $1`)).
+		WithArgs(int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(t, repo.SetUserDisabled(context.Background(), 1, true))
+	assert.NoError(t, repo.SetUserDisabled(context.Background(), 1, false))
+	assert.ErrorIs(t, repo.SetUserDisabled(context.Background(), 2, true), repository.ErrUserNotFound)
+
+	err := mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestDeleteUser(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	query := regexp.QuoteMeta(`DELETE FROM users WHERE id = $1`)
+	mock.ExpectExec(query).
+		WithArgs(int64(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(query).
+		WithArgs(int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(t, repo.DeleteUser(context.Background(), 1))
+	assert.ErrorIs(t, repo.DeleteUser(context.Background(), 2), repository.ErrUserNotFound)
+
+	err := mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
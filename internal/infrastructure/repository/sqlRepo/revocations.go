@@ -0,0 +1,75 @@
+package sqlRepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// RevokeToken stores service tokens, which have no user, with a NULL user_id.
+func (r *Repository) RevokeToken(ctx context.Context, jti string, userID int64, expiresAt time.Time) error {
+	query := `
+		INSERT INTO revoked_tokens (jti, user_id, expires_at)
+		VALUES ($1, NULLIF($2, 0), $3)
+		ON CONFLICT (jti) DO NOTHING
+	`
+	_, err := r.db.ExecContext(ctx, query, jti, userID, expiresAt)
+	return err
+}
+
+func (r *Repository) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`
+
+	var revoked bool
+	err := r.db.QueryRowContext(ctx, query, jti).Scan(&revoked)
+	return revoked, err
+}
+
+// RevokeUserTokensBefore never moves an existing cutoff backwards.
+func (r *Repository) RevokeUserTokensBefore(ctx context.Context, userID int64, before time.Time) error {
+	query := `
+		INSERT INTO user_token_revocations (user_id, revoked_before)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET revoked_before = GREATEST(user_token_revocations.revoked_before, EXCLUDED.revoked_before)
+	`
+	_, err := r.db.ExecContext(ctx, query, userID, before)
+	return err
+}
+
+// GetUserTokensRevokedBefore returns the zero time when the user has no cutoff.
+func (r *Repository) GetUserTokensRevokedBefore(ctx context.Context, userID int64) (time.Time, error) {
+	query := `SELECT revoked_before FROM user_token_revocations WHERE user_id = $1`
+
+	var before time.Time
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&before)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return before, err
+}
+
+// DeleteExpiredRevocations drops denylist entries for tokens that have expired anyway
+// and per-user cutoffs older than any token that could still be valid.
+func (r *Repository) DeleteExpiredRevocations(ctx context.Context, expiredBefore time.Time, issuedCutoffBefore time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at < $1`, expiredBefore)
+	if err != nil {
+		return 0, err
+	}
+	tokens, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	res, err = r.db.ExecContext(ctx, `DELETE FROM user_token_revocations WHERE revoked_before < $1`, issuedCutoffBefore)
+	if err != nil {
+		return 0, err
+	}
+	users, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return tokens + users, nil
+}
@@ -0,0 +1,109 @@
+package sqlRepo
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ repository.TokenRevocationRepository = (*Repository)(nil)
+
+func TestRevokeToken(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	expiresAt := time.Now().Add(time.Minute)
+	mock.ExpectExec(regexp.QuoteMeta(`
+		INSERT INTO revoked_tokens (jti, user_id, expires_at)
+		VALUES ($1, NULLIF($2, 0), $3)
+		ON CONFLICT (jti) DO NOTHING`)).
+		WithArgs("jti-1", int64(1), expiresAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.RevokeToken(context.Background(), "jti-1", 1, expiresAt)
+	assert.NoError(t, err)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestIsTokenRevoked(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`)).
+		WithArgs("jti-1").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	revoked, err := repo.IsTokenRevoked(context.Background(), "jti-1")
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestUserTokenRevocations(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	before := time.Now()
+	mock.ExpectExec(regexp.QuoteMeta(`
+		INSERT INTO user_token_revocations (user_id, revoked_before)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET revoked_before = GREATEST(user_token_revocations.revoked_before, EXCLUDED.revoked_before)`)).
+		WithArgs(int64(1), before).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	err := repo.RevokeUserTokensBefore(context.Background(), 1, before)
+	assert.NoError(t, err)
+
+	query := regexp.QuoteMeta(`SELECT revoked_before FROM user_token_revocations WHERE user_id = $1`)
+	mock.ExpectQuery(query).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"revoked_before"}).AddRow(before))
+
+	got, err := repo.GetUserTokensRevokedBefore(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, before, got)
+
+	// Нет отзыва для пользователя
+	mock.ExpectQuery(query).
+		WithArgs(int64(2)).
+		WillReturnError(sql.ErrNoRows)
+
+	got, err = repo.GetUserTokensRevokedBefore(context.Background(), 2)
+	assert.NoError(t, err)
+	assert.True(t, got.IsZero())
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestDeleteExpiredRevocations(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	now := time.Now()
+	cutoff := now.Add(-time.Hour)
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM revoked_tokens WHERE expires_at < $1`)).
+		WithArgs(now).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM user_token_revocations WHERE revoked_before < $1`)).
+		WithArgs(cutoff).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	n, err := repo.DeleteExpiredRevocations(context.Background(), now, cutoff)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), n)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
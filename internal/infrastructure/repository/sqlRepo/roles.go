@@ -0,0 +1,157 @@
+package sqlRepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/lib/pq"
+)
+
+func (r *Repository) GetUserRoles(ctx context.Context, userID int64) ([]string, error) {
+	query := `
+		SELECT r.name FROM roles r
+		JOIN user_roles ur ON ur.role_id = r.id
+		WHERE ur.user_id = $1
+		ORDER BY r.name
+	`
+	return r.queryStrings(ctx, query, userID)
+}
+
+func (r *Repository) GetUserPermissions(ctx context.Context, userID int64) ([]string, error) {
+	query := `
+		SELECT DISTINCT p.name FROM permissions p
+		JOIN role_permissions rp ON rp.permission_id = p.id
+		JOIN user_roles ur ON ur.role_id = rp.role_id
+		WHERE ur.user_id = $1
+		ORDER BY p.name
+	`
+	return r.queryStrings(ctx, query, userID)
+}
+
+// AssignRole is idempotent: granting a role the user already has is not an error.
+func (r *Repository) AssignRole(ctx context.Context, userID int64, role string) error {
+	query := `
+		INSERT INTO user_roles (user_id, role_id)
+		SELECT $1, id FROM roles WHERE name = $2
+		ON CONFLICT (user_id, role_id) DO NOTHING
+		RETURNING role_id
+	`
+
+	var roleID int64
+	err := r.db.QueryRowContext(ctx, query, userID, role).Scan(&roleID)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Either the role does not exist or the user already has it.
+		return r.ensureRoleExists(ctx, role)
+	}
+	return err
+}
+
+func (r *Repository) RevokeRole(ctx context.Context, userID int64, role string) error {
+	query := `
+		DELETE FROM user_roles
+		WHERE user_id = $1 AND role_id = (SELECT id FROM roles WHERE name = $2)
+	`
+	_, err := r.db.ExecContext(ctx, query, userID, role)
+	return err
+}
+
+func (r *Repository) ListRoles(ctx context.Context) ([]model.Role, error) {
+	query := `
+		SELECT r.id, r.name, r.description, COALESCE(array_agg(p.name ORDER BY p.name) FILTER (WHERE p.name IS NOT NULL), '{}')
+		FROM roles r
+		LEFT JOIN role_permissions rp ON rp.role_id = r.id
+		LEFT JOIN permissions p ON p.id = rp.permission_id
+		GROUP BY r.id
+		ORDER BY r.name
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []model.Role{}
+	for rows.Next() {
+		var role model.Role
+		if err := rows.Scan(&role.Id, &role.Name, &role.Description, pq.Array(&role.Permissions)); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+// SaveRole creates the role or updates its description, and replaces its permissions
+// with role.Permissions. Unknown permissions are created on the fly.
+func (r *Repository) SaveRole(ctx context.Context, role model.Role) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var roleID int64
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO roles (name, description) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET description = EXCLUDED.description
+		RETURNING id
+	`, role.Name, role.Description).Scan(&roleID)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role_id = $1`, roleID); err != nil {
+		return 0, err
+	}
+
+	if len(role.Permissions) > 0 {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO permissions (name) SELECT unnest($1::text[])
+			ON CONFLICT (name) DO NOTHING
+		`, pq.Array(role.Permissions)); err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO role_permissions (role_id, permission_id)
+			SELECT $1, id FROM permissions WHERE name = ANY($2)
+		`, roleID, pq.Array(role.Permissions)); err != nil {
+			return 0, err
+		}
+	}
+
+	return roleID, tx.Commit()
+}
+
+func (r *Repository) ensureRoleExists(ctx context.Context, role string) error {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM roles WHERE name = $1)`, role).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return repository.ErrRoleNotFound
+	}
+	return nil
+}
+
+func (r *Repository) queryStrings(ctx context.Context, query string, args ...interface{}) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := []string{}
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
@@ -0,0 +1,121 @@
+package sqlRepo
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ repository.RoleRepository = (*Repository)(nil)
+
+func TestGetUserPermissions(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT DISTINCT p.name FROM permissions p`)).
+		WithArgs(int64(1)).
+		WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("roles:manage").AddRow("tokens:revoke"))
+
+	perms, err := repo.GetUserPermissions(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"roles:manage", "tokens:revoke"}, perms)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestAssignRole(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	insert := regexp.QuoteMeta(`INSERT INTO user_roles (user_id, role_id)`)
+	exists := regexp.QuoteMeta(`SELECT EXISTS (SELECT 1 FROM roles WHERE name = $1)`)
+
+	mock.ExpectQuery(insert).
+		WithArgs(int64(1), "admin").
+		WillReturnRows(sqlmock.NewRows([]string{"role_id"}).AddRow(1))
+
+	err := repo.AssignRole(context.Background(), 1, "admin")
+	assert.NoError(t, err)
+
+	// Роль уже назначена
+	mock.ExpectQuery(insert).
+		WithArgs(int64(1), "admin").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(exists).
+		WithArgs("admin").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	err = repo.AssignRole(context.Background(), 1, "admin")
+	assert.NoError(t, err)
+
+	// Роль не существует
+	mock.ExpectQuery(insert).
+		WithArgs(int64(1), "ghost").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(exists).
+		WithArgs("ghost").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	err = repo.AssignRole(context.Background(), 1, "ghost")
+	assert.ErrorIs(t, err, repository.ErrRoleNotFound)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestListRoles(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT r.id, r.name, r.description`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "description", "permissions"}).
+			AddRow(1, "admin", "Administrators", "{roles:manage,tokens:revoke}"))
+
+	roles, err := repo.ListRoles(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []model.Role{{
+		Id:          1,
+		Name:        "admin",
+		Description: "Administrators",
+		Permissions: []string{"roles:manage", "tokens:revoke"},
+	}}, roles)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestSaveRole(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO roles (name, description) VALUES ($1, $2)`)).
+		WithArgs("moderator", "Chat moderators").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM role_permissions WHERE role_id = $1`)).
+		WithArgs(int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO permissions (name) SELECT unnest($1::text[])`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO role_permissions (role_id, permission_id)`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	id, err := repo.SaveRole(context.Background(), model.Role{
+		Name:        "moderator",
+		Description: "Chat moderators",
+		Permissions: []string{"messages:delete"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), id)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
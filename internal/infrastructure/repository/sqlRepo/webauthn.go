@@ -0,0 +1,150 @@
+package sqlRepo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/lib/pq"
+)
+
+const webAuthnCredentialColumns = `id, user_id, credential_id, public_key, sign_count, transports, aaguid,
+		attestation_type, flags, name, created_at, last_used_at`
+
+func (r *Repository) ListWebAuthnCredentials(ctx context.Context, userID int64) ([]model.WebAuthnCredential, error) {
+	query := `SELECT ` + webAuthnCredentialColumns + ` FROM webauthn_credentials WHERE user_id = $1 ORDER BY id`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credentials := []model.WebAuthnCredential{}
+	for rows.Next() {
+		credential, err := scanWebAuthnCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, *credential)
+	}
+
+	return credentials, rows.Err()
+}
+
+func (r *Repository) GetWebAuthnCredential(ctx context.Context, credentialID []byte) (*model.WebAuthnCredential, error) {
+	query := `SELECT ` + webAuthnCredentialColumns + ` FROM webauthn_credentials WHERE credential_id = $1`
+
+	credential, err := scanWebAuthnCredential(r.db.QueryRowContext(ctx, query, credentialID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrCredentialNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return credential, nil
+}
+
+func (r *Repository) CreateWebAuthnCredential(ctx context.Context, credential model.WebAuthnCredential) (int64, error) {
+	query := `
+		INSERT INTO webauthn_credentials (user_id, credential_id, public_key, sign_count, transports, aaguid,
+			attestation_type, flags, name, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW())
+		RETURNING id
+	`
+
+	var id int64
+	err := r.db.QueryRowContext(ctx, query, credential.UserId, credential.CredentialId, credential.PublicKey,
+		int64(credential.SignCount), pq.Array(credential.Transports), credential.AAGUID,
+		credential.AttestationType, int16(credential.Flags), credential.Name).Scan(&id)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return 0, repository.ErrCredentialExists
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (r *Repository) UpdateWebAuthnCredentialUsage(ctx context.Context, credentialID []byte, signCount uint32, flags uint8) error {
+	query := `
+		UPDATE webauthn_credentials SET sign_count = $2, flags = $3, last_used_at = NOW()
+		WHERE credential_id = $1
+	`
+
+	res, err := r.db.ExecContext(ctx, query, credentialID, int64(signCount), int16(flags))
+	if err != nil {
+		return err
+	}
+	return expectAffected(res, repository.ErrCredentialNotFound)
+}
+
+// DeleteWebAuthnCredential only deletes credentials owned by userID.
+func (r *Repository) DeleteWebAuthnCredential(ctx context.Context, userID, id int64) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	return expectAffected(res, repository.ErrCredentialNotFound)
+}
+
+func (r *Repository) CreateWebAuthnSession(ctx context.Context, session model.WebAuthnSession) error {
+	query := `
+		INSERT INTO webauthn_sessions (id, user_id, purpose, data, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	userID := sql.NullInt64{Int64: session.UserId, Valid: session.UserId != 0}
+
+	_, err := r.db.ExecContext(ctx, query, session.Id, userID, session.Purpose, session.Data, session.ExpiresAt)
+	return err
+}
+
+// ConsumeWebAuthnSession deletes the session in the same statement that reads it,
+// so a challenge can only be answered once.
+func (r *Repository) ConsumeWebAuthnSession(ctx context.Context, id, purpose string) (*model.WebAuthnSession, error) {
+	query := `
+		DELETE FROM webauthn_sessions
+		WHERE id = $1 AND purpose = $2 AND expires_at > NOW()
+		RETURNING user_id, data, expires_at
+	`
+
+	session := model.WebAuthnSession{Id: id, Purpose: purpose}
+	var userID sql.NullInt64
+	err := r.db.QueryRowContext(ctx, query, id, purpose).Scan(&userID, &session.Data, &session.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, repository.ErrWebAuthnSessionInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	session.UserId = userID.Int64
+
+	return &session, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanWebAuthnCredential(row rowScanner) (*model.WebAuthnCredential, error) {
+	var (
+		credential model.WebAuthnCredential
+		signCount  int64
+		flags      int16
+	)
+	err := row.Scan(&credential.Id, &credential.UserId, &credential.CredentialId, &credential.PublicKey, &signCount,
+		pq.Array(&credential.Transports), &credential.AAGUID, &credential.AttestationType, &flags, &credential.Name,
+		&credential.CreatedAt, &credential.LastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	credential.SignCount = uint32(signCount)
+	credential.Flags = uint8(flags)
+
+	return &credential, nil
+}
@@ -0,0 +1,131 @@
+package sqlRepo
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ repository.WebAuthnRepository = (*Repository)(nil)
+
+var webAuthnCredentialRows = []string{"id", "user_id", "credential_id", "public_key", "sign_count", "transports",
+	"aaguid", "attestation_type", "flags", "name", "created_at", "last_used_at"}
+
+func TestGetWebAuthnCredential(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	query := regexp.QuoteMeta(`FROM webauthn_credentials WHERE credential_id = $1`)
+	now := time.Now()
+
+	mock.ExpectQuery(query).
+		WithArgs([]byte("cred")).
+		WillReturnRows(sqlmock.NewRows(webAuthnCredentialRows).
+			AddRow(3, 1, []byte("cred"), []byte("key"), 7, "{internal,hybrid}", nil, "none", 0x5d, "Laptop", now, nil))
+
+	credential, err := repo.GetWebAuthnCredential(context.Background(), []byte("cred"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), credential.UserId)
+	assert.Equal(t, uint32(7), credential.SignCount)
+	assert.Equal(t, uint8(0x5d), credential.Flags)
+	assert.Equal(t, []string{"internal", "hybrid"}, credential.Transports)
+	assert.Nil(t, credential.LastUsedAt)
+
+	// Неизвестный ключ
+	mock.ExpectQuery(query).
+		WithArgs([]byte("other")).
+		WillReturnError(sql.ErrNoRows)
+
+	credential, err = repo.GetWebAuthnCredential(context.Background(), []byte("other"))
+	assert.Nil(t, credential)
+	assert.ErrorIs(t, err, repository.ErrCredentialNotFound)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestCreateWebAuthnCredential(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	query := regexp.QuoteMeta(`INSERT INTO webauthn_credentials`)
+	credential := model.WebAuthnCredential{
+		UserId:       1,
+		CredentialId: []byte("cred"),
+		PublicKey:    []byte("key"),
+		Transports:   []string{"internal"},
+		Flags:        0x45,
+		Name:         "Laptop",
+	}
+
+	mock.ExpectQuery(query).
+		WithArgs(int64(1), []byte("cred"), []byte("key"), int64(0), sqlmock.AnyArg(), sqlmock.AnyArg(), "", int16(0x45), "Laptop").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+
+	id, err := repo.CreateWebAuthnCredential(context.Background(), credential)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), id)
+
+	// Ключ уже зарегистрирован
+	mock.ExpectQuery(query).
+		WillReturnError(&pq.Error{Code: uniqueViolation})
+
+	_, err = repo.CreateWebAuthnCredential(context.Background(), credential)
+	assert.ErrorIs(t, err, repository.ErrCredentialExists)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestDeleteWebAuthnCredential_OnlyOwn(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	// Чужой ключ не удаляется
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2`)).
+		WithArgs(int64(5), int64(2)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err := repo.DeleteWebAuthnCredential(context.Background(), 2, 5)
+	assert.ErrorIs(t, err, repository.ErrCredentialNotFound)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
+
+func TestConsumeWebAuthnSession(t *testing.T) {
+	repo, mock, closeDB := setupMockDB(t)
+	defer closeDB()
+
+	query := regexp.QuoteMeta(`DELETE FROM webauthn_sessions`)
+	expires := time.Now().Add(time.Minute)
+
+	// Беспарольный вход: пользователь ещё неизвестен
+	mock.ExpectQuery(query).
+		WithArgs("session-1", "webauthn_login").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "data", "expires_at"}).AddRow(nil, "{}", expires))
+
+	session, err := repo.ConsumeWebAuthnSession(context.Background(), "session-1", "webauthn_login")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), session.UserId)
+	assert.Equal(t, "{}", session.Data)
+
+	// Повторное использование
+	mock.ExpectQuery(query).
+		WithArgs("session-1", "webauthn_login").
+		WillReturnError(sql.ErrNoRows)
+
+	_, err = repo.ConsumeWebAuthnSession(context.Background(), "session-1", "webauthn_login")
+	assert.ErrorIs(t, err, repository.ErrWebAuthnSessionInvalid)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+}
@@ -0,0 +1,177 @@
+package revocation
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+)
+
+// Store answers "is this access token revoked?" on every request. Revocations are
+// durable in SQL so all replicas agree; lookups are cached in memory. A revoked jti
+// stays cached until the token expires, while "not revoked" answers and per-user
+// cutoffs are only trusted for cacheTTL, which bounds how long another replica can
+// keep accepting a freshly revoked token.
+type Store struct {
+	repo     repository.TokenRevocationRepository
+	cacheTTL time.Duration
+	tokenTTL time.Duration
+	now      func() time.Time
+
+	mu     sync.Mutex
+	tokens map[string]tokenEntry
+	users  map[int64]userEntry
+}
+
+type tokenEntry struct {
+	revoked bool
+	until   time.Time
+}
+
+type userEntry struct {
+	before time.Time
+	until  time.Time
+}
+
+// NewStore needs tokenTTL, the longest access token lifetime, to know when a
+// per-user cutoff can no longer affect any valid token.
+func NewStore(repo repository.TokenRevocationRepository, cacheTTL, tokenTTL time.Duration) *Store {
+	return &Store{
+		repo:     repo,
+		cacheTTL: cacheTTL,
+		tokenTTL: tokenTTL,
+		now:      time.Now,
+		tokens:   make(map[string]tokenEntry),
+		users:    make(map[int64]userEntry),
+	}
+}
+
+func (s *Store) IsRevoked(ctx context.Context, claims *security.Claims) (bool, error) {
+	before, err := s.userCutoff(ctx, claims.UserID)
+	if err != nil {
+		return false, err
+	}
+	// iat only has whole seconds, so the cutoff is compared at the same precision and
+	// every token of the cutoff's second counts as revoked. That also catches one issued
+	// just before the cutoff; the price is that one issued just after it needs a new login.
+	if !before.IsZero() && !claims.IssuedAt.After(before.Truncate(time.Second)) {
+		return true, nil
+	}
+
+	// Tokens issued before jti was introduced can only be revoked per user.
+	if claims.ID == "" {
+		return false, nil
+	}
+
+	now := s.now()
+	s.mu.Lock()
+	entry, ok := s.tokens[claims.ID]
+	s.mu.Unlock()
+	if ok && now.Before(entry.until) {
+		return entry.revoked, nil
+	}
+
+	revoked, err := s.repo.IsTokenRevoked(ctx, claims.ID)
+	if err != nil {
+		return false, err
+	}
+
+	entry = tokenEntry{revoked: revoked, until: now.Add(s.cacheTTL)}
+	if revoked {
+		entry.until = claims.ExpiresAt
+	}
+	s.mu.Lock()
+	s.tokens[claims.ID] = entry
+	s.mu.Unlock()
+
+	return revoked, nil
+}
+
+func (s *Store) RevokeToken(ctx context.Context, claims *security.Claims) error {
+	if err := s.repo.RevokeToken(ctx, claims.ID, claims.UserID, claims.ExpiresAt); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.tokens[claims.ID] = tokenEntry{revoked: true, until: claims.ExpiresAt}
+	s.mu.Unlock()
+
+	return nil
+}
+
+// RevokeUserTokens rejects every token of the user issued before the given time.
+func (s *Store) RevokeUserTokens(ctx context.Context, userID int64, before time.Time) error {
+	if err := s.repo.RevokeUserTokensBefore(ctx, userID, before); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	delete(s.users, userID)
+	s.mu.Unlock()
+
+	return nil
+}
+
+// CollectGarbage removes revocations that can no longer match a valid token.
+func (s *Store) CollectGarbage(ctx context.Context) (int64, error) {
+	now := s.now()
+
+	s.mu.Lock()
+	for jti, entry := range s.tokens {
+		if !now.Before(entry.until) {
+			delete(s.tokens, jti)
+		}
+	}
+	for userID, entry := range s.users {
+		if !now.Before(entry.until) {
+			delete(s.users, userID)
+		}
+	}
+	s.mu.Unlock()
+
+	return s.repo.DeleteExpiredRevocations(ctx, now, now.Add(-s.tokenTTL))
+}
+
+// Run collects garbage every interval until ctx is cancelled.
+func (s *Store) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := s.CollectGarbage(ctx); err != nil {
+				log.Printf("revocation garbage collection failed: %v", err)
+			} else if n > 0 {
+				log.Printf("revocation garbage collection removed %d entries", n)
+			}
+		}
+	}
+}
+
+func (s *Store) userCutoff(ctx context.Context, userID int64) (time.Time, error) {
+	now := s.now()
+
+	s.mu.Lock()
+	entry, ok := s.users[userID]
+	s.mu.Unlock()
+	if ok && now.Before(entry.until) {
+		return entry.before, nil
+	}
+
+	before, err := s.repo.GetUserTokensRevokedBefore(ctx, userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	s.mu.Lock()
+	s.users[userID] = userEntry{before: before, until: now.Add(s.cacheTTL)}
+	s.mu.Unlock()
+
+	return before, nil
+}
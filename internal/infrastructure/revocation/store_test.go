@@ -0,0 +1,141 @@
+package revocation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockRepo struct {
+	mock.Mock
+}
+
+func (m *MockRepo) RevokeToken(ctx context.Context, jti string, userID int64, expiresAt time.Time) error {
+	args := m.Called(ctx, jti, userID, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockRepo) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	args := m.Called(ctx, jti)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRepo) RevokeUserTokensBefore(ctx context.Context, userID int64, before time.Time) error {
+	args := m.Called(ctx, userID, before)
+	return args.Error(0)
+}
+
+func (m *MockRepo) GetUserTokensRevokedBefore(ctx context.Context, userID int64) (time.Time, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
+func (m *MockRepo) DeleteExpiredRevocations(ctx context.Context, expiredBefore time.Time, issuedCutoffBefore time.Time) (int64, error) {
+	args := m.Called(ctx, expiredBefore, issuedCutoffBefore)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func newTestStore(repo *MockRepo, now *time.Time) *Store {
+	store := NewStore(repo, time.Minute, 15*time.Minute)
+	store.now = func() time.Time { return *now }
+	return store
+}
+
+func TestStore_RevokeTokenIsCached(t *testing.T) {
+	now := time.Now()
+	repo := new(MockRepo)
+	store := newTestStore(repo, &now)
+
+	claims := &security.Claims{UserID: 1, ID: "jti-1", IssuedAt: now, ExpiresAt: now.Add(15 * time.Minute)}
+	repo.On("GetUserTokensRevokedBefore", mock.Anything, int64(1)).Return(time.Time{}, nil)
+	repo.On("RevokeToken", mock.Anything, "jti-1", int64(1), claims.ExpiresAt).Return(nil)
+
+	assert.NoError(t, store.RevokeToken(context.Background(), claims))
+
+	revoked, err := store.IsRevoked(context.Background(), claims)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+	repo.AssertNotCalled(t, "IsTokenRevoked", mock.Anything, mock.Anything)
+}
+
+func TestStore_NegativeLookupExpires(t *testing.T) {
+	now := time.Now()
+	repo := new(MockRepo)
+	store := newTestStore(repo, &now)
+
+	claims := &security.Claims{UserID: 1, ID: "jti-1", IssuedAt: now, ExpiresAt: now.Add(15 * time.Minute)}
+	repo.On("GetUserTokensRevokedBefore", mock.Anything, int64(1)).Return(time.Time{}, nil)
+	repo.On("IsTokenRevoked", mock.Anything, "jti-1").Return(false, nil).Once()
+
+	revoked, err := store.IsRevoked(context.Background(), claims)
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	// Отзыв на другой реплике виден после истечения кеша
+	now = now.Add(2 * time.Minute)
+	repo.On("IsTokenRevoked", mock.Anything, "jti-1").Return(true, nil).Once()
+
+	revoked, err = store.IsRevoked(context.Background(), claims)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+func TestStore_UserCutoff(t *testing.T) {
+	now := time.Now()
+	repo := new(MockRepo)
+	store := newTestStore(repo, &now)
+
+	cutoff := now
+	repo.On("RevokeUserTokensBefore", mock.Anything, int64(1), cutoff).Return(nil)
+	repo.On("GetUserTokensRevokedBefore", mock.Anything, int64(1)).Return(cutoff, nil)
+	repo.On("IsTokenRevoked", mock.Anything, "new").Return(false, nil)
+
+	assert.NoError(t, store.RevokeUserTokens(context.Background(), 1, cutoff))
+
+	revoked, err := store.IsRevoked(context.Background(), &security.Claims{UserID: 1, ID: "old", IssuedAt: now.Add(-time.Minute)})
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	revoked, err = store.IsRevoked(context.Background(), &security.Claims{UserID: 1, ID: "new", IssuedAt: now.Add(time.Second)})
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+}
+
+func TestStore_UserCutoffComparesWholeSeconds(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	repo := new(MockRepo)
+	store := newTestStore(repo, &now)
+
+	cutoff := now.Add(500 * time.Millisecond)
+	repo.On("GetUserTokensRevokedBefore", mock.Anything, int64(1)).Return(cutoff, nil)
+	repo.On("IsTokenRevoked", mock.Anything, "new").Return(false, nil)
+
+	// Токен из той же секунды, что и отзыв, мог быть выпущен до него, поэтому отозван
+	revoked, err := store.IsRevoked(context.Background(), &security.Claims{UserID: 1, ID: "old", IssuedAt: now})
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	revoked, err = store.IsRevoked(context.Background(), &security.Claims{UserID: 1, ID: "new", IssuedAt: now.Add(time.Second)})
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+}
+
+func TestStore_CollectGarbage(t *testing.T) {
+	now := time.Now()
+	repo := new(MockRepo)
+	store := newTestStore(repo, &now)
+
+	store.tokens["expired"] = tokenEntry{revoked: true, until: now.Add(-time.Second)}
+	store.tokens["live"] = tokenEntry{revoked: true, until: now.Add(time.Minute)}
+	repo.On("DeleteExpiredRevocations", mock.Anything, now, now.Add(-15*time.Minute)).Return(int64(2), nil)
+
+	n, err := store.CollectGarbage(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	assert.NotContains(t, store.tokens, "expired")
+	assert.Contains(t, store.tokens, "live")
+}
@@ -0,0 +1,195 @@
+package security
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Principal types tell tokens of users from tokens a service obtained for itself
+// with the client credentials grant.
+const (
+	PrincipalUser    = "user"
+	PrincipalService = "service"
+)
+
+// Claims are the verified contents of a token. Service tokens have no UserID; their
+// subject is the OAuth client, also found in ClientID.
+type Claims struct {
+	UserID    int64
+	Principal string
+	ID        string
+	TokenType string
+	Issuer    string
+	Subject   string
+	Audience  []string
+	IssuedAt  time.Time
+	NotBefore time.Time
+	ExpiresAt time.Time
+	Authorization
+}
+
+// Authorization is what an access token grants beyond identity. Permissions travel
+// in the space separated scope claim. Tokens issued to an OAuth client also name the
+// client in client_id and carry the scopes the user granted it in scp.
+type Authorization struct {
+	Roles       []string
+	Permissions []string
+	ClientID    string
+	Scopes      []string
+}
+
+func (a Authorization) HasScope(scope string) bool {
+	return contains(a.Scopes, scope)
+}
+
+func (a Authorization) HasPermission(permission string) bool {
+	return contains(a.Permissions, permission)
+}
+
+func (c *Claims) IsService() bool {
+	return c.Principal == PrincipalService
+}
+
+func (c *Claims) HasAudience(audience string) bool {
+	for _, aud := range c.Audience {
+		if aud == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// ClaimsPolicy controls the registered claims put on issued tokens and enforced on
+// verification.
+type ClaimsPolicy struct {
+	// Issuer is written to iss. It is also trusted when TrustedIssuers is empty.
+	Issuer string
+	// Audience is written to aud on access tokens.
+	Audience []string
+	// TrustedIssuers lists accepted iss values; empty means only Issuer is accepted.
+	TrustedIssuers []string
+	// AllowedAudiences requires access tokens to carry at least one of these; empty disables the check.
+	AllowedAudiences []string
+	// Leeway tolerates clock skew between this service and whoever checks exp, nbf and iat.
+	Leeway time.Duration
+}
+
+func (p ClaimsPolicy) trustedIssuers() []string {
+	if len(p.TrustedIssuers) > 0 {
+		return p.TrustedIssuers
+	}
+	if p.Issuer != "" {
+		return []string{p.Issuer}
+	}
+	return nil
+}
+
+// validate checks time based claims and, when strict, issuer and audience. Refresh
+// tokens are not strict so sessions started before iss/aud were issued survive.
+func (p ClaimsPolicy) validate(c *Claims, now time.Time, strict bool) error {
+	if !c.ExpiresAt.IsZero() && now.After(c.ExpiresAt.Add(p.Leeway)) {
+		return fmt.Errorf("token is expired")
+	}
+	if !c.NotBefore.IsZero() && now.Add(p.Leeway).Before(c.NotBefore) {
+		return fmt.Errorf("token is not valid yet")
+	}
+	if !c.IssuedAt.IsZero() && now.Add(p.Leeway).Before(c.IssuedAt) {
+		return fmt.Errorf("token used before issued")
+	}
+
+	if issuers := p.trustedIssuers(); len(issuers) > 0 && (strict || c.Issuer != "") {
+		if !contains(issuers, c.Issuer) {
+			return fmt.Errorf("untrusted issuer: %q", c.Issuer)
+		}
+	}
+
+	if len(p.AllowedAudiences) > 0 && strict {
+		allowed := false
+		for _, aud := range c.Audience {
+			if contains(p.AllowedAudiences, aud) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("token audience %v is not allowed", c.Audience)
+		}
+	}
+
+	return nil
+}
+
+func claimsFromMap(m jwt.MapClaims) (*Claims, error) {
+	c := &Claims{
+		IssuedAt:  numericDate(m["iat"]),
+		NotBefore: numericDate(m["nbf"]),
+		ExpiresAt: numericDate(m["exp"]),
+	}
+	c.ID, _ = m["jti"].(string)
+	c.TokenType, _ = m["token_type"].(string)
+	c.Issuer, _ = m["iss"].(string)
+	c.Subject, _ = m["sub"].(string)
+
+	c.Roles = stringList(m["roles"])
+	if scope, ok := m["scope"].(string); ok && scope != "" {
+		c.Permissions = strings.Fields(scope)
+	}
+	c.ClientID, _ = m["client_id"].(string)
+	if scp, ok := m["scp"].(string); ok && scp != "" {
+		c.Scopes = strings.Fields(scp)
+	}
+
+	switch aud := m["aud"].(type) {
+	case string:
+		c.Audience = []string{aud}
+	case []interface{}:
+		c.Audience = stringList(aud)
+	}
+
+	userIDFloat, ok := m["user_id"].(float64)
+	switch {
+	case ok:
+		c.UserID = int64(userIDFloat)
+		c.Principal = PrincipalUser
+		if c.Subject != "" && c.Subject != strconv.FormatInt(c.UserID, 10) {
+			return nil, fmt.Errorf("sub does not match user_id")
+		}
+	case c.ClientID != "" && c.Subject == c.ClientID:
+		c.Principal = PrincipalService
+	default:
+		return nil, fmt.Errorf("user_id not found in token")
+	}
+
+	return c, nil
+}
+
+func stringList(v interface{}) []string {
+	items, _ := v.([]interface{})
+	var list []string
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+func numericDate(v interface{}) time.Time {
+	if f, ok := v.(float64); ok {
+		return time.Unix(int64(f), 0)
+	}
+	return time.Time{}
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package security
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJWTManager_RegisteredClaims(t *testing.T) {
+	policy := ClaimsPolicy{
+		Issuer:           "https://auth.example.com",
+		Audience:         []string{"chat"},
+		AllowedAudiences: []string{"chat"},
+		Leeway:           30 * time.Second,
+	}
+	jwtManager := NewJWTManager("access", "refresh", time.Minute, time.Hour).WithClaimsPolicy(policy)
+
+	token, err := jwtManager.GenerateAccessToken(42, Authorization{})
+	assert.NoError(t, err)
+
+	claims, err := jwtManager.ParseAccessToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://auth.example.com", claims.Issuer)
+	assert.Equal(t, "42", claims.Subject)
+	assert.Equal(t, []string{"chat"}, claims.Audience)
+	assert.True(t, claims.HasAudience("chat"))
+	assert.False(t, claims.NotBefore.IsZero())
+
+	t.Run("Other audience is rejected", func(t *testing.T) {
+		billing := NewJWTManager("access", "refresh", time.Minute, time.Hour).WithClaimsPolicy(ClaimsPolicy{
+			Issuer:           "https://auth.example.com",
+			AllowedAudiences: []string{"billing"},
+		})
+		_, err := billing.ParseAccessToken(token)
+		assert.Error(t, err)
+	})
+
+	t.Run("Untrusted issuer is rejected", func(t *testing.T) {
+		other := NewJWTManager("access", "refresh", time.Minute, time.Hour).WithClaimsPolicy(ClaimsPolicy{
+			TrustedIssuers: []string{"https://other.example.com"},
+		})
+		_, err := other.ParseAccessToken(token)
+		assert.Error(t, err)
+	})
+
+	t.Run("Leeway tolerates clock skew", func(t *testing.T) {
+		verifier := NewJWTManager("access", "refresh", time.Minute, time.Hour).WithClaimsPolicy(policy)
+
+		verifier.now = func() time.Time { return time.Now().Add(time.Minute + 10*time.Second) }
+		_, err := verifier.ParseAccessToken(token)
+		assert.NoError(t, err, "expired 10s ago but within 30s leeway")
+
+		verifier.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+		_, err = verifier.ParseAccessToken(token)
+		assert.Error(t, err)
+
+		verifier.now = func() time.Time { return time.Now().Add(-time.Minute) }
+		_, err = verifier.ParseAccessToken(token)
+		assert.Error(t, err, "not valid before nbf minus leeway")
+	})
+}
+
+func TestJWTManager_RefreshTokensWithoutIssuerStayValid(t *testing.T) {
+	legacy := NewJWTManager("access", "refresh", time.Minute, time.Hour)
+	token, err := legacy.GenerateRefreshToken(42)
+	assert.NoError(t, err)
+
+	upgraded := NewJWTManager("access", "refresh", time.Minute, time.Hour).WithClaimsPolicy(ClaimsPolicy{
+		Issuer:           "https://auth.example.com",
+		AllowedAudiences: []string{"chat"},
+	})
+
+	id, err := upgraded.VerifyRefreshToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), id)
+
+	access, err := legacy.GenerateAccessToken(42, Authorization{})
+	assert.NoError(t, err)
+	_, err = upgraded.VerifyAccessToken(access)
+	assert.Error(t, err, "access tokens are checked strictly")
+}
+
+func TestJWTManager_MultipleAudiences(t *testing.T) {
+	jwtManager := NewJWTManager("access", "refresh", time.Minute, time.Hour).WithClaimsPolicy(ClaimsPolicy{
+		Audience:         []string{"chat", "admin"},
+		AllowedAudiences: []string{"admin"},
+	})
+
+	token, err := jwtManager.GenerateAccessToken(1, Authorization{})
+	assert.NoError(t, err)
+
+	claims, err := jwtManager.ParseAccessToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"chat", "admin"}, claims.Audience)
+}
+
+func TestJWTManager_AuthorizationClaims(t *testing.T) {
+	jwtManager := NewJWTManager("access", "refresh", time.Minute, time.Hour)
+
+	token, err := jwtManager.GenerateAccessToken(1, Authorization{
+		Roles:       []string{"admin"},
+		Permissions: []string{"roles:manage", "tokens:revoke"},
+	})
+	assert.NoError(t, err)
+
+	claims, err := jwtManager.ParseAccessToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"admin"}, claims.Roles)
+	assert.True(t, claims.HasPermission("tokens:revoke"))
+	assert.False(t, claims.HasPermission("users:manage"))
+}
@@ -1,95 +1,291 @@
 package security
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"github.com/dgrijalva/jwt-go"
+	"strconv"
+	"strings"
 	"time"
 )
 
+const (
+	tokenTypeAccess  = "access"
+	tokenTypeRefresh = "refresh"
+	tokenTypeID      = "id"
+)
+
 type JWTManager struct {
-	accessSecret  string
-	refreshSecret string
-	accessTTL     time.Duration
-	refreshTTL    time.Duration
+	accessKeys  *KeyRing
+	refreshKeys *KeyRing
+	accessTTL   time.Duration
+	refreshTTL  time.Duration
+	policy      ClaimsPolicy
+	now         func() time.Time
 }
 
 func NewJWTManager(accessSecret, refreshSecret string, accessTTL, refreshTTL time.Duration) *JWTManager {
-	return &JWTManager{accessSecret, refreshSecret, accessTTL, refreshTTL}
+	return &JWTManager{
+		accessKeys:  NewKeyRing(NewHMACKey("", accessSecret), accessTTL),
+		refreshKeys: NewKeyRing(NewHMACKey("", refreshSecret), refreshTTL),
+		accessTTL:   accessTTL,
+		refreshTTL:  refreshTTL,
+		now:         time.Now,
+	}
+}
+
+// NewJWTManagerWithKey signs both token types with one key; the token_type claim keeps
+// a refresh token from being accepted as an access token.
+func NewJWTManagerWithKey(key *SigningKey, accessTTL, refreshTTL time.Duration) *JWTManager {
+	return NewJWTManagerWithKeyRing(NewKeyRing(key, refreshTTL), accessTTL, refreshTTL)
+}
+
+// NewJWTManagerWithKeyRing signs both token types with the ring's active key. The ring's
+// grace period should be at least refreshTTL so rotation does not end sessions early.
+func NewJWTManagerWithKeyRing(ring *KeyRing, accessTTL, refreshTTL time.Duration) *JWTManager {
+	return &JWTManager{
+		accessKeys:  ring,
+		refreshKeys: ring,
+		accessTTL:   accessTTL,
+		refreshTTL:  refreshTTL,
+		now:         time.Now,
+	}
+}
+
+// WithClaimsPolicy sets the issuer, audience and leeway rules. It returns j so it can
+// be chained onto a constructor.
+func (j *JWTManager) WithClaimsPolicy(policy ClaimsPolicy) *JWTManager {
+	j.policy = policy
+	return j
 }
 
 func (j *JWTManager) VerifyRefreshToken(token string) (int64, error) {
-	parsed, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(j.refreshSecret), nil
-	})
+	claims, err := j.ParseRefreshToken(token)
+	if err != nil {
+		return 0, err
+	}
+	return claims.UserID, nil
+}
 
+func (j *JWTManager) VerifyAccessToken(token string) (int64, error) {
+	claims, err := j.ParseAccessToken(token)
 	if err != nil {
 		return 0, err
 	}
+	return claims.UserID, nil
+}
 
-	if !parsed.Valid {
-		return 0, fmt.Errorf("invalid token")
+func (j *JWTManager) ParseRefreshToken(token string) (*Claims, error) {
+	return j.verify(token, j.refreshKeys, tokenTypeRefresh)
+}
+
+func (j *JWTManager) ParseAccessToken(token string) (*Claims, error) {
+	return j.verify(token, j.accessKeys, tokenTypeAccess)
+}
+
+func (j *JWTManager) GenerateAccessToken(userID int64, authz Authorization) (string, error) {
+	token, _, err := j.generate(userID, authz, j.accessKeys, tokenTypeAccess, j.accessTTL)
+	return token, err
+}
+
+func (j *JWTManager) GenerateRefreshToken(userID int64) (string, error) {
+	token, _, err := j.generate(userID, Authorization{}, j.refreshKeys, tokenTypeRefresh, j.refreshTTL)
+	return token, err
+}
+
+// GenerateActionToken issues a short lived token that only ParseActionToken with the
+// same purpose accepts, e.g. for email verification links. The returned claims carry
+// the jti so the caller can make the token single-use.
+func (j *JWTManager) GenerateActionToken(userID int64, purpose string, ttl time.Duration) (string, *Claims, error) {
+	if purpose == "" || purpose == tokenTypeAccess || purpose == tokenTypeRefresh || purpose == tokenTypeID {
+		return "", nil, fmt.Errorf("invalid action token purpose %q", purpose)
 	}
+	return j.generate(userID, Authorization{}, j.accessKeys, purpose, ttl)
+}
 
-	claims, ok := parsed.Claims.(jwt.MapClaims)
-	if !ok {
-		return 0, fmt.Errorf("invalid claims type")
+// ParseActionToken rejects tokens issued for any other purpose. The token_type claim
+// is mandatory here, unlike for legacy access and refresh tokens.
+func (j *JWTManager) ParseActionToken(token, purpose string) (*Claims, error) {
+	claims, err := j.verify(token, j.accessKeys, purpose)
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenType != purpose {
+		return nil, fmt.Errorf("unexpected token type: %q", claims.TokenType)
 	}
+	return claims, nil
+}
 
-	userIDFloat, ok := claims["user_id"].(float64)
-	if !ok {
-		return 0, fmt.Errorf("user_id not found in token")
+// GenerateServiceToken issues an access token to an OAuth client acting on its own
+// behalf. Its subject is the client, it carries no user_id and only the given scopes.
+func (j *JWTManager) GenerateServiceToken(clientID string, scopes []string) (string, error) {
+	token, _, err := j.generate(0, Authorization{ClientID: clientID, Scopes: scopes}, j.accessKeys, tokenTypeAccess, j.accessTTL)
+	return token, err
+}
+
+// GenerateIDToken issues an OpenID Connect ID token for the client with the access
+// token keys, so relying parties verify it against the JWKS. It has no user_id claim
+// and its own token_type, which keeps it from being accepted as an access token.
+// Claims such as nonce and email are added to the registered ones.
+func (j *JWTManager) GenerateIDToken(userID int64, clientID string, claims map[string]interface{}) (string, error) {
+	key := j.accessKeys.Active()
+	now := j.now()
+
+	mapClaims := jwt.MapClaims{}
+	for name, value := range claims {
+		mapClaims[name] = value
+	}
+	mapClaims["sub"] = strconv.FormatInt(userID, 10)
+	mapClaims["aud"] = clientID
+	mapClaims["azp"] = clientID
+	mapClaims["token_type"] = tokenTypeID
+	mapClaims["iat"] = now.Unix()
+	mapClaims["exp"] = now.Add(j.accessTTL).Unix()
+	if j.policy.Issuer != "" {
+		mapClaims["iss"] = j.policy.Issuer
 	}
 
-	return int64(userIDFloat), nil
+	token := jwt.NewWithClaims(key.Method, mapClaims)
+	if key.Kid != "" {
+		token.Header["kid"] = key.Kid
+	}
+	return token.SignedString(key.signKey)
 }
 
-func (j *JWTManager) VerifyAccessToken(token string) (int64, error) {
-	parsed, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+// KeyRing exposes the access token keys so they can be rotated or reloaded at runtime.
+func (j *JWTManager) KeyRing() *KeyRing {
+	return j.accessKeys
+}
+
+// JWKS lists the public keys that may have signed a live access token. It is empty in HS256 mode.
+func (j *JWTManager) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range j.accessKeys.Keys() {
+		if jwk, ok := NewJWK(key); ok {
+			set.Keys = append(set.Keys, jwk)
+		}
+	}
+	return set
+}
+
+func (j *JWTManager) verify(token string, keys *KeyRing, tokenType string) (*Claims, error) {
+	// Time based claims are checked by ClaimsPolicy so the configured leeway applies.
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	parsed, err := parser.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keys.Lookup(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key: %q", kid)
+		}
+		if token.Method.Alg() != key.Method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(j.accessSecret), nil
+		return key.verifyKey, nil
 	})
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
 	if !parsed.Valid {
-		return 0, fmt.Errorf("invalid token")
+		return nil, fmt.Errorf("invalid token")
 	}
 
-	claims, ok := parsed.Claims.(jwt.MapClaims)
+	mapClaims, ok := parsed.Claims.(jwt.MapClaims)
 	if !ok {
-		return 0, fmt.Errorf("invalid claims type")
+		return nil, fmt.Errorf("invalid claims type")
 	}
 
-	userIDFloat, ok := claims["user_id"].(float64)
-	if !ok {
-		return 0, fmt.Errorf("user_id not found in token")
+	if typ, ok := mapClaims["token_type"]; ok && typ != tokenType {
+		return nil, fmt.Errorf("unexpected token type: %v", typ)
 	}
 
-	return int64(userIDFloat), nil
-}
+	claims, err := claimsFromMap(mapClaims)
+	if err != nil {
+		return nil, err
+	}
 
-func (j *JWTManager) GenerateAccessToken(userID int64) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(j.accessTTL).Unix(),
+	if err := j.policy.validate(claims, j.now(), tokenType == tokenTypeAccess); err != nil {
+		return nil, err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(j.accessSecret))
+	return claims, nil
 }
 
-func (j *JWTManager) GenerateRefreshToken(userID int64) (string, error) {
+func (j *JWTManager) generate(userID int64, authz Authorization, keys *KeyRing, tokenType string, ttl time.Duration) (string, *Claims, error) {
+	key := keys.Active()
+	jti, err := newTokenID()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := j.now()
 	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(j.refreshTTL).Unix(),
+		"token_type": tokenType,
+		"jti":        jti,
+		"iat":        now.Unix(),
+		"nbf":        now.Unix(),
+		"exp":        now.Add(ttl).Unix(),
+	}
+	principal, subject := PrincipalUser, strconv.FormatInt(userID, 10)
+	if userID == 0 && authz.ClientID != "" {
+		principal, subject = PrincipalService, authz.ClientID
+	} else {
+		claims["user_id"] = userID
+	}
+	claims["sub"] = subject
+	if j.policy.Issuer != "" {
+		claims["iss"] = j.policy.Issuer
+	}
+	if len(authz.Roles) > 0 {
+		claims["roles"] = authz.Roles
+	}
+	if len(authz.Permissions) > 0 {
+		claims["scope"] = strings.Join(authz.Permissions, " ")
+	}
+	if authz.ClientID != "" {
+		claims["client_id"] = authz.ClientID
+	}
+	if len(authz.Scopes) > 0 {
+		claims["scp"] = strings.Join(authz.Scopes, " ")
+	}
+	if tokenType == tokenTypeAccess {
+		switch len(j.policy.Audience) {
+		case 0:
+		case 1:
+			claims["aud"] = j.policy.Audience[0]
+		default:
+			claims["aud"] = j.policy.Audience
+		}
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(j.refreshSecret))
+	token := jwt.NewWithClaims(key.Method, claims)
+	if key.Kid != "" {
+		token.Header["kid"] = key.Kid
+	}
+	signed, err := token.SignedString(key.signKey)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return signed, &Claims{
+		UserID:        userID,
+		Principal:     principal,
+		ID:            jti,
+		TokenType:     tokenType,
+		Issuer:        j.policy.Issuer,
+		Subject:       subject,
+		IssuedAt:      time.Unix(now.Unix(), 0),
+		NotBefore:     time.Unix(now.Unix(), 0),
+		ExpiresAt:     time.Unix(now.Add(ttl).Unix(), 0),
+		Authorization: authz,
+	}, nil
+}
+
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
 }
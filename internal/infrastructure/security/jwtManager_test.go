@@ -1,9 +1,17 @@
 package security
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"testing"
 	"time"
 
+	"github.com/dgrijalva/jwt-go"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -17,7 +25,7 @@ func TestJWTManager(t *testing.T) {
 	userID := int64(42)
 
 	t.Run("Generate and verify access token", func(t *testing.T) {
-		token, err := jwtManager.GenerateAccessToken(userID)
+		token, err := jwtManager.GenerateAccessToken(userID, Authorization{})
 		assert.NoError(t, err)
 		assert.NotEmpty(t, token)
 
@@ -49,10 +57,225 @@ func TestJWTManager(t *testing.T) {
 	t.Run("Verify token with wrong secret", func(t *testing.T) {
 		wrongJWT := NewJWTManager("wrong-access", "wrong-refresh", accessTTL, refreshTTL)
 
-		token, err := jwtManager.GenerateAccessToken(userID)
+		token, err := jwtManager.GenerateAccessToken(userID, Authorization{})
 		assert.NoError(t, err)
 
 		_, err = wrongJWT.VerifyAccessToken(token)
 		assert.Error(t, err)
 	})
 }
+
+func TestJWTManager_AsymmetricKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	cases := map[string]interface{}{
+		AlgorithmRS256: rsaKey,
+		AlgorithmES256: ecKey,
+		AlgorithmEdDSA: edKey,
+	}
+
+	for alg, privateKey := range cases {
+		t.Run(alg, func(t *testing.T) {
+			key, err := NewAsymmetricKey("", privateKey, alg)
+			assert.NoError(t, err)
+			assert.NotEmpty(t, key.Kid)
+
+			jwtManager := NewJWTManagerWithKey(key, time.Hour, 24*time.Hour)
+
+			token, err := jwtManager.GenerateAccessToken(42, Authorization{})
+			assert.NoError(t, err)
+
+			id, err := jwtManager.VerifyAccessToken(token)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(42), id)
+
+			_, err = jwtManager.VerifyRefreshToken(token)
+			assert.Error(t, err, "access token must not be accepted as refresh token")
+
+			jwks := jwtManager.JWKS()
+			assert.Len(t, jwks.Keys, 1)
+			assert.Equal(t, alg, jwks.Keys[0].Alg)
+			assert.Equal(t, key.Kid, jwks.Keys[0].Kid)
+			assert.Equal(t, key.Kid, jwks.Keys[0].Thumbprint())
+
+			// Опубликованный ключ декодируется обратно в тот же публичный ключ
+			publicKey, err := jwks.Keys[0].PublicKey()
+			assert.NoError(t, err)
+			assert.Equal(t, key.PublicKey(), publicKey)
+		})
+	}
+
+	t.Run("Algorithm mismatch", func(t *testing.T) {
+		_, err := NewAsymmetricKey("", ecKey, AlgorithmRS256)
+		assert.Error(t, err)
+	})
+
+	t.Run("HS256 token rejected by asymmetric manager", func(t *testing.T) {
+		key, err := NewAsymmetricKey("", rsaKey, AlgorithmRS256)
+		assert.NoError(t, err)
+
+		token, err := NewJWTManager("secret", "secret", time.Hour, time.Hour).GenerateAccessToken(1, Authorization{})
+		assert.NoError(t, err)
+
+		_, err = NewJWTManagerWithKey(key, time.Hour, time.Hour).VerifyAccessToken(token)
+		assert.Error(t, err)
+	})
+}
+
+func TestJWTManager_HMACHasNoJWKS(t *testing.T) {
+	jwtManager := NewJWTManager("access", "refresh", time.Hour, time.Hour)
+	assert.Empty(t, jwtManager.JWKS().Keys)
+}
+
+func mustGenerateECPEM(t *testing.T) []byte {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	assert.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func TestParsePrivateKeyPEM(t *testing.T) {
+	key, err := ParsePrivateKeyPEM("kid-1", mustGenerateECPEM(t), "")
+	assert.NoError(t, err)
+	assert.Equal(t, "kid-1", key.Kid)
+	assert.Equal(t, AlgorithmES256, key.Method.Alg())
+
+	_, err = ParsePrivateKeyPEM("", []byte("not a pem"), "")
+	assert.Error(t, err)
+}
+
+func TestJWTManager_RefreshTokensAreUnique(t *testing.T) {
+	jwtManager := NewJWTManager("access", "refresh", time.Hour, time.Hour)
+
+	first, err := jwtManager.GenerateRefreshToken(1)
+	assert.NoError(t, err)
+	second, err := jwtManager.GenerateRefreshToken(1)
+	assert.NoError(t, err)
+
+	assert.NotEqual(t, first, second)
+}
+
+func TestTokenHasher(t *testing.T) {
+	hasher := NewTokenHasher("pepper")
+
+	assert.Equal(t, hasher.Hash("token"), hasher.Hash("token"))
+	assert.Len(t, hasher.Hash("token"), 64)
+	assert.NotEqual(t, hasher.Hash("token"), NewTokenHasher("other").Hash("token"))
+	assert.NotContains(t, hasher.Hash("token"), "token")
+}
+
+func TestJWTManager_ParseAccessToken(t *testing.T) {
+	jwtManager := NewJWTManager("access", "refresh", time.Hour, time.Hour)
+
+	first, err := jwtManager.GenerateAccessToken(42, Authorization{})
+	assert.NoError(t, err)
+	second, err := jwtManager.GenerateAccessToken(42, Authorization{})
+	assert.NoError(t, err)
+
+	firstClaims, err := jwtManager.ParseAccessToken(first)
+	assert.NoError(t, err)
+	secondClaims, err := jwtManager.ParseAccessToken(second)
+	assert.NoError(t, err)
+
+	assert.Equal(t, int64(42), firstClaims.UserID)
+	assert.NotEmpty(t, firstClaims.ID)
+	assert.NotEqual(t, firstClaims.ID, secondClaims.ID)
+	assert.WithinDuration(t, time.Now(), firstClaims.IssuedAt, 2*time.Second)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), firstClaims.ExpiresAt, 2*time.Second)
+}
+
+func TestJWTManager_ActionToken(t *testing.T) {
+	jwtManager := NewJWTManager("access", "refresh", time.Minute, time.Hour)
+
+	token, issued, err := jwtManager.GenerateActionToken(1, "email_verification", time.Hour)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, issued.ID)
+
+	claims, err := jwtManager.ParseActionToken(token, "email_verification")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), claims.UserID)
+	assert.Equal(t, issued.ID, claims.ID)
+
+	// Токен для другой цели и как access токен не принимается
+	_, err = jwtManager.ParseActionToken(token, "password_reset")
+	assert.Error(t, err)
+	_, err = jwtManager.ParseAccessToken(token)
+	assert.Error(t, err)
+
+	access, err := jwtManager.GenerateAccessToken(1, Authorization{})
+	assert.NoError(t, err)
+	_, err = jwtManager.ParseActionToken(access, "email_verification")
+	assert.Error(t, err)
+
+	_, _, err = jwtManager.GenerateActionToken(1, "access", time.Hour)
+	assert.Error(t, err)
+}
+
+func TestJWTManager_ClientAuthorization(t *testing.T) {
+	jwtManager := NewJWTManager("access", "refresh", time.Minute, time.Hour)
+
+	token, err := jwtManager.GenerateAccessToken(1, Authorization{
+		Permissions: []string{"tokens:revoke"},
+		ClientID:    "grafana",
+		Scopes:      []string{"openid", "email"},
+	})
+	assert.NoError(t, err)
+
+	// Права пользователя и scope клиента не смешиваются
+	claims, err := jwtManager.ParseAccessToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tokens:revoke"}, claims.Permissions)
+	assert.Equal(t, "grafana", claims.ClientID)
+	assert.True(t, claims.HasScope("openid"))
+	assert.False(t, claims.HasPermission("openid"))
+}
+
+func TestJWTManager_IDToken(t *testing.T) {
+	jwtManager := NewJWTManager("access", "refresh", time.Minute, time.Hour).
+		WithClaimsPolicy(ClaimsPolicy{Issuer: "https://auth.example.com"})
+	key := jwtManager.KeyRing().Active()
+
+	token, err := jwtManager.GenerateIDToken(42, "grafana", map[string]interface{}{"nonce": "n-1", "aud": "other"})
+	assert.NoError(t, err)
+
+	parsed, err := jwt.Parse(token, func(*jwt.Token) (interface{}, error) { return key.verifyKey, nil })
+	assert.NoError(t, err)
+	claims := parsed.Claims.(jwt.MapClaims)
+	assert.Equal(t, "42", claims["sub"])
+	assert.Equal(t, "grafana", claims["aud"])
+	assert.Equal(t, "n-1", claims["nonce"])
+	assert.Equal(t, "https://auth.example.com", claims["iss"])
+
+	// ID токен не принимается как access токен
+	_, err = jwtManager.ParseAccessToken(token)
+	assert.Error(t, err)
+}
+
+func TestJWTManager_ServiceToken(t *testing.T) {
+	jwtManager := NewJWTManager("access", "refresh", time.Minute, time.Hour)
+
+	token, err := jwtManager.GenerateServiceToken("billing", []string{"messages:read"})
+	assert.NoError(t, err)
+
+	// Токен сервиса: sub = клиент, без user_id
+	claims, err := jwtManager.ParseAccessToken(token)
+	assert.NoError(t, err)
+	assert.True(t, claims.IsService())
+	assert.Equal(t, int64(0), claims.UserID)
+	assert.Equal(t, "billing", claims.Subject)
+	assert.Equal(t, []string{"messages:read"}, claims.Scopes)
+
+	user, err := jwtManager.GenerateAccessToken(1, Authorization{ClientID: "billing"})
+	assert.NoError(t, err)
+	claims, err = jwtManager.ParseAccessToken(user)
+	assert.NoError(t, err)
+	assert.Equal(t, PrincipalUser, claims.Principal)
+	assert.Equal(t, int64(1), claims.UserID)
+}
@@ -0,0 +1,147 @@
+package security
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// KeyRing holds the active signing key together with keys that were rotated out.
+// Retired keys keep verifying tokens and stay in the JWKS until the grace period
+// after their retirement has passed, so rotation never invalidates live sessions.
+type KeyRing struct {
+	mu          sync.RWMutex
+	active      string
+	keys        map[string]*ringKey
+	gracePeriod time.Duration
+	now         func() time.Time
+}
+
+type ringKey struct {
+	key       *SigningKey
+	retiredAt time.Time
+}
+
+// RetiredKey is a verification-only key loaded from config together with the time it was rotated out.
+type RetiredKey struct {
+	Key       *SigningKey
+	RetiredAt time.Time
+}
+
+func NewKeyRing(active *SigningKey, gracePeriod time.Duration) *KeyRing {
+	return &KeyRing{
+		active:      active.Kid,
+		keys:        map[string]*ringKey{active.Kid: {key: active}},
+		gracePeriod: gracePeriod,
+		now:         time.Now,
+	}
+}
+
+// Active returns the key new tokens are signed with.
+func (r *KeyRing) Active() *SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.keys[r.active].key
+}
+
+// Lookup returns the key for kid if it is active or still inside its grace period.
+func (r *KeyRing) Lookup(kid string) (*SigningKey, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	k, ok := r.keys[kid]
+	if !ok || r.expired(k) {
+		return nil, false
+	}
+	return k.key, true
+}
+
+// Keys returns every key that may still verify tokens, active key first.
+func (r *KeyRing) Keys() []*SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	retired := make([]*ringKey, 0, len(r.keys))
+	for kid, k := range r.keys {
+		if kid != r.active && !r.expired(k) {
+			retired = append(retired, k)
+		}
+	}
+	sort.Slice(retired, func(i, j int) bool {
+		return retired[i].retiredAt.After(retired[j].retiredAt)
+	})
+
+	keys := []*SigningKey{r.keys[r.active].key}
+	for _, k := range retired {
+		keys = append(keys, k.key)
+	}
+	return keys
+}
+
+// Rotate makes key the active signing key and retires the previous one.
+func (r *KeyRing) Rotate(key *SigningKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if key.Kid == r.active {
+		return fmt.Errorf("key %q is already active", key.Kid)
+	}
+
+	r.retire(r.active)
+	r.keys[key.Kid] = &ringKey{key: key}
+	r.active = key.Kid
+	r.prune()
+	return nil
+}
+
+// Load replaces the ring contents with a freshly read configuration. Keys that
+// disappear from the configuration or lose their active status are retired now
+// rather than dropped, so a config reload behaves like Rotate.
+func (r *KeyRing) Load(active *SigningKey, retired []RetiredKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	next := make(map[string]*ringKey, len(retired)+1)
+	for kid, k := range r.keys {
+		if k.retiredAt.IsZero() && kid != active.Kid {
+			k.retiredAt = now
+		}
+		next[kid] = k
+	}
+	for _, k := range retired {
+		retiredAt := k.RetiredAt
+		if existing, ok := next[k.Key.Kid]; ok && !existing.retiredAt.IsZero() && (retiredAt.IsZero() || existing.retiredAt.Before(retiredAt)) {
+			retiredAt = existing.retiredAt
+		}
+		if retiredAt.IsZero() {
+			retiredAt = now
+		}
+		next[k.Key.Kid] = &ringKey{key: k.Key, retiredAt: retiredAt}
+	}
+	next[active.Kid] = &ringKey{key: active}
+
+	r.keys = next
+	r.active = active.Kid
+	r.prune()
+}
+
+func (r *KeyRing) retire(kid string) {
+	if k, ok := r.keys[kid]; ok && k.retiredAt.IsZero() {
+		k.retiredAt = r.now()
+	}
+}
+
+func (r *KeyRing) prune() {
+	for kid, k := range r.keys {
+		if r.expired(k) {
+			delete(r.keys, kid)
+		}
+	}
+}
+
+func (r *KeyRing) expired(k *ringKey) bool {
+	return !k.retiredAt.IsZero() && r.now().After(k.retiredAt.Add(r.gracePeriod))
+}
@@ -0,0 +1,82 @@
+package security
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyRing_Rotate(t *testing.T) {
+	now := time.Now()
+	ring := NewKeyRing(NewHMACKey("k1", "secret-1"), time.Hour)
+	ring.now = func() time.Time { return now }
+
+	jwtManager := NewJWTManagerWithKeyRing(ring, time.Minute, time.Hour)
+
+	oldToken, err := jwtManager.GenerateAccessToken(7, Authorization{})
+	assert.NoError(t, err)
+
+	assert.NoError(t, ring.Rotate(NewHMACKey("k2", "secret-2")))
+	assert.Equal(t, "k2", ring.Active().Kid)
+	assert.Error(t, ring.Rotate(NewHMACKey("k2", "secret-2")))
+
+	t.Run("Retired key still verifies inside grace period", func(t *testing.T) {
+		id, err := jwtManager.VerifyAccessToken(oldToken)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), id)
+	})
+
+	t.Run("New tokens are signed with the active key", func(t *testing.T) {
+		token, err := jwtManager.GenerateAccessToken(7, Authorization{})
+		assert.NoError(t, err)
+
+		_, err = NewJWTManagerWithKeyRing(NewKeyRing(NewHMACKey("k2", "secret-2"), time.Hour), time.Minute, time.Hour).VerifyAccessToken(token)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Retired key ages out after grace period", func(t *testing.T) {
+		now = now.Add(2 * time.Hour)
+
+		_, ok := ring.Lookup("k1")
+		assert.False(t, ok)
+		assert.Len(t, ring.Keys(), 1)
+	})
+}
+
+func TestKeyRing_Load(t *testing.T) {
+	now := time.Now()
+	ring := NewKeyRing(NewHMACKey("k1", "secret-1"), time.Hour)
+	ring.now = func() time.Time { return now }
+
+	ring.Load(NewHMACKey("k2", "secret-2"), []RetiredKey{
+		{Key: NewHMACKey("k0", "secret-0"), RetiredAt: now.Add(-2 * time.Hour)},
+	})
+
+	assert.Equal(t, "k2", ring.Active().Kid)
+
+	_, ok := ring.Lookup("k1")
+	assert.True(t, ok, "previously active key is retired, not dropped")
+
+	_, ok = ring.Lookup("k0")
+	assert.False(t, ok, "key retired before the grace period is not loaded")
+
+	keys := ring.Keys()
+	assert.Len(t, keys, 2)
+	assert.Equal(t, "k2", keys[0].Kid)
+}
+
+func TestJWTManager_JWKSIncludesRetiredKeys(t *testing.T) {
+	first, err := ParsePrivateKeyPEM("k1", mustGenerateECPEM(t), "")
+	assert.NoError(t, err)
+	second, err := ParsePrivateKeyPEM("k2", mustGenerateECPEM(t), "")
+	assert.NoError(t, err)
+
+	jwtManager := NewJWTManagerWithKey(first, time.Minute, time.Hour)
+	assert.NoError(t, jwtManager.KeyRing().Rotate(second))
+
+	jwks := jwtManager.JWKS()
+	assert.Len(t, jwks.Keys, 2)
+	assert.Equal(t, "k2", jwks.Keys[0].Kid)
+	assert.Equal(t, "k1", jwks.Keys[1].Kid)
+}
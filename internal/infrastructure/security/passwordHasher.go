@@ -0,0 +1,278 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+var (
+	ErrUnsupportedHash = errors.New("unsupported password hash")
+	// ErrUnknownPepper means the hash was keyed with a pepper that is no longer configured.
+	ErrUnknownPepper = errors.New("password hash uses an unknown pepper")
+)
+
+// PasswordHasher hashes new passwords with one algorithm and verifies hashes of
+// every supported algorithm, so stored hashes can be upgraded on the next login.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify checks password against encoded and reports whether encoded should be
+	// replaced by a fresh Hash because its algorithm, parameters or pepper are outdated.
+	Verify(password, encoded string) (ok bool, rehash bool, err error)
+}
+
+// Argon2Params are the argon2id cost parameters; Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params follow the OWASP recommendation for argon2id.
+var DefaultArgon2Params = Argon2Params{Memory: 64 * 1024, Iterations: 3, Parallelism: 2, SaltLength: 16, KeyLength: 32}
+
+// Argon2idHasher stores hashes in the PHC string format,
+// $argon2id$v=19$m=65536,t=3,p=2[,keyid=...]$salt$hash.
+type Argon2idHasher struct {
+	params Argon2Params
+	pepper *pepper
+}
+
+func NewArgon2idHasher(params Argon2Params, pepperKey string) *Argon2idHasher {
+	return &Argon2idHasher{params: params, pepper: newPepper(pepperKey)}
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	sum := argon2.IDKey(h.pepper.apply(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, h.params.KeyLength)
+
+	params := fmt.Sprintf("m=%d,t=%d,p=%d", h.params.Memory, h.params.Iterations, h.params.Parallelism)
+	if h.pepper != nil {
+		params += ",keyid=" + h.pepper.id
+	}
+	return fmt.Sprintf("$%s$v=%d$%s$%s$%s", AlgorithmArgon2id, argon2.Version, params,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(sum)), nil
+}
+
+func (h *Argon2idHasher) Verify(password, encoded string) (bool, bool, error) {
+	decoded, err := parsePasswordHash(encoded)
+	if err != nil {
+		return false, false, err
+	}
+	ok, err := decoded.verify(password, h.pepper)
+	if err != nil || !ok {
+		return false, false, err
+	}
+
+	current := decoded.algorithm == AlgorithmArgon2id &&
+		decoded.argon2.Memory == h.params.Memory &&
+		decoded.argon2.Iterations == h.params.Iterations &&
+		decoded.argon2.Parallelism == h.params.Parallelism &&
+		decoded.argon2.SaltLength == h.params.SaltLength &&
+		decoded.argon2.KeyLength == h.params.KeyLength &&
+		decoded.keyID == h.pepper.keyID()
+	return true, !current, nil
+}
+
+// BcryptHasher stores plain bcrypt hashes, or $bcrypt$keyid=...$2a$... when a pepper
+// is configured.
+type BcryptHasher struct {
+	cost   int
+	pepper *pepper
+}
+
+func NewBcryptHasher(cost int, pepperKey string) *BcryptHasher {
+	return &BcryptHasher{cost: cost, pepper: newPepper(pepperKey)}
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword(h.pepper.apply(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	if h.pepper != nil {
+		return fmt.Sprintf("$%s$keyid=%s%s", AlgorithmBcrypt, h.pepper.id, hash), nil
+	}
+	return string(hash), nil
+}
+
+func (h *BcryptHasher) Verify(password, encoded string) (bool, bool, error) {
+	decoded, err := parsePasswordHash(encoded)
+	if err != nil {
+		return false, false, err
+	}
+	ok, err := decoded.verify(password, h.pepper)
+	if err != nil || !ok {
+		return false, false, err
+	}
+
+	current := decoded.algorithm == AlgorithmBcrypt &&
+		decoded.bcryptCost == h.cost &&
+		decoded.keyID == h.pepper.keyID()
+	return true, !current, nil
+}
+
+// pepper is a server-side secret mixed into every password with HMAC-SHA256 before
+// hashing; id lets a hash name the pepper it was keyed with.
+type pepper struct {
+	key []byte
+	id  string
+}
+
+func newPepper(key string) *pepper {
+	if key == "" {
+		return nil
+	}
+	sum := sha256.Sum256([]byte(key))
+	return &pepper{key: []byte(key), id: hex.EncodeToString(sum[:4])}
+}
+
+func (p *pepper) apply(password string) []byte {
+	if p == nil {
+		return []byte(password)
+	}
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(password))
+	return []byte(hex.EncodeToString(mac.Sum(nil)))
+}
+
+func (p *pepper) keyID() string {
+	if p == nil {
+		return ""
+	}
+	return p.id
+}
+
+type passwordHash struct {
+	algorithm string
+	keyID     string
+
+	argon2 Argon2Params
+	salt   []byte
+	sum    []byte
+
+	bcryptCost int
+	bcrypt     []byte
+}
+
+func parsePasswordHash(encoded string) (*passwordHash, error) {
+	switch {
+	case strings.HasPrefix(encoded, "$"+AlgorithmArgon2id+"$"):
+		return parseArgon2id(encoded)
+	case strings.HasPrefix(encoded, "$"+AlgorithmBcrypt+"$"):
+		// $bcrypt$keyid=...$2a$10$...
+		params, bcryptHash, ok := strings.Cut(strings.TrimPrefix(encoded, "$"+AlgorithmBcrypt+"$"), "$")
+		keyID, keyed := strings.CutPrefix(params, "keyid=")
+		if !ok || !keyed {
+			return nil, ErrUnsupportedHash
+		}
+		h, err := parseBcrypt("$" + bcryptHash)
+		if err != nil {
+			return nil, err
+		}
+		h.keyID = keyID
+		return h, nil
+	case strings.HasPrefix(encoded, "$2"):
+		return parseBcrypt(encoded)
+	default:
+		return nil, ErrUnsupportedHash
+	}
+}
+
+func parseArgon2id(encoded string) (*passwordHash, error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..[,keyid=..]", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return nil, ErrUnsupportedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, ErrUnsupportedHash
+	}
+
+	h := &passwordHash{algorithm: AlgorithmArgon2id}
+	for _, param := range strings.Split(parts[3], ",") {
+		name, value, _ := strings.Cut(param, "=")
+		var err error
+		switch name {
+		case "m":
+			_, err = fmt.Sscanf(value, "%d", &h.argon2.Memory)
+		case "t":
+			_, err = fmt.Sscanf(value, "%d", &h.argon2.Iterations)
+		case "p":
+			_, err = fmt.Sscanf(value, "%d", &h.argon2.Parallelism)
+		case "keyid":
+			h.keyID = value
+		default:
+			err = ErrUnsupportedHash
+		}
+		if err != nil {
+			return nil, ErrUnsupportedHash
+		}
+	}
+
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, ErrUnsupportedHash
+	}
+	if h.sum, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, ErrUnsupportedHash
+	}
+	if h.argon2.Iterations == 0 || h.argon2.Parallelism == 0 || len(h.sum) == 0 {
+		return nil, ErrUnsupportedHash
+	}
+	h.argon2.SaltLength = uint32(len(h.salt))
+	h.argon2.KeyLength = uint32(len(h.sum))
+
+	return h, nil
+}
+
+func parseBcrypt(encoded string) (*passwordHash, error) {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil {
+		return nil, ErrUnsupportedHash
+	}
+	return &passwordHash{algorithm: AlgorithmBcrypt, bcryptCost: cost, bcrypt: []byte(encoded)}, nil
+}
+
+func (h *passwordHash) verify(password string, p *pepper) (bool, error) {
+	if h.keyID != p.keyID() && h.keyID != "" {
+		return false, ErrUnknownPepper
+	}
+	input := []byte(password)
+	if h.keyID != "" {
+		input = p.apply(password)
+	}
+
+	switch h.algorithm {
+	case AlgorithmArgon2id:
+		sum := argon2.IDKey(input, h.salt, h.argon2.Iterations, h.argon2.Memory, h.argon2.Parallelism, h.argon2.KeyLength)
+		return subtle.ConstantTimeCompare(sum, h.sum) == 1, nil
+	default:
+		err := bcrypt.CompareHashAndPassword(h.bcrypt, input)
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+}
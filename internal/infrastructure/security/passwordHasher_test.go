@@ -0,0 +1,105 @@
+package security
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Дешёвые параметры, чтобы тесты оставались быстрыми
+var testArgon2Params = Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestArgon2idHasher_HashAndVerify(t *testing.T) {
+	hasher := NewArgon2idHasher(testArgon2Params, "")
+
+	hash, err := hasher.Hash("correct horse")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"))
+
+	ok, rehash, err := hasher.Verify("correct horse", hash)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, rehash)
+
+	ok, _, err = hasher.Verify("wrong", hash)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// Каждый хеш получает свою соль
+	other, _ := hasher.Hash("correct horse")
+	assert.NotEqual(t, hash, other)
+}
+
+func TestArgon2idHasher_RehashesOutdatedHashes(t *testing.T) {
+	hasher := NewArgon2idHasher(testArgon2Params, "")
+
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	ok, rehash, err := hasher.Verify("secret", string(legacy))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, rehash)
+
+	weaker := testArgon2Params
+	weaker.Iterations = 2
+	old, _ := NewArgon2idHasher(weaker, "").Hash("secret")
+	ok, rehash, _ = hasher.Verify("secret", old)
+	assert.True(t, ok)
+	assert.True(t, rehash)
+
+	// Хеш без pepper обновляется, когда pepper включён
+	ok, rehash, _ = NewArgon2idHasher(testArgon2Params, "pepper").Verify("secret", old)
+	assert.True(t, ok)
+	assert.True(t, rehash)
+}
+
+func TestPasswordHasher_Pepper(t *testing.T) {
+	hasher := NewArgon2idHasher(testArgon2Params, "pepper")
+
+	hash, err := hasher.Hash("secret")
+	require.NoError(t, err)
+	assert.Contains(t, hash, ",keyid=")
+
+	ok, rehash, err := hasher.Verify("secret", hash)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, rehash)
+
+	_, _, err = NewArgon2idHasher(testArgon2Params, "").Verify("secret", hash)
+	assert.ErrorIs(t, err, ErrUnknownPepper)
+
+	bcryptHasher := NewBcryptHasher(bcrypt.MinCost, "pepper")
+	bcryptHash, err := bcryptHasher.Hash("secret")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(bcryptHash, "$bcrypt$keyid="))
+
+	ok, rehash, err = bcryptHasher.Verify("secret", bcryptHash)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, rehash)
+
+	// argon2id проверяет bcrypt-хеши с тем же pepper и требует их обновить
+	ok, rehash, err = hasher.Verify("secret", bcryptHash)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, rehash)
+}
+
+func TestBcryptHasher_CostUpgrade(t *testing.T) {
+	hasher := NewBcryptHasher(bcrypt.MinCost+1, "")
+
+	old, _ := NewBcryptHasher(bcrypt.MinCost, "").Hash("secret")
+	ok, rehash, err := hasher.Verify("secret", old)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, rehash)
+
+	ok, _, err = hasher.Verify("wrong", old)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, _, err = hasher.Verify("secret", "plaintext")
+	assert.ErrorIs(t, err, ErrUnsupportedHash)
+}
@@ -0,0 +1,199 @@
+package security
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+// SigningKey pairs a jwt signing method with the key material used to sign and verify tokens.
+// For HMAC both keys are the shared secret, for asymmetric algorithms verifyKey is the public half.
+type SigningKey struct {
+	Kid       string
+	Method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+func NewHMACKey(kid, secret string) *SigningKey {
+	return &SigningKey{
+		Kid:       kid,
+		Method:    jwt.SigningMethodHS256,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+	}
+}
+
+// LoadSigningKey reads a key file for algorithm: the raw shared secret for HS256,
+// a PEM private key otherwise.
+func LoadSigningKey(kid, path, algorithm string) (*SigningKey, error) {
+	if algorithm == "" || algorithm == AlgorithmHS256 {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read secret %s: %w", path, err)
+		}
+		return NewHMACKey(kid, strings.TrimSpace(string(data))), nil
+	}
+
+	return LoadPrivateKey(kid, path, algorithm)
+}
+
+// GenerateSigningKey creates new key material for algorithm in the format
+// LoadSigningKey reads: a random 256-bit secret for HS256, a PKCS#8 PEM private key
+// otherwise.
+func GenerateSigningKey(algorithm string) ([]byte, error) {
+	var (
+		key interface{}
+		err error
+	)
+	switch algorithm {
+	case "", AlgorithmHS256:
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		return []byte(base64.RawURLEncoding.EncodeToString(secret) + "\n"), nil
+	case AlgorithmRS256:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case AlgorithmES256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgorithmEdDSA:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// LoadPrivateKey reads a PEM encoded RSA, ECDSA or Ed25519 private key from disk.
+func LoadPrivateKey(kid, path, algorithm string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read private key %s: %w", path, err)
+	}
+
+	return ParsePrivateKeyPEM(kid, data, algorithm)
+}
+
+// ParsePrivateKeyPEM accepts PKCS#1, SEC 1 and PKCS#8 encoded keys. An empty algorithm is
+// inferred from the key type; otherwise it must match the key.
+func ParsePrivateKeyPEM(kid string, data []byte, algorithm string) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+
+	var (
+		key interface{}
+		err error
+	)
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAsymmetricKey(kid, key, algorithm)
+}
+
+func NewAsymmetricKey(kid string, privateKey interface{}, algorithm string) (*SigningKey, error) {
+	var (
+		method    jwt.SigningMethod
+		publicKey interface{}
+	)
+
+	switch k := privateKey.(type) {
+	case *rsa.PrivateKey:
+		method = jwt.SigningMethodRS256
+		switch m := jwt.GetSigningMethod(algorithm).(type) {
+		case *jwt.SigningMethodRSA:
+			method = m
+		case *jwt.SigningMethodRSAPSS:
+			method = m
+		}
+		publicKey = &k.PublicKey
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			method = jwt.SigningMethodES256
+		case elliptic.P384():
+			method = jwt.SigningMethodES384
+		case elliptic.P521():
+			method = jwt.SigningMethodES512
+		default:
+			return nil, fmt.Errorf("unsupported elliptic curve %s", k.Curve.Params().Name)
+		}
+		publicKey = &k.PublicKey
+	case ed25519.PrivateKey:
+		method = SigningMethodEd25519
+		publicKey = k.Public()
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", privateKey)
+	}
+
+	if algorithm != "" && method.Alg() != algorithm {
+		return nil, fmt.Errorf("algorithm %s does not match %s key", algorithm, method.Alg())
+	}
+
+	key := &SigningKey{
+		Kid:       kid,
+		Method:    method,
+		signKey:   privateKey,
+		verifyKey: publicKey,
+	}
+
+	// Without an explicit kid the RFC 7638 thumbprint lets verifiers match tokens to the JWKS entry.
+	if key.Kid == "" {
+		jwk, _ := NewJWK(key)
+		key.Kid = jwk.Thumbprint()
+	}
+
+	return key, nil
+}
+
+func (k *SigningKey) IsSymmetric() bool {
+	_, ok := k.Method.(*jwt.SigningMethodHMAC)
+	return ok
+}
+
+// PublicKey returns nil for HMAC keys so shared secrets never leave the service.
+func (k *SigningKey) PublicKey() crypto.PublicKey {
+	if k.IsSymmetric() {
+		return nil
+	}
+	return k.verifyKey
+}
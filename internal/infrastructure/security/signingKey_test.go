@@ -0,0 +1,37 @@
+package security
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateSigningKey(t *testing.T) {
+	for _, alg := range []string{AlgorithmHS256, AlgorithmRS256, AlgorithmES256, AlgorithmEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			data, err := GenerateSigningKey(alg)
+			require.NoError(t, err)
+
+			// Сгенерированный файл должен читаться тем же загрузчиком, что и при старте сервиса
+			path := filepath.Join(t.TempDir(), "key")
+			require.NoError(t, os.WriteFile(path, data, 0o600))
+			key, err := LoadSigningKey("k1", path, alg)
+			require.NoError(t, err)
+			assert.Equal(t, alg, key.Method.Alg())
+
+			jwtManager := NewJWTManagerWithKeyRing(NewKeyRing(key, time.Hour), time.Minute, time.Hour)
+			token, err := jwtManager.GenerateAccessToken(1, Authorization{})
+			require.NoError(t, err)
+			id, err := jwtManager.VerifyAccessToken(token)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(1), id)
+		})
+	}
+
+	_, err := GenerateSigningKey("none")
+	assert.Error(t, err)
+}
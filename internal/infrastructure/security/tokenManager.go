@@ -0,0 +1,17 @@
+package security
+
+import "time"
+
+type TokenManager interface {
+	GenerateAccessToken(userID int64, authz Authorization) (string, error)
+	GenerateRefreshToken(userID int64) (string, error)
+	VerifyAccessToken(token string) (int64, error)
+	VerifyRefreshToken(token string) (int64, error)
+	ParseAccessToken(token string) (*Claims, error)
+	ParseRefreshToken(token string) (*Claims, error)
+	GenerateActionToken(userID int64, purpose string, ttl time.Duration) (string, *Claims, error)
+	ParseActionToken(token, purpose string) (*Claims, error)
+	GenerateServiceToken(clientID string, scopes []string) (string, error)
+	GenerateIDToken(userID int64, clientID string, claims map[string]interface{}) (string, error)
+	JWKS() JWKS
+}
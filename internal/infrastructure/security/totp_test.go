@@ -0,0 +1,75 @@
+package security
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Секрет "12345678901234567890" из приложения B к RFC 6238
+const rfcTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode_RFC6238Vectors(t *testing.T) {
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+
+	for unix, want := range vectors {
+		code, err := TOTPCode(rfcTOTPSecret, time.Unix(unix, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, want, code)
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	assert.NoError(t, err)
+
+	now := time.Now()
+	code, err := TOTPCode(secret, now.Add(-totpPeriod*time.Second))
+	assert.NoError(t, err)
+
+	// Код предыдущего шага принимается из-за расхождения часов
+	step, ok := ValidateTOTP(secret, code, now)
+	assert.True(t, ok)
+	assert.Equal(t, totpStep(now)-1, step)
+
+	_, ok = ValidateTOTP(secret, code, now.Add(2*totpPeriod*time.Second))
+	assert.False(t, ok)
+
+	_, ok = ValidateTOTP(secret, "12345", now)
+	assert.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("Chat", "test@test.com", "SECRET")
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Chat:test@test.com?"))
+	assert.Contains(t, uri, "secret=SECRET")
+	assert.Contains(t, uri, "issuer=Chat")
+}
+
+func TestSecretBox(t *testing.T) {
+	box, err := NewSecretBox("passphrase")
+	assert.NoError(t, err)
+
+	sealed, err := box.Seal("secret")
+	assert.NoError(t, err)
+	assert.NotContains(t, sealed, "secret")
+
+	opened, err := box.Open(sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", opened)
+
+	// Другой ключ не расшифровывает
+	other, _ := NewSecretBox("other")
+	_, err = other.Open(sealed)
+	assert.Error(t, err)
+
+	_, err = NewSecretBox("")
+	assert.Error(t, err)
+}
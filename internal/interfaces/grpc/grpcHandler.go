@@ -3,7 +3,11 @@ package grpc
 import (
 	"context"
 	"github.com/danilkompaniets/auth-service/internal/application"
+	"github.com/danilkompaniets/auth-service/pkg/authclient"
 	gen_auth "github.com/danilkompaniets/go-chat-common/gen/gen-auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"strings"
 )
 
 type AuthGRPCHandler struct {
@@ -17,14 +21,61 @@ func NewAuthGRPCHandler(service *application.AuthService) *AuthGRPCHandler {
 	}
 }
 
+// audienceMetadataKey lets a calling service state which audience it expects, since
+// ValidateTokenRequest only carries the token.
+const audienceMetadataKey = authclient.AudienceHeader
+
+// acceptServiceMetadataKey opts a caller in to service client tokens. Without it they
+// are reported as not valid, so callers that only check Valid and use UserId never
+// mistake a service for user 0.
+const acceptServiceMetadataKey = authclient.AcceptServiceTokensHeader
+
+// The generated ValidateTokenResponse has no room for authorization data, so the
+// caller's roles and permissions are returned as space separated response headers.
+// principalMetadataKey tells users from service clients, which have no UserId; their
+// client id and granted scopes are returned as well. The authclient package reads
+// them back for calling services.
+const (
+	rolesMetadataKey       = authclient.RolesHeader
+	permissionsMetadataKey = authclient.PermissionsHeader
+	principalMetadataKey   = authclient.PrincipalHeader
+	clientIDMetadataKey    = authclient.ClientIDHeader
+	scopesMetadataKey      = authclient.ScopesHeader
+)
+
 func (h *AuthGRPCHandler) ValidateToken(ctx context.Context, req *gen_auth.ValidateTokenRequest) (*gen_auth.ValidateTokenResponse, error) {
-	userId, err := h.service.ValidateToken(req.Token)
+	var audience string
+	var acceptService bool
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(audienceMetadataKey); len(values) > 0 {
+			audience = values[0]
+		}
+		if values := md.Get(acceptServiceMetadataKey); len(values) > 0 {
+			acceptService = values[0] == "true"
+		}
+	}
+
+	claims, err := h.service.AuthorizeToken(ctx, req.Token, audience)
 	if err != nil {
 		return nil, err
 	}
+	if claims.IsService() && !acceptService {
+		return &gen_auth.ValidateTokenResponse{Valid: false}, nil
+	}
+
+	header := metadata.Pairs(
+		rolesMetadataKey, strings.Join(claims.Roles, " "),
+		permissionsMetadataKey, strings.Join(claims.Permissions, " "),
+		principalMetadataKey, claims.Principal,
+		clientIDMetadataKey, claims.ClientID,
+		scopesMetadataKey, strings.Join(claims.Scopes, " "),
+	)
+	if err := grpc.SetHeader(ctx, header); err != nil {
+		return nil, err
+	}
 
 	return &gen_auth.ValidateTokenResponse{
-		Valid:  userId != 0,
-		UserId: userId,
+		Valid:  true,
+		UserId: claims.UserID,
 	}, nil
 }
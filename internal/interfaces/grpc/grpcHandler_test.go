@@ -0,0 +1,73 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/application"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+	gen_auth "github.com/danilkompaniets/go-chat-common/gen/gen-auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// headerStream records the headers a handler sets, like the server transport does.
+type headerStream struct {
+	header metadata.MD
+}
+
+func (s *headerStream) Method() string { return "/auth.AuthService/ValidateToken" }
+
+func (s *headerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *headerStream) SendHeader(md metadata.MD) error { return s.SetHeader(md) }
+
+func (s *headerStream) SetTrailer(metadata.MD) error { return nil }
+
+func TestValidateToken_ServiceTokensRequireOptIn(t *testing.T) {
+	jwt := security.NewJWTManager("access", "refresh", time.Minute, time.Hour)
+	handler := NewAuthGRPCHandler(application.NewAuthService(nil, jwt))
+
+	token, err := jwt.GenerateServiceToken("billing", []string{"users.read"})
+	require.NoError(t, err)
+
+	// Без флага токен сервиса не считается действительным
+	stream := &headerStream{}
+	ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+	resp, err := handler.ValidateToken(ctx, &gen_auth.ValidateTokenRequest{Token: token})
+	require.NoError(t, err)
+	assert.False(t, resp.Valid)
+	assert.Nil(t, stream.header)
+
+	stream = &headerStream{}
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(acceptServiceMetadataKey, "true"))
+	ctx = grpc.NewContextWithServerTransportStream(ctx, stream)
+	resp, err = handler.ValidateToken(ctx, &gen_auth.ValidateTokenRequest{Token: token})
+	require.NoError(t, err)
+	assert.True(t, resp.Valid)
+	assert.Zero(t, resp.UserId)
+	assert.Equal(t, []string{security.PrincipalService}, stream.header.Get(principalMetadataKey))
+	assert.Equal(t, []string{"billing"}, stream.header.Get(clientIDMetadataKey))
+}
+
+func TestValidateToken_UserToken(t *testing.T) {
+	jwt := security.NewJWTManager("access", "refresh", time.Minute, time.Hour)
+	handler := NewAuthGRPCHandler(application.NewAuthService(nil, jwt))
+
+	token, err := jwt.GenerateAccessToken(7, security.Authorization{Roles: []string{"admin"}})
+	require.NoError(t, err)
+
+	stream := &headerStream{}
+	ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+	resp, err := handler.ValidateToken(ctx, &gen_auth.ValidateTokenRequest{Token: token})
+	require.NoError(t, err)
+	assert.True(t, resp.Valid)
+	assert.Equal(t, int64(7), resp.UserId)
+	assert.Equal(t, []string{"admin"}, stream.header.Get(rolesMetadataKey))
+}
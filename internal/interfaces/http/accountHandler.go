@@ -0,0 +1,116 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/danilkompaniets/auth-service/internal/application"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/api"
+	"github.com/gin-gonic/gin"
+)
+
+// ChangePassword godoc
+// @Summary      Change password
+// @Description  Requires the current password; every other session of the user is ended
+// @Tags         account
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        input body api.ChangePasswordRequest true "Change password request"
+// @Success      200  {object} map[string]string "ok"
+// @Failure      400  {object} map[string]string "bad request"
+// @Failure      403  {object} map[string]string "wrong current password"
+// @Failure      422  {object} map[string]interface{} "password policy violations"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/password/change [post]
+func (h *HttpHandler) ChangePassword(c *gin.Context) {
+	var req api.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The caller's own session survives when its refresh cookie comes along.
+	refreshToken, _ := c.Cookie(refreshTokenCookie)
+
+	err := h.service.ChangePassword(c, c.GetInt64(ctxUserID), req.CurrentPassword, req.NewPassword, refreshToken)
+	if errors.Is(err, application.ErrInvalidPassword) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if passwordPolicyError(c, err, "new_password") {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// ChangeEmail godoc
+// @Summary      Change email
+// @Description  Requires the current password and sends a confirmation link to the new address; the email changes once it is opened
+// @Tags         account
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        input body api.ChangeEmailRequest true "Change email request"
+// @Success      202  {object} map[string]string "confirmation sent"
+// @Failure      400  {object} map[string]string "bad request"
+// @Failure      403  {object} map[string]string "wrong current password"
+// @Failure      409  {object} map[string]string "email already in use"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/email/change [post]
+func (h *HttpHandler) ChangeEmail(c *gin.Context) {
+	var req api.ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.service.RequestEmailChange(c, c.GetInt64(ctxUserID), req.CurrentPassword, req.NewEmail)
+	switch {
+	case errors.Is(err, application.ErrInvalidPassword):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, repository.ErrEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{})
+}
+
+// ConfirmEmailChange godoc
+// @Summary      Confirm email change
+// @Description  Consumes the single-use token sent to the new address and switches the account to it
+// @Tags         account
+// @Produce      json
+// @Param        token query string true "Confirmation token"
+// @Success      200  {object} map[string]string "ok"
+// @Failure      400  {object} map[string]string "invalid or expired token"
+// @Failure      409  {object} map[string]string "email already in use"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/email/confirm [get]
+func (h *HttpHandler) ConfirmEmailChange(c *gin.Context) {
+	err := h.service.ConfirmEmailChange(c, c.Query("token"))
+	switch {
+	case errors.Is(err, repository.ErrActionTokenInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, repository.ErrEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
@@ -0,0 +1,253 @@
+package http
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/api"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/gin-gonic/gin"
+)
+
+// ListRoles godoc
+// @Summary      List roles
+// @Description  Returns every role together with its permissions
+// @Tags         admin
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {array}  model.Role
+// @Failure      403  {object} map[string]string "forbidden"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/admin/roles [get]
+func (h *HttpHandler) ListRoles(c *gin.Context) {
+	roles, err := h.service.ListRoles(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// SaveRole godoc
+// @Summary      Create or update role
+// @Description  Creates the role or replaces its description and permissions
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        name  path string true "Role name"
+// @Param        input body api.SaveRoleRequest true "Role"
+// @Success      200  {object} map[string]interface{} "roleId"
+// @Failure      400  {object} map[string]string "bad request"
+// @Failure      403  {object} map[string]string "forbidden"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/admin/roles/{name} [put]
+func (h *HttpHandler) SaveRole(c *gin.Context) {
+	var req api.SaveRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	roleId, err := h.service.SaveRole(c, model.Role{
+		Name:        c.Param("name"),
+		Description: req.Description,
+		Permissions: req.Permissions,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roleId": roleId})
+}
+
+// AssignRole godoc
+// @Summary      Assign role
+// @Description  Grants a role to the user, effective from their next token refresh
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id    path int true "User id"
+// @Param        input body api.AssignRoleRequest true "Role"
+// @Success      200  {object} map[string]string "ok"
+// @Failure      400  {object} map[string]string "bad request"
+// @Failure      403  {object} map[string]string "forbidden"
+// @Failure      404  {object} map[string]string "role not found"
+// @Router       /auth/admin/users/{id}/roles [post]
+func (h *HttpHandler) AssignRole(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	var req api.AssignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.service.AssignRole(c, userID, req.Role)
+	if errors.Is(err, repository.ErrRoleNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// RevokeRole godoc
+// @Summary      Revoke role
+// @Description  Removes a role from the user, effective from their next token refresh
+// @Tags         admin
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path int    true "User id"
+// @Param        role path string true "Role name"
+// @Success      200  {object} map[string]string "ok"
+// @Failure      400  {object} map[string]string "bad request"
+// @Failure      403  {object} map[string]string "forbidden"
+// @Router       /auth/admin/users/{id}/roles/{role} [delete]
+func (h *HttpHandler) RevokeRole(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.RevokeRole(c, userID, c.Param("role")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// RevokeUserTokens godoc
+// @Summary      Revoke all tokens of a user
+// @Description  Rejects every access token of the user issued before now and ends all of their sessions
+// @Tags         admin
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path int true "User id"
+// @Success      200  {object} map[string]string "ok"
+// @Failure      400  {object} map[string]string "bad request"
+// @Failure      403  {object} map[string]string "forbidden"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/admin/users/{id}/tokens/revoke [post]
+func (h *HttpHandler) RevokeUserTokens(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.RevokeUserTokens(c, userID, time.Time{}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// ResetMFA godoc
+// @Summary      Reset MFA of a user
+// @Description  Removes the user's TOTP enrolment and recovery codes so they can log in with the password alone
+// @Tags         admin
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path int true "User id"
+// @Success      200  {object} map[string]string "ok"
+// @Failure      400  {object} map[string]string "bad request"
+// @Failure      403  {object} map[string]string "forbidden"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/admin/users/{id}/mfa [delete]
+func (h *HttpHandler) ResetMFA(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.ResetMFA(c, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// UnlockUser godoc
+// @Summary      Unlock user login
+// @Description  Clears the failed login attempts recorded against the user's account, lifting any lockout
+// @Tags         admin
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path int true "User id"
+// @Success      200  {object} map[string]string "ok"
+// @Failure      400  {object} map[string]string "bad request"
+// @Failure      403  {object} map[string]string "forbidden"
+// @Failure      404  {object} map[string]string "user not found"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/admin/users/{id}/unlock [post]
+func (h *HttpHandler) UnlockUser(c *gin.Context) {
+	userID, ok := userIDParam(c)
+	if !ok {
+		return
+	}
+
+	err := h.service.UnlockUser(c, userID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// UnlockIP godoc
+// @Summary      Unlock client address
+// @Description  Clears the failed login attempts recorded against a client IP, lifting any lockout
+// @Tags         admin
+// @Produce      json
+// @Security     BearerAuth
+// @Param        ip   path string true "Client IP"
+// @Success      200  {object} map[string]string "ok"
+// @Failure      400  {object} map[string]string "bad request"
+// @Failure      403  {object} map[string]string "forbidden"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/admin/lockouts/ip/{ip} [delete]
+func (h *HttpHandler) UnlockIP(c *gin.Context) {
+	ip := net.ParseIP(c.Param("ip"))
+	if ip == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ip"})
+		return
+	}
+
+	if err := h.service.UnlockIP(c, ip.String()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+func userIDParam(c *gin.Context) (int64, bool) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || userID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return 0, false
+	}
+	return userID, true
+}
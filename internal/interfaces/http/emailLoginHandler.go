@@ -0,0 +1,124 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/danilkompaniets/auth-service/internal/application"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/api"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/gin-gonic/gin"
+)
+
+// RequestEmailLogin godoc
+// @Summary      Request passwordless login
+// @Description  Mails a magic link and a 6-digit code; the response is the same whether or not the email is registered
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input body api.EmailLoginRequest true "Email login request"
+// @Success      202  {object} map[string]string "ok"
+// @Failure      400  {object} map[string]string "bad request"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/login/email [post]
+func (h *HttpHandler) RequestEmailLogin(c *gin.Context) {
+	var req api.EmailLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.RequestEmailLogin(c, req.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{})
+}
+
+// LoginWithEmailCode godoc
+// @Summary      Log in with emailed code
+// @Description  Exchanges the 6-digit code from the login email for tokens. Codes are single-use and stop working after too many wrong guesses.
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input body api.EmailCodeLoginRequest true "Code login request"
+// @Success      200  {object} map[string]string "access_token, or mfa_token and mfa_methods when a second factor is required"
+// @Failure      400  {object} map[string]string "bad request"
+// @Failure      401  {object} map[string]string "invalid or expired code"
+// @Failure      403  {object} map[string]string "account disabled"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/login/email/code [post]
+func (h *HttpHandler) LoginWithEmailCode(c *gin.Context) {
+	var req api.EmailCodeLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	device := model.Device{
+		Name:      req.DeviceName,
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	}
+
+	tokens, err := h.service.LoginWithEmailCode(c, req.Email, req.Code, device)
+	emailLoginResponse(c, tokens, err)
+}
+
+// LoginWithEmailLink godoc
+// @Summary      Log in with magic link
+// @Description  Exchanges the token from the magic link in the login email for tokens
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input body api.EmailLinkLoginRequest true "Link login request"
+// @Success      200  {object} map[string]string "access_token, or mfa_token and mfa_methods when a second factor is required"
+// @Failure      400  {object} map[string]string "bad request"
+// @Failure      401  {object} map[string]string "invalid, expired or used link"
+// @Failure      403  {object} map[string]string "account disabled"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/login/email/link [post]
+func (h *HttpHandler) LoginWithEmailLink(c *gin.Context) {
+	var req api.EmailLinkLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	device := model.Device{
+		Name:      req.DeviceName,
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	}
+
+	tokens, err := h.service.LoginWithEmailLink(c, req.Token, device)
+	emailLoginResponse(c, tokens, err)
+}
+
+func emailLoginResponse(c *gin.Context, tokens *application.Tokens, err error) {
+	var mfaErr *application.MFARequiredError
+	switch {
+	case errors.As(err, &mfaErr):
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required": true,
+			"mfa_token":    mfaErr.ChallengeToken,
+			"mfa_methods":  mfaErr.Methods,
+		})
+		return
+	case errors.Is(err, repository.ErrLoginCodeInvalid):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, application.ErrUserDisabled):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	setRefreshTokenCookie(c, tokens.RefreshToken)
+	c.JSON(http.StatusOK, gin.H{
+		"access_token": "Bearer " + tokens.AccessToken,
+	})
+}
@@ -0,0 +1,204 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/danilkompaniets/auth-service/internal/application"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/federation"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/api"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/gin-gonic/gin"
+)
+
+// FederationProviders godoc
+// @Summary      List identity providers
+// @Description  Returns the names of the upstream identity providers users can log in with
+// @Tags         federation
+// @Produce      json
+// @Success      200  {array}  string
+// @Router       /auth/federation/providers [get]
+func (h *HttpHandler) FederationProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, h.service.FederationProviders())
+}
+
+// BeginFederatedLogin godoc
+// @Summary      Start login with an identity provider
+// @Description  Returns the provider URL to send the browser to and the state to keep until the callback
+// @Tags         federation
+// @Produce      json
+// @Param        provider path string true "Provider name"
+// @Success      200  {object} application.FederatedRedirect
+// @Failure      404  {object} map[string]string "unknown provider"
+// @Failure      501  {object} map[string]string "federated login not configured"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/federation/providers/{provider}/begin [post]
+func (h *HttpHandler) BeginFederatedLogin(c *gin.Context) {
+	redirect, err := h.service.BeginFederatedLogin(c, c.Param("provider"))
+	if err != nil {
+		federationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, redirect)
+}
+
+// CompleteFederatedLogin godoc
+// @Summary      Finish login with an identity provider
+// @Description  Exchanges the code and state of the provider callback for tokens. Unknown accounts are linked by verified email or signed up, as far as the provider's settings allow.
+// @Tags         federation
+// @Accept       json
+// @Produce      json
+// @Param        input body api.FederatedCallbackRequest true "Provider callback"
+// @Success      200  {object} map[string]string "access_token, or mfa_token and mfa_methods when a second factor is required"
+// @Failure      400  {object} map[string]string "bad request"
+// @Failure      401  {object} map[string]string "invalid state or rejected by the provider"
+// @Failure      403  {object} map[string]string "account disabled, signup disabled or email not verified"
+// @Failure      409  {object} map[string]string "account with this email exists and must link the provider after logging in"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/federation/callback [post]
+func (h *HttpHandler) CompleteFederatedLogin(c *gin.Context) {
+	var req api.FederatedCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	device := model.Device{
+		Name:      req.DeviceName,
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	}
+
+	tokens, err := h.service.CompleteFederatedLogin(c, req.State, req.Code, device)
+	var mfaErr *application.MFARequiredError
+	if err != nil && !errors.As(err, &mfaErr) {
+		federationError(c, err)
+		return
+	}
+	emailLoginResponse(c, tokens, err)
+}
+
+// ListIdentities godoc
+// @Summary      List linked identity providers
+// @Description  Returns the upstream accounts linked to the current user
+// @Tags         federation
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {array}  model.Identity
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/identities [get]
+func (h *HttpHandler) ListIdentities(c *gin.Context) {
+	identities, err := h.service.ListIdentities(c, c.GetInt64(ctxUserID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, identities)
+}
+
+// BeginIdentityLink godoc
+// @Summary      Start linking an identity provider
+// @Description  Like the login variant, but the callback links the provider account to the current user
+// @Tags         federation
+// @Produce      json
+// @Security     BearerAuth
+// @Param        provider path string true "Provider name"
+// @Success      200  {object} application.FederatedRedirect
+// @Failure      404  {object} map[string]string "unknown provider"
+// @Failure      501  {object} map[string]string "federated login not configured"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/identities/providers/{provider}/begin [post]
+func (h *HttpHandler) BeginIdentityLink(c *gin.Context) {
+	redirect, err := h.service.BeginIdentityLink(c, c.GetInt64(ctxUserID), c.Param("provider"))
+	if err != nil {
+		federationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, redirect)
+}
+
+// CompleteIdentityLink godoc
+// @Summary      Finish linking an identity provider
+// @Description  Links the provider account from the callback to the current user
+// @Tags         federation
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        input body api.LinkIdentityRequest true "Provider callback"
+// @Success      200  {object} model.Identity
+// @Failure      400  {object} map[string]string "bad request"
+// @Failure      401  {object} map[string]string "invalid state or rejected by the provider"
+// @Failure      409  {object} map[string]string "provider account already linked"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/identities/callback [post]
+func (h *HttpHandler) CompleteIdentityLink(c *gin.Context) {
+	var req api.LinkIdentityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	identity, err := h.service.CompleteIdentityLink(c, c.GetInt64(ctxUserID), req.State, req.Code)
+	if err != nil {
+		federationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, identity)
+}
+
+// UnlinkIdentity godoc
+// @Summary      Unlink identity provider
+// @Description  Removes one of the current user's linked provider accounts. Accounts without a password keep their last one.
+// @Tags         federation
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path int true "Identity id"
+// @Success      200  {object} map[string]string "ok"
+// @Failure      400  {object} map[string]string "bad request"
+// @Failure      404  {object} map[string]string "identity not found"
+// @Failure      409  {object} map[string]string "last way to log in"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/identities/{id} [delete]
+func (h *HttpHandler) UnlinkIdentity(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid identity id"})
+		return
+	}
+
+	if err := h.service.UnlinkIdentity(c, c.GetInt64(ctxUserID), id); err != nil {
+		federationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+func federationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, application.ErrFederationDisabled):
+		c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+	case errors.Is(err, application.ErrUnknownProvider), errors.Is(err, repository.ErrIdentityNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrFederatedLoginInvalid):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, federation.ErrInvalidResponse):
+		// The details name upstream endpoints, they only go to the request log.
+		c.Error(err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "identity provider rejected the login"})
+	case errors.Is(err, application.ErrUserDisabled), errors.Is(err, application.ErrEmailNotVerified),
+		errors.Is(err, application.ErrFederatedSignupDisabled), errors.Is(err, application.ErrFederatedEmailUnverified):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, application.ErrIdentityLinkRequired), errors.Is(err, repository.ErrIdentityExists),
+		errors.Is(err, repository.ErrEmailTaken), errors.Is(err, application.ErrLastLoginMethod):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -1,14 +1,25 @@
 package http
 
 import (
+	"errors"
 	"github.com/danilkompaniets/auth-service/internal/application"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
 	"github.com/danilkompaniets/auth-service/pkg/api"
 	"github.com/danilkompaniets/auth-service/pkg/model"
 	"github.com/gin-gonic/gin"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
+const (
+	refreshTokenCookie     = "refresh_token"
+	refreshTokenCookiePath = "/api/v1/auth"
+	refreshTokenCookieTTL  = 60 * 60 * 24 * 7
+)
+
 type HttpHandler struct {
 	service *application.AuthService
 }
@@ -28,6 +39,7 @@ func NewHttpHandler(service *application.AuthService) *HttpHandler {
 // @Param        input body registerRequest true "Register request"
 // @Success      200  {object} map[string]interfaces{} "userId"
 // @Failure      400  {object} map[string]string "bad request"
+// @Failure      422  {object} map[string]interface{} "password policy violations"
 // @Failure      500  {object} map[string]string "internal error"
 // @Router       /auth/register [post]
 func (h *HttpHandler) Register(c *gin.Context) {
@@ -45,6 +57,9 @@ func (h *HttpHandler) Register(c *gin.Context) {
 	}
 
 	userId, err := h.service.CreateUser(c, user)
+	if passwordPolicyError(c, err, "password") {
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -60,8 +75,11 @@ func (h *HttpHandler) Register(c *gin.Context) {
 // @Accept       json
 // @Produce      json
 // @Param        input body loginRequest true "Login request"
-// @Success      200  {object} map[string]string "access_token"
+// @Success      200  {object} map[string]string "access_token, or mfa_token and mfa_methods when a second factor is required"
 // @Failure      400  {object} map[string]string "bad request"
+// @Failure      401  {object} map[string]string "invalid email or password"
+// @Failure      403  {object} map[string]string "email not verified or account disabled"
+// @Failure      429  {object} map[string]string "too many failed attempts, see Retry-After"
 // @Failure      500  {object} map[string]string "internal error"
 // @Router       /auth/login [post]
 func (h *HttpHandler) Login(c *gin.Context) {
@@ -75,46 +93,81 @@ func (h *HttpHandler) Login(c *gin.Context) {
 		Email:    req.Email,
 		Password: req.Password,
 	}
+	device := model.Device{
+		Name:      req.DeviceName,
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	}
 
-	tokens, err := h.service.LoginUser(c, user)
+	tokens, err := h.service.LoginUser(c, user, device)
+	var mfaErr *application.MFARequiredError
+	if errors.As(err, &mfaErr) {
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required": true,
+			"mfa_token":    mfaErr.ChallengeToken,
+			"mfa_methods":  mfaErr.Methods,
+		})
+		return
+	}
+	var lockedErr *application.LockedOutError
+	if errors.As(err, &lockedErr) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(lockedErr.RetryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, application.ErrInvalidCredentials) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, application.ErrEmailNotVerified) || errors.Is(err, application.ErrUserDisabled) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	tokens.AccessToken = "Bearer " + tokens.AccessToken
-	tokens.RefreshToken = "Bearer " + tokens.RefreshToken
-
-	c.SetCookie("refresh_token", tokens.RefreshToken, 60*60*24*7, "/auth/refresh", "localhost", false, true)
+	setRefreshTokenCookie(c, tokens.RefreshToken)
 	c.JSON(http.StatusOK, gin.H{
-		"access_token": tokens.AccessToken,
+		"access_token": "Bearer " + tokens.AccessToken,
 	})
 }
 
 // Logout godoc
 // @Summary      User logout
-// @Description  Deletes user refresh token
+// @Description  Ends the session of the presented refresh token, other devices stay logged in
 // @Tags         auth
 // @Accept       json
 // @Produce      json
 // @Param        input body logoutRequest true "Logout request"
 // @Success      200  {object} map[string]string "ok"
 // @Failure      400  {object} map[string]string "bad request"
+// @Failure      401  {object} map[string]string "refresh token missing or unknown"
 // @Failure      500  {object} map[string]string "internal error"
 // @Router       /auth/logout [post]
 func (h *HttpHandler) Logout(c *gin.Context) {
 	var req api.LogoutRequest
-	if err := c.ShouldBindJSON(req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+	refreshToken, err := c.Cookie(refreshTokenCookie)
+	if err != nil {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		refreshToken = req.RefreshToken
 	}
 
-	if err := h.service.DeleteRefreshToken(c, req.UserID); err != nil {
+	// The cookie goes either way: a token the service does not know is of no use to the client.
+	err = h.service.Logout(c, refreshToken)
+	c.SetCookie(refreshTokenCookie, "", -1, refreshTokenCookiePath, "localhost", false, true)
+	switch {
+	case errors.Is(err, application.ErrRefreshTokenInvalid), errors.Is(err, repository.ErrRefreshTokenNotFound):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case err != nil:
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+	default:
+		c.JSON(http.StatusOK, gin.H{})
 	}
-
-	c.JSON(http.StatusOK, gin.H{})
 }
 
 // RefreshTokens godoc
@@ -123,23 +176,237 @@ func (h *HttpHandler) Logout(c *gin.Context) {
 // @Tags         auth
 // @Produce      json
 // @Success      200  {object} map[string]string "access_token"
+// @Failure      400  {object} map[string]string "missing refresh token"
+// @Failure      401  {object} map[string]string "refresh token invalid, reused or revoked"
 // @Failure      500  {object} map[string]string "internal error"
-// @Router       /auth/refresh [get]
+// @Router       /auth/refresh-token [post]
 func (h *HttpHandler) RefreshTokens(c *gin.Context) {
-	refreshToken, err := c.Cookie("refresh_token")
+	refreshToken, err := c.Cookie(refreshTokenCookie)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "missing refresh token"})
 		return
 	}
 
 	res, err := h.service.RefreshUserTokens(c, refreshToken)
+	if errors.Is(err, application.ErrRefreshTokenReused) || errors.Is(err, application.ErrRefreshTokenInvalid) ||
+		errors.Is(err, application.ErrSessionRevoked) || errors.Is(err, application.ErrRefreshTokenClient) ||
+		errors.Is(err, repository.ErrRefreshTokenNotFound) {
+		// The cookie can never be refreshed again, so it is dropped as well.
+		c.SetCookie(refreshTokenCookie, "", -1, refreshTokenCookiePath, "localhost", false, true)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.SetCookie("refresh_token", res.RefreshToken, 60*60*24*7, "/auth/refresh", "localhost", false, true)
+	setRefreshTokenCookie(c, res.RefreshToken)
 	c.JSON(http.StatusOK, gin.H{
-		"access_token": res.AccessToken,
+		"access_token": "Bearer " + res.AccessToken,
 	})
 }
+
+func setRefreshTokenCookie(c *gin.Context, refreshToken string) {
+	c.SetCookie(refreshTokenCookie, refreshToken, refreshTokenCookieTTL, refreshTokenCookiePath, "localhost", false, true)
+}
+
+// passwordPolicyError answers 422 with the broken rules when err is a policy
+// rejection, reporting them under the request's password field.
+func passwordPolicyError(c *gin.Context, err error, field string) bool {
+	var policyErr *application.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+
+	violations := make([]application.PolicyViolation, len(policyErr.Violations))
+	for i, v := range policyErr.Violations {
+		v.Field = field
+		violations[i] = v
+	}
+	c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "password does not meet the password policy", "violations": violations})
+	return true
+}
+
+// VerifyEmail godoc
+// @Summary      Verify email address
+// @Description  Consumes the single-use token from the verification email
+// @Tags         auth
+// @Produce      json
+// @Param        token query string true "Verification token"
+// @Success      200  {object} map[string]string "ok"
+// @Failure      400  {object} map[string]string "invalid or expired token"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/verify-email [get]
+func (h *HttpHandler) VerifyEmail(c *gin.Context) {
+	err := h.service.VerifyEmail(c, c.Query("token"))
+	if errors.Is(err, repository.ErrActionTokenInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// ResendVerificationEmail godoc
+// @Summary      Resend verification email
+// @Description  Sends a new verification link; succeeds for unknown addresses too
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input body api.ResendVerificationRequest true "Resend request"
+// @Success      200  {object} map[string]string "ok"
+// @Failure      400  {object} map[string]string "bad request"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/verify-email/resend [post]
+func (h *HttpHandler) ResendVerificationEmail(c *gin.Context) {
+	var req api.ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.ResendVerificationEmail(c, req.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// ForgotPassword godoc
+// @Summary      Request password reset
+// @Description  Mails a single-use reset link; the response is the same whether or not the email is registered
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input body api.ForgotPasswordRequest true "Forgot password request"
+// @Success      200  {object} map[string]string "ok"
+// @Failure      400  {object} map[string]string "bad request"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/password/forgot [post]
+func (h *HttpHandler) ForgotPassword(c *gin.Context) {
+	var req api.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.ForgotPassword(c, req.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// ResetPassword godoc
+// @Summary      Reset password
+// @Description  Consumes a reset token, sets the new password and ends all sessions
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input body api.ResetPasswordRequest true "Reset password request"
+// @Success      200  {object} map[string]string "ok"
+// @Failure      400  {object} map[string]string "invalid or expired token"
+// @Failure      422  {object} map[string]interface{} "password policy violations"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/password/reset [post]
+func (h *HttpHandler) ResetPassword(c *gin.Context) {
+	var req api.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.service.ResetPassword(c, req.Token, req.Password)
+	if errors.Is(err, repository.ErrActionTokenInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if passwordPolicyError(c, err, "password") {
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.SetCookie(refreshTokenCookie, "", -1, refreshTokenCookiePath, "localhost", false, true)
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// RevokeToken godoc
+// @Summary      Revoke access token
+// @Description  Puts a single access token on the denylist until it expires
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Param        input body api.RevokeTokenRequest true "Revoke request"
+// @Success      200  {object} map[string]string "ok"
+// @Failure      400  {object} map[string]string "bad request"
+// @Router       /auth/tokens/revoke [post]
+func (h *HttpHandler) RevokeToken(c *gin.Context) {
+	var req api.RevokeTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.RevokeAccessToken(c, strings.TrimPrefix(req.Token, "Bearer ")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// RevokeAllTokens godoc
+// @Summary      Revoke all tokens of the caller
+// @Description  Rejects every access token issued before issued_before (default now, later times are clamped to now) and ends all sessions
+// @Tags         auth
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        input body api.RevokeAllTokensRequest false "Revoke all request"
+// @Success      200  {object} map[string]string "ok"
+// @Failure      401  {object} map[string]string "unauthorized"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/tokens/revoke-all [post]
+func (h *HttpHandler) RevokeAllTokens(c *gin.Context) {
+	var req api.RevokeAllTokensRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var before time.Time
+	if req.IssuedBefore != nil {
+		before = *req.IssuedBefore
+	}
+
+	if err := h.service.RevokeUserTokens(c, c.GetInt64(ctxUserID), before); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// JWKS godoc
+// @Summary      JSON Web Key Set
+// @Description  Public keys for verifying access tokens locally
+// @Tags         auth
+// @Produce      json
+// @Success      200  {object} security.JWKS
+// @Router       /.well-known/jwks.json [get]
+func (h *HttpHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.service.JWKS())
+}
@@ -0,0 +1,122 @@
+package http
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/danilkompaniets/auth-service/internal/application"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/api"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/gin-gonic/gin"
+)
+
+// EnrollTOTP godoc
+// @Summary      Start TOTP enrolment
+// @Description  Generates a TOTP secret and otpauth URI; MFA is enabled once confirmed with a code
+// @Tags         mfa
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object} application.TOTPEnrollment
+// @Failure      409  {object} map[string]string "mfa already enabled"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/mfa/totp/enroll [post]
+func (h *HttpHandler) EnrollTOTP(c *gin.Context) {
+	enrollment, err := h.service.EnrollTOTP(c, c.GetInt64(ctxUserID))
+	if errors.Is(err, application.ErrMFAAlreadyEnabled) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmTOTP godoc
+// @Summary      Confirm TOTP enrolment
+// @Description  Enables MFA after checking a code from the authenticator app and returns one-time recovery codes
+// @Tags         mfa
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        input body api.ConfirmTOTPRequest true "Confirm request"
+// @Success      200  {object} map[string][]string "recovery_codes"
+// @Failure      400  {object} map[string]string "invalid code"
+// @Failure      404  {object} map[string]string "no pending enrolment"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/mfa/totp/confirm [post]
+func (h *HttpHandler) ConfirmTOTP(c *gin.Context) {
+	var req api.ConfirmTOTPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := h.service.ConfirmTOTP(c, c.GetInt64(ctxUserID), req.Code)
+	switch {
+	case errors.Is(err, application.ErrMFAInvalidCode), errors.Is(err, application.ErrMFAAlreadyEnabled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, repository.ErrMFANotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// CompleteMFALogin godoc
+// @Summary      Second login step
+// @Description  Exchanges the mfa_token from /login and a TOTP or recovery code for tokens. A wrong code invalidates the mfa_token.
+// @Tags         mfa
+// @Accept       json
+// @Produce      json
+// @Param        input body api.MFALoginRequest true "MFA login request"
+// @Success      200  {object} map[string]string "access_token"
+// @Failure      400  {object} map[string]string "bad request"
+// @Failure      401  {object} map[string]string "invalid code or mfa token"
+// @Failure      429  {object} map[string]string "too many failed attempts, see Retry-After"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/login/mfa [post]
+func (h *HttpHandler) CompleteMFALogin(c *gin.Context) {
+	var req api.MFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	device := model.Device{
+		Name:      req.DeviceName,
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	}
+
+	tokens, err := h.service.CompleteMFALogin(c, req.MFAToken, req.Code, device)
+	var lockedErr *application.LockedOutError
+	if errors.As(err, &lockedErr) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(lockedErr.RetryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, application.ErrMFAInvalidCode) || errors.Is(err, repository.ErrActionTokenInvalid) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	setRefreshTokenCookie(c, tokens.RefreshToken)
+	c.JSON(http.StatusOK, gin.H{
+		"access_token": "Bearer " + tokens.AccessToken,
+	})
+}
@@ -0,0 +1,103 @@
+package http
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/ratelimit"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ctxUserID = "user_id"
+	ctxClaims = "claims"
+)
+
+// RequireAuth rejects requests without a valid, non-revoked Bearer access token
+// and stores the caller's claims in the gin context. The first-party API acts on a
+// user with the user's own permissions, so tokens of service clients and tokens
+// issued to OAuth clients are rejected as well.
+func (h *HttpHandler) RequireAuth() gin.HandlerFunc {
+	return h.requireToken(false)
+}
+
+// RequireOAuthToken is RequireAuth for the endpoints OAuth clients call on behalf of
+// a user, like userinfo. Tokens issued to a client are accepted, service tokens are not.
+func (h *HttpHandler) RequireOAuthToken() gin.HandlerFunc {
+	return h.requireToken(true)
+}
+
+func (h *HttpHandler) requireToken(allowClients bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing bearer token"})
+			return
+		}
+
+		claims, err := h.service.AuthenticateAccessToken(c, token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if claims.IsService() {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "service tokens cannot act on behalf of a user"})
+			return
+		}
+		if !allowClients && claims.ClientID != "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "tokens issued to oauth clients cannot use this endpoint"})
+			return
+		}
+
+		c.Set(ctxUserID, claims.UserID)
+		c.Set(ctxClaims, claims)
+		c.Next()
+	}
+}
+
+// RequirePermission must run after RequireAuth and rejects callers whose access
+// token does not carry perm. Tokens issued to OAuth clients never pass, whatever
+// they carry.
+func (h *HttpHandler) RequirePermission(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, ok := c.Get(ctxClaims)
+		claims, _ := value.(*security.Claims)
+		if !ok || claims == nil || claims.ClientID != "" || !claims.HasPermission(perm) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing permission " + perm})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RateLimit rejects requests over their route's limit with 429 and Retry-After.
+// Register it after RequireAuth on protected routes so rules keyed by user see the caller.
+func (h *HttpHandler) RateLimit(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil {
+			c.Next()
+			return
+		}
+
+		keys := ratelimit.Keys{IP: c.ClientIP()}
+		if userID, ok := c.Get(ctxUserID); ok {
+			keys.UserID = strconv.FormatInt(userID.(int64), 10)
+		}
+		// Only the client a verified token was issued to counts, see ratelimit.Keys.
+		if claims, ok := c.Get(ctxClaims); ok {
+			keys.ClientID = claims.(*security.Claims).ClientID
+		}
+
+		wait := limiter.Allow(c, c.Request.Method+" "+c.FullPath(), keys)
+		if wait > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+			return
+		}
+		c.Next()
+	}
+}
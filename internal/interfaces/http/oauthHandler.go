@@ -0,0 +1,476 @@
+package http
+
+import (
+	"embed"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/danilkompaniets/auth-service/internal/application"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/api"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed templates/authorize.html
+var templates embed.FS
+
+var authorizePage = template.Must(template.ParseFS(templates, "templates/authorize.html"))
+
+type authorizePageData struct {
+	Fatal      bool
+	Error      string
+	ClientName string
+	Scopes     []string
+	Request    application.AuthorizeRequest
+	Email      string
+	MFAToken   string
+}
+
+// Authorize godoc
+// @Summary      OAuth authorization endpoint
+// @Description  Validates an authorization request with PKCE (S256) and shows the login and consent page
+// @Tags         oauth
+// @Produce      html
+// @Param        client_id             query string true  "Client id"
+// @Param        redirect_uri          query string false "Registered redirect URI, optional when the client has exactly one"
+// @Param        response_type         query string true  "Must be code"
+// @Param        scope                 query string false "Space separated scopes"
+// @Param        state                 query string false "Opaque value returned to the client"
+// @Param        code_challenge        query string true  "PKCE code challenge"
+// @Param        code_challenge_method query string true  "Must be S256"
+// @Param        nonce                 query string false "OpenID Connect nonce, echoed in the ID token"
+// @Param        prompt                query string false "OpenID Connect prompt; none always fails with login_required"
+// @Success      200  {string} string "login and consent page"
+// @Failure      302  {string} string "error redirected to the client"
+// @Failure      400  {string} string "invalid client or redirect uri"
+// @Router       /oauth/authorize [get]
+func (h *HttpHandler) Authorize(c *gin.Context) {
+	req := authorizeRequest(c.Query)
+
+	client, err := h.service.ValidateAuthorizeRequest(c, &req)
+	if err != nil {
+		h.authorizeError(c, client, req, err)
+		return
+	}
+
+	renderAuthorizePage(c, http.StatusOK, client, req, authorizePageData{})
+}
+
+// ApproveAuthorization godoc
+// @Summary      OAuth login and consent
+// @Description  Logs the user in with the form of the authorization page and redirects back to the client with an authorization code, or with access_denied when the user declined
+// @Tags         oauth
+// @Accept       x-www-form-urlencoded
+// @Produce      html
+// @Param        action    formData string true  "approve or deny"
+// @Param        email     formData string false "Email"
+// @Param        password  formData string false "Password"
+// @Param        mfa_token formData string false "Challenge from the previous step"
+// @Param        code      formData string false "TOTP or recovery code"
+// @Success      302  {string} string "redirect to the client"
+// @Failure      400  {string} string "invalid client or redirect uri"
+// @Failure      401  {string} string "login page with the error"
+// @Router       /oauth/authorize [post]
+func (h *HttpHandler) ApproveAuthorization(c *gin.Context) {
+	req := authorizeRequest(c.PostForm)
+
+	client, err := h.service.ValidateAuthorizeRequest(c, &req)
+	if err != nil {
+		h.authorizeError(c, client, req, err)
+		return
+	}
+
+	if c.PostForm("action") != "approve" {
+		redirectAuthorizeError(c, req, application.OAuthAccessDenied, "the user denied the request")
+		return
+	}
+
+	device := model.Device{UserAgent: c.Request.UserAgent(), IP: c.ClientIP()}
+	email := c.PostForm("email")
+
+	var userID int64
+	if mfaToken := c.PostForm("mfa_token"); mfaToken != "" {
+		userID, err = h.service.VerifyMFALogin(c, mfaToken, c.PostForm("code"), device)
+	} else {
+		userID, err = h.service.VerifyLogin(c, email, c.PostForm("password"), device)
+	}
+
+	var mfaErr *application.MFARequiredError
+	var lockedErr *application.LockedOutError
+	switch {
+	case errors.As(err, &mfaErr):
+		if !slices.Contains(mfaErr.Methods, application.MFAMethodTOTP) {
+			renderAuthorizePage(c, http.StatusForbidden, client, req, authorizePageData{
+				Error: "This account requires a passkey, which this page does not support yet.",
+			})
+			return
+		}
+		renderAuthorizePage(c, http.StatusOK, client, req, authorizePageData{MFAToken: mfaErr.ChallengeToken})
+		return
+	case errors.As(err, &lockedErr):
+		renderAuthorizePage(c, http.StatusTooManyRequests, client, req, authorizePageData{Email: email, Error: err.Error()})
+		return
+	case errors.Is(err, application.ErrInvalidCredentials), errors.Is(err, repository.ErrUserNotFound):
+		renderAuthorizePage(c, http.StatusUnauthorized, client, req, authorizePageData{Email: email, Error: application.ErrInvalidCredentials.Error()})
+		return
+	case errors.Is(err, application.ErrMFAInvalidCode), errors.Is(err, repository.ErrActionTokenInvalid):
+		// The challenge is spent after a wrong code, the user starts over with the password.
+		renderAuthorizePage(c, http.StatusUnauthorized, client, req, authorizePageData{Error: err.Error()})
+		return
+	case errors.Is(err, application.ErrEmailNotVerified), errors.Is(err, application.ErrUserDisabled):
+		renderAuthorizePage(c, http.StatusForbidden, client, req, authorizePageData{Email: email, Error: err.Error()})
+		return
+	case err != nil:
+		renderAuthorizePage(c, http.StatusBadRequest, client, req, authorizePageData{Email: email, Error: err.Error()})
+		return
+	}
+
+	code, err := h.service.AuthorizeUser(c, userID, req)
+	if err != nil {
+		h.authorizeError(c, client, req, err)
+		return
+	}
+
+	redirectAuthorize(c, req, url.Values{"code": {code}})
+}
+
+// Token godoc
+// @Summary      OAuth token endpoint
+// @Description  Exchanges an authorization code and its PKCE verifier, or a refresh token, for tokens. Service clients get an access token of their own with client_credentials. Confidential clients authenticate with HTTP Basic or client_secret in the body.
+// @Tags         oauth
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Param        grant_type    formData string true  "authorization_code, refresh_token or client_credentials"
+// @Param        client_id     formData string false "Client id, unless sent with HTTP Basic"
+// @Param        code          formData string false "Authorization code"
+// @Param        redirect_uri  formData string false "Redirect URI of the authorization request"
+// @Param        code_verifier formData string false "PKCE code verifier"
+// @Param        refresh_token formData string false "Refresh token"
+// @Param        scope         formData string false "Space separated scopes for client_credentials, all registered ones by default"
+// @Success      200  {object} map[string]interface{} "access_token, token_type, expires_in, refresh_token except for client_credentials, scope and id_token for the openid scope"
+// @Failure      400  {object} map[string]string "error, error_description"
+// @Failure      401  {object} map[string]string "invalid_client"
+// @Failure      500  {object} map[string]string "server_error"
+// @Router       /oauth/token [post]
+func (h *HttpHandler) Token(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	req := application.TokenRequest{
+		GrantType:    c.PostForm("grant_type"),
+		ClientID:     c.PostForm("client_id"),
+		ClientSecret: c.PostForm("client_secret"),
+		Code:         c.PostForm("code"),
+		RedirectURI:  c.PostForm("redirect_uri"),
+		CodeVerifier: c.PostForm("code_verifier"),
+		RefreshToken: c.PostForm("refresh_token"),
+		Scope:        c.PostForm("scope"),
+	}
+	if err := clientCredentials(c, &req.ClientID, &req.ClientSecret); err != nil {
+		oauthErrorResponse(c, err)
+		return
+	}
+
+	device := model.Device{UserAgent: c.Request.UserAgent(), IP: c.ClientIP()}
+	tokens, err := h.service.ExchangeOAuthToken(c, req, device)
+	if err != nil {
+		oauthErrorResponse(c, err)
+		return
+	}
+
+	response := gin.H{
+		"access_token": tokens.AccessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int64(tokens.ExpiresIn.Seconds()),
+	}
+	if tokens.RefreshToken != "" {
+		response["refresh_token"] = tokens.RefreshToken
+	}
+	if tokens.Scope != "" {
+		response["scope"] = tokens.Scope
+	}
+	if tokens.IDToken != "" {
+		response["id_token"] = tokens.IDToken
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Introspect godoc
+// @Summary      OAuth token introspection
+// @Description  Describes an access or refresh token as in RFC 7662. Only confidential clients may call it; refresh tokens are only described to the client they were issued to.
+// @Tags         oauth
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Param        token           formData string true  "Token to describe"
+// @Param        token_type_hint formData string false "access_token or refresh_token"
+// @Param        client_id       formData string false "Client id, unless sent with HTTP Basic"
+// @Success      200  {object} application.Introspection
+// @Failure      400  {object} map[string]string "error, error_description"
+// @Failure      401  {object} map[string]string "invalid_client"
+// @Failure      500  {object} map[string]string "server_error"
+// @Router       /oauth/introspect [post]
+func (h *HttpHandler) Introspect(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+
+	req, err := clientTokenRequest(c)
+	if err != nil {
+		oauthErrorResponse(c, err)
+		return
+	}
+
+	result, err := h.service.IntrospectToken(c, req)
+	if err != nil {
+		oauthErrorResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Revoke godoc
+// @Summary      OAuth token revocation
+// @Description  Revokes a token issued to the calling client as in RFC 7009. Revoking a refresh token ends its session. Unknown and expired tokens are accepted.
+// @Tags         oauth
+// @Accept       x-www-form-urlencoded
+// @Produce      json
+// @Param        token           formData string true  "Token to revoke"
+// @Param        token_type_hint formData string false "access_token or refresh_token"
+// @Param        client_id       formData string false "Client id, unless sent with HTTP Basic"
+// @Success      200  "revoked"
+// @Failure      400  {object} map[string]string "error, error_description"
+// @Failure      401  {object} map[string]string "invalid_client"
+// @Failure      500  {object} map[string]string "server_error"
+// @Router       /oauth/revoke [post]
+func (h *HttpHandler) Revoke(c *gin.Context) {
+	req, err := clientTokenRequest(c)
+	if err != nil {
+		oauthErrorResponse(c, err)
+		return
+	}
+
+	if err := h.service.RevokeOAuthToken(c, req); err != nil {
+		oauthErrorResponse(c, err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// ListOAuthClients godoc
+// @Summary      List OAuth clients
+// @Tags         admin
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {array}  model.OAuthClient
+// @Failure      403  {object} map[string]string "forbidden"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/admin/oauth/clients [get]
+func (h *HttpHandler) ListOAuthClients(c *gin.Context) {
+	clients, err := h.service.ListOAuthClients(c)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, clients)
+}
+
+// RegisterOAuthClient godoc
+// @Summary      Register OAuth client
+// @Description  Registers a client; confidential and service clients get a secret that is only shown in this response
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        input body api.RegisterOAuthClientRequest true "Client"
+// @Success      201  {object} map[string]interface{} "client, client_secret"
+// @Failure      400  {object} map[string]string "bad request"
+// @Failure      403  {object} map[string]string "forbidden"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/admin/oauth/clients [post]
+func (h *HttpHandler) RegisterOAuthClient(c *gin.Context) {
+	var req api.RegisterOAuthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var (
+		client *model.OAuthClient
+		secret string
+		err    error
+	)
+	if req.Service {
+		client, secret, err = h.service.RegisterServiceClient(c, req.Name, req.Scopes)
+	} else {
+		client, secret, err = h.service.RegisterOAuthClient(c, req.Name, req.RedirectURIs, req.Scopes, req.Confidential)
+	}
+	if errors.Is(err, application.ErrInvalidRedirectURI) || errors.Is(err, application.ErrInvalidOAuthClient) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{"client": client}
+	if secret != "" {
+		response["client_secret"] = secret
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// DeleteOAuthClient godoc
+// @Summary      Delete OAuth client
+// @Description  Removes the client together with its pending codes and sessions
+// @Tags         admin
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path string true "Client id"
+// @Success      200  {object} map[string]string "ok"
+// @Failure      403  {object} map[string]string "forbidden"
+// @Failure      404  {object} map[string]string "client not found"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/admin/oauth/clients/{id} [delete]
+func (h *HttpHandler) DeleteOAuthClient(c *gin.Context) {
+	err := h.service.DeleteOAuthClient(c, c.Param("id"))
+	if errors.Is(err, repository.ErrOAuthClientNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+func authorizeRequest(param func(string) string) application.AuthorizeRequest {
+	return application.AuthorizeRequest{
+		ClientID:            param("client_id"),
+		RedirectURI:         param("redirect_uri"),
+		ResponseType:        param("response_type"),
+		Scope:               param("scope"),
+		State:               param("state"),
+		CodeChallenge:       param("code_challenge"),
+		CodeChallengeMethod: param("code_challenge_method"),
+		Nonce:               param("nonce"),
+		Prompt:              param("prompt"),
+	}
+}
+
+// authorizeError redirects errors back to the client once its redirect URI has been
+// verified and shows them on the page otherwise (RFC 6749 section 4.1.2.1).
+func (h *HttpHandler) authorizeError(c *gin.Context, client *model.OAuthClient, req application.AuthorizeRequest, err error) {
+	if errors.Is(err, application.ErrOAuthDisabled) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	var oauthErr *application.OAuthError
+	if client != nil && errors.As(err, &oauthErr) {
+		redirectAuthorizeError(c, req, oauthErr.Code, oauthErr.Description)
+		return
+	}
+
+	status := http.StatusBadRequest
+	if !errors.As(err, &oauthErr) {
+		status = http.StatusInternalServerError
+	}
+	renderAuthorizePage(c, status, nil, req, authorizePageData{Fatal: true, Error: err.Error()})
+}
+
+func redirectAuthorizeError(c *gin.Context, req application.AuthorizeRequest, code, description string) {
+	redirectAuthorize(c, req, url.Values{"error": {code}, "error_description": {description}})
+}
+
+func redirectAuthorize(c *gin.Context, req application.AuthorizeRequest, params url.Values) {
+	target, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		renderAuthorizePage(c, http.StatusBadRequest, nil, req, authorizePageData{Fatal: true, Error: err.Error()})
+		return
+	}
+
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+	query := target.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	target.RawQuery = query.Encode()
+
+	c.Redirect(http.StatusFound, target.String())
+}
+
+func renderAuthorizePage(c *gin.Context, status int, client *model.OAuthClient, req application.AuthorizeRequest, data authorizePageData) {
+	// The page takes a password, so it must never be framed by another site. form-action
+	// stays open because browsers apply it to the redirect back to the client.
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; frame-ancestors 'none'")
+	c.Header("Cache-Control", "no-store")
+
+	data.Request = req
+	if client != nil {
+		data.ClientName = client.Name
+		data.Scopes = strings.Fields(req.Scope)
+	}
+
+	c.Status(status)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := authorizePage.Execute(c.Writer, data); err != nil {
+		_ = c.Error(err)
+	}
+}
+
+func clientTokenRequest(c *gin.Context) (application.ClientTokenRequest, error) {
+	req := application.ClientTokenRequest{
+		ClientID:      c.PostForm("client_id"),
+		ClientSecret:  c.PostForm("client_secret"),
+		Token:         c.PostForm("token"),
+		TokenTypeHint: c.PostForm("token_type_hint"),
+	}
+	return req, clientCredentials(c, &req.ClientID, &req.ClientSecret)
+}
+
+// clientCredentials prefers HTTP Basic authentication over the body parameters.
+func clientCredentials(c *gin.Context, clientID, clientSecret *string) error {
+	id, secret, ok := c.Request.BasicAuth()
+	if !ok {
+		return nil
+	}
+
+	// RFC 6749 section 2.3.1 form-encodes both values before Basic encoding.
+	var idErr, secretErr error
+	*clientID, idErr = url.QueryUnescape(id)
+	*clientSecret, secretErr = url.QueryUnescape(secret)
+	if idErr != nil || secretErr != nil {
+		return &application.OAuthError{Code: application.OAuthInvalidClient, Description: "malformed basic credentials"}
+	}
+	return nil
+}
+
+func oauthErrorResponse(c *gin.Context, err error) {
+	if errors.Is(err, application.ErrOAuthDisabled) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	var oauthErr *application.OAuthError
+	if !errors.As(err, &oauthErr) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error", "error_description": err.Error()})
+		return
+	}
+
+	status := http.StatusBadRequest
+	if oauthErr.Code == application.OAuthInvalidClient {
+		status = http.StatusUnauthorized
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	c.JSON(status, gin.H{"error": oauthErr.Code, "error_description": oauthErr.Description})
+}
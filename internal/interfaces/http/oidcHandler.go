@@ -0,0 +1,67 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/danilkompaniets/auth-service/internal/application"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/security"
+	"github.com/gin-gonic/gin"
+)
+
+// OpenIDConfiguration godoc
+// @Summary      OpenID Connect discovery
+// @Description  Provider metadata that relying parties such as Grafana read to configure themselves
+// @Tags         oauth
+// @Produce      json
+// @Success      200  {object} application.OpenIDConfiguration
+// @Failure      404  {object} map[string]string "openid connect is not configured"
+// @Router       /.well-known/openid-configuration [get]
+func (h *HttpHandler) OpenIDConfiguration(c *gin.Context) {
+	cfg, err := h.service.OpenIDConfiguration()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, cfg)
+}
+
+// UserInfo godoc
+// @Summary      OpenID Connect userinfo
+// @Description  Returns the claims released by the scopes of an access token issued to an OAuth client with the openid scope
+// @Tags         oauth
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object} map[string]interface{} "sub and the claims of the profile and email scopes"
+// @Failure      401  {object} map[string]string "invalid token"
+// @Failure      403  {object} map[string]string "insufficient_scope"
+// @Failure      404  {object} map[string]string "openid connect is not configured"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /userinfo [get]
+func (h *HttpHandler) UserInfo(c *gin.Context) {
+	claims := c.MustGet(ctxClaims).(*security.Claims)
+
+	info, err := h.service.UserInfo(c, claims)
+	switch {
+	case errors.Is(err, application.ErrOIDCDisabled):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, application.ErrInsufficientScope):
+		c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient_scope", "error_description": err.Error()})
+		return
+	case errors.Is(err, repository.ErrUserNotFound), errors.Is(err, application.ErrUserDisabled):
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_token", "error_description": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, info)
+}
@@ -0,0 +1,264 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/danilkompaniets/auth-service/internal/application"
+	"github.com/danilkompaniets/auth-service/internal/infrastructure/repository"
+	"github.com/danilkompaniets/auth-service/pkg/api"
+	"github.com/danilkompaniets/auth-service/pkg/model"
+	"github.com/gin-gonic/gin"
+)
+
+// ListPasskeys godoc
+// @Summary      List passkeys
+// @Description  Returns the passkeys registered to the current user
+// @Tags         passkeys
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {array}  model.WebAuthnCredential
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/passkeys [get]
+func (h *HttpHandler) ListPasskeys(c *gin.Context) {
+	passkeys, err := h.service.ListPasskeys(c, c.GetInt64(ctxUserID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, passkeys)
+}
+
+// BeginPasskeyRegistration godoc
+// @Summary      Start passkey registration
+// @Description  Returns options for navigator.credentials.create and a session_id for the finish step
+// @Tags         passkeys
+// @Produce      json
+// @Security     BearerAuth
+// @Success      200  {object} application.PasskeyCeremony
+// @Failure      501  {object} map[string]string "passkeys not configured"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/passkeys/register/begin [post]
+func (h *HttpHandler) BeginPasskeyRegistration(c *gin.Context) {
+	ceremony, err := h.service.BeginPasskeyRegistration(c, c.GetInt64(ctxUserID))
+	if err != nil {
+		passkeyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ceremony)
+}
+
+// FinishPasskeyRegistration godoc
+// @Summary      Finish passkey registration
+// @Description  Verifies the authenticator response and stores the passkey
+// @Tags         passkeys
+// @Accept       json
+// @Produce      json
+// @Security     BearerAuth
+// @Param        input body api.FinishPasskeyRegistrationRequest true "Registration response"
+// @Success      200  {object} model.WebAuthnCredential
+// @Failure      400  {object} map[string]string "invalid response or session"
+// @Failure      409  {object} map[string]string "passkey already registered"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/passkeys/register/finish [post]
+func (h *HttpHandler) FinishPasskeyRegistration(c *gin.Context) {
+	var req api.FinishPasskeyRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	credential, err := h.service.FinishPasskeyRegistration(c, c.GetInt64(ctxUserID), req.SessionID, req.Name, req.Credential)
+	if err != nil {
+		passkeyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, credential)
+}
+
+// DeletePasskey godoc
+// @Summary      Delete passkey
+// @Description  Removes one of the current user's passkeys
+// @Tags         passkeys
+// @Produce      json
+// @Security     BearerAuth
+// @Param        id   path int true "Passkey id"
+// @Success      200  {object} map[string]string "ok"
+// @Failure      400  {object} map[string]string "bad request"
+// @Failure      404  {object} map[string]string "passkey not found"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/passkeys/{id} [delete]
+func (h *HttpHandler) DeletePasskey(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid passkey id"})
+		return
+	}
+
+	err = h.service.DeletePasskey(c, c.GetInt64(ctxUserID), id)
+	if errors.Is(err, repository.ErrCredentialNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// BeginPasskeyLogin godoc
+// @Summary      Start passwordless login
+// @Description  Returns options for navigator.credentials.get and a session_id for the finish step
+// @Tags         passkeys
+// @Produce      json
+// @Success      200  {object} application.PasskeyCeremony
+// @Failure      501  {object} map[string]string "passkeys not configured"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/login/passkey/begin [post]
+func (h *HttpHandler) BeginPasskeyLogin(c *gin.Context) {
+	ceremony, err := h.service.BeginPasskeyLogin(c)
+	if err != nil {
+		passkeyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ceremony)
+}
+
+// FinishPasskeyLogin godoc
+// @Summary      Finish passwordless login
+// @Description  Verifies the passkey assertion and returns tokens, without a password or second factor
+// @Tags         passkeys
+// @Accept       json
+// @Produce      json
+// @Param        input body api.PasskeyLoginRequest true "Assertion response"
+// @Success      200  {object} map[string]string "access_token"
+// @Failure      400  {object} map[string]string "bad request"
+// @Failure      401  {object} map[string]string "invalid passkey or session"
+// @Failure      403  {object} map[string]string "email not verified or account disabled"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/login/passkey/finish [post]
+func (h *HttpHandler) FinishPasskeyLogin(c *gin.Context) {
+	var req api.PasskeyLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	device := model.Device{
+		Name:      req.DeviceName,
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	}
+
+	tokens, err := h.service.FinishPasskeyLogin(c, req.SessionID, req.Credential, device)
+	if err != nil {
+		passkeyLoginError(c, err)
+		return
+	}
+
+	setRefreshTokenCookie(c, tokens.RefreshToken)
+	c.JSON(http.StatusOK, gin.H{
+		"access_token": "Bearer " + tokens.AccessToken,
+	})
+}
+
+// BeginPasskeyMFA godoc
+// @Summary      Start passkey second factor
+// @Description  Returns options for navigator.credentials.get limited to the user's passkeys, for the mfa_token from /login
+// @Tags         mfa
+// @Accept       json
+// @Produce      json
+// @Param        input body api.BeginPasskeyMFARequest true "MFA token"
+// @Success      200  {object} application.PasskeyCeremony
+// @Failure      400  {object} map[string]string "no passkeys registered"
+// @Failure      401  {object} map[string]string "invalid mfa token"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/login/mfa/passkey/begin [post]
+func (h *HttpHandler) BeginPasskeyMFA(c *gin.Context) {
+	var req api.BeginPasskeyMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ceremony, err := h.service.BeginPasskeyMFA(c, req.MFAToken)
+	if err != nil {
+		passkeyLoginError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ceremony)
+}
+
+// CompletePasskeyMFALogin godoc
+// @Summary      Second login step with a passkey
+// @Description  Exchanges the mfa_token from /login and a passkey assertion for tokens. A failed assertion invalidates the mfa_token.
+// @Tags         mfa
+// @Accept       json
+// @Produce      json
+// @Param        input body api.PasskeyMFALoginRequest true "Assertion response"
+// @Success      200  {object} map[string]string "access_token"
+// @Failure      400  {object} map[string]string "bad request"
+// @Failure      401  {object} map[string]string "invalid passkey, session or mfa token"
+// @Failure      500  {object} map[string]string "internal error"
+// @Router       /auth/login/mfa/passkey/finish [post]
+func (h *HttpHandler) CompletePasskeyMFALogin(c *gin.Context) {
+	var req api.PasskeyMFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	device := model.Device{
+		Name:      req.DeviceName,
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+	}
+
+	tokens, err := h.service.CompletePasskeyMFALogin(c, req.MFAToken, req.SessionID, req.Credential, device)
+	if err != nil {
+		passkeyLoginError(c, err)
+		return
+	}
+
+	setRefreshTokenCookie(c, tokens.RefreshToken)
+	c.JSON(http.StatusOK, gin.H{
+		"access_token": "Bearer " + tokens.AccessToken,
+	})
+}
+
+func passkeyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, application.ErrPasskeysDisabled):
+		c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+	case errors.Is(err, application.ErrPasskeyInvalid), errors.Is(err, repository.ErrWebAuthnSessionInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrCredentialExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func passkeyLoginError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, application.ErrPasskeysDisabled):
+		c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+	case errors.Is(err, application.ErrPasskeyInvalid), errors.Is(err, repository.ErrWebAuthnSessionInvalid),
+		errors.Is(err, repository.ErrActionTokenInvalid), errors.Is(err, repository.ErrCredentialNotFound):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, application.ErrNoPasskeysEnrolled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, application.ErrEmailNotVerified), errors.Is(err, application.ErrUserDisabled):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -1,12 +1,18 @@
 package api
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email      string `json:"email"`
+	Password   string `json:"password"`
+	DeviceName string `json:"device_name"`
 }
 
 type LogoutRequest struct {
-	UserID int64 `json:"user_id"`
+	RefreshToken string `json:"refresh_token"`
 }
 
 type RefreshTokenRequest struct {
@@ -35,3 +41,114 @@ type RefreshTokenResponse struct {
 type RegisterResponse struct {
 	UserId int64 `json:"user_id"`
 }
+
+type RevokeTokenRequest struct {
+	Token string `json:"token"`
+}
+
+type RevokeAllTokensRequest struct {
+	IssuedBefore *time.Time `json:"issued_before"`
+}
+
+type SaveRoleRequest struct {
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type AssignRoleRequest struct {
+	Role string `json:"role"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ChangeEmailRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewEmail        string `json:"new_email"`
+}
+
+type ConfirmTOTPRequest struct {
+	Code string `json:"code"`
+}
+
+type MFALoginRequest struct {
+	MFAToken   string `json:"mfa_token"`
+	Code       string `json:"code"`
+	DeviceName string `json:"device_name"`
+}
+
+type EmailLoginRequest struct {
+	Email string `json:"email"`
+}
+
+type EmailCodeLoginRequest struct {
+	Email      string `json:"email"`
+	Code       string `json:"code"`
+	DeviceName string `json:"device_name"`
+}
+
+type EmailLinkLoginRequest struct {
+	Token      string `json:"token"`
+	DeviceName string `json:"device_name"`
+}
+
+// Credential fields carry the PublicKeyCredential returned by the browser as is.
+type FinishPasskeyRegistrationRequest struct {
+	SessionID  string          `json:"session_id"`
+	Name       string          `json:"name"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+type PasskeyLoginRequest struct {
+	SessionID  string          `json:"session_id"`
+	Credential json.RawMessage `json:"credential"`
+	DeviceName string          `json:"device_name"`
+}
+
+type BeginPasskeyMFARequest struct {
+	MFAToken string `json:"mfa_token"`
+}
+
+type PasskeyMFALoginRequest struct {
+	MFAToken   string          `json:"mfa_token"`
+	SessionID  string          `json:"session_id"`
+	Credential json.RawMessage `json:"credential"`
+	DeviceName string          `json:"device_name"`
+}
+
+type RegisterOAuthClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	Confidential bool     `json:"confidential"`
+	// Service registers a client credentials client; redirect URIs are ignored.
+	Service bool `json:"service"`
+}
+
+// FederatedCallbackRequest carries the code and state the identity provider
+// redirected the browser back with.
+type FederatedCallbackRequest struct {
+	Code       string `json:"code"`
+	State      string `json:"state"`
+	DeviceName string `json:"device_name"`
+}
+
+type LinkIdentityRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
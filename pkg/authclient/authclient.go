@@ -0,0 +1,136 @@
+// Package authclient checks access tokens with the auth service's gRPC ValidateToken
+// for other services.
+//
+// The ValidateTokenResponse message is generated from the shared go-chat-common
+// protos and only carries Valid and UserId, so the service returns everything else
+// as response headers. Client reads them back into a Principal.
+package authclient
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	gen_auth "github.com/danilkompaniets/go-chat-common/gen/gen-auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Metadata keys of the ValidateToken call. Lists are space separated.
+const (
+	// AudienceHeader is sent by the caller to require a token issued for that audience.
+	AudienceHeader = "x-token-audience"
+	// AcceptServiceTokensHeader is sent as "true" by callers that accept tokens service
+	// clients obtained for themselves; to other callers such tokens are not valid.
+	AcceptServiceTokensHeader = "x-accept-service-tokens"
+
+	RolesHeader       = "x-user-roles"
+	PermissionsHeader = "x-user-permissions"
+	PrincipalHeader   = "x-principal-type"
+	ClientIDHeader    = "x-client-id"
+	ScopesHeader      = "x-token-scopes"
+)
+
+// Principal types reported in PrincipalHeader.
+const (
+	PrincipalUser    = "user"
+	PrincipalService = "service"
+)
+
+var ErrInvalidToken = errors.New("token is not valid")
+
+// Principal is whoever a validated token was issued to.
+type Principal struct {
+	// UserID is zero for service clients.
+	UserID int64
+	Type   string
+	// ClientID is the OAuth client the token was issued to, if any.
+	ClientID    string
+	Roles       []string
+	Permissions []string
+	Scopes      []string
+}
+
+func (p *Principal) IsService() bool {
+	return p.Type == PrincipalService
+}
+
+func (p *Principal) HasPermission(permission string) bool {
+	return slices.Contains(p.Permissions, permission)
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// Client validates tokens with the auth service.
+type Client struct {
+	rpc            gen_auth.AuthServiceClient
+	audience       string
+	acceptServices bool
+}
+
+// Option configures optional Client behaviour.
+type Option func(*Client)
+
+// WithAudience rejects tokens that were not issued for audience.
+func WithAudience(audience string) Option {
+	return func(c *Client) {
+		c.audience = audience
+	}
+}
+
+// AcceptServiceTokens lets tokens of service clients through; their Principal has
+// no UserID.
+func AcceptServiceTokens() Option {
+	return func(c *Client) {
+		c.acceptServices = true
+	}
+}
+
+// New wraps a client of the auth service, e.g. gen_auth.NewAuthServiceClient(conn).
+func New(rpc gen_auth.AuthServiceClient, opts ...Option) *Client {
+	c := &Client{rpc: rpc}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Validate returns the principal of token, or ErrInvalidToken when the service reports
+// it as not valid for this client. Tokens the service rejects outright, like expired
+// or revoked ones, come back as the error of the call.
+func (c *Client) Validate(ctx context.Context, token string) (*Principal, error) {
+	if c.audience != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, AudienceHeader, c.audience)
+	}
+	if c.acceptServices {
+		ctx = metadata.AppendToOutgoingContext(ctx, AcceptServiceTokensHeader, "true")
+	}
+
+	var header metadata.MD
+	resp, err := c.rpc.ValidateToken(ctx, &gen_auth.ValidateTokenRequest{Token: token}, grpc.Header(&header))
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	return &Principal{
+		UserID:      resp.UserId,
+		Type:        first(header, PrincipalHeader),
+		ClientID:    first(header, ClientIDHeader),
+		Roles:       strings.Fields(first(header, RolesHeader)),
+		Permissions: strings.Fields(first(header, PermissionsHeader)),
+		Scopes:      strings.Fields(first(header, ScopesHeader)),
+	}, nil
+}
+
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
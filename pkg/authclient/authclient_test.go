@@ -0,0 +1,72 @@
+package authclient
+
+import (
+	"context"
+	"testing"
+
+	gen_auth "github.com/danilkompaniets/go-chat-common/gen/gen-auth"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// fakeAuthService answers like the server: the response plus its headers.
+type fakeAuthService struct {
+	resp     *gen_auth.ValidateTokenResponse
+	header   metadata.MD
+	outgoing metadata.MD
+}
+
+func (f *fakeAuthService) ValidateToken(ctx context.Context, _ *gen_auth.ValidateTokenRequest, opts ...grpc.CallOption) (*gen_auth.ValidateTokenResponse, error) {
+	f.outgoing, _ = metadata.FromOutgoingContext(ctx)
+	for _, opt := range opts {
+		if h, ok := opt.(grpc.HeaderCallOption); ok {
+			*h.HeaderAddr = f.header
+		}
+	}
+	return f.resp, nil
+}
+
+func TestValidate_ReadsAuthorizationHeaders(t *testing.T) {
+	rpc := &fakeAuthService{
+		resp: &gen_auth.ValidateTokenResponse{Valid: true, UserId: 7},
+		header: metadata.Pairs(
+			RolesHeader, "admin support",
+			PermissionsHeader, "users.read users.write",
+			PrincipalHeader, PrincipalUser,
+			ClientIDHeader, "",
+			ScopesHeader, "",
+		),
+	}
+	client := New(rpc, WithAudience("chat"))
+
+	principal, err := client.Validate(context.Background(), "token")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), principal.UserID)
+	assert.Equal(t, []string{"admin", "support"}, principal.Roles)
+	assert.True(t, principal.HasPermission("users.write"))
+	assert.False(t, principal.IsService())
+	assert.Empty(t, principal.Scopes)
+	assert.Equal(t, []string{"chat"}, rpc.outgoing.Get(AudienceHeader))
+	// Без опции токены сервисов не запрашиваются
+	assert.Empty(t, rpc.outgoing.Get(AcceptServiceTokensHeader))
+}
+
+func TestValidate_ServiceTokens(t *testing.T) {
+	rpc := &fakeAuthService{resp: &gen_auth.ValidateTokenResponse{Valid: false}}
+
+	_, err := New(rpc).Validate(context.Background(), "token")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	rpc = &fakeAuthService{
+		resp:   &gen_auth.ValidateTokenResponse{Valid: true},
+		header: metadata.Pairs(PrincipalHeader, PrincipalService, ClientIDHeader, "billing", ScopesHeader, "users.read"),
+	}
+	principal, err := New(rpc, AcceptServiceTokens()).Validate(context.Background(), "token")
+	require.NoError(t, err)
+	assert.True(t, principal.IsService())
+	assert.Equal(t, "billing", principal.ClientID)
+	assert.True(t, principal.HasScope("users.read"))
+	assert.Equal(t, []string{"true"}, rpc.outgoing.Get(AcceptServiceTokensHeader))
+}
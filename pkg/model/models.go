@@ -2,17 +2,156 @@ package model
 
 import "time"
 
+// RefreshToken is one link in a session's rotation chain. Every login starts a new
+// family; each refresh adds a child row and marks its parent as rotated.
 type RefreshToken struct {
-	Id        string    `json:"id"`
-	UserId    string    `json:"user_id"`
-	Token     string    `json:"token"`
-	CreatedAt time.Time `json:"created_at"`
+	Id         int64      `json:"id"`
+	UserId     int64      `json:"user_id"`
+	Token      string     `json:"-"`
+	FamilyId   string     `json:"family_id"`
+	ParentId   int64      `json:"parent_id,omitempty"`
+	DeviceName string     `json:"device_name"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	ClientId   string     `json:"client_id,omitempty"`
+	Scope      string     `json:"scope,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	RotatedAt  *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Device describes the client a session was opened from.
+type Device struct {
+	Name      string `json:"name"`
+	UserAgent string `json:"user_agent"`
+	IP        string `json:"ip"`
 }
 
 type User struct {
-	Id        int64     `json:"id"`
-	Email     string    `json:"email"`
-	Password  string    `json:"password"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	Id              int64      `json:"id"`
+	Email           string     `json:"email"`
+	Password        string     `json:"password"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	DisabledAt      *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// ActionToken tracks a signed single-use token, e.g. an email verification link.
+// The token itself is never stored, only its jti.
+type ActionToken struct {
+	Jti       string     `json:"jti"`
+	UserId    int64      `json:"user_id"`
+	Purpose   string     `json:"purpose"`
+	Payload   string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+}
+
+type Role struct {
+	Id          int64    `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// MFA is a user's TOTP enrolment. It only protects logins once ConfirmedAt is set.
+type MFA struct {
+	UserId          int64      `json:"user_id"`
+	SecretEncrypted string     `json:"-"`
+	LastUsedStep    int64      `json:"-"`
+	ConfirmedAt     *time.Time `json:"confirmed_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// LoginCode is a passwordless login sent by email as a magic link and a short code.
+// Code is only set when creating it; the repository stores a hash.
+type LoginCode struct {
+	Id        int64      `json:"id"`
+	UserId    int64      `json:"user_id"`
+	Jti       string     `json:"jti"`
+	Code      string     `json:"-"`
+	Attempts  int        `json:"attempts"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// WebAuthnCredential is a registered passkey or security key.
+type WebAuthnCredential struct {
+	Id              int64      `json:"id"`
+	UserId          int64      `json:"user_id"`
+	CredentialId    []byte     `json:"credential_id"`
+	PublicKey       []byte     `json:"-"`
+	SignCount       uint32     `json:"-"`
+	Transports      []string   `json:"transports"`
+	AAGUID          []byte     `json:"aaguid,omitempty"`
+	AttestationType string     `json:"-"`
+	Flags           uint8      `json:"-"`
+	Name            string     `json:"name"`
+	CreatedAt       time.Time  `json:"created_at"`
+	LastUsedAt      *time.Time `json:"last_used_at,omitempty"`
+}
+
+// WebAuthnSession holds the challenge of a registration or login ceremony between
+// its two steps. UserId is zero for passwordless logins.
+type WebAuthnSession struct {
+	Id        string    `json:"id"`
+	UserId    int64     `json:"user_id"`
+	Purpose   string    `json:"purpose"`
+	Data      string    `json:"-"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// OAuthClient is an application registered for the OAuth authorization code flow.
+// Public clients have no SecretHash and prove possession of a code with PKCE only.
+type OAuthClient struct {
+	Id           string    `json:"id"`
+	Name         string    `json:"name"`
+	SecretHash   string    `json:"-"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	GrantTypes   []string  `json:"grant_types"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// AuthorizationCode is a single-use OAuth code bound to the PKCE challenge of the
+// request that produced it. Code is only set when creating it; the repository stores
+// a hash.
+type AuthorizationCode struct {
+	Code                string     `json:"-"`
+	ClientId            string     `json:"client_id"`
+	UserId              int64      `json:"user_id"`
+	RedirectURI         string     `json:"redirect_uri"`
+	Scope               string     `json:"scope"`
+	CodeChallenge       string     `json:"-"`
+	CodeChallengeMethod string     `json:"-"`
+	Nonce               string     `json:"-"`
+	AuthTime            time.Time  `json:"auth_time"`
+	ExpiresAt           time.Time  `json:"expires_at"`
+	UsedAt              *time.Time `json:"used_at,omitempty"`
+}
+
+// Identity links a user to their account at an upstream identity provider.
+type Identity struct {
+	Id          int64      `json:"id"`
+	UserId      int64      `json:"user_id"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"subject"`
+	Email       string     `json:"email"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// FederatedLogin is a redirect to an upstream identity provider in progress. State is
+// only set when creating it; the repository stores a hash. UserId is set when a
+// logged in user links the provider instead of logging in.
+type FederatedLogin struct {
+	State        string    `json:"-"`
+	Provider     string    `json:"provider"`
+	CodeVerifier string    `json:"-"`
+	Nonce        string    `json:"-"`
+	UserId       int64     `json:"user_id,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at"`
 }